@@ -0,0 +1,55 @@
+//go:build cshared
+
+package main
+
+// The C library: go build -tags cshared -buildmode=c-shared -o libjson_drop_keys.so
+// ./cmd/json_drop_keys_udf writes it with its header, libjson_drop_keys.h. The functions may be
+// called from any number of threads.
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"json_drop_keys_udf/pkg/jsondrop"
+)
+
+// json_drop_keys drops keys, a key argument like ['a', 'b.c'], from the document json, and
+// returns the result, or NULL if either doesn't parse. The result is freed with
+// json_drop_keys_free.
+//
+//export json_drop_keys
+func json_drop_keys(json, keys *C.char) *C.char {
+	result, err := jsondrop.TransformDocument("", C.GoString(keys), []byte(C.GoString(json)))
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(result))
+}
+
+// json_drop_keys_transform runs json through the transform the UDF's flags, separated by
+// spaces, and key argument build, e.g. "-mode=redact -placeholder=x" and "['email']". It returns
+// the result, or NULL with the reason in *error if error isn't NULL. Both are freed with
+// json_drop_keys_free.
+//
+//export json_drop_keys_transform
+func json_drop_keys_transform(flags, keys, json *C.char, error **C.char) *C.char {
+	result, err := jsondrop.TransformDocument(C.GoString(flags), C.GoString(keys), []byte(C.GoString(json)))
+	if err != nil {
+		if error != nil {
+			*error = C.CString(err.Error())
+		}
+		return nil
+	}
+	return C.CString(string(result))
+}
+
+// json_drop_keys_free frees a string the library returned
+//
+//export json_drop_keys_free
+func json_drop_keys_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
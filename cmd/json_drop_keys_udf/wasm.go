@@ -0,0 +1,89 @@
+//go:build wasip1
+
+package main
+
+// The WASM module: GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o json_drop_keys.wasm
+// ./cmd/json_drop_keys_udf builds a WASI reactor exporting these functions, for hosts such as edge
+// workers to call after _initialize. Without -buildmode=c-shared it's the UDF binary, reading rows on
+// stdin under any WASI runtime.
+//
+// Strings, documents and results are passed as a pointer and a length in the module's memory. The
+// host writes its arguments to memory from json_drop_keys_alloc and frees it once done.
+
+import (
+	"unsafe"
+
+	"json_drop_keys_udf/pkg/jsondrop"
+)
+
+// wasmBuffers keeps the memory handed to the host alive until it's freed
+var wasmBuffers = map[unsafe.Pointer][]byte{}
+
+// wasmResult is the last call's result or error, until the next call
+var wasmResult []byte
+
+// json_drop_keys_alloc returns size bytes of memory for the host to write an argument to
+//
+//go:wasmexport json_drop_keys_alloc
+func json_drop_keys_alloc(size uint32) unsafe.Pointer {
+	buf := make([]byte, max(size, 1))
+	p := unsafe.Pointer(unsafe.SliceData(buf))
+	wasmBuffers[p] = buf
+	return p
+}
+
+// json_drop_keys_free frees memory from json_drop_keys_alloc
+//
+//go:wasmexport json_drop_keys_free
+func json_drop_keys_free(p unsafe.Pointer) {
+	delete(wasmBuffers, p)
+}
+
+// json_drop_keys drops keys, a key argument like ['a', 'b.c'], from the document json. It returns
+// 0 with the result in json_drop_keys_result, or 1 with the error there.
+//
+//go:wasmexport json_drop_keys
+func json_drop_keys(keys unsafe.Pointer, keysLen uint32, json unsafe.Pointer, jsonLen uint32) uint32 {
+	return wasmTransform("", wasmString(keys, keysLen), wasmBytes(json, jsonLen))
+}
+
+// json_drop_keys_transform runs json through the transform the UDF's flags, separated by spaces,
+// and key argument build, e.g. "-mode=redact -placeholder=x" and "['email']". It returns 0 with the
+// result in json_drop_keys_result, or 1 with the error there.
+//
+//go:wasmexport json_drop_keys_transform
+func json_drop_keys_transform(flags unsafe.Pointer, flagsLen uint32, keys unsafe.Pointer, keysLen uint32, json unsafe.Pointer, jsonLen uint32) uint32 {
+	return wasmTransform(wasmString(flags, flagsLen), wasmString(keys, keysLen), wasmBytes(json, jsonLen))
+}
+
+// json_drop_keys_result is where the last call's result or error is
+//
+//go:wasmexport json_drop_keys_result
+func json_drop_keys_result() unsafe.Pointer {
+	return unsafe.Pointer(unsafe.SliceData(wasmResult))
+}
+
+// json_drop_keys_result_len is the length of the last call's result or error
+//
+//go:wasmexport json_drop_keys_result_len
+func json_drop_keys_result_len() uint32 {
+	return uint32(len(wasmResult))
+}
+
+func wasmTransform(flags, keys string, document []byte) uint32 {
+	result, err := jsondrop.TransformDocument(flags, keys, document)
+	if err != nil {
+		wasmResult = []byte(err.Error())
+		return 1
+	}
+	wasmResult = result
+	return 0
+}
+
+func wasmBytes(p unsafe.Pointer, n uint32) []byte {
+	return unsafe.Slice((*byte)(p), n)
+}
+
+func wasmString(p unsafe.Pointer, n uint32) string {
+	return string(wasmBytes(p, n))
+}
@@ -5,10 +5,10 @@ go 1.25
 require (
 	github.com/stretchr/testify v1.11.1
 	github.com/valyala/fastjson v1.6.7
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,29 @@
+//go:build !race
+
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRowAllocations checks rows reuse the pooled decoder, nodes and buffers: the only
+// allocations left are the strings of values longer than a byte. The race detector makes
+// sync.Pool drop items at random, so this doesn't run under it.
+func TestRowAllocations(t *testing.T) {
+	line := []byte(`{"event":"e","properties":{"a":1,"b":[{"x":1,"y":{"z":"s"}},{"x":22}],"c":{"d":{"e":{"f":"g"}}},"$set":{"email":"a@b.c"}}}`)
+	for _, mode := range []string{"drop", "keep", "extract", "redact", "drop-nulls"} {
+		c, err := parseConfig([]string{"-mode=" + mode})
+		assert.NoError(t, err)
+		process, err := c.buildLineFunc([]string{"properties.c.d", "properties.$set.email"})
+		assert.NoError(t, err)
+		var buf bytes.Buffer
+		allocs := testing.AllocsPerRun(100, func() {
+			assert.NoError(t, process(line, &buf))
+		})
+		// "a@b.c" and the number 22
+		assert.LessOrEqual(t, allocs, 2.0, mode)
+	}
+}
@@ -0,0 +1,24 @@
+package jsondrop
+
+// arrayFilterFunc keeps only the elements of the arrays the paths match that satisfy keep, e.g.
+// with -where="@.tag_name=='a'" only the link elements of elements_chain remain. Matched values
+// that aren't arrays are left alone.
+func arrayFilterFunc(keys *jsonKey, keep filterFunc) transformFunc {
+	return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+		arr, ok := value.(*arrayNode)
+		if !ok {
+			return key, value, true
+		}
+		writeIdx := 0
+		for _, element := range arr.values {
+			if !keep(element) {
+				recycleNode(element)
+				continue
+			}
+			arr.values[writeIdx] = element
+			writeIdx++
+		}
+		arr.values = arr.values[:writeIdx]
+		return key, arr, true
+	})
+}
@@ -0,0 +1,62 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArrayFilterJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want, where string
+		keys                     []string
+	}{
+		{
+			name:  "key equals value",
+			input: `{"elements":[{"tag":"a","href":"/x"},{"tag":"input","value":"secret"},{"tag":"a"}]}`,
+			want:  `{"elements":[{"tag":"a","href":"/x"},{"tag":"a"}]}`,
+			where: `@.tag=='a'`,
+			keys:  []string{"elements"},
+		},
+		{
+			name:  "key exists",
+			input: `{"items":[{"id":1},{"name":"x"},{"id":null}]}`,
+			want:  `{"items":[{"id":1},{"id":null}]}`,
+			where: `@.id`,
+			keys:  []string{"items"},
+		},
+		{
+			name:  "negated",
+			input: `{"items":[{"type":"password"},{"type":"text"},3]}`,
+			want:  `{"items":[{"type":"text"},3]}`,
+			where: `!(@.type=='password')`,
+			keys:  []string{"items"},
+		},
+		{
+			name:  "arrays at any depth",
+			input: `{"a":{"items":[{"k":1},{"k":2}]},"items":[{"k":2}]}`,
+			want:  `{"a":{"items":[{"k":2}]},"items":[{"k":2}]}`,
+			where: `@.k==2`,
+			keys:  []string{"**.items"},
+		},
+		{
+			name:  "non-arrays are left alone",
+			input: `{"items":{"k":1}}`,
+			want:  `{"items":{"k":1}}`,
+			where: `@.k==2`,
+			keys:  []string{"items"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keep, err := compileFilter(c.where)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			err = transformLine(arrayFilterFunc(mustKeyDict(t, c.keys), keep), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
@@ -0,0 +1,569 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// An ArrowStream is a schema message, then a message for every record batch and an end of stream
+// marker. A message is 0xFFFFFFFF, the length of its metadata, the metadata, a flatbuffer Message
+// table, and the body the metadata refers to, https://arrow.apache.org/docs/format/Columnar.html
+// Only what string columns need is read and written here: Utf8 and Binary fields, their large
+// variants on the way in, and Struct fields for -on-error=tuple on the way out.
+
+// the MessageHeader and Type union members used here, from Message.fbs and Schema.fbs
+const (
+	arrowSchema      = 1
+	arrowDictionary  = 2
+	arrowRecordBatch = 3
+
+	arrowBinary      = 4
+	arrowUtf8        = 5
+	arrowStruct      = 13
+	arrowLargeBinary = 19
+	arrowLargeUtf8   = 20
+
+	// arrowV5 is the MetadataVersion written
+	arrowV5 = 4
+)
+
+// maxArrowMessage is the longest message metadata read, to catch input that isn't an ArrowStream
+// before allocating for it
+const maxArrowMessage = 1 << 24
+
+var errMalformedArrow = errors.New("malformed ArrowStream message")
+
+// flatTable is a table of a flatbuffer being read. Its accessors don't check bounds, readers
+// recover from the panic a malformed flatbuffer causes.
+type flatTable struct {
+	buf []byte
+	pos int
+}
+
+func flatRoot(buf []byte) flatTable {
+	return flatTable{buf: buf, pos: int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns where field id is in the table, 0 if it isn't set
+func (t flatTable) field(id int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	slot := 4 + 2*id
+	if slot >= int(binary.LittleEndian.Uint16(t.buf[vtable:])) {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(t.buf[vtable+slot:]))
+}
+
+func (t flatTable) uint8(id int) uint8 {
+	if off := t.field(id); off != 0 {
+		return t.buf[t.pos+off]
+	}
+	return 0
+}
+
+func (t flatTable) int64(id int) int64 {
+	if off := t.field(id); off != 0 {
+		return int64(binary.LittleEndian.Uint64(t.buf[t.pos+off:]))
+	}
+	return 0
+}
+
+// ref returns where the table, vector or string field id refers to is
+func (t flatTable) ref(id int) (int, bool) {
+	off := t.field(id)
+	if off == 0 {
+		return 0, false
+	}
+	at := t.pos + off
+	return at + int(binary.LittleEndian.Uint32(t.buf[at:])), true
+}
+
+func (t flatTable) table(id int) (flatTable, bool) {
+	at, ok := t.ref(id)
+	return flatTable{buf: t.buf, pos: at}, ok
+}
+
+// vector returns where the elements of vector field id start and how many there are
+func (t flatTable) vector(id int) (start, n int) {
+	at, ok := t.ref(id)
+	if !ok {
+		return 0, 0
+	}
+	return at + 4, int(binary.LittleEndian.Uint32(t.buf[at:]))
+}
+
+// tableAt returns table i of a vector of tables starting at start
+func (t flatTable) tableAt(start, i int) flatTable {
+	at := start + 4*i
+	return flatTable{buf: t.buf, pos: at + int(binary.LittleEndian.Uint32(t.buf[at:]))}
+}
+
+func (t flatTable) string(id int) string {
+	start, n := t.vector(id)
+	return string(t.buf[start : start+n])
+}
+
+// arrowReader reads the record batches of an ArrowStream into the columns of native
+type arrowReader struct {
+	native *nativeReader
+	// large is set for the columns with 64-bit offsets, nil until the schema is read
+	large []bool
+	meta  []byte
+	body  []byte
+}
+
+// readBatch reads the next record batch, io.EOF at the end of the stream
+func (a *arrowReader) readBatch(r *bufio.Reader) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errMalformedArrow
+		}
+	}()
+	for {
+		message, err := a.readMessage(r)
+		if err != nil {
+			return err
+		}
+		header, _ := message.table(2)
+		switch message.uint8(1) {
+		case arrowSchema:
+			if err := a.readSchema(header); err != nil {
+				return err
+			}
+		case arrowRecordBatch:
+			if a.large == nil {
+				return fmt.Errorf("ArrowStream record batch before its schema")
+			}
+			return a.readRecordBatch(header)
+		case arrowDictionary:
+			return fmt.Errorf("ArrowStream dictionary encoded columns aren't supported")
+		default:
+			return fmt.Errorf("unexpected ArrowStream message type %d", message.uint8(1))
+		}
+	}
+}
+
+// readMessage reads the next message into meta and body, io.EOF at the end of the stream
+func (a *arrowReader) readMessage(r *bufio.Reader) (flatTable, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return flatTable{}, err
+	}
+	size := binary.LittleEndian.Uint32(prefix[:])
+	if size == math.MaxUint32 {
+		// the continuation marker, streams from before Arrow 0.15 don't have it
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			return flatTable{}, unexpectedEOF(err)
+		}
+		size = binary.LittleEndian.Uint32(prefix[:])
+	}
+	if size == 0 {
+		return flatTable{}, io.EOF
+	}
+	if size > maxArrowMessage {
+		return flatTable{}, fmt.Errorf("ArrowStream message of %d bytes is longer than %d", size, maxArrowMessage)
+	}
+	a.meta = growBytes(a.meta, int(size))
+	if _, err := io.ReadFull(r, a.meta); err != nil {
+		return flatTable{}, unexpectedEOF(err)
+	}
+	message := flatRoot(a.meta)
+	bodyLength := message.int64(3)
+	if bodyLength < 0 || bodyLength > maxRowBinaryString {
+		return flatTable{}, fmt.Errorf("ArrowStream message body of %d bytes is longer than %d", bodyLength, maxRowBinaryString)
+	}
+	a.body = growBytes(a.body, int(bodyLength))
+	if _, err := io.ReadFull(r, a.body); err != nil {
+		return flatTable{}, unexpectedEOF(err)
+	}
+	return message, nil
+}
+
+func (a *arrowReader) readSchema(schema flatTable) error {
+	start, n := schema.vector(1)
+	if n != len(a.native.columns) {
+		return fmt.Errorf("ArrowStream schema has %d fields, expected %d", n, len(a.native.columns))
+	}
+	a.large = make([]bool, n)
+	for i := range a.large {
+		field := schema.tableAt(start, i)
+		if _, ok := field.ref(4); ok {
+			return fmt.Errorf("ArrowStream dictionary encoded columns aren't supported")
+		}
+		switch field.uint8(2) {
+		case arrowBinary, arrowUtf8:
+		case arrowLargeBinary, arrowLargeUtf8:
+			a.large[i] = true
+		default:
+			return fmt.Errorf("ArrowStream field %s has type %d, expected Utf8 or Binary", field.string(0), field.uint8(2))
+		}
+	}
+	return nil
+}
+
+func (a *arrowReader) readRecordBatch(batch flatTable) error {
+	if _, ok := batch.ref(3); ok {
+		return fmt.Errorf("compressed ArrowStream record batches aren't supported")
+	}
+	length := batch.int64(0)
+	nodes, nodeCount := batch.vector(1)
+	buffers, bufferCount := batch.vector(2)
+	columns := a.native.columns
+	if length < 0 || length > maxRowBinaryString || nodeCount != len(columns) || bufferCount != 3*len(columns) {
+		return errMalformedArrow
+	}
+	rows := int(length)
+	// buffer returns buffer i of the body
+	buffer := func(i int) ([]byte, error) {
+		at := buffers + 16*i
+		offset := int64(binary.LittleEndian.Uint64(batch.buf[at:]))
+		size := int64(binary.LittleEndian.Uint64(batch.buf[at+8:]))
+		if offset < 0 || size < 0 || offset+size > int64(len(a.body)) {
+			return nil, errMalformedArrow
+		}
+		return a.body[offset : offset+size], nil
+	}
+	for i := range columns {
+		c := &columns[i]
+		node := nodes + 16*i
+		if int64(binary.LittleEndian.Uint64(batch.buf[node:])) != length {
+			return errMalformedArrow
+		}
+		nullCount := binary.LittleEndian.Uint64(batch.buf[node+8:])
+		validity, err := buffer(3 * i)
+		if err != nil {
+			return err
+		}
+		offsets, err := buffer(3*i + 1)
+		if err != nil {
+			return err
+		}
+		data, err := buffer(3*i + 2)
+		if err != nil {
+			return err
+		}
+
+		c.reset(nullCount > 0)
+		offsetSize := 4
+		if a.large[i] {
+			offsetSize = 8
+		}
+		if len(offsets) < (rows+1)*offsetSize || (c.nulls != nil && len(validity) < (rows+7)/8) {
+			return errMalformedArrow
+		}
+		offset := func(row int) uint64 {
+			if a.large[i] {
+				return binary.LittleEndian.Uint64(offsets[8*row:])
+			}
+			return uint64(binary.LittleEndian.Uint32(offsets[4*row:]))
+		}
+		for row := 0; row < rows; row++ {
+			if c.nulls != nil {
+				c.nulls = append(c.nulls, 1-validity[row/8]>>(row%8)&1)
+			}
+			start, end := offset(row), offset(row+1)
+			if start > end || end > uint64(len(data)) {
+				return errMalformedArrow
+			}
+			c.add(data[start:end])
+		}
+		c.findConstant(rows)
+	}
+	a.native.rows, a.native.next = rows, 0
+	return nil
+}
+
+func growBytes(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+// arrowWriter writes blocks as ArrowStream record batches, led by the schema
+type arrowWriter struct {
+	schema bool
+	body   bytes.Buffer
+	nodes  bytes.Buffer
+	bufs   bytes.Buffer
+}
+
+// writeBatch writes a record batch of the first count rows of results, and of errs for
+// -on-error=tuple
+func (a *arrowWriter) writeBatch(w io.Writer, format *rowBinary, count int, results, errs *nativeColumn) error {
+	if err := a.writeSchema(w, format); err != nil {
+		return err
+	}
+	a.body.Reset()
+	a.nodes.Reset()
+	a.bufs.Reset()
+	columns := []*nativeColumn{results}
+	if format.tuple {
+		columns = append(columns, errs)
+		// the struct's own node and validity, it's never null
+		a.addNode(count, 0)
+		a.addBuffer(nil)
+	}
+	var offsets []byte
+	for _, c := range columns {
+		if len(c.data) > math.MaxInt32 {
+			return fmt.Errorf("ArrowStream record batch of %d bytes is longer than Utf8 allows", len(c.data))
+		}
+		var validity []byte
+		nulls := 0
+		if c.nulls != nil {
+			validity = make([]byte, (count+7)/8)
+			for i, null := range c.nulls[:count] {
+				if null == 1 {
+					nulls++
+				} else {
+					validity[i/8] |= 1 << (i % 8)
+				}
+			}
+		}
+		if nulls == 0 {
+			validity = nil
+		}
+		offsets = binary.LittleEndian.AppendUint32(offsets[:0], 0)
+		for i := 0; i < count; i++ {
+			offsets = binary.LittleEndian.AppendUint32(offsets, uint32(c.ends[i]))
+		}
+		a.addNode(count, nulls)
+		a.addBuffer(validity)
+		a.addBuffer(offsets)
+		a.addBuffer(c.data)
+	}
+
+	batch := flatFields{
+		{size: 8, value: uint64(count)},
+		{child: flatStructs(a.nodes.Bytes())},
+		{child: flatStructs(a.bufs.Bytes())},
+	}
+	return writeArrowMessage(w, arrowRecordBatch, batch, a.body.Bytes())
+}
+
+func (a *arrowWriter) addNode(length, nulls int) {
+	var node [16]byte
+	binary.LittleEndian.PutUint64(node[:], uint64(length))
+	binary.LittleEndian.PutUint64(node[8:], uint64(nulls))
+	a.nodes.Write(node[:])
+}
+
+// addBuffer adds b to the body, buffers start 8 byte aligned
+func (a *arrowWriter) addBuffer(b []byte) {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(a.body.Len()))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(len(b)))
+	a.bufs.Write(buf[:])
+	a.body.Write(b)
+	for a.body.Len()%8 != 0 {
+		a.body.WriteByte(0)
+	}
+}
+
+// writeSchema writes the schema unless it has been: a result field of Utf8, or a Struct of
+// result and error for -on-error=tuple
+func (a *arrowWriter) writeSchema(w io.Writer, format *rowBinary) error {
+	if a.schema {
+		return nil
+	}
+	a.schema = true
+	utf8Field := func(name string, nullable bool) flatObject {
+		return flatFields{
+			{child: flatString(name)},
+			{size: 1, value: boolValue(nullable)},
+			{size: 1, value: arrowUtf8},
+			{child: flatFields{}},
+			{},
+			// readers expect the children even when there are none
+			{child: flatTables{}},
+		}
+	}
+	field := utf8Field(nativeResult, format.nullable && !format.tuple)
+	if format.tuple {
+		field = flatFields{
+			{child: flatString(nativeResult)},
+			{size: 1, value: 0},
+			{size: 1, value: arrowStruct},
+			{child: flatFields{}},
+			{},
+			{child: flatTables{utf8Field(nativeResult, false), utf8Field("error", false)}},
+		}
+	}
+	schema := flatFields{
+		{size: 2, value: 0},
+		{child: flatTables{field}},
+	}
+	return writeArrowMessage(w, arrowSchema, schema, nil)
+}
+
+// end writes the end of stream marker, after the schema if no batch has been written
+func (a *arrowWriter) end(w io.Writer, format *rowBinary) error {
+	if err := a.writeSchema(w, format); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return err
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func writeArrowMessage(w io.Writer, headerType uint8, header flatObject, body []byte) error {
+	message := flatFields{
+		{size: 2, value: arrowV5},
+		{size: 1, value: uint64(headerType)},
+		{child: header},
+		{size: 8, value: uint64(len(body))},
+	}
+	meta := buildFlatbuffer(message)
+	// the body starts 8 byte aligned after the marker and the length
+	for len(meta)%8 != 0 {
+		meta = append(meta, 0)
+	}
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:], math.MaxUint32)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	for _, b := range [][]byte{prefix[:], meta, body} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flatObject is a table, vector or string of a flatbuffer being built. Objects are written
+// front to back, each before the objects it refers to, as flatbuffer offsets only point forward.
+type flatObject interface {
+	// build appends the object and returns where it starts
+	build(b *flatBuilder) int
+}
+
+type flatBuilder struct {
+	buf []byte
+}
+
+func buildFlatbuffer(root flatObject) []byte {
+	b := &flatBuilder{buf: make([]byte, 4, 256)}
+	binary.LittleEndian.PutUint32(b.buf, uint32(root.build(b)))
+	return b.buf
+}
+
+func (b *flatBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// refer sets the offset at at to the object at target
+func (b *flatBuilder) refer(at, target int) {
+	binary.LittleEndian.PutUint32(b.buf[at:], uint32(target-at))
+}
+
+// flatField is a scalar field of size bytes, a field referring to child, or unset
+type flatField struct {
+	size  int
+	value uint64
+	child flatObject
+}
+
+// flatFields is a table, its fields in id order
+type flatFields []flatField
+
+func (f flatFields) build(b *flatBuilder) int {
+	offsets := make([]int, len(f))
+	size := 4
+	for i, field := range f {
+		n := field.size
+		if field.child != nil {
+			n = 4
+		}
+		if n == 0 {
+			continue
+		}
+		size = (size + n - 1) / n * n
+		offsets[i] = size
+		size += n
+	}
+
+	b.align(2)
+	vtable := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*len(f)))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(size))
+	for _, offset := range offsets {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(offset))
+	}
+	b.align(8)
+	table := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[table:], uint32(table-vtable))
+	for i, field := range f {
+		at := b.buf[table+offsets[i]:]
+		switch {
+		case field.child != nil:
+		case field.size == 1:
+			at[0] = uint8(field.value)
+		case field.size == 2:
+			binary.LittleEndian.PutUint16(at, uint16(field.value))
+		case field.size == 4:
+			binary.LittleEndian.PutUint32(at, uint32(field.value))
+		case field.size == 8:
+			binary.LittleEndian.PutUint64(at, field.value)
+		}
+	}
+	for i, field := range f {
+		if field.child != nil {
+			b.refer(table+offsets[i], field.child.build(b))
+		}
+	}
+	return table
+}
+
+type flatString string
+
+func (s flatString) build(b *flatBuilder) int {
+	b.align(4)
+	at := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(append(b.buf, s...), 0)
+	return at
+}
+
+// flatTables is a vector of tables
+type flatTables []flatObject
+
+func (v flatTables) build(b *flatBuilder) int {
+	b.align(4)
+	at := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)))
+	b.buf = append(b.buf, make([]byte, 4*len(v))...)
+	for i, table := range v {
+		b.refer(at+4+4*i, table.build(b))
+	}
+	return at
+}
+
+// flatStructs is a vector of the 16 byte FieldNode or Buffer structs, laid out one after the
+// other
+type flatStructs []byte
+
+func (v flatStructs) build(b *flatBuilder) int {
+	// the structs hold 8 byte fields, so they start 8 byte aligned after the length
+	b.align(4)
+	if len(b.buf)%8 == 0 {
+		b.buf = append(b.buf, 0, 0, 0, 0)
+	}
+	at := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)/16))
+	b.buf = append(b.buf, v...)
+	return at
+}
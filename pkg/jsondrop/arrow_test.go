@@ -0,0 +1,216 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// arrowBatch is a record batch of Utf8 columns, LargeUtf8 with large, nil values are NULL
+func arrowBatch(large bool, columns ...[]*string) (flatObject, []byte) {
+	var body, nodes, buffers bytes.Buffer
+	addBuffer := func(b []byte) {
+		_ = binary.Write(&buffers, binary.LittleEndian, [2]uint64{uint64(body.Len()), uint64(len(b))})
+		body.Write(b)
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	for _, column := range columns {
+		validity := make([]byte, (len(column)+7)/8)
+		var data []byte
+		offsets := make([]byte, 4)
+		if large {
+			offsets = make([]byte, 8)
+		}
+		nulls := 0
+		for i, value := range column {
+			if value == nil {
+				nulls++
+			} else {
+				validity[i/8] |= 1 << (i % 8)
+				data = append(data, *value...)
+			}
+			if large {
+				offsets = binary.LittleEndian.AppendUint64(offsets, uint64(len(data)))
+			} else {
+				offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+			}
+		}
+		_ = binary.Write(&nodes, binary.LittleEndian, [2]uint64{uint64(len(column)), uint64(nulls)})
+		addBuffer(validity)
+		addBuffer(offsets)
+		addBuffer(data)
+	}
+	return flatFields{
+		{size: 8, value: uint64(len(columns[0]))},
+		{child: flatStructs(nodes.Bytes())},
+		{child: flatStructs(buffers.Bytes())},
+	}, body.Bytes()
+}
+
+// arrowInput is an ArrowStream of a field for each column of the batches
+func arrowInput(large bool, batches ...[][]*string) []byte {
+	typ := uint64(arrowUtf8)
+	if large {
+		typ = arrowLargeUtf8
+	}
+	var fields flatTables
+	for range batches[0] {
+		fields = append(fields, flatFields{{child: flatString("c")}, {size: 1, value: 1}, {size: 1, value: typ}, {child: flatFields{}}})
+	}
+	var buf bytes.Buffer
+	_ = writeArrowMessage(&buf, arrowSchema, flatFields{{}, {child: fields}}, nil)
+	for _, columns := range batches {
+		batch, body := arrowBatch(large, columns...)
+		_ = writeArrowMessage(&buf, arrowRecordBatch, batch, body)
+	}
+	buf.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return buf.Bytes()
+}
+
+// runArrow transforms ArrowStream input the way main does
+func runArrow(t *testing.T, input []byte, keys []string, flags ...string) ([]byte, error) {
+	c, err := parseConfig(append([]string{"-format=arrowstream"}, flags...))
+	assert.NoError(t, err)
+	f, err := c.rowBinary()
+	assert.NoError(t, err)
+	native := newNativeReader(f)
+	native.arrow = &arrowReader{native: native}
+	process, err := c.buildLineFunc(keys)
+	assert.NoError(t, err)
+	process = f.lineFunc(process)
+
+	lines := newLineReader(bufio.NewReaderSize(bytes.NewReader(input), 16), 0)
+	lines.native = native
+	var out bytes.Buffer
+	w := newNativeWriter(bufio.NewWriter(&out), f)
+	w.arrow = &arrowWriter{}
+	var buf bytes.Buffer
+	for {
+		line, _, err := lines.next()
+		if err == io.EOF {
+			return out.Bytes(), w.Close()
+		}
+		if err != nil {
+			return out.Bytes(), err
+		}
+		if err := process(line, &buf); err != nil {
+			return out.Bytes(), err
+		}
+		_, _ = w.Write(buf.Bytes())
+		if lines.endOfChunk() {
+			assert.NoError(t, w.Flush())
+		}
+	}
+}
+
+// arrowRows reads back the rows of a single Utf8 column ArrowStream, \N for NULL
+func arrowRows(t *testing.T, stream []byte) []string {
+	native := newNativeReader(&rowBinary{columns: 1})
+	native.arrow = &arrowReader{native: native}
+	r := bufio.NewReader(bytes.NewReader(stream))
+	var rows []string
+	for {
+		row, _, _, err := native.readRow(r)
+		if err == io.EOF {
+			return rows
+		}
+		assert.NoError(t, err)
+		rows = append(rows, string(row))
+	}
+}
+
+func TestArrowStream(t *testing.T) {
+	input := arrowInput(false,
+		[][]*string{{str("{\"a\":1,\n\"b\":2}"), str(`{"a":2}`)}},
+		[][]*string{{str(`{"c":{"a":1}}`)}})
+	out, err := runArrow(t, input, []string{"a"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"b":2}`, `{}`, `{"c":{"a":1}}`}, arrowRows(t, out))
+
+	out, err = runArrow(t, arrowInput(true, [][]*string{{nil, str(`{"a":1,"b":2}`), str(`{`)}}), []string{"a"},
+		"-nullable", "-on-error=null")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`\N`, `{"b":2}`, `\N`}, arrowRows(t, out))
+
+	out, err = runArrow(t, arrowInput(false, [][]*string{{str("{\"a\":\"\t\"}")}, {str(`{"b":1}`)}}), nil, "-mode=merge-patch")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"a":"\t","b":1}`}, arrowRows(t, out))
+
+	// no rows is still a stream with a schema
+	out, err = runArrow(t, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, arrowRows(t, out))
+
+	_, err = runArrow(t, input[:len(input)-20], nil)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = runArrow(t, arrowInput(false, [][]*string{{str("1")}, {str("1")}}), nil)
+	assert.ErrorContains(t, err, "schema has 2 fields, expected 1")
+	_, err = runArrow(t, bytes.Repeat([]byte{0x10, 0, 0, 0}, 8), nil)
+	assert.Equal(t, errMalformedArrow, err)
+}
+
+func TestArrowStreamTuple(t *testing.T) {
+	out, err := runArrow(t, arrowInput(false, [][]*string{{str(`{"a":1}`), str(`{`)}}), []string{"a"}, "-on-error=tuple")
+	assert.NoError(t, err)
+
+	r := &arrowReader{}
+	stream := bufio.NewReader(bytes.NewReader(out))
+	message, err := r.readMessage(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(arrowSchema), message.uint8(1))
+	schema, _ := message.table(2)
+	fields, n := schema.vector(1)
+	assert.Equal(t, 1, n)
+	field := schema.tableAt(fields, 0)
+	assert.Equal(t, uint8(arrowStruct), field.uint8(2))
+	children, n := field.vector(5)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "error", field.tableAt(children, 1).string(0))
+
+	message, err = r.readMessage(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(arrowRecordBatch), message.uint8(1))
+	batch, _ := message.table(2)
+	assert.Equal(t, int64(2), batch.int64(0))
+	_, nodes := batch.vector(1)
+	_, buffers := batch.vector(2)
+	assert.Equal(t, 3, nodes)
+	assert.Equal(t, 7, buffers)
+	// the error column's data is the last buffer
+	buffer, _ := batch.vector(2)
+	offset := binary.LittleEndian.Uint64(batch.buf[buffer+16*6:])
+	length := binary.LittleEndian.Uint64(batch.buf[buffer+16*6+8:])
+	assert.Contains(t, string(r.body[offset:offset+length]), "json parse error")
+
+	_, err = r.readMessage(stream)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFlatbuffer(t *testing.T) {
+	buf := buildFlatbuffer(flatFields{
+		{size: 1, value: 7},
+		{},
+		{size: 8, value: 1 << 40},
+		{child: flatString("name")},
+		{child: flatTables{flatFields{{size: 1, value: 1}}, flatFields{}}},
+	})
+	root := flatRoot(buf)
+	assert.Equal(t, uint8(7), root.uint8(0))
+	assert.Equal(t, 0, root.field(1))
+	assert.Equal(t, int64(1<<40), root.int64(2))
+	assert.Equal(t, "name", root.string(3))
+	tables, n := root.vector(4)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, uint8(1), root.tableAt(tables, 0).uint8(0))
+	assert.Equal(t, uint8(0), root.tableAt(tables, 1).uint8(0))
+	// fields past the end of the vtable aren't set
+	assert.Equal(t, 0, root.field(9))
+	// scalars are aligned to their size
+	assert.Zero(t, (root.pos+root.field(2))%8)
+}
@@ -0,0 +1,177 @@
+package jsondrop
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// benchCommand is the first argument that runs the benchmark instead of the UDF
+const benchCommand = "bench"
+
+// benchResult is what a benchmark run measured
+type benchResult struct {
+	rows, errors         int
+	inputBytes, outBytes int64
+	elapsed              time.Duration
+	mallocs              uint64
+	// latencies are the time each row took, sorted
+	latencies []time.Duration
+}
+
+// runBench is the bench subcommand: it transforms every row of -input with the same flags the UDF
+// takes, -keys standing in for the key argument, and reports throughput, allocations and latency
+// percentiles. Rows are transformed one at a time, -workers doesn't apply.
+func runBench(args []string, stdout, stderr io.Writer) int {
+	c := &config{}
+	fs := newFlagSet(c)
+	fs.Init(benchCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	input := fs.String("input", "", "the newline delimited rows to benchmark with")
+	fs.StringVar(&c.keysArg, "keys", "", "the key argument, e.g. ['a', 'b.c']")
+	passes := fs.Int("passes", 1, "how many times to run through the input")
+	if err := c.parseFlags(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	c.keysArg = c.keyArgument(c.keysArg)
+	if *input == "" || *passes < 1 {
+		fmt.Fprintln(stderr, "bench needs -input, and -passes of at least 1")
+		return 2
+	}
+	if _, ok := transformModes[c.mode]; !ok && c.mode != dispatchMode {
+		fmt.Fprintf(stderr, "unknown mode %q\n", c.mode)
+		return 2
+	}
+	c.flagArgs = stripBenchFlags(args)
+
+	var fileKeys []string
+	if c.keysFile != "" {
+		var err error
+		if fileKeys, err = (&keysFile{path: c.keysFile}).read(); err != nil {
+			fmt.Fprintf(stderr, "keys file error: %v\n", err)
+			return 1
+		}
+	}
+	process, err := c.lineFunc(fileKeys, c.keysFile != "")
+	if err != nil {
+		fmt.Fprintf(stderr, "keysToDrop parse error: %v\n", err)
+		return 1
+	}
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		fmt.Fprintf(stderr, "input error: %v\n", err)
+		return 1
+	}
+
+	rows := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+	for i, row := range rows {
+		rows[i], _ = trimLineEnding(row)
+	}
+	stopProfiling, err := c.startProfiling(slog.New(slog.NewTextHandler(stderr, nil)))
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	result := bench(process, rows, *passes)
+	if err := stopProfiling(); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	writeBenchResult(stdout, result)
+	return 0
+}
+
+// stripBenchFlags leaves out the flags only bench has, so dispatch builds its functions with
+// the rest
+func stripBenchFlags(args []string) []string {
+	return stripFlags(args, "input", "keys", "passes")
+}
+
+// stripFlags leaves out the flags with the given names, which all take a value
+func stripFlags(args []string, names ...string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		name := args[i]
+		for len(name) > 0 && name[0] == '-' {
+			name = name[1:]
+		}
+		flagName, _, hasValue := strings.Cut(name, "=")
+		if slices.Contains(names, flagName) {
+			if !hasValue {
+				i++
+			}
+			continue
+		}
+		kept = append(kept, args[i])
+	}
+	return kept
+}
+
+func bench(process lineFunc, rows [][]byte, passes int) benchResult {
+	result := benchResult{latencies: make([]time.Duration, 0, len(rows)*passes)}
+	var buf bytes.Buffer
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for pass := 0; pass < passes; pass++ {
+		for _, row := range rows {
+			rowStart := time.Now()
+			if err := process(row, &buf); err != nil {
+				result.errors++
+			} else {
+				result.outBytes += int64(buf.Len())
+			}
+			result.latencies = append(result.latencies, time.Since(rowStart))
+			result.inputBytes += int64(len(row))
+		}
+	}
+	result.elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	result.rows = len(rows) * passes
+	// latencies has room for every row up front, so the allocations are the rows' own
+	result.mallocs = after.Mallocs - before.Mallocs
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+	return result
+}
+
+// percentile returns the latency p percent of rows were faster than
+func (r benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies)-1) * p / 100)
+	return r.latencies[i]
+}
+
+func writeBenchResult(w io.Writer, r benchResult) {
+	seconds := r.elapsed.Seconds()
+	perRow := func(n float64) float64 {
+		if r.rows == 0 {
+			return 0
+		}
+		return n / float64(r.rows)
+	}
+	fmt.Fprintf(w, "rows        %d\n", r.rows)
+	fmt.Fprintf(w, "errors      %d\n", r.errors)
+	fmt.Fprintf(w, "input       %.1f MB\n", float64(r.inputBytes)/1e6)
+	fmt.Fprintf(w, "output      %.1f MB\n", float64(r.outBytes)/1e6)
+	fmt.Fprintf(w, "elapsed     %s\n", r.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "rows/sec    %.0f\n", float64(r.rows)/seconds)
+	fmt.Fprintf(w, "MB/sec      %.1f\n", float64(r.inputBytes)/1e6/seconds)
+	fmt.Fprintf(w, "allocs/row  %.2f\n", perRow(float64(r.mallocs)))
+	fmt.Fprintf(w, "p50         %s\n", r.percentile(50))
+	fmt.Fprintf(w, "p99         %s\n", r.percentile(99))
+	fmt.Fprintf(w, "max         %s\n", r.percentile(100))
+}
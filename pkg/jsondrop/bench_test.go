@@ -0,0 +1,35 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBench(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "corpus.ndjson")
+	assert.NoError(t, os.WriteFile(input, []byte("{\"a\":1,\"b\":2}\r\n{\"b\":{\"c\":3}}\nnot json\n"), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runBench([]string{"-input", input, "-keys=['b.c']", "-passes=2"}, &stdout, &stderr), stderr.String())
+	for _, line := range []string{"rows        6\n", "errors      2\n", "rows/sec", "MB/sec", "allocs/row", "p99", "max"} {
+		assert.Contains(t, stdout.String(), line)
+	}
+
+	result := bench(func(rawLine []byte, buf *bytes.Buffer) error {
+		buf.Reset()
+		buf.Write(rawLine)
+		return nil
+	}, [][]byte{[]byte("{}"), []byte("[]")}, 3)
+	assert.Equal(t, 6, result.rows)
+	assert.Equal(t, int64(12), result.inputBytes)
+	assert.Len(t, result.latencies, 6)
+
+	assert.Equal(t, 2, runBench([]string{"-keys=['a']"}, &stdout, &stderr))
+	assert.Equal(t, 1, runBench([]string{"-input", input + ".missing"}, &stdout, &stderr))
+	assert.Equal(t, []string{"-mode=redact", "-placeholder=x"},
+		stripBenchFlags([]string{"-input", input, "-mode=redact", "--keys=['a']", "-passes", "2", "-placeholder=x"}))
+}
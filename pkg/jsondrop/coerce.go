@@ -0,0 +1,73 @@
+package jsondrop
+
+// coerceNumbersFunc turns strings that hold a JSON number, like "42" or "-3.5e2", into numbers.
+// With keys, only the strings at and below the matched paths are converted.
+func coerceNumbersFunc(keys *jsonKey) transformFunc {
+	if keys == nil {
+		return coerceNumbers
+	}
+	return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+		return key, coerceNumbers(value), true
+	})
+}
+
+func coerceNumbers(n node) node {
+	switch v := n.(type) {
+	case *valueNode:
+		if v.kind == kindString && isJSONNumber(v.str) {
+			*v = valueNode{kind: kindNumber, num: v.str}
+		}
+	case *objectNode:
+		for i := range v.entries {
+			v.entries[i].value = coerceNumbers(v.entries[i].value)
+		}
+	case *arrayNode:
+		for i, value := range v.values {
+			v.values[i] = coerceNumbers(value)
+		}
+	}
+	return n
+}
+
+// isJSONNumber reports whether s is a number as JSON writes it. Leading zeros, a leading +,
+// surrounding spaces, hex, Infinity and NaN don't count, so IDs like "007" stay strings.
+func isJSONNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(s) && s[i] == '0':
+		i++
+	case i < len(s) && s[i] >= '1' && s[i] <= '9':
+		i = skipDigits(s, i)
+	default:
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		start := i + 1
+		i = skipDigits(s, start)
+		if i == start {
+			return false
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		start := i
+		i = skipDigits(s, start)
+		if i == start {
+			return false
+		}
+	}
+	return i == len(s)
+}
+
+func skipDigits(s string, i int) int {
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
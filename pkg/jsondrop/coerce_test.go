@@ -0,0 +1,61 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsJSONNumber(t *testing.T) {
+	for _, s := range []string{"0", "42", "-7", "3.14", "-0.5", "1e10", "2.5E-3", "1e+2"} {
+		assert.True(t, isJSONNumber(s), s)
+	}
+	for _, s := range []string{"", "-", "007", "+1", " 1", "1 ", "1.", ".5", "1e", "0x10", "NaN", "Infinity", "1,000", "12abc"} {
+		assert.False(t, isJSONNumber(s), s)
+	}
+}
+
+func TestCoerceNumbersJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			name:  "everywhere",
+			input: `{"a":"42","b":{"c":["3.14","x",1]},"zip":"02134"}`,
+			want:  `{"a":42,"b":{"c":[3.14,"x",1]},"zip":"02134"}`,
+		},
+		{
+			name:  "only listed paths",
+			input: `{"props":{"price":"9.99","sku":"123"},"id":"1"}`,
+			want:  `{"props":{"price":9.99,"sku":"123"},"id":"1"}`,
+			keys:  []string{"props.price"},
+		},
+		{
+			name:  "everything below a path",
+			input: `{"props":{"a":"1","b":{"c":"2"}},"id":"1"}`,
+			want:  `{"props":{"a":1,"b":{"c":2}},"id":"1"}`,
+			keys:  []string{"props"},
+		},
+		{
+			name:  "top-level array elements are documents",
+			input: `[{"n":"1"},{"n":"2"}]`,
+			want:  `[{"n":1},{"n":2}]`,
+			keys:  []string{"n"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var keys *jsonKey
+			if c.keys != nil {
+				keys = mustKeyDict(t, c.keys)
+			}
+			var buf bytes.Buffer
+			err := transformLine(coerceNumbersFunc(keys), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package jsondrop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configKeysEntry is the entry of a config file holding the key argument rather than a flag
+const configKeysEntry = "keys"
+
+// envPrefix starts the environment variables setting flags, followed by the flag's name in upper
+// case with underscores for dashes, e.g. JSON_UDF_ON_ERROR for -on-error
+const envPrefix = "JSON_UDF_"
+
+// parseFlags parses args with fs, then sets the flags args don't from the environment, then those
+// neither does from -config's file, so the command line overrides the environment, the environment
+// the file and the file the defaults. A key argument in the file is kept for keyArgument.
+func (c *config) parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := applyEnv(fs, os.LookupEnv); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return err
+	}
+	if c.configFile == "" {
+		return nil
+	}
+	if err := c.applyConfigFile(fs); err != nil {
+		err = fmt.Errorf("config file %s: %w", c.configFile, err)
+		fmt.Fprintln(fs.Output(), err)
+		return err
+	}
+	return nil
+}
+
+// applyEnv sets the flags that weren't given from their environment variables, if they're set
+// and not empty
+func applyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		if value, ok := lookup(name); ok && value != "" && !set[f.Name] && err == nil {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("%s: %w", name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// envName is the environment variable setting a flag
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// keyArgument is the key argument given on the command line, or the config file's without one
+func (c *config) keyArgument(arg string) string {
+	if arg == "" {
+		return c.configKeys
+	}
+	return arg
+}
+
+// applyConfigFile reads -config, a YAML mapping of flag names without the dash to their values.
+// Lists are joined with commas, as -detectors and -empty take them, except for keys, the key
+// argument, which becomes a JSON array.
+func (c *config) applyConfigFile(fs *flag.FlagSet) error {
+	data, err := os.ReadFile(c.configFile)
+	if err != nil {
+		return err
+	}
+	var entries map[string]any
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := entries[name]
+		if name == configKeysEntry {
+			if c.configKeys, err = configKeysValue(value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+		if name == "config" {
+			return fmt.Errorf("config files can't include another")
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if set[name] {
+			continue
+		}
+		s, err := configFlagValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := fs.Set(name, s); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// configFlagValue is a flag's value in a config file as the command line would give it
+func configFlagValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := configFlagValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("expected a string, number, boolean or list, not %T", value)
+	}
+}
+
+// configKeysValue is the key argument for the keys entry of a config file, a list of paths or a
+// string holding the argument as it would be given
+func configKeysValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []any:
+		keys := make([]string, len(v))
+		for i, item := range v {
+			key, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("expected paths, not %T", item)
+			}
+			keys[i] = key
+		}
+		array, err := json.Marshal(keys)
+		return string(array), err
+	default:
+		return "", fmt.Errorf("expected a list of paths, not %T", value)
+	}
+}
@@ -0,0 +1,110 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "json_udf.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+mode: keep
+on-error: passthrough
+workers: 3
+chunk-header: true
+keys-file-interval: 1m
+detectors: [email, ipv4]
+keys: [a, b.c]
+`)
+	c, err := parseConfig([]string{"-config", path})
+	assert.NoError(t, err)
+	assert.Equal(t, "keep", c.mode)
+	assert.Equal(t, "passthrough", c.onError)
+	assert.Equal(t, 3, c.workers)
+	assert.True(t, c.chunkHeader)
+	assert.Equal(t, time.Minute, c.keysFileInterval)
+	assert.Equal(t, "email,ipv4", c.detectors)
+	assert.Equal(t, `["a","b.c"]`, c.keysArg)
+
+	// the command line overrides the file, wherever -config is
+	c, err = parseConfig([]string{"-workers=2", "-config", path, "-mode=drop", "['x']"})
+	assert.NoError(t, err)
+	assert.Equal(t, "drop", c.mode)
+	assert.Equal(t, 2, c.workers)
+	assert.Equal(t, "passthrough", c.onError)
+	assert.Equal(t, "['x']", c.keysArg)
+	process, err := c.lineFunc(nil, false)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte(`{"a":1,"x":2}`), &buf))
+	assert.Equal(t, `{"a":1}`, buf.String())
+
+	c, err = parseConfig([]string{"-config", writeConfigFile(t, "keys: \"['q']\"\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, "['q']", c.keysArg)
+	_, err = parseConfig([]string{"-config", writeConfigFile(t, "")})
+	assert.NoError(t, err)
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		content, want string
+	}{
+		{"mode: [drop: 1]\n", "mode: expected a string"},
+		{"no-such-flag: 1\n", `unknown flag "no-such-flag"`},
+		{"workers: many\n", "workers: parse error"},
+		{"config: other.yaml\n", "can't include another"},
+		{"keys: [1, 2]\n", "keys: expected paths"},
+		{"- a\n", "cannot unmarshal"},
+	} {
+		c := &config{}
+		fs := newFlagSet(c)
+		fs.SetOutput(&bytes.Buffer{})
+		err := c.parseFlags(fs, []string{"-config", writeConfigFile(t, tc.content)})
+		if assert.Error(t, err, tc.content) {
+			assert.Contains(t, err.Error(), tc.want, tc.content)
+		}
+	}
+	_, err := parseConfig([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestEnvFlags(t *testing.T) {
+	assert.Equal(t, "JSON_UDF_ON_ERROR", envName("on-error"))
+	assert.Equal(t, "JSON_UDF_CPUPROFILE", envName("cpuprofile"))
+
+	t.Setenv("JSON_UDF_ON_ERROR", "null")
+	t.Setenv("JSON_UDF_NULLABLE", "true")
+	t.Setenv("JSON_UDF_WORKERS", "2")
+	t.Setenv("JSON_UDF_MODE", "")
+	c, err := parseConfig([]string{"-workers=5", "['a']"})
+	assert.NoError(t, err)
+	assert.Equal(t, "null", c.onError)
+	assert.True(t, c.nullable)
+	assert.Equal(t, 5, c.workers)
+	assert.Equal(t, "drop", c.mode)
+
+	// the environment overrides the config file, and may name it
+	path := writeConfigFile(t, "on-error: passthrough\nmode: keep\n")
+	t.Setenv("JSON_UDF_CONFIG", path)
+	c, err = parseConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "null", c.onError)
+	assert.Equal(t, "keep", c.mode)
+
+	t.Setenv("JSON_UDF_WORKERS", "many")
+	_, err = parseConfig(nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "JSON_UDF_WORKERS")
+	}
+}
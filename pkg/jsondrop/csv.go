@@ -0,0 +1,145 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CSV rows separate columns with commas. A column may be quoted with double quotes, and has to
+// be if it holds commas, quotes or newlines; quotes inside it are doubled. An unquoted \N is NULL.
+// ClickHouse quotes every String it writes, https://clickhouse.com/docs/interfaces/formats/CSV
+
+// csvRows reads CSV rows as the text rows the mode takes and writes their results back as CSV,
+// like rowBinary does for RowBinary. The reader keeps reading lines while a quote is open, so a
+// row is a whole CSV record.
+type csvRows struct {
+	// layout is how the columns map to the mode's rows, as for RowBinary
+	layout *rowBinary
+}
+
+// csvRows returns the CSV format if -format asks for it, nil otherwise
+func (c *config) csvRows() (*csvRows, error) {
+	if c.format != "csv" {
+		return nil, nil
+	}
+	layout, err := c.rowLayout()
+	if err != nil {
+		return nil, err
+	}
+	return &csvRows{layout: layout}, nil
+}
+
+// lineFunc turns every CSV row into the row process takes and writes its result as CSV. Rows
+// without the columns the mode takes fail.
+func (f *csvRows) lineFunc(process lineFunc) lineFunc {
+	var row, result bytes.Buffer
+	var fields []csvField
+	var line []byte
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		// the row is split in a copy, rawLine is still logged as it was read when it fails
+		line = append(line[:0], rawLine...)
+		var err error
+		if fields, err = splitCSV(fields[:0], line); err != nil {
+			return err
+		}
+		if len(fields) != f.layout.columns {
+			return fmt.Errorf("CSV row has %d columns, expected %d", len(fields), f.layout.columns)
+		}
+		row.Reset()
+		for i, field := range fields {
+			f.layout.appendColumn(&row, i, field.null, field.value)
+		}
+		if err := process(row.Bytes(), &result); err != nil {
+			return err
+		}
+		buf.Reset()
+		text := result.Bytes()
+		switch {
+		case f.layout.tuple:
+			value, errColumn, _ := bytes.Cut(text, []byte{'\t'})
+			writeCSVQuoted(buf, unescapeTSV(value))
+			buf.WriteByte(',')
+			writeCSVQuoted(buf, unescapeTSV(errColumn))
+		case f.layout.nullable && bytes.Equal(text, nullTSV):
+			buf.Write(nullTSV)
+		case f.layout.tsv:
+			writeCSVQuoted(buf, unescapeTSV(text))
+		default:
+			writeCSVQuoted(buf, text)
+		}
+		return nil
+	}
+}
+
+// csvField is a column of a CSV row, value is only valid until the next row
+type csvField struct {
+	value []byte
+	null  bool
+}
+
+// splitCSV appends the columns of a CSV row to fields. Quoted columns are unquoted in place.
+func splitCSV(fields []csvField, row []byte) ([]csvField, error) {
+	for i := 0; ; {
+		if i < len(row) && row[i] == '"' {
+			// value is unquoted over the column as it's read, it's never longer
+			start := i
+			value := row[start:start]
+			i++
+			for {
+				if i == len(row) {
+					return nil, fmt.Errorf("CSV column %d has no closing quote", len(fields)+1)
+				}
+				if row[i] == '"' {
+					if i+1 < len(row) && row[i+1] == '"' {
+						value = append(value, '"')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value = append(value, row[i])
+				i++
+			}
+			if i < len(row) && row[i] != ',' {
+				return nil, fmt.Errorf("CSV column %d has %q after its closing quote", len(fields)+1, row[i])
+			}
+			fields = append(fields, csvField{value: value})
+		} else {
+			end := bytes.IndexByte(row[i:], ',')
+			if end < 0 {
+				end = len(row) - i
+			}
+			value := row[i : i+end]
+			fields = append(fields, csvField{value: value, null: bytes.Equal(value, nullTSV)})
+			i += end
+		}
+		if i == len(row) {
+			return fields, nil
+		}
+		// skip the comma
+		i++
+	}
+}
+
+// writeCSVQuoted appends field to buf as a quoted CSV column
+func writeCSVQuoted(buf *bytes.Buffer, field []byte) {
+	buf.WriteByte('"')
+	for {
+		quote := bytes.IndexByte(field, '"')
+		if quote < 0 {
+			break
+		}
+		buf.Write(field[:quote+1])
+		buf.WriteByte('"')
+		field = field[quote+1:]
+	}
+	buf.Write(field)
+	buf.WriteByte('"')
+}
+
+// openCSVQuote reports whether a CSV row ends inside a quoted column, so its record goes on to the
+// next line
+func openCSVQuote(row []byte) bool {
+	return bytes.Count(row, []byte{'"'})%2 == 1
+}
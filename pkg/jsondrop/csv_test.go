@@ -0,0 +1,78 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runCSV transforms CSV input the way main does, a row of output per line
+func runCSV(t *testing.T, input string, keys []string, flags ...string) (string, error) {
+	c, err := parseConfig(append([]string{"-format=csv"}, flags...))
+	assert.NoError(t, err)
+	f, err := c.csvRows()
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc(keys)
+	assert.NoError(t, err)
+	process = f.lineFunc(process)
+
+	lines := newLineReader(bufio.NewReaderSize(strings.NewReader(input), 16), 0)
+	lines.csv = true
+	var out, buf bytes.Buffer
+	for {
+		line, _, err := lines.next()
+		if err == io.EOF && len(line) == 0 {
+			return out.String(), nil
+		}
+		if err != nil && err != io.EOF {
+			return out.String(), err
+		}
+		if err := process(line, &buf); err != nil {
+			return out.String(), err
+		}
+		out.Write(buf.Bytes())
+		out.WriteByte('\n')
+	}
+}
+
+func TestCSV(t *testing.T) {
+	input := `"{""a"":1,""b"":""x,y""}"` + "\n" +
+		"\"{\"\"a\"\":2,\n\"\"b\"\":\"\"\\t\"\"}\"\n" +
+		`{}` + "\n"
+	out, err := runCSV(t, input, []string{"a"})
+	assert.NoError(t, err)
+	assert.Equal(t, `"{""b"":""x,y""}"`+"\n"+`"{""b"":""\t""}"`+"\n"+`"{}"`+"\n", out)
+
+	out, err = runCSV(t, `\N`+"\n"+`"\N"`+"\n", nil, "-nullable", "-on-error=null")
+	assert.NoError(t, err)
+	assert.Equal(t, `\N`+"\n"+`\N`+"\n", out)
+
+	out, err = runCSV(t, `"{""a"":1}","{""b"":2}"`+"\n", nil, "-mode=merge-patch")
+	assert.NoError(t, err)
+	assert.Equal(t, `"{""a"":1,""b"":2}"`+"\n", out)
+
+	out, err = runCSV(t, `"{""a"":1}"`+"\n"+`"{"`+"\n", []string{"a"}, "-on-error=tuple")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, `"{}",""`+"\n"+`"","json parse error`), out)
+
+	for _, input := range []string{`"{}`, `"{}"x`, `"{}",{}`} {
+		_, err = runCSV(t, input, nil)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestSplitCSV(t *testing.T) {
+	fields, err := splitCSV(nil, []byte(`a,"b,""c""",,\N,"\N"`))
+	assert.NoError(t, err)
+	assert.Equal(t, []csvField{
+		{value: []byte("a")},
+		{value: []byte(`b,"c"`)},
+		{value: []byte("")},
+		{value: []byte(`\N`), null: true},
+		{value: []byte(`\N`)},
+	}, fields)
+}
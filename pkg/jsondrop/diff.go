@@ -0,0 +1,138 @@
+package jsondrop
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// diffLineFunc compares the JSON documents in the two columns of a TabSeparated row and outputs
+// {"added":{...},"removed":{...},"changed":{...}}, keyed by path. Added and removed hold the
+// value on the side that has it, changed holds {"from":...,"to":...}. Objects are compared member
+// by member and arrays element by element, paths use the key syntax with [n] for elements.
+// Numbers are compared by value, so 1 and 1.0 are equal.
+func diffLineFunc() lineFunc {
+	var d jsonDiff
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		before, after, err := parseColumnPair(rawLine, "before", "after")
+		if err != nil {
+			return err
+		}
+		d.reset()
+		d.compare("", before, after)
+		recycleNode(before)
+		recycleNode(after)
+
+		d.out.Reset()
+		d.out.WriteString(`{"added":{`)
+		d.out.Write(d.added.Bytes())
+		d.out.WriteString(`},"removed":{`)
+		d.out.Write(d.removed.Bytes())
+		d.out.WriteString(`},"changed":{`)
+		d.out.Write(d.changed.Bytes())
+		d.out.WriteString(`}}`)
+		buf.Reset()
+		writeTSVEscaped(buf, d.out.Bytes())
+		return nil
+	}
+}
+
+type jsonDiff struct {
+	added, removed, changed, out bytes.Buffer
+}
+
+func (d *jsonDiff) reset() {
+	d.added.Reset()
+	d.removed.Reset()
+	d.changed.Reset()
+}
+
+func (d *jsonDiff) compare(path string, a, b node) {
+	switch av := a.(type) {
+	case *objectNode:
+		if bv, ok := b.(*objectNode); ok {
+			d.compareObjects(path, av, bv)
+			return
+		}
+	case *arrayNode:
+		if bv, ok := b.(*arrayNode); ok {
+			d.compareArrays(path, av, bv)
+			return
+		}
+	case *valueNode:
+		if bv, ok := b.(*valueNode); ok && equalValues(av, bv) {
+			return
+		}
+	}
+	startMember(&d.changed, path)
+	d.changed.WriteString(`{"from":`)
+	a.Write(&d.changed)
+	d.changed.WriteString(`,"to":`)
+	b.Write(&d.changed)
+	d.changed.WriteByte('}')
+}
+
+func (d *jsonDiff) compareObjects(path string, a, b *objectNode) {
+	for _, entry := range a.entries {
+		memberPath := joinPath(path, entry.key)
+		if other := memberValue(b, entry.key); other != nil {
+			d.compare(memberPath, entry.value, other)
+			continue
+		}
+		startMember(&d.removed, memberPath)
+		entry.value.Write(&d.removed)
+	}
+	for _, entry := range b.entries {
+		if memberValue(a, entry.key) == nil {
+			startMember(&d.added, joinPath(path, entry.key))
+			entry.value.Write(&d.added)
+		}
+	}
+}
+
+func (d *jsonDiff) compareArrays(path string, a, b *arrayNode) {
+	for i := 0; i < len(a.values) || i < len(b.values); i++ {
+		elementPath := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i >= len(b.values):
+			startMember(&d.removed, elementPath)
+			a.values[i].Write(&d.removed)
+		case i >= len(a.values):
+			startMember(&d.added, elementPath)
+			b.values[i].Write(&d.added)
+		default:
+			d.compare(elementPath, a.values[i], b.values[i])
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return escapePathSegment(key)
+	}
+	return path + "." + escapePathSegment(key)
+}
+
+// startMember writes the key of the next member of a JSON object being built in buf
+func startMember(buf *bytes.Buffer, key string) {
+	if buf.Len() > 0 {
+		buf.WriteByte(',')
+	}
+	writeJSONString(buf, key)
+	buf.WriteByte(':')
+}
+
+func equalValues(a, b *valueNode) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	switch a.kind {
+	case kindString:
+		return a.str == b.str
+	case kindNumber:
+		return canonicalNumber(a.num) == canonicalNumber(b.num)
+	case kindBool:
+		return a.b == b.b
+	default:
+		return true
+	}
+}
@@ -0,0 +1,67 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		name, before, after, want string
+	}{
+		{
+			name:   "identical",
+			before: `{"a":1,"b":{"c":[1,2]}}`,
+			after:  `{"b":{"c":[1,2]},"a":1.0}`,
+			want:   `{"added":{},"removed":{},"changed":{}}`,
+		},
+		{
+			name:   "added removed changed",
+			before: `{"a":1,"b":{"c":"x","d":true}}`,
+			after:  `{"b":{"c":"y","e":null},"f":[1]}`,
+			want:   `{"added":{"b.e":null,"f":[1]},"removed":{"a":1,"b.d":true},"changed":{"b.c":{"from":"x","to":"y"}}}`,
+		},
+		{
+			name:   "arrays element by element",
+			before: `{"a":[1,{"b":2},3]}`,
+			after:  `{"a":[1,{"b":3}]}`,
+			want:   `{"added":{},"removed":{"a[2]":3},"changed":{"a[1].b":{"from":2,"to":3}}}`,
+		},
+		{
+			name:   "numbers compared exactly",
+			before: `{"id":12345678901234567890,"x":1e2}`,
+			after:  `{"id":12345678901234567891,"x":100.0}`,
+			want:   `{"added":{},"removed":{},"changed":{"id":{"from":12345678901234567890,"to":12345678901234567891}}}`,
+		},
+		{
+			name:   "type change",
+			before: `{"a":{"b":1}}`,
+			after:  `{"a":[1]}`,
+			want:   `{"added":{},"removed":{},"changed":{"a":{"from":{"b":1},"to":[1]}}}`,
+		},
+		{
+			name:   "whole document",
+			before: `1`,
+			after:  `"1"`,
+			want:   `{"added":{},"removed":{},"changed":{"":{"from":1,"to":"1"}}}`,
+		},
+		{
+			// the path is a\.b, its backslash is escaped once in JSON and once more in TSV
+			name:   "special keys are escaped",
+			before: `{}`,
+			after:  `{"a.b":1}`,
+			want:   `{"added":{"a\\\\.b":1},"removed":{},"changed":{}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := diffLineFunc()([]byte(c.before+"\t"+c.after), &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+}
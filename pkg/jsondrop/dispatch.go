@@ -0,0 +1,107 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// dispatchMode reads the function to run from the first column of each row
+const dispatchMode = "dispatch"
+
+// maxDispatchCache bounds the transforms dispatch keeps built, it starts over once it's full
+const maxDispatchCache = 256
+
+// dispatchLineFunc runs the function or mode named in the first TabSeparated column of each row.
+// The rest of the row is its input: for merge-patch, set-defaults and diff their two documents,
+// otherwise a document and optionally its key array in ClickHouse's Array(String) text form,
+// e.g. "redact\t{...}\t['email']". The function's flags are parsed over baseArgs, the process's
+// own, and keys from the keys file are added to every key array. Transforms are built on first
+// use and reused for rows with the same function and keys.
+func dispatchLineFunc(baseArgs []string, fileKeys []string) lineFunc {
+	type dispatchTarget struct {
+		process lineFunc
+		tsv     bool
+		// tuple rows are TabSeparated already, with -on-error=tuple
+		tuple bool
+		// nullable functions map a NULL document to NULL
+		nullable bool
+	}
+	cache := make(map[string]dispatchTarget)
+	var out bytes.Buffer
+
+	build := func(name, keysArg []byte) (dispatchTarget, error) {
+		functionFlags, ok := functionArgs(string(name))
+		if !ok {
+			return dispatchTarget{}, fmt.Errorf("unknown function %q", name)
+		}
+		args := append(append([]string{}, baseArgs...), functionFlags...)
+		c, err := parseConfig(args)
+		if err != nil {
+			return dispatchTarget{}, err
+		}
+		if c.mode == dispatchMode {
+			return dispatchTarget{}, fmt.Errorf("function %q can't dispatch", name)
+		}
+		selected := transformModes[c.mode]
+		var keys []string
+		if selected.line == nil && (len(keysArg) > 0 || (len(fileKeys) == 0 && !selected.keyless)) {
+			keys, err = parseKeysArray(string(keysArg))
+			if err != nil {
+				return dispatchTarget{}, err
+			}
+		}
+		keys = append(keys, fileKeys...)
+		process, err := c.buildLineFunc(keys)
+		if err != nil {
+			return dispatchTarget{}, err
+		}
+		return dispatchTarget{process: process, tsv: selected.tsv, tuple: c.onError == "tuple", nullable: c.nullable}, nil
+	}
+
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		name, rest, ok := bytes.Cut(rawLine, []byte{'\t'})
+		if !ok {
+			return fmt.Errorf("expected a function name column and a document column")
+		}
+		name = unescapeTSV(name)
+		document, keysArg, _ := bytes.Cut(rest, []byte{'\t'})
+
+		// TabSeparated modes are cached by name alone, their second column is a document
+		target, ok := cache[string(name)]
+		if !ok || !target.tsv {
+			cacheKey := string(name) + "\t" + string(keysArg)
+			if target, ok = cache[cacheKey]; !ok {
+				var err error
+				target, err = build(name, keysArg)
+				if err != nil {
+					return err
+				}
+				if len(cache) >= maxDispatchCache {
+					clear(cache)
+				}
+				if target.tsv {
+					cacheKey = string(name)
+				}
+				cache[cacheKey] = target
+			}
+		}
+
+		if target.tsv {
+			return target.process(rest, buf)
+		}
+		if target.tuple {
+			return target.process(document, buf)
+		}
+		if target.nullable && bytes.Equal(document, nullTSV) {
+			buf.Reset()
+			buf.Write(nullTSV)
+			return nil
+		}
+		if err := target.process(unescapeTSV(document), &out); err != nil {
+			return err
+		}
+		buf.Reset()
+		writeTSVEscaped(buf, out.Bytes())
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatch(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+	}{
+		{"mode with keys", "drop\t{\"a\":1,\"b\":2}\t['a']", `{"b":2}`},
+		{"function name", "JSONRedactKeys\t{\"a\":1}\t['a']", `{"a":"X"}`},
+		{"function flags", "JSONDropNulls\t{\"a\":{\"b\":null}}\t[]", `{"a":{}}`},
+		{"keyless without keys", "sort-keys\t{\"b\":1,\"a\":2}", `{"a":2,"b":1}`},
+		{"escaped document", "drop\t{\"a\":\"x\\\\ty\",\"b\":1}\t['b']", `{"a":"x\\ty"}`},
+		{"output is escaped", "drop\t{\"a\":\"x\\ty\"}\t[]", `{"a":"x\\ty"}`},
+		{"two documents", "JSONMergePatch\t{\"a\":1}\t{\"b\":2}", `{"a":1,"b":2}`},
+		{"raw line mode", "validate\t{\"a\":", "0"},
+	}
+	process := dispatchLineFunc([]string{"-placeholder=X"}, nil)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, process([]byte(c.input), &buf))
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+}
+
+func TestDispatchReusesTransforms(t *testing.T) {
+	process := dispatchLineFunc(nil, []string{"c"})
+	var buf bytes.Buffer
+	for _, keys := range []string{"['a']", "['b']", "['a']"} {
+		assert.NoError(t, process([]byte("drop\t{\"a\":1,\"b\":2,\"c\":3}\t"+keys), &buf))
+	}
+	assert.Equal(t, `{"b":2}`, buf.String())
+}
+
+func TestDispatchErrors(t *testing.T) {
+	process := dispatchLineFunc(nil, nil)
+	var buf bytes.Buffer
+	assert.Error(t, process([]byte(`{"a":1}`), &buf))
+	assert.Error(t, process([]byte("JSONNope\t{}"), &buf))
+	assert.Error(t, process([]byte("dispatch\t{}"), &buf))
+	assert.Error(t, process([]byte("drop\t{}\tnot an array"), &buf))
+}
+
+func TestParseConfigFlagArgs(t *testing.T) {
+	c, err := parseConfig([]string{"-mode=redact", "-placeholder=x", "['a']"})
+	assert.NoError(t, err)
+	assert.Equal(t, "['a']", c.keysArg)
+	assert.Equal(t, []string{"-mode=redact", "-placeholder=x"}, c.flagArgs)
+
+	_, err = parseConfig([]string{"-mode=nope"})
+	assert.Error(t, err)
+}
+
+func TestDispatchTuple(t *testing.T) {
+	process := dispatchLineFunc([]string{"-on-error=tuple"}, nil)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte("drop\t{\"a\":1,\"b\":2}\t['a']"), &buf))
+	assert.Equal(t, "{\"b\":2}\t", buf.String())
+	assert.NoError(t, process([]byte("drop\t{\"a\":\t['a']"), &buf))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("\tjson parse error")), buf.String())
+}
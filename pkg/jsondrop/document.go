@@ -0,0 +1,113 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/valyala/fastjson"
+)
+
+// nonObjectPolicy is what happens to documents that aren't objects
+type nonObjectPolicy int
+
+const (
+	// nonObjectElements transforms the elements of top-level arrays as documents of their own and
+	// leaves other values to the transform, most of which pass them through, the default
+	nonObjectElements nonObjectPolicy = iota
+	// nonObjectPassthrough writes them out exactly as they came in
+	nonObjectPassthrough
+	// nonObjectError fails the row
+	nonObjectError
+)
+
+// parseNonObjectPolicy parses the -non-object flag
+func parseNonObjectPolicy(s string) (nonObjectPolicy, error) {
+	switch s {
+	case "elements":
+		return nonObjectElements, nil
+	case "passthrough":
+		return nonObjectPassthrough, nil
+	case "error":
+		return nonObjectError, nil
+	default:
+		return 0, fmt.Errorf("unknown non-object policy %q, expected elements, passthrough or error", s)
+	}
+}
+
+// documentOptions are applied to a parsed document before it's transformed
+type documentOptions struct {
+	duplicateKeys duplicateKeyPolicy
+	nonObject     nonObjectPolicy
+	depth         depthLimit
+}
+
+// parseDepthLimit parses the -max-depth and -max-depth-action flags
+func parseDepthLimit(maxDepth int, action string) (depthLimit, error) {
+	if maxDepth < 0 || maxDepth > fastjson.MaxDepth {
+		return depthLimit{}, fmt.Errorf("-max-depth must be between 0 and %d", fastjson.MaxDepth)
+	}
+	switch action {
+	case "error":
+		return depthLimit{maxDepth: maxDepth}, nil
+	case "prune":
+		return depthLimit{maxDepth: maxDepth, prune: true}, nil
+	default:
+		return depthLimit{}, fmt.Errorf("unknown max depth action %q, expected error or prune", action)
+	}
+}
+
+// documentLineFunc is transformLine with the document options applied first
+func documentLineFunc(transform transformFunc, opts documentOptions) lineFunc {
+	if opts == (documentOptions{}) {
+		return func(rawLine []byte, buf *bytes.Buffer) error {
+			return transformLine(transform, rawLine, buf)
+		}
+	}
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		parsed, err := parseNodeLimited(rawLine, opts.depth)
+		if err != nil {
+			return err
+		}
+		if _, isObject := parsed.(*objectNode); !isObject && opts.nonObject != nonObjectElements {
+			kind := typeName(parsed)
+			recycleNode(parsed)
+			if opts.nonObject == nonObjectError {
+				return fmt.Errorf("document is %s, not an object", kind)
+			}
+			buf.Reset()
+			buf.Write(rawLine)
+			return nil
+		}
+		parsed, err = resolveDuplicateKeys(parsed, opts.duplicateKeys)
+		if err != nil {
+			recycleNode(parsed)
+			return err
+		}
+		result := transform(parsed)
+		buf.Reset()
+		buf.Grow(len(rawLine))
+		result.Write(buf)
+		recycleNode(result)
+		return nil
+	}
+}
+
+// typeName names the JSON type of n, with an article for error messages
+func typeName(n node) string {
+	switch v := n.(type) {
+	case *objectNode:
+		return "an object"
+	case *arrayNode:
+		return "an array"
+	case *valueNode:
+		switch v.kind {
+		case kindString:
+			return "a string"
+		case kindNumber:
+			return "a number"
+		case kindBool:
+			return "a boolean"
+		}
+	}
+	return "null"
+}
@@ -0,0 +1,89 @@
+package jsondrop
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonObjectPolicy(t *testing.T) {
+	drop := dropKeysFunc(mustKeyDict(t, []string{"a"}))
+	cases := []struct {
+		policy, input, want, err string
+	}{
+		{"elements", `[{"a":1,"b":2},3]`, `[{"b":2},3]`, ""},
+		{"elements", `"x"`, `"x"`, ""},
+		{"passthrough", `[ {"a":1} ]`, `[ {"a":1} ]`, ""},
+		{"passthrough", `true`, `true`, ""},
+		{"passthrough", `{"a":1,"b":2}`, `{"b":2}`, ""},
+		{"error", `[{"a":1}]`, "", "document is an array, not an object"},
+		{"error", `null`, "", "document is null, not an object"},
+		{"error", `"s"`, "", "document is a string, not an object"},
+		{"error", `{"a":1}`, `{}`, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.policy+" "+c.input, func(t *testing.T) {
+			policy, err := parseNonObjectPolicy(c.policy)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			err = documentLineFunc(drop, documentOptions{nonObject: policy})([]byte(c.input), &buf)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+
+	_, err := parseNonObjectPolicy("wrap")
+	assert.Error(t, err)
+}
+
+func TestMaxDepth(t *testing.T) {
+	drop := dropKeysFunc(mustKeyDict(t, []string{"x"}))
+	cases := []struct {
+		maxDepth         int
+		action           string
+		input, want, err string
+	}{
+		{3, "error", `{"a":{"b":{"c":1}}}`, `{"a":{"b":{"c":1}}}`, ""},
+		{2, "error", `{"a":{"b":{"c":1}}}`, "", "document is nested more than -max-depth=2 deep"},
+		{2, "error", `{"a":{"b":{}},"x":{"y":{"z":1}}}`, "", "document is nested more than -max-depth=2 deep"},
+		{2, "prune", `{"a":{"b":{"c":1},"d":{},"e":2},"f":[1,[2],[]]}`, `{"a":{"d":{},"e":2},"f":[1,[]]}`, ""},
+		{1, "prune", `[{"a":1},{},2]`, `[{},2]`, ""},
+		{0, "error", `{"a":{"b":{"c":1}}}`, `{"a":{"b":{"c":1}}}`, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.action+" "+c.input, func(t *testing.T) {
+			limit, err := parseDepthLimit(c.maxDepth, c.action)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			err = documentLineFunc(drop, documentOptions{depth: limit})([]byte(c.input), &buf)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+
+	_, err := parseDepthLimit(2, "truncate")
+	assert.Error(t, err)
+	_, err = parseDepthLimit(-1, "error")
+	assert.Error(t, err)
+}
+
+// TestDeepDocument runs the deepest document fastjson parses through conversion, drop, writing
+// and recycling, which don't recurse
+func TestDeepDocument(t *testing.T) {
+	depth := 299
+	input := strings.Repeat(`{"a":[`, depth/2) + `{"x":1,"y":2}` + strings.Repeat(`]}`, depth/2)
+	want := strings.Repeat(`{"a":[`, depth/2) + `{"y":2}` + strings.Repeat(`]}`, depth/2)
+	var buf bytes.Buffer
+	assert.NoError(t, transformLine(dropKeysFunc(mustKeyDict(t, []string{"deep:x"})), []byte(input), &buf))
+	assert.Equal(t, want, buf.String())
+}
@@ -0,0 +1,70 @@
+package jsondrop
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// dryRunValue is -dry-run, given alone it's -dry-run=paths
+type dryRunValue struct {
+	mode *string
+}
+
+func (v dryRunValue) String() string {
+	if v.mode == nil {
+		return ""
+	}
+	return *v.mode
+}
+
+func (v dryRunValue) Set(s string) error {
+	switch s {
+	case "true", "paths":
+		*v.mode = "paths"
+	case "false":
+		*v.mode = ""
+	case "count":
+		*v.mode = "count"
+	default:
+		return fmt.Errorf("expected paths or count")
+	}
+	return nil
+}
+
+func (dryRunValue) IsBoolFlag() bool { return true }
+
+// dryRunFunc replaces a document with the paths -mode=drop would remove from it, as a sorted JSON
+// array in the key syntax with the indexes of array elements, or with their number if count is set
+func dryRunFunc(keys *jsonKey, count bool) transformFunc {
+	return func(n node) node {
+		var paths []string
+		if arr, ok := n.(*arrayNode); ok {
+			// as dropKeysFromElements drops them
+			for i, value := range arr.values {
+				path := "[" + strconv.Itoa(i) + "]"
+				next, toDrop := keys.set().element(i, len(arr.values), value)
+				if toDrop {
+					paths = append(paths, path)
+					continue
+				}
+				dropKeysPaths(value, next.union(keys.set()), path, &paths)
+			}
+		} else {
+			dropKeysPaths(n, keys.set(), "", &paths)
+		}
+		recycleNode(n)
+		if count {
+			v := valueNodePool.Get().(*valueNode)
+			*v = valueNode{kind: kindNumber, num: strconv.Itoa(len(paths))}
+			return v
+		}
+		slices.Sort(paths)
+		arr := arrayNodePool.Get().(*arrayNode)
+		arr.values = arr.values[:0]
+		for _, path := range paths {
+			arr.values = append(arr.values, stringNode(path))
+		}
+		return arr
+	}
+}
@@ -0,0 +1,50 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	keys := []string{"a", "b.c", "b.d[*].c", "items[-1]", `**.f\.g`, "x.y", "[0]"}
+	for _, tc := range []struct {
+		flags       []string
+		line, want  string
+		description string
+	}{
+		{[]string{"-dry-run"}, `{"a":1,"b":{"c":2,"d":[{"c":1},{"x":2}]},"items":[1,2,3],"z":{"f.g":[]}}`, `["a","b.c","b.d[0].c","items[2]","z.f\\.g"]`, "paths"},
+		{[]string{"-dry-run=paths"}, `{"x.y":1,"x":{"z":2}}`, `["x.y"]`, "dotted keys"},
+		{[]string{"-dry-run"}, `[{"a":1},{"b":{"c":2}}]`, `["[0]","[1].b.c"]`, "arrays of documents"},
+		{[]string{"-dry-run"}, `{"q":1}`, `[]`, "nothing dropped"},
+		{[]string{"-dry-run=count"}, `{"a":1,"b":{"c":2,"d":[{"c":1},{"c":2}]}}`, `4`, "count"},
+		{[]string{"-dry-run", "-prescan", "-verbatim"}, `{"a" : 1}`, `["a"]`, "prescan doesn't apply"},
+		{[]string{"-dry-run", "-ignore-case"}, `{"A":1}`, `["A"]`, "key options apply"},
+		{[]string{"-dry-run=false"}, `{"a":1,"q":2}`, `{"q":2}`, "off"},
+	} {
+		c, err := parseConfig(tc.flags)
+		assert.NoError(t, err, tc.description)
+		process, err := c.buildLineFunc(keys)
+		assert.NoError(t, err, tc.description)
+		var buf bytes.Buffer
+		assert.NoError(t, process([]byte(tc.line), &buf), tc.description)
+		assert.Equal(t, tc.want, buf.String(), tc.description)
+	}
+
+	_, err := parseConfig([]string{"-dry-run=maybe"})
+	assert.Error(t, err)
+	for _, flags := range [][]string{{"-dry-run", "-mode=keep"}, {"-dry-run", "-encoding=msgpack", "-format=tsv"}} {
+		c, err := parseConfig(flags)
+		assert.NoError(t, err)
+		_, err = c.buildLineFunc(keys)
+		assert.Error(t, err, flags)
+	}
+
+	// nothing is counted as dropped either
+	before := droppedKeys.Load()
+	c, _ := parseConfig([]string{"-dry-run"})
+	process, _ := c.buildLineFunc(keys)
+	assert.NoError(t, process([]byte(`{"a":1}`), new(bytes.Buffer)))
+	assert.Equal(t, before, droppedKeys.Load())
+}
@@ -0,0 +1,116 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// duplicateKeyPolicy is what happens to objects with the same key more than once
+type duplicateKeyPolicy int
+
+const (
+	// duplicatesKeep keeps every member as it is, the default
+	duplicatesKeep duplicateKeyPolicy = iota
+	// duplicatesFirst keeps the first member with a key
+	duplicatesFirst
+	// duplicatesLast keeps the value of the last member with a key, where the first one was,
+	// the way JavaScript reads objects
+	duplicatesLast
+	// duplicatesError rejects the document
+	duplicatesError
+)
+
+// parseDuplicateKeyPolicy parses the -duplicate-keys flag
+func parseDuplicateKeyPolicy(s string) (duplicateKeyPolicy, error) {
+	switch s {
+	case "keep":
+		return duplicatesKeep, nil
+	case "first":
+		return duplicatesFirst, nil
+	case "last":
+		return duplicatesLast, nil
+	case "error":
+		return duplicatesError, nil
+	default:
+		return 0, fmt.Errorf("unknown duplicate key policy %q, expected keep, first, last or error", s)
+	}
+}
+
+// resolveDuplicateKeys applies policy to every object in a parsed document, before it's
+// transformed. With duplicatesError it returns an error naming the first duplicate.
+func resolveDuplicateKeys(n node, policy duplicateKeyPolicy) (node, error) {
+	switch policy {
+	case duplicatesKeep:
+		return n, nil
+	case duplicatesError:
+		if path, ok := findDuplicateKey(n, ""); ok {
+			return n, fmt.Errorf("duplicate key %q", path)
+		}
+		return n, nil
+	default:
+		dedupeKeys(n, policy == duplicatesLast)
+		return n, nil
+	}
+}
+
+// findDuplicateKey returns the path of the first key an object has twice
+func findDuplicateKey(n node, prefix string) (string, bool) {
+	switch v := n.(type) {
+	case *objectNode:
+		var seen map[string]struct{}
+		if len(v.entries) > 1 {
+			seen = make(map[string]struct{}, len(v.entries))
+		}
+		for _, entry := range v.entries {
+			path := joinPath(prefix, entry.key)
+			if seen != nil {
+				if _, ok := seen[entry.key]; ok {
+					return path, true
+				}
+				seen[entry.key] = struct{}{}
+			}
+			if found, ok := findDuplicateKey(entry.value, path); ok {
+				return found, true
+			}
+		}
+	case *arrayNode:
+		for i, value := range v.values {
+			if found, ok := findDuplicateKey(value, prefix+"["+strconv.Itoa(i)+"]"); ok {
+				return found, true
+			}
+		}
+	}
+	return "", false
+}
+
+func dedupeKeys(n node, last bool) {
+	switch v := n.(type) {
+	case *objectNode:
+		if len(v.entries) > 1 {
+			first := make(map[string]int, len(v.entries))
+			writeIdx := 0
+			for _, entry := range v.entries {
+				if at, ok := first[entry.key]; ok {
+					if last {
+						recycleNode(v.entries[at].value)
+						v.entries[at].value = entry.value
+					} else {
+						recycleNode(entry.value)
+					}
+					continue
+				}
+				first[entry.key] = writeIdx
+				v.entries[writeIdx] = entry
+				writeIdx++
+			}
+			v.entries = v.entries[:writeIdx]
+		}
+		for _, entry := range v.entries {
+			dedupeKeys(entry.value, last)
+		}
+	case *arrayNode:
+		for _, value := range v.values {
+			dedupeKeys(value, last)
+		}
+	}
+}
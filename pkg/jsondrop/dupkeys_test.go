@@ -0,0 +1,54 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicateKeys(t *testing.T) {
+	input := `{"a":1,"b":{"c":1,"c":2},"a":3,"d":[{"e":1,"e":2}]}`
+	cases := []struct {
+		policy, want string
+	}{
+		{"keep", `{"a":1,"b":{"c":1,"c":2},"a":3,"d":[{"e":1,"e":2}]}`},
+		{"first", `{"a":1,"b":{"c":1},"d":[{"e":1}]}`},
+		{"last", `{"a":3,"b":{"c":2},"d":[{"e":2}]}`},
+	}
+	for _, c := range cases {
+		t.Run(c.policy, func(t *testing.T) {
+			policy, err := parseDuplicateKeyPolicy(c.policy)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			process := documentLineFunc(func(n node) node { return n }, documentOptions{duplicateKeys: policy})
+			assert.NoError(t, process([]byte(input), &buf))
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+}
+
+func TestDuplicateKeysDropped(t *testing.T) {
+	// duplicates are resolved before dropping, so a dropped key takes its duplicates with it
+	var buf bytes.Buffer
+	process := documentLineFunc(dropKeysFunc(mustKeyDict(t, []string{"b"})), documentOptions{duplicateKeys: duplicatesLast})
+	assert.NoError(t, process([]byte(`{"a":1,"b":2,"a":3,"b":4}`), &buf))
+	assert.Equal(t, `{"a":3}`, buf.String())
+}
+
+func TestDuplicateKeysError(t *testing.T) {
+	var buf bytes.Buffer
+	process := documentLineFunc(dropKeysFunc(mustKeyDict(t, []string{"x"})), documentOptions{duplicateKeys: duplicatesError})
+	assert.NoError(t, process([]byte(`{"a":{"b":1},"c":[{"b":1}]}`), &buf))
+	assert.Equal(t, `{"a":{"b":1},"c":[{"b":1}]}`, buf.String())
+
+	err := process([]byte(`{"a":1,"c":[{"b":1,"b":2}]}`), &buf)
+	assert.EqualError(t, err, `duplicate key "c[0].b"`)
+
+	validate := validateLineFunc(false, duplicatesError)
+	assert.NoError(t, validate([]byte(`{"a":1,"a":2}`), &buf))
+	assert.Equal(t, "0", buf.String())
+
+	_, err = parseDuplicateKeyPolicy("merge")
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// chainAttributes are the attributes -mode=elements-chain removes, by name or, for entries
+// ending in *, by prefix
+type chainAttributes struct {
+	names    map[string]bool
+	prefixes []string
+}
+
+// parseChainAttributes parses -chain-attributes, a comma separated list like
+// attr__value,attr__data-*
+func parseChainAttributes(s string) (chainAttributes, error) {
+	attrs := chainAttributes{names: make(map[string]bool)}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "" || name == "*":
+			return chainAttributes{}, fmt.Errorf("invalid -chain-attributes %q, expected a comma separated list of attribute names", s)
+		case strings.HasSuffix(name, "*"):
+			attrs.prefixes = append(attrs.prefixes, strings.TrimSuffix(name, "*"))
+		default:
+			attrs.names[name] = true
+		}
+	}
+	return attrs, nil
+}
+
+func (a chainAttributes) match(name string) bool {
+	if a.names[name] {
+		return true
+	}
+	for _, prefix := range a.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubElementsChain removes the attributes attrs matches from a string in PostHog's
+// elements_chain encoding: elements separated by semicolons, each its tag and classes, a colon and
+// its attributes written one after the other as name="value", with quotes in values escaped, e.g.
+// a.nav:attr__href="/x"href="/x"nth-child="1"tag_name="a"text="Home";div:nth-child="2".
+// Anything that isn't an attribute, and what's left of an element it can't parse, is kept as it
+// is, so strings that aren't chains come out unchanged.
+func scrubElementsChain(chain string, attrs chainAttributes) string {
+	var out strings.Builder
+	changed := false
+	inAttributes := false
+	for i := 0; i < len(chain); {
+		if !inAttributes {
+			// the tag and classes, up to the colon before the attributes or the next element.
+			// Classes may have colons too, like hover:underline, but no name= after them.
+			end := i
+			for end < len(chain) && chain[end] != ';' && !(chain[end] == ':' && chainAttributesStart(chain[end+1:])) {
+				end++
+			}
+			if end == len(chain) {
+				out.WriteString(chain[i:])
+				break
+			}
+			out.WriteString(chain[i : end+1])
+			inAttributes = chain[end] == ':'
+			i = end + 1
+			continue
+		}
+		if chain[i] == ';' {
+			out.WriteByte(';')
+			inAttributes = false
+			i++
+			continue
+		}
+		name, end, ok := chainAttribute(chain, i)
+		if !ok {
+			// not an attribute, the rest of the element goes as it is
+			next := strings.IndexByte(chain[i:], ';')
+			if next < 0 {
+				next = len(chain) - i
+			}
+			out.WriteString(chain[i : i+next])
+			i += next
+			continue
+		}
+		if attrs.match(name) {
+			changed = true
+		} else {
+			out.WriteString(chain[i:end])
+		}
+		i = end
+	}
+	if !changed {
+		return chain
+	}
+	return out.String()
+}
+
+// chainAttributesStart reports whether s starts with an attribute name and =, or is empty, as
+// after the colon of an element without attributes
+func chainAttributesStart(s string) bool {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '=':
+			return true
+		case ch == '-' || ch == '_' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// chainAttribute parses the name="value" attribute at chain[start:], end is where it ends
+func chainAttribute(chain string, start int) (name string, end int, ok bool) {
+	eq := strings.Index(chain[start:], `="`)
+	if eq <= 0 || strings.ContainsAny(chain[start:start+eq], `;"`) {
+		return "", 0, false
+	}
+	for i := start + eq + 2; i < len(chain); i++ {
+		switch chain[i] {
+		case '\\':
+			i++
+		case '"':
+			return chain[start : start+eq], i + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// elementsChainFunc scrubs the strings the listed paths match as elements chains, other values
+// are left alone
+func elementsChainFunc(keys *jsonKey, attrs chainAttributes) transformFunc {
+	return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+		v, ok := value.(*valueNode)
+		if !ok || v.kind != kindString {
+			return key, value, true
+		}
+		if scrubbed := scrubElementsChain(v.str, attrs); scrubbed != v.str {
+			recycleNode(value)
+			return key, stringNode(scrubbed), true
+		}
+		return key, value, true
+	})
+}
@@ -0,0 +1,51 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrubElementsChain(t *testing.T) {
+	attrs, err := parseChainAttributes("attr__value, text,attr__data-*")
+	assert.NoError(t, err)
+	for _, tc := range []struct{ chain, want string }{
+		{
+			`input.form-control:attr__class="form-control"attr__value="hunter2"nth-child="1"nth-of-type="1"tag_name="input";form:nth-child="2"`,
+			`input.form-control:attr__class="form-control"nth-child="1"nth-of-type="1"tag_name="input";form:nth-child="2"`,
+		},
+		{
+			`a.hover:underline.md:w-1/2:attr__data-user="42"attr__href="/x"href="/x"text="Hi; \"you\""nth-child="1";div.nav:attr__data-id="7"`,
+			`a.hover:underline.md:w-1/2:attr__href="/x"href="/x"nth-child="1";div.nav:`,
+		},
+		// elements without attributes, or anything else, are kept as they are
+		{`button:;div`, `button:;div`},
+		{`no chain here`, `no chain here`},
+		{`a:attr__value="unterminated`, `a:attr__value="unterminated`},
+		{`a:garbage;b:attr__value="x"`, `a:garbage;b:`},
+		{"", ""},
+	} {
+		assert.Equal(t, tc.want, scrubElementsChain(tc.chain, attrs), tc.chain)
+	}
+
+	for _, s := range []string{"", "a,,b", "*"} {
+		_, err := parseChainAttributes(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestElementsChainMode(t *testing.T) {
+	c, err := parseConfig([]string{"-mode=elements-chain", "['$elements_chain', 'chains[*]']"})
+	assert.NoError(t, err)
+	process, err := c.lineFunc(nil, false)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte(`{"$elements_chain":"input:attr__value=\"secret\"nth-child=\"1\"","chains":["a:attr__value=\"x\"",1],"other":"input:attr__value=\"kept\""}`), &buf))
+	assert.Equal(t, `{"$elements_chain":"input:nth-child=\"1\"","chains":["a:",1],"other":"input:attr__value=\"kept\""}`, buf.String())
+
+	c, err = parseConfig([]string{"-mode=elements-chain", "-chain-attributes=,", "['$elements_chain']"})
+	assert.NoError(t, err)
+	_, err = c.lineFunc(nil, false)
+	assert.Error(t, err)
+}
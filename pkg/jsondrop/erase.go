@@ -0,0 +1,92 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// eraseMode scrubs the documents of the ids an erasures file lists and leaves every other row alone
+const eraseMode = "erase"
+
+// readErasures reads an -erasures file, a YAML mapping of the ids whose data has to go, a
+// distinct_id or a person id, to the paths to erase from their documents
+func readErasures(path string) (map[string][]string, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-mode=%s needs -erasures", eraseMode)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var erasures map[string][]string
+	if err := yaml.Unmarshal(data, &erasures); err != nil {
+		return nil, fmt.Errorf("erasures file %s: %w", path, err)
+	}
+	for id, paths := range erasures {
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("erasures file %s: %q lists no paths", path, id)
+		}
+	}
+	return erasures, nil
+}
+
+// erasureIDs are the ids of an erasures file, sorted
+func erasureIDs(erasures map[string][]string) []string {
+	ids := make([]string, 0, len(erasures))
+	for id := range erasures {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// eraseLineFunc drops the paths the erasures file lists for the id in the second column of a
+// TabSeparated row from the document in the first one. Rows of ids it doesn't list are written
+// back as they are, without being parsed, so a mutation over a whole table only rewrites the
+// documents of the people being forgotten. Ids erasing the same paths share a trie.
+func eraseLineFunc(opts transformOptions) (lineFunc, error) {
+	erasures, err := readErasures(opts.erasures)
+	if err != nil {
+		return nil, err
+	}
+	byPaths := make(map[string]lineFunc)
+	byID := make(map[string]lineFunc, len(erasures))
+	for _, id := range erasureIDs(erasures) {
+		paths := erasures[id]
+		process, ok := byPaths[strings.Join(paths, "\n")]
+		if !ok {
+			keyDict, err := newKeyDict(paths, opts.keyDict)
+			if err != nil {
+				return nil, fmt.Errorf("erasures file %s: %q: %w", opts.erasures, id, err)
+			}
+			process = documentLineFunc(dropKeysFunc(keyDict), opts.document)
+			byPaths[strings.Join(paths, "\n")] = process
+		}
+		byID[id] = process
+	}
+
+	var out bytes.Buffer
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		document, id, ok := bytes.Cut(rawLine, []byte{'\t'})
+		if !ok {
+			return fmt.Errorf("expected a document column and a distinct_id column")
+		}
+		process, ok := byID[string(unescapeTSV(id))]
+		if !ok || bytes.Equal(document, nullTSV) {
+			buf.Reset()
+			buf.Write(document)
+			return nil
+		}
+		if err := process(unescapeTSV(document), &out); err != nil {
+			return err
+		}
+		buf.Reset()
+		writeTSVEscaped(buf, out.Bytes())
+		return nil
+	}, nil
+}
@@ -0,0 +1,65 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeErasures(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "erasures.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestErase(t *testing.T) {
+	path := writeErasures(t, "user-1: [email, $set.email]\n\"it's\": [name]\n42: [email, $set.email]\n")
+	c, err := parseConfig([]string{"-mode=erase", "-erasures=" + path})
+	assert.NoError(t, err)
+	process, err := c.lineFunc(nil, false)
+	assert.NoError(t, err)
+	for _, tc := range []struct{ line, want string }{
+		{`{"email":"a","$set":{"email":"a","plan":"pro"}}` + "\tuser-1", `{"$set":{"plan":"pro"}}`},
+		{`{"email":"a","name":"b"}` + "\t42", `{"name":"b"}`},
+		{`{"email":"a","name":"b\tc"}` + "\tit's", `{"email":"a"}`},
+		// rows of other ids are written back as they came, even if they aren't JSON
+		{`{ "email" : "a",  "name":"b\tc"}` + "\tuser-2", `{ "email" : "a",  "name":"b\tc"}`},
+		{`not json` + "\tuser-2", `not json`},
+		{`\N` + "\tuser-1", `\N`},
+	} {
+		var buf bytes.Buffer
+		assert.NoError(t, process([]byte(tc.line), &buf), tc.line)
+		assert.Equal(t, tc.want, buf.String(), tc.line)
+	}
+	var buf bytes.Buffer
+	assert.EqualError(t, process([]byte(`{"email":"a"}`), &buf), "expected a document column and a distinct_id column")
+	assert.Error(t, process([]byte(`{"email":`+"\tuser-1"), &buf))
+
+	for content, want := range map[string]string{
+		"user-1: []\n":     `"user-1" lists no paths`,
+		"user-1: [a..b]\n": `"user-1": key "a..b"`,
+		"[user-1]\n":       "cannot unmarshal",
+	} {
+		c, err := parseConfig([]string{"-mode=erase", "-erasures=" + writeErasures(t, content)})
+		assert.NoError(t, err)
+		_, err = c.lineFunc(nil, false)
+		if assert.Error(t, err, content) {
+			assert.Contains(t, err.Error(), want)
+		}
+	}
+	c, err = parseConfig([]string{"-mode=erase"})
+	assert.NoError(t, err)
+	_, err = c.lineFunc(nil, false)
+	assert.EqualError(t, err, "-mode=erase needs -erasures")
+}
+
+func TestEraseSQL(t *testing.T) {
+	path := writeErasures(t, "user-2: [email]\nuser-1: [email]\n")
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runSQL([]string{"-name=json_erase", "-mode=erase", "-erasures=" + path, "-table=posthog.events"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "SELECT json_erase(properties, distinct_id) FROM posthog.events LIMIT 10;\n")
+	assert.Contains(t, stdout.String(), "ALTER TABLE posthog.events UPDATE properties = json_erase(properties, distinct_id) WHERE distinct_id IN ('user-1', 'user-2');\n")
+}
@@ -0,0 +1,41 @@
+package jsondrop
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// errorSample logs one in every -error-log-sample rows -on-error replaces, nil when it's 0. It's
+// set up once before any rows are transformed.
+var errorSample *sampledErrorLog
+
+// sampledErrorLog logs the first row error and every one after it, so a block of malformed rows
+// gives a few records to go by rather than one per row
+type sampledErrorLog struct {
+	log    *slog.Logger
+	every  uint64
+	logged atomic.Uint64
+}
+
+func newSampledErrorLog(log *slog.Logger, every int) *sampledErrorLog {
+	if every <= 0 {
+		return nil
+	}
+	return &sampledErrorLog{log: log, every: uint64(every)}
+}
+
+// observe logs the failure of rawLine, the nth row error, if it's in the sample
+func (l *sampledErrorLog) observe(n uint64, rawLine []byte, err error) {
+	if (n-1)%l.every != 0 {
+		return
+	}
+	l.logged.Add(1)
+	l.log.Warn("row replaced by -on-error", "row_error", n, "sample", logSample(rawLine), "error", err.Error())
+}
+
+// close logs how many rows failed in all, and how many of them were logged
+func (l *sampledErrorLog) close() {
+	if n := rowErrors.Load(); n > 0 {
+		l.log.Warn("rows replaced by -on-error", "row_errors", n, "logged", l.logged.Load(), "sample_every", l.every)
+	}
+}
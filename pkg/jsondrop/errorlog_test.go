@@ -0,0 +1,40 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampledErrorLog(t *testing.T) {
+	rowErrors.Store(0)
+	var log bytes.Buffer
+	errorSample = newSampledErrorLog(jsonLogger(&log), 3)
+	defer func() { errorSample = nil }()
+
+	c, err := parseConfig([]string{"-on-error=empty"})
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc([]string{"a"})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, process([]byte(fmt.Sprintf(`{"a":%d`, i)), &buf))
+	}
+	assert.NoError(t, process([]byte(`{"a":1}`), &buf))
+	errorSample.close()
+
+	records := logRecords(t, &log)
+	assert.Len(t, records, 4)
+	for i, n := range []float64{1, 4, 7} {
+		assert.Equal(t, "row replaced by -on-error", records[i]["msg"])
+		assert.Equal(t, n, records[i]["row_error"])
+		assert.Equal(t, fmt.Sprintf(`{"a":%d`, int(n)-1), records[i]["sample"])
+	}
+	assert.Equal(t, "rows replaced by -on-error", records[3]["msg"])
+	assert.Equal(t, 7.0, records[3]["row_errors"])
+	assert.Equal(t, 3.0, records[3]["logged"])
+
+	assert.Nil(t, newSampledErrorLog(jsonLogger(&log), 0))
+}
@@ -0,0 +1,344 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filterFunc is a compiled filter expression like @.type=='secret', it's evaluated against a
+// member value or array element (the @ node)
+type filterFunc func(n node) bool
+
+// compileFilter compiles the subset of JSONPath filter expressions we support: comparisons
+// (==, !=, <, <=, >, >=) of @ paths and string, number, true/false/null literals, bare @ paths
+// testing for existence, !, && and || with parentheses.
+func compileFilter(expr string) (filterFunc, error) {
+	p := &filterParser{s: expr}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q in filter expression", p.s[p.pos:])
+	}
+	return f, nil
+}
+
+// closingParen returns the index of the parenthesis closing the one at s[open], skipping quoted strings
+func closingParen(s string, open int) (int, error) {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '"':
+			p := &filterParser{s: s, pos: i}
+			if _, err := p.parseQuoted(); err != nil {
+				return 0, err
+			}
+			i = p.pos - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated filter expression")
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *filterParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterFunc, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(n node) bool { return l(n) || right(n) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterFunc, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(n node) bool { return l(n) && right(n) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterFunc, error) {
+	if p.consume("!") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(n node) bool { return !inner(n) }, nil
+	}
+	if p.consume("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ) in filter expression")
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+// filterOperand resolves to the node it refers to, nil when a path doesn't exist
+type filterOperand func(n node) node
+
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *filterParser) parseComparison() (filterFunc, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range comparisonOperators {
+		if !p.consume(op) {
+			continue
+		}
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func(n node) bool {
+			return compareNodes(left(n), right(n), op)
+		}, nil
+	}
+	return func(n node) bool { return left(n) != nil }, nil
+}
+
+func (p *filterParser) parseOperand() (filterOperand, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, fmt.Errorf("unexpected end of filter expression")
+	}
+	switch ch := p.s[p.pos]; {
+	case ch == '@':
+		p.pos++
+		return p.parsePath()
+	case ch == '\'' || ch == '"':
+		str, err := p.parseQuoted()
+		if err != nil {
+			return nil, err
+		}
+		lit := &valueNode{kind: kindString, str: str}
+		return func(node) node { return lit }, nil
+	default:
+		end := p.pos
+		for end < len(p.s) && strings.IndexByte(" \t)=!<>&|", p.s[end]) < 0 {
+			end++
+		}
+		word := p.s[p.pos:end]
+		p.pos = end
+		var lit *valueNode
+		switch word {
+		case "true", "false":
+			lit = &valueNode{kind: kindBool, b: word == "true"}
+		case "null":
+			lit = &valueNode{kind: kindNull}
+		default:
+			if !isJSONNumber(word) {
+				return nil, fmt.Errorf("unexpected %q in filter expression", word)
+			}
+			lit = &valueNode{kind: kindNumber, num: word}
+		}
+		return func(node) node { return lit }, nil
+	}
+}
+
+// parsePath parses the part of an @ path after the @, e.g. .props.type or ['a.b'][0]
+func (p *filterParser) parsePath() (filterOperand, error) {
+	var steps []func(node) node
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '.':
+			p.pos++
+			end := p.pos
+			for end < len(p.s) && strings.IndexByte(" \t.[)=!<>&|", p.s[end]) < 0 {
+				end++
+			}
+			if end == p.pos {
+				return nil, fmt.Errorf("empty key in filter path")
+			}
+			key := p.s[p.pos:end]
+			p.pos = end
+			steps = append(steps, func(n node) node { return memberValue(n, key) })
+		case '[':
+			p.pos++
+			p.skipSpace()
+			if p.pos < len(p.s) && (p.s[p.pos] == '\'' || p.s[p.pos] == '"') {
+				key, err := p.parseQuoted()
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, func(n node) node { return memberValue(n, key) })
+			} else {
+				end := strings.IndexByte(p.s[p.pos:], ']')
+				if end < 0 {
+					return nil, fmt.Errorf("missing ] in filter path")
+				}
+				index, err := strconv.Atoi(strings.TrimSpace(p.s[p.pos : p.pos+end]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in filter path: %w", err)
+				}
+				p.pos += end
+				steps = append(steps, func(n node) node { return elementValue(n, index) })
+			}
+			if !p.consume("]") {
+				return nil, fmt.Errorf("missing ] in filter path")
+			}
+		default:
+			return resolveSteps(steps), nil
+		}
+	}
+	return resolveSteps(steps), nil
+}
+
+func resolveSteps(steps []func(node) node) filterOperand {
+	return func(n node) node {
+		for _, step := range steps {
+			if n == nil {
+				return nil
+			}
+			n = step(n)
+		}
+		return n
+	}
+}
+
+// parseQuoted parses a single or double quoted string with backslash escapes
+func (p *filterParser) parseQuoted() (string, error) {
+	quote := p.s[p.pos]
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.s) {
+		ch := p.s[p.pos]
+		switch {
+		case ch == '\\' && p.pos+1 < len(p.s):
+			sb.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+		case ch == quote:
+			p.pos++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(ch)
+			p.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated string in filter expression")
+}
+
+// memberValue returns the value of the first member named key, nil if n isn't an object or has no such key
+func memberValue(n node, key string) node {
+	obj, ok := n.(*objectNode)
+	if !ok {
+		return nil
+	}
+	for _, entry := range obj.entries {
+		if entry.key == key {
+			return entry.value
+		}
+	}
+	return nil
+}
+
+// elementValue returns element i of an array, negative indexes count from the end
+func elementValue(n node, i int) node {
+	arr, ok := n.(*arrayNode)
+	if !ok {
+		return nil
+	}
+	if i < 0 {
+		i += len(arr.values)
+	}
+	if i < 0 || i >= len(arr.values) {
+		return nil
+	}
+	return arr.values[i]
+}
+
+// compareNodes compares two filter operands, missing values and mismatched types are only ever not equal
+func compareNodes(a, b node, op string) bool {
+	av, aok := a.(*valueNode)
+	bv, bok := b.(*valueNode)
+	if !aok || !bok || av.kind != bv.kind {
+		return op == "!="
+	}
+	var cmp int
+	switch av.kind {
+	case kindString:
+		cmp = strings.Compare(av.str, bv.str)
+	case kindNumber:
+		x, okA := parseDecimal(av.num)
+		y, okB := parseDecimal(bv.num)
+		if !okA || !okB {
+			return op == "!="
+		}
+		cmp = compareDecimals(x, y)
+	case kindBool:
+		if av.b != bv.b {
+			cmp = 1
+		}
+		if op != "==" && op != "!=" {
+			return false
+		}
+	case kindNull:
+		if op != "==" && op != "!=" {
+			return false
+		}
+	}
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
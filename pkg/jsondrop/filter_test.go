@@ -0,0 +1,60 @@
+package jsondrop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fastjson"
+)
+
+func TestCompileFilter(t *testing.T) {
+	doc := `{"type":"secret","n":3,"ok":true,"nil":null,"a":{"b":"x"},"arr":[1,"two"],"dot.key":1}`
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`@.type=='secret'`, true},
+		{`@.type == "public"`, false},
+		{`@.type != 'public'`, true},
+		{`@.n > 2`, true},
+		{`@.n <= 2`, false},
+		{`@.n == 3.0`, true},
+		{`@.ok == true`, true},
+		{`@.nil == null`, true},
+		{`@.a.b == 'x'`, true},
+		{`@['dot.key'] == 1`, true},
+		{`@.arr[1] == 'two'`, true},
+		{`@.arr[-1] == 'two'`, true},
+		{`@.missing`, false},
+		{`@.type`, true},
+		{`!@.missing`, true},
+		{`@.missing != 'x'`, true},
+		{`@.n == '3'`, false},
+		{`@.type=='secret' && @.n < 3`, false},
+		{`@.type=='public' || @.n == 3`, true},
+		{`!(@.type=='secret' && @.ok)`, false},
+	}
+
+	value, err := fastjson.Parse(doc)
+	require.NoError(t, err)
+	n, err := convertFastJSON(value)
+	require.NoError(t, err)
+
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			f, err := compileFilter(c.expr)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, f(n))
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	for _, expr := range []string{``, `@.a ==`, `@.a = 1`, `(@.a`, `@.a == 'x`, `@.a == foo`, `@.`} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := compileFilter(expr)
+			assert.Error(t, err)
+		})
+	}
+}
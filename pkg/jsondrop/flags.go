@@ -0,0 +1,372 @@
+package jsondrop
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// config holds the command line flags and the key argument
+type config struct {
+	cpuProfile       string
+	memProfile       string
+	pprofListen      string
+	statsInterval    time.Duration
+	statsRows        int
+	statsFile        string
+	metricsListen    string
+	debug            bool
+	logLevel         string
+	logFile          string
+	errorLogSample   int
+	mode             string
+	keyCase          string
+	detectors        string
+	output           string
+	collision        string
+	wrapKey          string
+	where            string
+	erasures         string
+	chainAttributes  string
+	reportErrors     bool
+	dryRun           string
+	duplicateKeys    string
+	nonObject        string
+	maxDepth         int
+	maxDepthAction   string
+	onError          string
+	nullable         bool
+	maxLineBytes     int
+	workers          int
+	chunkHeader      bool
+	format           string
+	columns          int
+	encoding         string
+	prescan          bool
+	verbatim         bool
+	maxStringBytes   int
+	truncateMarker   string
+	delimiter        string
+	arrays           string
+	types            string
+	depth            int
+	prunePlaceholder string
+	ipv4Prefix       int
+	ipv6Prefix       int
+	maxBytes         int
+	empty            string
+	placeholder      string
+	recursive        bool
+	ignoreCase       bool
+	keysFile         string
+	keysFileInterval time.Duration
+	presets          []string
+	teamKeys         string
+	eventKeys        string
+	personProperties bool
+	version          bool
+	handshake        bool
+	pathStats        bool
+	configFile       string
+	// configKeys is the key argument from the config file
+	configKeys string
+	// warn is told about the entries of the key list that have no effect, if set
+	warn func(key, reason string)
+	// keysArg is the first positional argument, the key array
+	keysArg string
+	// flagArgs are the arguments before keysArg, the flags
+	flagArgs []string
+}
+
+const modeUsage = "drop: remove the listed keys, keep: remove everything except the listed keys, extract: keep only the listed paths that exist, rename: rename keys by old.path:new_name mappings, redact: replace the values of the listed keys with -placeholder, hash: replace them with their SHA-256, anonymize-ip: zero the host part of the IP addresses in them, drop-nulls: remove members that are null, drop-empty: remove members that are empty, drop-by-value: remove members whose value is listed, drop-by-type: remove members of -types, prune-depth: remove everything deeper than -depth, shrink: drop values until documents fit -max-bytes, flatten: turn nested objects into delimited top-level keys, unflatten: the inverse of flatten, merge-patch: apply the RFC 7386 patch in the second column to the first, sort-keys: canonicalize documents, truncate: cut long strings, at the listed paths if any, list-paths: output the key paths in a document, count-keys: output the number of keys, or of matches of the listed paths, diff: compare the documents in two columns, set-defaults: add the keys of the defaults in the second column that are missing from the first, transform-keys: convert every key to -case, mask-pii: mask the PII -detectors find in string values, validate: output 1 if a row is valid JSON and 0 if not, coerce-numbers: turn numeric strings into numbers, at the listed paths if any, promote: move the members of the listed objects up into their parent, wrap: nest documents, or the listed members, under -wrap-key, array-filter: keep only the elements of the listed arrays matching -where, elements-chain: remove -chain-attributes from the elements chains at the listed paths, erase: drop the paths -erasures lists for the distinct_id in the second column, leaving other rows alone, dispatch: run the function named in the first column of each row"
+
+// programName is the name the binary was run as, the library and WASM hosts may run it without
+// any arguments at all
+func programName() string {
+	if len(os.Args) > 0 {
+		return os.Args[0]
+	}
+	return installBinary
+}
+
+func newFlagSet(c *config) *flag.FlagSet {
+	fs := flag.NewFlagSet(programName(), flag.ContinueOnError)
+	fs.StringVar(&c.cpuProfile, "cpuprofile", "", "write CPU profile to file")
+	fs.StringVar(&c.memProfile, "memprofile", "", "write a heap profile to file when the input ends")
+	fs.StringVar(&c.pprofListen, "pprof-listen", "", "serve net/http/pprof at this loopback address, e.g. localhost:6060")
+	fs.BoolVar(&c.debug, "debug", false, "enable debug logging, to "+debugLogPath+" unless -log-file is given")
+	fs.StringVar(&c.logLevel, "log-level", "info", "the least severe log records written: debug, info, warn or error")
+	fs.StringVar(&c.logFile, "log-file", "", "append JSON log records to this file instead of stderr")
+	fs.IntVar(&c.errorLogSample, "error-log-sample", 0, "log one in this many rows -on-error replaces, and how many there were at the end, 0 for none")
+	fs.DurationVar(&c.statsInterval, "stats-interval", 0, "write rows, errors, bytes in and out and keys dropped so far to stderr this often, 0 for never")
+	fs.IntVar(&c.statsRows, "stats-rows", 0, "write the same stats as -stats-interval every this many rows, 0 for never")
+	fs.StringVar(&c.statsFile, "stats-file", "", "append stats to this file instead of the log")
+	fs.BoolVar(&c.pathStats, "path-stats", false, "count the members and elements each path of -mode=drop drops, logged when the input ends and served with -metrics-listen")
+	fs.StringVar(&c.metricsListen, "metrics-listen", "", "serve Prometheus metrics at /metrics on this address, e.g. :9100")
+	fs.StringVar(&c.mode, "mode", "drop", modeUsage)
+	fs.StringVar(&c.keyCase, "case", "snake", "the case -mode=transform-keys converts keys to: lower, snake or camel")
+	fs.StringVar(&c.detectors, "detectors", "email,card,ipv6,ipv4,phone", "the PII -mode=mask-pii masks: email, card, ipv6, ipv4, phone")
+	fs.StringVar(&c.output, "output", "compact", "compact: write documents on one line, pretty: indent them, only for -mode=merge-patch, set-defaults, diff and dispatch in ClickHouse, which splits Raw output at newlines")
+	fs.StringVar(&c.collision, "collision", "keep", "what -mode=promote does with members whose key the parent already has, keep: keep the parent's, overwrite: replace it")
+	fs.StringVar(&c.wrapKey, "wrap-key", "", "the key -mode=wrap nests documents or members under")
+	fs.StringVar(&c.where, "where", "", "the filter expression -mode=array-filter keeps elements by, e.g. @.tag_name=='a'")
+	fs.StringVar(&c.chainAttributes, "chain-attributes", "attr__value", "the attributes -mode=elements-chain removes, a comma separated list of names, ending in * for a prefix, e.g. attr__value,attr__data-*")
+	fs.StringVar(&c.erasures, "erasures", "", "the YAML file of ids to the paths -mode=erase drops from their rows, read again when the keys file is reloaded")
+	fs.BoolVar(&c.reportErrors, "report-errors", false, "make -mode=validate output the parse error, or an empty string for valid JSON, instead of 1/0")
+	fs.Var(dryRunValue{&c.dryRun}, "dry-run", "make -mode=drop output the paths it would drop from each document as a JSON array instead of dropping them, or their number with -dry-run=count")
+	fs.StringVar(&c.duplicateKeys, "duplicate-keys", "keep", "what happens to keys an object has more than once, keep: keep them all, first: keep the first, last: keep the last value where the first was, error: fail the row")
+	fs.StringVar(&c.nonObject, "non-object", "elements", "what happens to documents that aren't objects, elements: transform the elements of arrays as documents and leave other values to the mode, passthrough: write them out unchanged, error: fail the row")
+	fs.IntVar(&c.maxDepth, "max-depth", 0, "how many keys or indexes deep documents may nest, 0 for fastjson's limit of 300")
+	fs.StringVar(&c.maxDepthAction, "max-depth-action", "error", "what happens to documents nested deeper than -max-depth, error: fail the row, prune: drop the objects and arrays with members too deep")
+	fs.StringVar(&c.onError, "on-error", "fail", "what to output for rows that fail, fail: exit and fail the query, passthrough: the input unchanged, empty: {}, null: \\N for a Nullable return type")
+	fs.BoolVar(&c.nullable, "nullable", false, "output \\N for NULL and empty rows instead of failing on them, for Nullable(String) functions")
+	fs.IntVar(&c.maxLineBytes, "max-line-bytes", 0, "the longest row read, longer rows fail with a row error -on-error handles instead of being read into memory, 0 for no limit")
+	fs.StringVar(&c.format, "format", "raw", "the format of rows, raw: the function's format is Raw, or TabSeparated for the modes taking two columns, tsv: it's TabSeparated, csv: it's CSV, rowbinary: it's RowBinary, native: it's Native, arrowstream: it's ArrowStream")
+	fs.IntVar(&c.columns, "columns", 0, "how many String arguments -format=csv, rowbinary, native and arrowstream rows have, 0 for the mode's, 1 or 2 for TabSeparated modes and dispatch")
+	fs.StringVar(&c.encoding, "encoding", "json", "how documents are encoded, json or msgpack, msgpack works with the modes that transform documents and needs -format=tsv, csv or a binary one")
+	fs.BoolVar(&c.chunkHeader, "chunk-header", false, "read rows in chunks led by their row count and flush the output after each chunk, for functions with send_chunk_header")
+	fs.IntVar(&c.workers, "workers", 1, "how many rows to transform concurrently, output rows stay in input order, 0 for one per CPU")
+	fs.BoolVar(&c.prescan, "prescan", false, "write rows -mode=drop can't change as they are, without parsing them, when none of the top-level keys appear in them")
+	fs.BoolVar(&c.verbatim, "verbatim", false, "copy the members -mode=drop leaves untouched from the input as they are, formatting included, instead of writing them out again")
+	fs.IntVar(&c.maxStringBytes, "max-string-bytes", 1024, "the longest string -mode=truncate leaves alone")
+	fs.StringVar(&c.truncateMarker, "truncate-marker", "...", "appended to strings cut by -mode=truncate")
+	fs.StringVar(&c.delimiter, "delimiter", ".", "the delimiter -mode=flatten joins keys with and -mode=unflatten splits them at")
+	fs.StringVar(&c.arrays, "arrays", "index", "how -mode=flatten handles arrays, index: flatten elements into keys with their index (and unflatten them back into arrays), keep: keep arrays as values")
+	fs.StringVar(&c.types, "types", "object,array", "the JSON types -mode=drop-by-type removes: object, array, string, number, boolean, null")
+	fs.IntVar(&c.depth, "depth", 32, "how deep a document -mode=prune-depth leaves alone")
+	fs.IntVar(&c.ipv4Prefix, "ipv4-prefix", 24, "the leading bits of IPv4 addresses -mode=anonymize-ip keeps, 24 zeroes the last octet")
+	fs.IntVar(&c.ipv6Prefix, "ipv6-prefix", 48, "the leading bits of IPv6 addresses -mode=anonymize-ip keeps, 48 zeroes the last 80")
+	fs.StringVar(&c.prunePlaceholder, "prune-placeholder", "", "replaces subtrees removed by -mode=prune-depth, they're dropped if empty")
+	fs.IntVar(&c.maxBytes, "max-bytes", 65536, "the size in bytes -mode=shrink cuts documents down to")
+	fs.StringVar(&c.empty, "empty", "strings,objects,arrays", "the kinds of empty values -mode=drop-empty removes")
+	fs.StringVar(&c.placeholder, "placeholder", "[REDACTED]", "the string redacted values, and values -mode=anonymize-ip can't parse, are replaced with")
+	fs.BoolVar(&c.recursive, "recursive", false, "match every key at any depth, as if it had the deep: prefix, keyless modes apply to nested objects too")
+	fs.BoolVar(&c.ignoreCase, "ignore-case", false, "match keys case-insensitively")
+	fs.StringVar(&c.keysFile, "keys-file", "", "read additional keys from a file, one path per line, reloaded on SIGHUP or when it changes")
+	fs.DurationVar(&c.keysFileInterval, "keys-file-interval", 10*time.Second, "how often to check the keys file for changes")
+	fs.BoolVar(&c.personProperties, "person-properties", false, "also apply the paths under $set and $set_once, and with -mode=drop remove the top-level keys from $unset, so person properties don't keep what's removed from the event")
+	fs.Var(presetsValue{&c.presets}, "preset", "add the paths of a named list of PostHog properties to the keys, more than one may be given: "+strings.Join(presetNames(), ", "))
+	fs.StringVar(&c.teamKeys, "team-keys", "", "read the keys of each team from this YAML file of team ids to paths, rows are a document and its team_id, and drop the team's keys on top of the others")
+	fs.StringVar(&c.eventKeys, "event-keys", "", "read the keys of each event from this YAML file of event names to paths, rows are a document and its event, and drop the event's keys on top of the others")
+	fs.StringVar(&c.configFile, "config", "", "read flags, and the key argument as keys, from this YAML file, flags on the command line override it")
+	fs.BoolVar(&c.version, "version", false, "write the version, commit, functions and protocol features of this build as JSON and exit")
+	fs.BoolVar(&c.handshake, "handshake", false, "write the same JSON as -version, with the flags, as a line on stderr when starting")
+	return fs
+}
+
+// parseConfig parses command line arguments, later flags override earlier ones
+func parseConfig(args []string) (*config, error) {
+	c := &config{}
+	fs := newFlagSet(c)
+	if err := c.parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	c.keysArg = c.keyArgument(fs.Arg(0))
+	c.flagArgs = args[:len(args)-fs.NArg()]
+	if _, ok := transformModes[c.mode]; !ok && c.mode != dispatchMode {
+		return nil, fmt.Errorf("unknown mode %q", c.mode)
+	}
+	if c.workers < 0 {
+		return nil, fmt.Errorf("-workers must be at least 0")
+	}
+	if c.errorLogSample < 0 {
+		return nil, fmt.Errorf("-error-log-sample must be at least 0")
+	}
+	if c.statsRows < 0 || c.statsInterval < 0 {
+		return nil, fmt.Errorf("-stats-rows and -stats-interval must be at least 0")
+	}
+	if c.workers == 0 {
+		c.workers = runtime.NumCPU()
+	}
+	return c, nil
+}
+
+func (c *config) transformOptions() transformOptions {
+	var hits *pathHitCounts
+	if c.pathStats {
+		hits = &pathHits
+	}
+	return transformOptions{
+		keyDict:          keyDictOptions{ignoreCase: c.ignoreCase, recursive: c.recursive, hits: hits},
+		placeholder:      c.placeholder,
+		salt:             os.Getenv(hashSaltEnv),
+		recursive:        c.recursive,
+		empty:            c.empty,
+		types:            c.types,
+		depth:            c.depth,
+		maxBytes:         c.maxBytes,
+		prunePlaceholder: c.prunePlaceholder,
+		ipv4Bits:         c.ipv4Prefix,
+		ipv6Bits:         c.ipv6Prefix,
+		delimiter:        c.delimiter,
+		arrays:           c.arrays,
+		keyCase:          c.keyCase,
+		detectors:        c.detectors,
+		reportErrors:     c.reportErrors,
+		collision:        c.collision,
+		wrapKey:          c.wrapKey,
+		where:            c.where,
+		erasures:         c.erasures,
+		chainAttributes:  c.chainAttributes,
+		truncate:         truncateOptions{maxBytes: c.maxStringBytes, marker: c.truncateMarker},
+	}
+}
+
+// buildLineFunc builds the row transform for the configured mode from the parsed keys
+// tooLongPolicy returns what rows over -max-line-bytes are replaced with, and whether rows are
+// TabSeparated. Dispatch leaves -on-error to the functions it runs, which an oversized row never
+// gets to, so it fails them.
+func (c *config) tooLongPolicy() (errorPolicy, bool) {
+	if c.mode == dispatchMode {
+		return errorFail, true
+	}
+	policy, err := parseErrorPolicy(c.onError)
+	if err != nil {
+		return errorFail, false
+	}
+	return policy, transformModes[c.mode].tsv || c.keyScope() != nil
+}
+
+// lineFunc builds the row transform from the key argument and the keys from -keys-file, the
+// key argument is optional with a keys file, presets or team keys
+func (c *config) lineFunc(fileKeys []string, hasKeysFile bool) (lineFunc, error) {
+	scope := c.keyScope()
+	if scope != nil {
+		if err := c.checkKeyScope(); err != nil {
+			return nil, err
+		}
+	}
+	if c.mode == dispatchMode {
+		return dispatchLineFunc(c.flagArgs, fileKeys), nil
+	}
+	var keys []string
+	if c.keysArg != "" || (!hasKeysFile && len(c.presets) == 0 && scope == nil && !transformModes[c.mode].keyless) {
+		var err error
+		keys, err = parseKeysArray(c.keysArg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keys = append(keys, presetKeys(c.presets)...)
+	keys, warnings, err := checkKeyList(append(keys, fileKeys...), c.mode, c.ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+	if c.warn != nil {
+		for _, w := range warnings {
+			c.warn(w.key, w.reason)
+		}
+	}
+	if scope != nil {
+		return c.scopedLineFunc(scope, keys)
+	}
+	return c.buildLineFunc(keys)
+}
+
+func (c *config) buildLineFunc(keys []string) (lineFunc, error) {
+	selected := transformModes[c.mode]
+	if c.personProperties {
+		if !personPropertyModes[c.mode] {
+			return nil, fmt.Errorf("-person-properties only works with -mode=drop, redact, hash and anonymize-ip")
+		}
+		if !c.recursive {
+			// -recursive matches them at any depth already
+			keys = personPropertyKeys(keys, c.mode == "drop")
+		}
+	}
+	pretty, err := parseOutputFormat(c.output)
+	if err != nil {
+		return nil, err
+	}
+	opts := c.transformOptions()
+	opts.document.duplicateKeys, err = parseDuplicateKeyPolicy(c.duplicateKeys)
+	if err != nil {
+		return nil, err
+	}
+	opts.document.nonObject, err = parseNonObjectPolicy(c.nonObject)
+	if err != nil {
+		return nil, err
+	}
+	opts.document.depth, err = parseDepthLimit(c.maxDepth, c.maxDepthAction)
+	if err != nil {
+		return nil, err
+	}
+	onError, err := parseErrorPolicy(c.onError)
+	if err != nil {
+		return nil, err
+	}
+	if c.dryRun != "" && c.mode != "drop" {
+		return nil, fmt.Errorf("-dry-run previews -mode=drop, it doesn't work with -mode=%s", c.mode)
+	}
+	if c.pathStats && c.mode != "drop" {
+		return nil, fmt.Errorf("-path-stats counts what -mode=drop drops, it doesn't work with -mode=%s", c.mode)
+	}
+	if c.dryRun != "" && c.encoding != "json" {
+		return nil, fmt.Errorf("-dry-run writes JSON, it doesn't work with -encoding=%s", c.encoding)
+	}
+	switch c.encoding {
+	case "json":
+	case "msgpack":
+		if selected.line != nil {
+			return nil, fmt.Errorf("-encoding=msgpack doesn't work with -mode=%s, only with modes that transform documents", c.mode)
+		}
+		if pretty || onError == errorEmpty {
+			return nil, fmt.Errorf("-encoding=msgpack can't be combined with -output=pretty or -on-error=empty, they write JSON")
+		}
+	default:
+		return nil, fmt.Errorf("unknown encoding %q, expected json or msgpack", c.encoding)
+	}
+	var process lineFunc
+	if selected.line != nil {
+		process, err = selected.line(opts)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		transform, err := selected.build(keys, opts)
+		if err != nil {
+			return nil, err
+		}
+		if c.dryRun != "" {
+			keyDict, err := newKeyDict(keys, opts.keyDict)
+			if err != nil {
+				return nil, err
+			}
+			transform = dryRunFunc(keyDict, c.dryRun == "count")
+		}
+		if c.encoding == "msgpack" {
+			process = msgpackLineFunc(transform, opts.document)
+		} else {
+			process = documentLineFunc(transform, opts.document)
+		}
+	}
+	if (c.prescan || c.verbatim) && c.mode == "drop" && c.dryRun == "" && c.encoding == "json" && opts.document == (documentOptions{}) {
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		if verbatim := newVerbatimLineFunc(keyDict, process); c.verbatim && verbatim != nil {
+			process = verbatim
+		}
+		if p := newPrescan(keyDict); c.prescan && p != nil {
+			process = prescanLineFunc(p, process)
+		}
+	}
+	if pretty {
+		process = prettyLineFunc(process, selected.tsv)
+	}
+	if c.format == "tsv" && !selected.tsv && onError != errorTuple {
+		// -on-error=tuple rows are TabSeparated already
+		process = escapedLineFunc(process)
+	}
+	if c.nullable && !selected.tsv {
+		if onError == errorTuple {
+			return nil, fmt.Errorf("-nullable can't be combined with -on-error=tuple")
+		}
+		process = nullableLineFunc(process)
+	}
+	return onErrorLineFunc(process, onError, selected.tsv), nil
+}
@@ -0,0 +1,162 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// flattenOptions configure flatten
+type flattenOptions struct {
+	// delimiter joins the keys of a path, "." by default
+	delimiter string
+	// indexArrays flattens array elements into keys with their index, e.g. {"a":[1]} into
+	// {"a.0":1}, otherwise arrays are kept as values
+	indexArrays bool
+}
+
+// parseArrayPolicy parses the -arrays flag, index or keep
+func parseArrayPolicy(s string) (indexArrays bool, err error) {
+	switch s {
+	case "index":
+		return true, nil
+	case "keep":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown array policy %q, expected index or keep", s)
+	}
+}
+
+// flattenFunc turns nested objects into top-level keys joined by the delimiter, e.g.
+// {"a":{"b":1}} into {"a.b":1}, so the result fits a Map(String, String) column. Empty objects
+// and arrays are kept as values, there's nothing to flatten them into.
+func flattenFunc(opts flattenOptions) transformFunc {
+	return func(n node) node {
+		if arr, ok := n.(*arrayNode); ok {
+			for i, value := range arr.values {
+				arr.values[i] = flatten(value, opts)
+			}
+			return arr
+		}
+		return flatten(n, opts)
+	}
+}
+
+func flatten(n node, opts flattenOptions) node {
+	obj, ok := n.(*objectNode)
+	if !ok {
+		return n
+	}
+	flat := objectNodePool.Get().(*objectNode)
+	flat.entries = flat.entries[:0]
+	for _, entry := range obj.entries {
+		flattenInto(flat, entry.key, entry.value, opts)
+	}
+	obj.entries = obj.entries[:0]
+	objectNodePool.Put(obj)
+	return flat
+}
+
+func flattenInto(flat *objectNode, key string, value node, opts flattenOptions) {
+	switch v := value.(type) {
+	case *objectNode:
+		if len(v.entries) == 0 {
+			break
+		}
+		for _, entry := range v.entries {
+			flattenInto(flat, key+opts.delimiter+entry.key, entry.value, opts)
+		}
+		v.entries = v.entries[:0]
+		objectNodePool.Put(v)
+		return
+	case *arrayNode:
+		if !opts.indexArrays || len(v.values) == 0 {
+			break
+		}
+		for i, element := range v.values {
+			flattenInto(flat, key+opts.delimiter+strconv.Itoa(i), element, opts)
+		}
+		v.values = v.values[:0]
+		arrayNodePool.Put(v)
+		return
+	}
+	flat.entries = append(flat.entries, objectEntry{key: key, value: value})
+}
+
+// unflattenFunc is the inverse of flattenFunc, it turns delimited keys into nested objects, e.g.
+// {"a.b":1,"a.c":2} into {"a":{"b":1,"c":2}}. With indexArrays the objects it creates whose keys
+// are exactly 0 to n-1 become arrays again.
+func unflattenFunc(opts flattenOptions) transformFunc {
+	return func(n node) node {
+		if arr, ok := n.(*arrayNode); ok {
+			for i, value := range arr.values {
+				arr.values[i] = unflatten(value, opts)
+			}
+			return arr
+		}
+		return unflatten(n, opts)
+	}
+}
+
+func unflatten(n node, opts flattenOptions) node {
+	obj, ok := n.(*objectNode)
+	if !ok || opts.delimiter == "" {
+		return n
+	}
+	entries := obj.entries
+	obj.entries = make([]objectEntry, 0, len(entries))
+	index := make(map[mergeKey]*objectNode)
+	created := make(map[*objectNode]bool)
+	for _, entry := range entries {
+		parent := obj
+		key := entry.key
+		for {
+			end := strings.Index(key, opts.delimiter)
+			if end < 0 {
+				break
+			}
+			head := key[:end]
+			key = key[end+len(opts.delimiter):]
+			child := index[mergeKey{parent: parent, key: head}]
+			if child == nil {
+				child = objectNodePool.Get().(*objectNode)
+				child.entries = child.entries[:0]
+				created[child] = true
+				appendEntry(parent, &parent.entries, head, child, index)
+			}
+			parent = child
+		}
+		appendEntry(parent, &parent.entries, key, entry.value, index)
+	}
+	if opts.indexArrays {
+		return indexedToArrays(obj, created)
+	}
+	return obj
+}
+
+// indexedToArrays replaces the objects in created whose keys are exactly 0 to n-1 with arrays
+func indexedToArrays(n node, created map[*objectNode]bool) node {
+	obj, ok := n.(*objectNode)
+	if !ok {
+		return n
+	}
+	for i := range obj.entries {
+		obj.entries[i].value = indexedToArrays(obj.entries[i].value, created)
+	}
+	if !created[obj] {
+		return obj
+	}
+	values := make([]node, len(obj.entries))
+	for _, entry := range obj.entries {
+		i, err := strconv.Atoi(entry.key)
+		if err != nil || i < 0 || i >= len(values) || values[i] != nil || strconv.Itoa(i) != entry.key {
+			return obj
+		}
+		values[i] = entry.value
+	}
+	arr := arrayNodePool.Get().(*arrayNode)
+	arr.values = append(arr.values[:0], values...)
+	obj.entries = obj.entries[:0]
+	objectNodePool.Put(obj)
+	return arr
+}
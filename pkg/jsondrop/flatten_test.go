@@ -0,0 +1,128 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenJSON(t *testing.T) {
+	dotted := flattenOptions{delimiter: ".", indexArrays: true}
+	cases := []struct {
+		name, input, want string
+		opts              flattenOptions
+	}{
+		{
+			name:  "nested objects",
+			input: `{"a":{"b":1,"c":{"d":"x"}},"e":true}`,
+			want:  `{"a.b":1,"a.c.d":"x","e":true}`,
+			opts:  dotted,
+		},
+		{
+			name:  "arrays indexed",
+			input: `{"a":[1,{"b":2}]}`,
+			want:  `{"a.0":1,"a.1.b":2}`,
+			opts:  dotted,
+		},
+		{
+			name:  "arrays kept",
+			input: `{"a":[1,{"b":{"c":2}}],"d":{"e":3}}`,
+			want:  `{"a":[1,{"b":{"c":2}}],"d.e":3}`,
+			opts:  flattenOptions{delimiter: "."},
+		},
+		{
+			name:  "custom delimiter",
+			input: `{"a":{"b":{"c":1}}}`,
+			want:  `{"a__b__c":1}`,
+			opts:  flattenOptions{delimiter: "__", indexArrays: true},
+		},
+		{
+			name:  "empty containers stay",
+			input: `{"a":{},"b":[],"c":{"d":{}}}`,
+			want:  `{"a":{},"b":[],"c.d":{}}`,
+			opts:  dotted,
+		},
+		{
+			name:  "top-level array elements are documents",
+			input: `[{"a":{"b":1}},2]`,
+			want:  `[{"a.b":1},2]`,
+			opts:  dotted,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(flattenFunc(c.opts), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestUnflattenJSON(t *testing.T) {
+	dotted := flattenOptions{delimiter: ".", indexArrays: true}
+	cases := []struct {
+		name, input, want string
+		opts              flattenOptions
+	}{
+		{
+			name:  "dotted keys",
+			input: `{"a.b":1,"a.c.d":"x","e":true}`,
+			want:  `{"a":{"b":1,"c":{"d":"x"}},"e":true}`,
+			opts:  dotted,
+		},
+		{
+			name:  "merges into existing objects",
+			input: `{"a":{"b":1},"a.c":2}`,
+			want:  `{"a":{"b":1,"c":2}}`,
+			opts:  dotted,
+		},
+		{
+			name:  "indexes become arrays",
+			input: `{"a.1.b":2,"a.0":1}`,
+			want:  `{"a":[1,{"b":2}]}`,
+			opts:  dotted,
+		},
+		{
+			name:  "gaps in indexes stay objects",
+			input: `{"a.0":1,"a.2":2}`,
+			want:  `{"a":{"0":1,"2":2}}`,
+			opts:  dotted,
+		},
+		{
+			name:  "indexes stay objects without indexArrays",
+			input: `{"a.0":1}`,
+			want:  `{"a":{"0":1}}`,
+			opts:  flattenOptions{delimiter: "."},
+		},
+		{
+			name:  "objects that were in the input are left alone",
+			input: `{"a":{"0":1}}`,
+			want:  `{"a":{"0":1}}`,
+			opts:  dotted,
+		},
+		{
+			name:  "custom delimiter",
+			input: `{"a__b":1,"c.d":2}`,
+			want:  `{"a":{"b":1},"c.d":2}`,
+			opts:  flattenOptions{delimiter: "__", indexArrays: true},
+		},
+		{
+			name:  "round trip",
+			input: `{"a.b":1,"a.c.0":2,"a.c.1":3,"a.d":{}}`,
+			want:  `{"a":{"b":1,"c":[2,3],"d":{}}}`,
+			opts:  dotted,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(unflattenFunc(c.opts), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package jsondrop
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// udfFunctions are the flags of the functions in udf/, so a single binary can serve all of them:
+// installed under a function's name, e.g. as a JSONRedactKeys or json_redact_keys symlink, it
+// runs as that function, and -mode=dispatch rows can name one
+var udfFunctions = map[string][]string{
+	"JSONAnonymizeIP":      {"-mode=anonymize-ip"},
+	"JSONArrayFilter":      {"-mode=array-filter", "-where=!(@.tag_name=='input')"},
+	"JSONCoerceNumbers":    {"-mode=coerce-numbers"},
+	"JSONCountKeys":        {"-mode=count-keys"},
+	"JSONDiff":             {"-mode=diff"},
+	"JSONDropByType":       {"-mode=drop-by-type"},
+	"JSONDropByValue":      {"-mode=drop-by-value"},
+	"JSONDropEmpty":        {"-mode=drop-empty"},
+	"JSONDropKeys":         {"-mode=drop"},
+	"JSONDropKeysNullable": {"-mode=drop", "-nullable", "-on-error=null"},
+	"JSONDropKeysOrError":  {"-mode=drop", "-on-error=tuple"},
+	"JSONDropNulls":        {"-mode=drop-nulls", "-recursive"},
+	"JSONErase":            {"-mode=erase", "-erasures=/etc/clickhouse-server/erasures.yaml"},
+	"JSONExtractPaths":     {"-mode=extract"},
+	"JSONFlatten":          {"-mode=flatten"},
+	"JSONHashValues":       {"-mode=hash"},
+	"JSONIsValid":          {"-mode=validate"},
+	"JSONKeepKeys":         {"-mode=keep"},
+	"JSONListPaths":        {"-mode=list-paths"},
+	"JSONMaskPII":          {"-mode=mask-pii"},
+	"JSONMergePatch":       {"-mode=merge-patch"},
+	"JSONPromote":          {"-mode=promote"},
+	"JSONPruneDepth":       {"-mode=prune-depth", "-depth=32"},
+	"JSONRedactKeys":       {"-mode=redact"},
+	"JSONRenameKeys":       {"-mode=rename"},
+	"JSONScrubElements":    {"-mode=elements-chain", "-chain-attributes=attr__value"},
+	"JSONSetDefaults":      {"-mode=set-defaults"},
+	"JSONShrinkToSize":     {"-mode=shrink", "-max-bytes=65536"},
+	"JSONSortKeys":         {"-mode=sort-keys"},
+	"JSONTransformKeys":    {"-mode=transform-keys", "-case=snake"},
+	"JSONTruncateStrings":  {"-mode=truncate", "-max-string-bytes=1024"},
+	"JSONUnflatten":        {"-mode=unflatten"},
+	"JSONValidationError":  {"-mode=validate", "-report-errors"},
+	"JSONWrap":             {"-mode=wrap", "-wrap-key=properties"},
+}
+
+// udfParameters are the query parameters the functions in udf/ take their key argument from,
+// where it isn't keys_parameter or the mode doesn't need one
+var udfParameters = map[string]string{
+	"JSONArrayFilter":     "paths_parameter",
+	"JSONCoerceNumbers":   "paths_parameter",
+	"JSONCountKeys":       "paths_parameter",
+	"JSONDropByType":      "paths_parameter",
+	"JSONDropByValue":     "values_parameter",
+	"JSONExtractPaths":    "paths_parameter",
+	"JSONPromote":         "paths_parameter",
+	"JSONRenameKeys":      "mappings_parameter",
+	"JSONScrubElements":   "paths_parameter",
+	"JSONShrinkToSize":    "paths_parameter",
+	"JSONTruncateStrings": "paths_parameter",
+	"JSONWrap":            "paths_parameter",
+}
+
+// functionArgs returns the flags for a function or mode name. Function names are matched
+// ignoring case, _ and -, so JSONDropNulls, json_drop_nulls and jsondropnulls are the same.
+func functionArgs(name string) ([]string, bool) {
+	if _, ok := transformModes[name]; ok {
+		return []string{"-mode=" + name}, true
+	}
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	name = normalize(name)
+	for function, args := range udfFunctions {
+		if normalize(function) == name {
+			return args, true
+		}
+	}
+	return nil, false
+}
+
+// programFunctionArgs returns the flags for the function the binary is installed as, nothing for
+// json_drop_keys_udf or any other name that isn't a function's
+func programFunctionArgs(program string) []string {
+	name := strings.TrimSuffix(filepath.Base(program), filepath.Ext(program))
+	if name == "json_drop_keys_udf" {
+		return nil
+	}
+	args, _ := functionArgs(name)
+	return args
+}
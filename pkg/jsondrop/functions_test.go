@@ -0,0 +1,64 @@
+package jsondrop
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctionArgs(t *testing.T) {
+	for _, name := range []string{"JSONDropNulls", "json_drop_nulls", "jsondropnulls", "json-drop-nulls"} {
+		args, ok := functionArgs(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, []string{"-mode=drop-nulls", "-recursive"}, args, name)
+	}
+	args, ok := functionArgs("redact")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"-mode=redact"}, args)
+	_, ok = functionArgs("JSONNope")
+	assert.False(t, ok)
+
+	assert.Nil(t, programFunctionArgs("/var/lib/clickhouse/user_scripts/json_drop_keys_udf"))
+	assert.Equal(t, []string{"-mode=redact"}, programFunctionArgs("/usr/bin/json_redact_keys"))
+	assert.Nil(t, programFunctionArgs("./something_else"))
+}
+
+// TestUDFFunctionsMatchXML keeps udfFunctions in sync with the flags in udf/
+func TestUDFFunctionsMatchXML(t *testing.T) {
+	paths, err := filepath.Glob("../../udf/*_function.xml")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, paths)
+	seen := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		var doc struct {
+			Functions []struct {
+				Name    string `xml:"name"`
+				Command string `xml:"command"`
+			} `xml:"function"`
+		}
+		assert.NoError(t, xml.Unmarshal(data, &doc), path)
+		for _, f := range doc.Functions {
+			flags := []string{}
+			for _, field := range strings.Fields(f.Command)[1:] {
+				if strings.HasPrefix(field, "-") {
+					flags = append(flags, field)
+				}
+			}
+			if len(flags) == 0 || !strings.HasPrefix(flags[0], "-mode=") {
+				flags = append([]string{"-mode=drop"}, flags...)
+			}
+			if flags[0] == "-mode="+dispatchMode {
+				continue
+			}
+			assert.Equal(t, flags, udfFunctions[f.Name], f.Name)
+			seen++
+		}
+	}
+	assert.Equal(t, len(udfFunctions), seen)
+}
@@ -0,0 +1,136 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fastjson"
+)
+
+// fuzzSeeds are the rows in testdata and the replay corpus's inputs, the corpus the fuzz targets
+// start from
+func fuzzSeeds(f *testing.F) [][]byte {
+	paths, err := filepath.Glob("../../testdata/*.*")
+	if err != nil {
+		f.Fatal(err)
+	}
+	inputs, err := filepath.Glob("../../testdata/replay/*/" + caseInput)
+	if err != nil {
+		f.Fatal(err)
+	}
+	var rows [][]byte
+	for _, path := range append(paths, inputs...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			rows = append(rows, slices.Clone(scanner.Bytes()))
+		}
+	}
+	return append(rows,
+		[]byte(`{"a":{"b":[1,{"c":"é😀"}]},"a.b":null}`),
+		[]byte(`[{"a":1},{"a":[[[]]]}]`),
+		[]byte(`{"a\\.b":1,"":{"":""}}`),
+		[]byte(`{"a":1`),
+		[]byte(strings.Repeat("[", 2000)+strings.Repeat("]", 2000)),
+	)
+}
+
+// fuzzKeys are key arguments in the syntaxes the keys take
+var fuzzKeys = []string{
+	`['a']`,
+	`['a.b', 'items[*].secret', 'obj.x']`,
+	`['*.k', '**.tag', 'deep:name']`,
+	`['re:^\$ph_.*', 'prefix:$', 'suffix:_token']`,
+	`['[?(@.type==\'secret\')]', 'meta?(@.tag==\'x\')']`,
+	`['/a/0', '$.payload.a', 'flags[-1]']`,
+	`["a\\.b", "id"]`,
+}
+
+// FuzzProcessLine checks that any row and key argument either fail or give valid JSON that parses
+// again. Dropping them again may well change it, array indexes shift.
+func FuzzProcessLine(f *testing.F) {
+	for _, row := range fuzzSeeds(f) {
+		for _, keys := range fuzzKeys {
+			f.Add(row, keys)
+		}
+	}
+	f.Fuzz(func(t *testing.T, row []byte, keys string) {
+		paths, err := parseKeysArray(keys)
+		if err != nil {
+			return
+		}
+		keyDict, err := makeKeyDict(paths)
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := processLine(keyDict, row, &buf); err != nil {
+			return
+		}
+		if err := fastjson.ValidateBytes(buf.Bytes()); err != nil {
+			t.Fatalf("invalid output %q for %q: %v", buf.Bytes(), row, err)
+		}
+		first := slices.Clone(buf.Bytes())
+		if err := processLine(keyDict, first, &buf); err != nil {
+			t.Fatalf("output %q doesn't parse: %v", first, err)
+		}
+	})
+}
+
+// FuzzParseKeysArray checks that the keys of any key argument that parses come back the same
+// quoted the way ClickHouse quotes them
+func FuzzParseKeysArray(f *testing.F) {
+	for _, keys := range fuzzKeys {
+		f.Add(keys)
+	}
+	f.Add(`[]`)
+	f.Add(`['it\'s', 'a\\b', '']`)
+	f.Add(`['unterminated`)
+	f.Add(`["a", 1]`)
+	f.Fuzz(func(t *testing.T, s string) {
+		keys, err := parseKeysArray(s)
+		if err != nil {
+			return
+		}
+		quoted := make([]string, len(keys))
+		for i, key := range keys {
+			quoted[i] = sqlString(key)
+		}
+		again, err := parseSingleQuotedArray("[" + strings.Join(quoted, ", ") + "]")
+		if err != nil {
+			t.Fatalf("keys %q of %q don't parse quoted: %v", keys, s, err)
+		}
+		if !slices.Equal(keys, again) {
+			t.Fatalf("keys %q of %q came back as %q", keys, s, again)
+		}
+	})
+}
+
+// FuzzUnescapeTSV checks that any column survives being escaped and unescaped, and that any
+// escapes at all unescape
+func FuzzUnescapeTSV(f *testing.F) {
+	for _, row := range fuzzSeeds(f) {
+		f.Add(row)
+	}
+	f.Add([]byte(`a\tb\\c\x41\xzz\0\`))
+	f.Add([]byte("tab\there\nnewline\r\b\f\x00"))
+	f.Fuzz(func(t *testing.T, field []byte) {
+		unescapeTSV(field)
+		var buf bytes.Buffer
+		writeTSVEscaped(&buf, field)
+		if bytes.ContainsAny(buf.Bytes(), "\t\n") {
+			t.Fatalf("escaped %q still has a tab or newline: %q", field, buf.Bytes())
+		}
+		if got := unescapeTSV(buf.Bytes()); !bytes.Equal(got, field) {
+			t.Fatalf("%q escaped as %q unescapes to %q", field, buf.Bytes(), got)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package jsondrop
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// genconfigCommand is the first argument that prints a function's XML config instead of running
+// the UDF
+const genconfigCommand = "genconfig"
+
+// clickhouseFormats are the ClickHouse names of the -format values
+var clickhouseFormats = map[string]string{
+	"raw":         "Raw",
+	"tsv":         "TabSeparated",
+	"csv":         "CSV",
+	"rowbinary":   "RowBinary",
+	"native":      "Native",
+	"arrowstream": "ArrowStream",
+}
+
+// argumentNames are the names of the arguments of the modes taking more than one, in the order
+// their columns are read
+var argumentNames = map[string][]string{
+	"merge-patch":  {"target", "patch"},
+	"set-defaults": {"document", "defaults"},
+	"diff":         {"before", "after"},
+	eraseMode:      {"json", "distinct_id"},
+	dispatchMode:   {"function", "json", "keys"},
+}
+
+// genconfigOptions are the genconfig flags that describe the function rather than its rows
+type genconfigOptions struct {
+	name, command, parameter  string
+	poolSize, terminationTime int
+}
+
+// runGenconfig is the genconfig subcommand: it prints the <functions> file declaring a function
+// that runs the binary with the same flags the UDF takes, its arguments, return type and format
+// worked out from them, so the declaration can't disagree with what the binary reads and writes.
+// -format also takes ClickHouse's format names, e.g. TabSeparated.
+func runGenconfig(args []string, stdout, stderr io.Writer) int {
+	c := &config{}
+	fs := newFlagSet(c)
+	fs.Init(genconfigCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var opts genconfigOptions
+	fs.StringVar(&opts.name, "name", "", "the name of the function")
+	fs.StringVar(&opts.command, "command", "json_drop_keys_udf", "the binary the function runs, a name in user_scripts_path or a path")
+	fs.StringVar(&opts.parameter, "parameter", "", "the name of the query parameter passing the key argument, keys_parameter for the modes that need keys, none for the others and with -team-keys or -event-keys")
+	fs.IntVar(&opts.poolSize, "pool-size", 0, "declare an executable_pool of this many processes instead of an executable, 0 for an executable")
+	fs.IntVar(&opts.terminationTime, "command-termination-timeout", 0, "the seconds ClickHouse waits for a pooled process to exit before sending it SIGTERM, 0 for its default")
+	if err := c.parseFlags(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if err := genconfig(stdout, c, opts, args, fs.NArg()); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// functionSignature is how ClickHouse has to declare a function for the rows the binary reads
+// and writes with a config's flags
+type functionSignature struct {
+	format, returnType string
+	arguments          []functionArgument
+}
+
+type functionArgument struct {
+	typ, name string
+}
+
+// signature checks the flags the way the UDF does and works out the function's signature from
+// them. -format also takes ClickHouse's format names, it's set to the flag's value for them.
+func (c *config) signature() (functionSignature, error) {
+	for value, name := range clickhouseFormats {
+		if strings.EqualFold(c.format, name) {
+			c.format = value
+		}
+	}
+	if _, ok := transformModes[c.mode]; !ok && c.mode != dispatchMode {
+		return functionSignature{}, fmt.Errorf("unknown mode %q", c.mode)
+	}
+	if _, err := parseErrorPolicy(c.onError); err != nil {
+		return functionSignature{}, err
+	}
+	layout, err := c.rowLayout()
+	if err != nil {
+		return functionSignature{}, err
+	}
+	if scope := c.keyScope(); scope != nil {
+		if err := c.checkKeyScope(); err != nil {
+			return functionSignature{}, err
+		}
+		// the document and the column its keys are picked by
+		document := functionArgument{typ: "String", name: "json"}
+		if c.nullable {
+			document.typ = "Nullable(String)"
+		}
+		return functionSignature{
+			format:     clickhouseFormats["tsv"],
+			returnType: c.returnType(true, false),
+			arguments:  []functionArgument{document, {typ: scope.typ, name: scope.column}},
+		}, nil
+	}
+
+	// Raw and TabSeparated rows are the mode's own, only the binary formats have a column count
+	tsv := c.mode == dispatchMode || transformModes[c.mode].tsv
+	columns := 1
+	switch {
+	case layout != nil:
+		columns = layout.columns
+	case tsv:
+		columns = len(argumentNames[c.mode])
+	}
+	s := functionSignature{format: clickhouseFormats[c.format], returnType: c.returnType(layout == nil, tsv)}
+	if c.format == "raw" && (tsv || c.onError == "tuple") {
+		s.format = clickhouseFormats["tsv"]
+	}
+	for i := 0; i < columns; i++ {
+		argument := functionArgument{typ: "String"}
+		switch {
+		case c.nullable && !tsv:
+			argument.typ = "Nullable(String)"
+		case c.mode == dispatchMode && i == 2 && layout == nil:
+			// a TabSeparated Array(String) is the text form of the key argument
+			argument.typ = "Array(String)"
+		}
+		if names := argumentNames[c.mode]; i < len(names) {
+			argument.name = names[i]
+		}
+		s.arguments = append(s.arguments, argument)
+	}
+	return s, nil
+}
+
+// genconfig checks the flags the way the UDF does and writes the function's config to w. args
+// are the genconfig arguments, positional the number of them after the flags.
+func genconfig(w io.Writer, c *config, opts genconfigOptions, args []string, positional int) error {
+	if opts.name == "" {
+		return fmt.Errorf("genconfig needs -name")
+	}
+	if positional > 0 {
+		return fmt.Errorf("genconfig takes no key argument, the function's is the query parameter -parameter names")
+	}
+	if opts.poolSize < 0 || opts.terminationTime < 0 {
+		return fmt.Errorf("-pool-size and -command-termination-timeout must be at least 0")
+	}
+	if opts.poolSize == 0 && opts.terminationTime > 0 {
+		return fmt.Errorf("-command-termination-timeout needs -pool-size")
+	}
+	signature, err := c.signature()
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	out.WriteString("<functions>\n    <function>\n")
+	typ := "executable"
+	if opts.poolSize > 0 {
+		typ = "executable_pool"
+	}
+	writeXMLElement(&out, "        ", "type", typ)
+	writeXMLElement(&out, "        ", "name", opts.name)
+	writeXMLElement(&out, "        ", "return_type", signature.returnType)
+	for _, argument := range signature.arguments {
+		out.WriteString("        <argument>\n")
+		writeXMLElement(&out, "            ", "type", argument.typ)
+		if argument.name != "" {
+			writeXMLElement(&out, "            ", "name", argument.name)
+		}
+		out.WriteString("        </argument>\n")
+	}
+	writeXMLElement(&out, "        ", "format", signature.format)
+	if opts.poolSize > 0 {
+		writeXMLElement(&out, "        ", "pool_size", fmt.Sprint(opts.poolSize))
+	}
+	if c.chunkHeader {
+		writeXMLElement(&out, "        ", "send_chunk_header", "true")
+	}
+	if opts.terminationTime > 0 {
+		writeXMLElement(&out, "        ", "command_termination_timeout", fmt.Sprint(opts.terminationTime))
+	}
+	writeXMLElement(&out, "        ", "command", opts.commandLine(c, args))
+	out.WriteString("    </function>\n</functions>\n")
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// returnType is the ClickHouse type of the function's result. The modes writing numbers only
+// return them as numbers in text rows, the other formats write every result as a String.
+func (c *config) returnType(text, tsv bool) string {
+	switch {
+	case c.onError == "tuple" && c.mode != dispatchMode:
+		return "Tuple(result String, error String)"
+	case c.nullable && !tsv:
+		return "Nullable(String)"
+	case text && c.mode == "validate" && !c.reportErrors:
+		return "UInt8"
+	case text && (c.mode == "count-keys" || c.dryRun == "count"):
+		return "UInt64"
+	}
+	return "String"
+}
+
+// commandLine is the <command> running the binary with the UDF's flags from args
+func (opts genconfigOptions) commandLine(c *config, args []string) string {
+	words := []string{opts.command}
+	if c.format != "raw" {
+		words = append(words, "-format="+c.format)
+	}
+	words = append(words, stripFlags(args, "name", "command", "parameter", "pool-size", "command-termination-timeout", "format")...)
+	parameter := opts.parameter
+	if parameter == "" && c.mode != dispatchMode && c.keyScope() == nil && !transformModes[c.mode].keyless {
+		parameter = "keys_parameter"
+	}
+	if parameter != "" {
+		words = append(words, "{"+parameter+":Array(String)}")
+	}
+	return strings.Join(words, " ")
+}
+
+// writeXMLElement writes an element holding text on a line of its own. Only what XML can't have
+// in text is escaped, so commands read the same as in hand-written configs.
+func writeXMLElement(out *strings.Builder, indent, name, text string) {
+	text = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+	fmt.Fprintf(out, "%s<%s>%s</%s>\n", indent, name, text, name)
+}
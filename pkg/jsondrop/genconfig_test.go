@@ -0,0 +1,82 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGenconfigShippedFunctions regenerates every config in udf/ from the flags in its command,
+// so they stay in sync with what the binary reads and writes
+func TestGenconfigShippedFunctions(t *testing.T) {
+	files, err := filepath.Glob("../../udf/*_function.xml")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+	command := regexp.MustCompile(`<command>json_drop_keys_udf(.*)</command>`)
+	parameter := regexp.MustCompile(`^\{(\w+):Array\(String\)\}$`)
+	for _, file := range files {
+		want, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		name := strings.TrimSuffix(filepath.Base(file), "_function.xml")
+		args := []string{"-name=" + name}
+		for _, word := range strings.Fields(command.FindStringSubmatch(string(want))[1]) {
+			if m := parameter.FindStringSubmatch(word); m != nil {
+				word = "-parameter=" + m[1]
+			}
+			args = append(args, word)
+		}
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, runGenconfig(args, &stdout, &stderr), "%s: %s", name, stderr.String())
+		assert.Equal(t, string(want), stdout.String(), name)
+	}
+}
+
+func TestGenconfig(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runGenconfig([]string{"--name", "json_drop_keys", "--format", "TabSeparated", "-pool-size=16",
+		"-chunk-header", "-command-termination-timeout=10", "-command=/usr/bin/json_drop_keys_udf"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, `<functions>
+    <function>
+        <type>executable_pool</type>
+        <name>json_drop_keys</name>
+        <return_type>String</return_type>
+        <argument>
+            <type>String</type>
+        </argument>
+        <format>TabSeparated</format>
+        <pool_size>16</pool_size>
+        <send_chunk_header>true</send_chunk_header>
+        <command_termination_timeout>10</command_termination_timeout>
+        <command>/usr/bin/json_drop_keys_udf -format=tsv -chunk-header {keys_parameter:Array(String)}</command>
+    </function>
+</functions>
+`, stdout.String())
+
+	stdout.Reset()
+	code = runGenconfig([]string{"-name=f", "-format=RowBinary", "-mode=validate", "-nullable", "-on-error=null",
+		"-where=a&&b"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "<return_type>Nullable(String)</return_type>")
+	assert.Contains(t, stdout.String(), "<type>Nullable(String)</type>")
+	assert.Contains(t, stdout.String(), "<format>RowBinary</format>")
+	assert.Contains(t, stdout.String(), "<command>json_drop_keys_udf -format=rowbinary -mode=validate -nullable -on-error=null -where=a&amp;&amp;b</command>")
+
+	for _, args := range [][]string{
+		{},
+		{"-name=f", "['a']"},
+		{"-name=f", "-mode=nope"},
+		{"-name=f", "-format=xml"},
+		{"-name=f", "-format=native", "-chunk-header"},
+		{"-name=f", "-command-termination-timeout=10"},
+	} {
+		stderr.Reset()
+		assert.Equal(t, 2, runGenconfig(args, &stdout, &stderr), args)
+		assert.NotEmpty(t, stderr.String(), args)
+	}
+}
@@ -0,0 +1,354 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// A gRPC call is an HTTP/2 POST to /package.Service/Method. Its body and the response's are
+// messages, each a byte that's 1 for a compressed one, its length as 4 big endian bytes and its
+// protobuf encoding, and the call's status is in the grpc-status and grpc-message trailers,
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md. proto/json_drop_keys.proto
+// declares the service.
+
+// grpcCommand is the first argument that serves the transforms over gRPC instead of running the
+// UDF
+const grpcCommand = "grpc"
+
+// grpcService is the path of the service's methods
+const grpcService = "/jsondropkeys.v1.JSONDropKeys/"
+
+// grpcMethods are the modes the service's methods run
+var grpcMethods = map[string]string{
+	"DropKeys": "drop",
+	"KeepKeys": "keep",
+	"Redact":   "redact",
+}
+
+// maxGRPCMessage is the longest message read, gRPC's default is 4MiB
+const maxGRPCMessage = 64 << 20
+
+// gRPC status codes, https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcResourceLimit   = 8
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// runGRPC is the grpc subcommand: it serves the service in proto/json_drop_keys.proto over
+// HTTP/2 without TLS, each method a stream transforming documents with the same flags the UDF
+// takes, bar -mode, which is the method's
+func runGRPC(args []string, stderr io.Writer) int {
+	c := &config{}
+	fs := newFlagSet(c)
+	fs.Init(grpcCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	listen := fs.String("listen", ":9090", "the address to serve on")
+	if err := c.parseFlags(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "grpc takes no arguments, the keys are in the requests")
+		return 2
+	}
+	log, logFile, err := c.newLogger(stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 2
+	}
+	if logFile != nil {
+		defer logFile.Close()
+		reopenOnHangup(log, logFile)
+	}
+	server, err := newGRPCServer(c)
+	if err != nil {
+		log.Error("grpc error", "error", err.Error())
+		return 2
+	}
+	server.log = log
+
+	srv := &http.Server{Addr: *listen, Handler: server, Protocols: new(http.Protocols)}
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	stopped := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Warn("stopping on signal", "signal", sig.String())
+		// calls in flight are finished first
+		_ = srv.Shutdown(context.Background())
+		close(stopped)
+	}()
+	log.Info("serving gRPC", "listen", *listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Error("grpc error", "error", (&listenError{"listen", err}).Error())
+		return 1
+	}
+	<-stopped
+	return 0
+}
+
+// grpcServer runs the service's calls
+type grpcServer struct {
+	config   *config
+	fileKeys []string
+	log      *slog.Logger
+}
+
+func newGRPCServer(c *config) (*grpcServer, error) {
+	if c.format != "raw" {
+		return nil, fmt.Errorf("grpc reads documents from messages, -format=%s doesn't apply", c.format)
+	}
+	if c.onError == "tuple" || c.onError == "null" || c.encoding != "json" {
+		return nil, fmt.Errorf("grpc responses have a document and an error, -on-error=%s and -encoding don't apply", c.onError)
+	}
+	s := &grpcServer{config: c, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	if c.keysFile != "" {
+		var err error
+		if s.fileKeys, err = (&keysFile{path: c.keysFile}).read(); err != nil {
+			return nil, err
+		}
+	}
+	for _, mode := range grpcMethods {
+		if _, err := s.lineFunc(mode, []string{}); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// lineFunc builds the transform for a method's mode and a call's keys
+func (s *grpcServer) lineFunc(mode string, keys []string) (lineFunc, error) {
+	c := *s.config
+	c.mode = mode
+	array, _ := json.Marshal(keys)
+	c.keysArg = string(array)
+	return c.lineFunc(s.fileKeys, c.keysFile != "")
+}
+
+func (s *grpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method, _ := strings.CutPrefix(r.URL.Path, grpcService)
+	mode, ok := grpcMethods[method]
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC calls are POSTed application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	if !ok {
+		// a response with only headers carries the status in them
+		w.Header().Set("Grpc-Status", fmt.Sprint(grpcUnimplemented))
+		w.Header().Set("Grpc-Message", "unknown method "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	code, err := s.call(w, r.Body, mode)
+	w.Header().Set("Grpc-Status", fmt.Sprint(code))
+	if err != nil {
+		s.log.Warn("call failed", "method", method, "error", err.Error())
+		w.Header().Set("Grpc-Message", grpcPercentEncode(err.Error()))
+	}
+}
+
+// call answers every request message of a stream with a response, returning the call's status
+func (s *grpcServer) call(w http.ResponseWriter, body io.Reader, mode string) (int, error) {
+	r := bufio.NewReader(body)
+	flusher, _ := w.(http.Flusher)
+	var process lineFunc
+	var keys []string
+	var message, out []byte
+	var buf bytes.Buffer
+	for {
+		var err error
+		message, err = readGRPCMessage(r, message)
+		if err == io.EOF {
+			return grpcOK, nil
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, errGRPCTooLarge):
+				return grpcResourceLimit, err
+			case errors.Is(err, errGRPCCompressed):
+				return grpcUnimplemented, err
+			}
+			return grpcInternal, err
+		}
+		request, err := decodeTransformRequest(message)
+		if err != nil {
+			return grpcInvalidArgument, err
+		}
+		if process == nil || len(request.keys) > 0 && !slices.Equal(request.keys, keys) {
+			keys = slices.Clone(request.keys)
+			if keys == nil {
+				keys = []string{}
+			}
+			if process, err = s.lineFunc(mode, keys); err != nil {
+				return grpcInvalidArgument, fmt.Errorf("keysToDrop parse error: %w", err)
+			}
+		}
+		var response transformResponse
+		if err := process(request.document, &buf); err != nil {
+			response.error = err.Error()
+		} else {
+			response.document = buf.Bytes()
+		}
+		out = appendGRPCMessage(out[:0], response.appendProto)
+		if _, err := w.Write(out); err != nil {
+			return grpcInternal, err
+		}
+		// the next request may wait on this response, it's sent unless more are already here
+		if flusher != nil && r.Buffered() == 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+var (
+	errGRPCTooLarge   = fmt.Errorf("gRPC message is longer than %d bytes", maxGRPCMessage)
+	errGRPCCompressed = errors.New("gRPC message is compressed, compression isn't supported")
+)
+
+// readGRPCMessage reads the next message into buf, io.EOF if the stream ended between messages
+func readGRPCMessage(r *bufio.Reader, buf []byte) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, unexpectedEOF(err)
+	}
+	if header[0] != 0 {
+		return nil, errGRPCCompressed
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxGRPCMessage {
+		return nil, errGRPCTooLarge
+	}
+	buf = growBytes(buf, int(length))
+	_, err := io.ReadFull(r, buf)
+	return buf, unexpectedEOF(err)
+}
+
+// appendGRPCMessage appends the uncompressed message appendProto encodes to buf
+func appendGRPCMessage(buf []byte, appendProto func([]byte) []byte) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0, 0)
+	buf = appendProto(buf)
+	binary.BigEndian.PutUint32(buf[start+1:], uint32(len(buf)-start-5))
+	return buf
+}
+
+// grpcPercentEncode encodes a status message the way grpc-message has it
+func grpcPercentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// transformRequest is a TransformRequest message
+type transformRequest struct {
+	keys     []string
+	document []byte
+}
+
+// transformResponse is a TransformResponse message
+type transformResponse struct {
+	document []byte
+	error    string
+}
+
+// protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+var errMalformedProto = errors.New("malformed protobuf message")
+
+// decodeTransformRequest decodes a TransformRequest, skipping fields it doesn't have. document
+// is part of message.
+func decodeTransformRequest(message []byte) (transformRequest, error) {
+	var request transformRequest
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return request, errMalformedProto
+		}
+		message = message[n:]
+		var value []byte
+		switch tag & 7 {
+		case protoVarint:
+			if _, n = binary.Uvarint(message); n <= 0 {
+				return request, errMalformedProto
+			}
+		case protoFixed64:
+			n = 8
+		case protoFixed32:
+			n = 4
+		case protoBytes:
+			length, lengthSize := binary.Uvarint(message)
+			if lengthSize <= 0 || length > uint64(len(message)-lengthSize) {
+				return request, errMalformedProto
+			}
+			value = message[lengthSize : lengthSize+int(length)]
+			n = lengthSize + int(length)
+		default:
+			return request, errMalformedProto
+		}
+		if n > len(message) {
+			return request, errMalformedProto
+		}
+		message = message[n:]
+		switch {
+		case tag == 1<<3|protoBytes:
+			request.keys = append(request.keys, string(value))
+		case tag == 2<<3|protoBytes:
+			request.document = value
+		}
+	}
+	return request, nil
+}
+
+// appendProto appends the response's protobuf encoding to buf, leaving out empty fields as
+// proto3 does
+func (r transformResponse) appendProto(buf []byte) []byte {
+	buf = appendProtoBytes(buf, 1, r.document)
+	return appendProtoBytes(buf, 2, []byte(r.error))
+}
+
+func appendProtoBytes(buf []byte, field uint64, value []byte) []byte {
+	if len(value) == 0 {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, field<<3|protoBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
@@ -0,0 +1,152 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// appendProto encodes a TransformRequest
+func (r transformRequest) appendProto(buf []byte) []byte {
+	for _, key := range r.keys {
+		buf = appendProtoBytes(buf, 1, []byte(key))
+	}
+	return appendProtoBytes(buf, 2, r.document)
+}
+
+// decodeTransformResponse decodes a TransformResponse the way a client would
+func decodeTransformResponse(t *testing.T, message []byte) transformResponse {
+	var response transformResponse
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		length, m := binary.Uvarint(message[n:])
+		value := message[n+m : n+m+int(length)]
+		message = message[n+m+int(length):]
+		switch tag {
+		case 1<<3 | protoBytes:
+			response.document = value
+		case 2<<3 | protoBytes:
+			response.error = string(value)
+		default:
+			t.Fatalf("unexpected tag %d", tag)
+		}
+	}
+	return response
+}
+
+// grpcRequests is the body of a call sending requests
+func grpcRequests(requests ...transformRequest) []byte {
+	var body []byte
+	for _, request := range requests {
+		body = appendGRPCMessage(body, request.appendProto)
+	}
+	return body
+}
+
+// grpcCall makes a call over HTTP/2 without TLS, sending body and returning the responses and
+// the call's status
+func grpcCall(t *testing.T, flags []string, method string, body []byte) ([]transformResponse, string, string) {
+	c, err := parseConfig(flags)
+	assert.NoError(t, err)
+	server, err := newGRPCServer(c)
+	assert.NoError(t, err)
+	ts := httptest.NewUnstartedServer(server)
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{Protocols: ts.Config.Protocols}}
+	req, err := http.NewRequest(http.MethodPost, ts.URL+grpcService+method, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	var responses []transformResponse
+	r := bufio.NewReader(resp.Body)
+	for {
+		message, err := readGRPCMessage(r, nil)
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		responses = append(responses, decodeTransformResponse(t, message))
+	}
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	return responses, status, message
+}
+
+func TestGRPC(t *testing.T) {
+	responses, status, _ := grpcCall(t, nil, "DropKeys", grpcRequests(
+		transformRequest{keys: []string{"a", "b.c"}, document: []byte(`{"a":1,"b":{"c":2,"d":3}}`)},
+		transformRequest{document: []byte(`{"a":1`)},
+		transformRequest{document: []byte(`{"b":{"c":1},"e":2}`)},
+		transformRequest{keys: []string{"e"}, document: []byte(`{"a":1,"e":2}`)}))
+	assert.Equal(t, "0", status)
+	assert.Len(t, responses, 4)
+	assert.Equal(t, `{"b":{"d":3}}`, string(responses[0].document))
+	assert.Empty(t, responses[1].document)
+	assert.Contains(t, responses[1].error, "parse error")
+	assert.Equal(t, `{"b":{},"e":2}`, string(responses[2].document))
+	assert.Equal(t, `{"a":1}`, string(responses[3].document))
+
+	responses, status, _ = grpcCall(t, []string{"-placeholder=x"}, "Redact", grpcRequests(
+		transformRequest{keys: []string{"a"}, document: []byte(`{"a":1,"b":2}`)}))
+	assert.Equal(t, "0", status)
+	assert.Equal(t, `{"a":"x","b":2}`, string(responses[0].document))
+
+	responses, status, _ = grpcCall(t, nil, "KeepKeys", grpcRequests(
+		transformRequest{keys: []string{"a"}, document: []byte(`{"a":1,"b":2}`)}))
+	assert.Equal(t, "0", status)
+	assert.Equal(t, `{"a":1}`, string(responses[0].document))
+
+	_, status, message := grpcCall(t, nil, "Nope", nil)
+	assert.Equal(t, "12", status)
+	assert.Contains(t, message, "unknown method")
+
+	// a response is sent for every request before a malformed one
+	body := append(grpcRequests(transformRequest{document: []byte(`{}`)}), 0, 0, 0, 0, 1, 0x80)
+	responses, status, message = grpcCall(t, nil, "DropKeys", body)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, "3", status)
+	assert.Equal(t, errMalformedProto.Error(), message)
+
+	_, status, _ = grpcCall(t, nil, "DropKeys", []byte{1, 0, 0, 0, 0})
+	assert.Equal(t, "12", status)
+	_, status, _ = grpcCall(t, nil, "DropKeys", []byte{0, 0, 0, 0, 5, 1})
+	assert.Equal(t, "13", status)
+
+	for _, flags := range [][]string{{"-format=rowbinary"}, {"-on-error=tuple"}, {"-encoding=msgpack"}} {
+		c, err := parseConfig(flags)
+		assert.NoError(t, err)
+		_, err = newGRPCServer(c)
+		assert.Error(t, err, flags)
+	}
+}
+
+func TestDecodeTransformRequest(t *testing.T) {
+	// unknown fields of every wire type are skipped
+	message := []byte{3<<3 | protoVarint, 0x96, 0x01, 4<<3 | protoFixed32, 1, 2, 3, 4, 5<<3 | protoFixed64, 1, 2, 3, 4, 5, 6, 7, 8}
+	message = transformRequest{keys: []string{"a"}, document: []byte("{}")}.appendProto(message)
+	request, err := decodeTransformRequest(message)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, request.keys)
+	assert.Equal(t, "{}", string(request.document))
+
+	for _, message := range [][]byte{{2<<3 | protoBytes, 5, 'a'}, {4<<3 | protoFixed32, 1}, {0x80}, {1<<3 | 3}} {
+		_, err := decodeTransformRequest(message)
+		assert.Equal(t, errMalformedProto, err, message)
+	}
+}
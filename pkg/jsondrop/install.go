@@ -0,0 +1,223 @@
+package jsondrop
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// installCommand is the first argument that installs the binary and its functions instead of
+// running the UDF
+const installCommand = "install"
+
+// installBinary is the name the binary is installed under, the functions' commands run it by
+// that name from user_scripts_path
+const installBinary = "json_drop_keys_udf"
+
+// dispatchFunction is the function declared for -mode=dispatch, which isn't in udfFunctions as
+// it can't be dispatched to
+const dispatchFunction = "JSONTransform"
+
+// runInstall is the install subcommand: it copies the binary into ClickHouse's user scripts
+// directory, writes the config of every function in udf/ next to ClickHouse's config, with the
+// config.d file loading them, and checks ClickHouse will be able to get at them.
+func runInstall(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(installCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	scriptsDir := fs.String("user-scripts-dir", "/var/lib/clickhouse/user_scripts", "ClickHouse's user_scripts_path, where the binary is copied")
+	configDir := fs.String("config-dir", "/etc/clickhouse-server", "ClickHouse's config directory, the functions go in user_defined and the file loading them in config.d")
+	clickhouseUser := fs.String("user", "clickhouse", "the user ClickHouse runs as, checked to be able to read the configs and run the binary")
+	poolSize := fs.Int("pool-size", 0, "declare the functions as executable_pool of this many processes rather than executable, 0 for executable")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 || *poolSize < 0 {
+		fmt.Fprintln(stderr, "install takes no arguments, and -pool-size of at least 0")
+		return 2
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(stderr, "install error: %v\n", err)
+		return 1
+	}
+	installed, err := install(binary, *scriptsDir, *configDir, *poolSize)
+	for _, path := range installed {
+		fmt.Fprintln(stdout, path)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "install error: %v\n", err)
+		return 1
+	}
+	if problems := checkInstallPermissions(installed, *clickhouseUser); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(stderr, problem)
+		}
+		return 1
+	}
+	return 0
+}
+
+// install copies binary to scriptsDir and writes the function configs under configDir, returning
+// the paths written so far
+func install(binary, scriptsDir, configDir string, poolSize int) ([]string, error) {
+	var installed []string
+	functionsDir := filepath.Join(configDir, "user_defined")
+	for _, dir := range []string{scriptsDir, functionsDir, filepath.Join(configDir, "config.d")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return installed, err
+		}
+	}
+	target := filepath.Join(scriptsDir, installBinary)
+	if err := copyBinary(binary, target); err != nil {
+		return installed, err
+	}
+	installed = append(installed, target)
+
+	names := make([]string, 0, len(udfFunctions)+1)
+	for name := range udfFunctions {
+		names = append(names, name)
+	}
+	names = append(names, dispatchFunction)
+	sort.Strings(names)
+	for _, name := range names {
+		args := udfFunctions[name]
+		if name == dispatchFunction {
+			args = []string{"-mode=" + dispatchMode}
+		}
+		config, err := functionConfig(name, args, poolSize)
+		if err != nil {
+			return installed, fmt.Errorf("%s: %w", name, err)
+		}
+		path := filepath.Join(functionsDir, name+"_function.xml")
+		if err := writeFileAtomic(path, config, 0o644); err != nil {
+			return installed, err
+		}
+		installed = append(installed, path)
+	}
+
+	path := filepath.Join(configDir, "config.d", "udf_config.xml")
+	loader := fmt.Sprintf("<clickhouse>\n  <user_defined_executable_functions_config>%s</user_defined_executable_functions_config>\n</clickhouse>\n",
+		filepath.Join(functionsDir, "*_function.xml"))
+	if err := writeFileAtomic(path, []byte(loader), 0o644); err != nil {
+		return installed, err
+	}
+	return append(installed, path), nil
+}
+
+// functionConfig is what genconfig prints for a function run with args
+func functionConfig(name string, args []string, poolSize int) ([]byte, error) {
+	c := &config{}
+	flags := newFlagSet(c)
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	opts := genconfigOptions{name: name, command: installBinary, parameter: udfParameters[name], poolSize: poolSize}
+	var buf bytes.Buffer
+	err := genconfig(&buf, c, opts, args, flags.NArg())
+	return buf.Bytes(), err
+}
+
+// copyBinary copies the running binary to target, unless it is target
+func copyBinary(binary, target string) error {
+	if source, err := os.Stat(binary); err == nil {
+		if existing, err := os.Stat(target); err == nil && os.SameFile(source, existing) {
+			return nil
+		}
+	}
+	data, err := os.ReadFile(binary)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(target, data, 0o755)
+}
+
+// writeFileAtomic replaces path with data, so a ClickHouse reading it never sees half of it
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes the file 0600 and the umask may take bits off perm, ClickHouse runs as
+	// another user and needs them
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkInstallPermissions returns what would stop user, the one ClickHouse runs as, from reading
+// the configs and running the binary: files it can't read, a binary it can't run, or directories
+// on the way it can't search. Without such a user, other users' permissions are checked.
+func checkInstallPermissions(paths []string, user string) []string {
+	can := fileAccess(user)
+	var problems []string
+	checked := map[string]bool{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		want, what := fs.FileMode(0o4), "read"
+		if filepath.Base(path) == installBinary {
+			want, what = 0o5, "run"
+		}
+		if !can(info, want) {
+			problems = append(problems, fmt.Sprintf("%s is %s, %s can't %s it", path, info.Mode(), user, what))
+		}
+		for dir := filepath.Dir(path); !checked[dir]; dir = filepath.Dir(dir) {
+			checked[dir] = true
+			if info, err := os.Stat(dir); err == nil && !can(info, 0o1) {
+				problems = append(problems, fmt.Sprintf("%s is %s, %s can't get at %s through it", dir, info.Mode(), user, path))
+			}
+		}
+	}
+	return problems
+}
+
+// fileAccess returns whether user has the permissions in want, 4 for read and 1 for execute,
+// to a file, as its owner, one of its groups or another user
+func fileAccess(name string) func(info fs.FileInfo, want fs.FileMode) bool {
+	uid, groups := -1, map[int]bool{}
+	if u, err := user.Lookup(name); err == nil {
+		uid, _ = strconv.Atoi(u.Uid)
+		gids, _ := u.GroupIds()
+		for _, gid := range append(gids, u.Gid) {
+			if id, err := strconv.Atoi(gid); err == nil {
+				groups[id] = true
+			}
+		}
+	}
+	return func(info fs.FileInfo, want fs.FileMode) bool {
+		perm := info.Mode().Perm()
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && uid >= 0 {
+			switch {
+			case int(stat.Uid) == uid:
+				perm >>= 6
+			case groups[int(stat.Gid)]:
+				perm >>= 3
+			}
+		}
+		return perm&want == want
+	}
+}
@@ -0,0 +1,63 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstall(t *testing.T) {
+	dir := t.TempDir()
+	// the temporary directories are only the test's own
+	assert.NoError(t, os.Chmod(filepath.Dir(dir), 0o755))
+	assert.NoError(t, os.Chmod(dir, 0o755))
+	binary := filepath.Join(dir, "build", "json_drop_keys_udf")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(binary), 0o755))
+	assert.NoError(t, os.WriteFile(binary, []byte("binary"), 0o700))
+	scripts, configDir := filepath.Join(dir, "user_scripts"), filepath.Join(dir, "clickhouse-server")
+
+	installed, err := install(binary, scripts, configDir, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, len(udfFunctions)+3, len(installed))
+	data, err := os.ReadFile(filepath.Join(scripts, installBinary))
+	assert.NoError(t, err)
+	assert.Equal(t, "binary", string(data))
+	assert.Empty(t, checkInstallPermissions(installed, "no such user"))
+
+	// the configs are the ones in udf/, JSONDropKeys leaves out -mode=drop
+	shipped, err := filepath.Glob("../../udf/*_function.xml")
+	assert.NoError(t, err)
+	assert.Len(t, shipped, len(udfFunctions)+1)
+	for _, path := range shipped {
+		want, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(configDir, "user_defined", filepath.Base(path)))
+		assert.NoError(t, err)
+		if filepath.Base(path) == "JSONDropKeys_function.xml" {
+			got = bytes.Replace(got, []byte(" -mode=drop"), nil, 1)
+		}
+		assert.Equal(t, string(want), string(got), path)
+	}
+	loader, err := os.ReadFile(filepath.Join(configDir, "config.d", "udf_config.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(loader), filepath.Join(configDir, "user_defined", "*_function.xml"))
+
+	// installing again from the installed binary keeps it
+	_, err = install(filepath.Join(scripts, installBinary), scripts, configDir, 16)
+	assert.NoError(t, err)
+	pooled, err := os.ReadFile(filepath.Join(configDir, "user_defined", "JSONKeepKeys_function.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(pooled), "<type>executable_pool</type>")
+	assert.Contains(t, string(pooled), "<pool_size>16</pool_size>")
+
+	assert.NoError(t, os.Chmod(filepath.Join(scripts, installBinary), 0o700))
+	assert.NoError(t, os.Chmod(configDir, 0o700))
+	problems := checkInstallPermissions(installed, "no such user")
+	assert.Len(t, problems, 2)
+	assert.True(t, strings.HasPrefix(problems[0], filepath.Join(scripts, installBinary)+" is -rwx------"), problems)
+	assert.True(t, strings.HasPrefix(problems[1], configDir+" is drwx------"), problems)
+}
@@ -0,0 +1,57 @@
+// Package jsondrop is the JSON Drop Keys UDF, for Go services to run the same transforms as
+// ClickHouse does without shelling out to the binary. Transform drops a key set from a document,
+// TransformDocument runs any of the UDF's modes, and Main is the binary itself.
+package jsondrop
+
+import (
+	"bytes"
+	"sync"
+)
+
+// KeySet is a set of paths to drop, in any syntax the UDF's key argument takes: dotted paths like
+// "b.c", wildcards, array indexes, JSON Pointers, JSONPath, regular expressions and filters
+type KeySet struct {
+	keys *jsonKey
+}
+
+// NewKeySet builds a KeySet from paths
+func NewKeySet(paths []string) (KeySet, error) {
+	keys, err := makeKeyDict(paths)
+	if err != nil {
+		return KeySet{}, err
+	}
+	return KeySet{keys: keys}, nil
+}
+
+// ParseKeySet builds a KeySet from a key argument, either ClickHouse's Array(String) text form
+// ['a', 'b.c'] or a JSON array ["a", "b.c"]
+func ParseKeySet(keys string) (KeySet, error) {
+	paths, err := ParseKeys(keys)
+	if err != nil {
+		return KeySet{}, err
+	}
+	return NewKeySet(paths)
+}
+
+// ParseKeys parses a key argument into its paths, unescaping ClickHouse's quoting
+func ParseKeys(keys string) ([]string, error) {
+	return parseKeysArray(keys)
+}
+
+var transformBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// Transform drops keys from a JSON document and returns it compacted, as the UDF's default mode
+// does. It's safe for concurrent use with the same KeySet. The zero KeySet drops nothing.
+func Transform(document []byte, keys KeySet) ([]byte, error) {
+	if keys.keys == nil {
+		keys.keys = newJSONKey()
+	}
+	buf := transformBuffers.Get().(*bytes.Buffer)
+	defer transformBuffers.Put(buf)
+	if err := processLine(keys.keys, document, buf); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
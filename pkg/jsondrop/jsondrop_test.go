@@ -0,0 +1,55 @@
+package jsondrop
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransform(t *testing.T) {
+	keys, err := ParseKeySet(`['a', 'b.c', 'items[*].secret']`)
+	assert.NoError(t, err)
+	result, err := Transform([]byte(`{"a":1, "b":{"c":2,"d":3}, "items":[{"secret":1,"x":2}]}`), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"b":{"d":3},"items":[{"x":2}]}`, string(result))
+
+	// the same KeySet from any number of goroutines
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 100 {
+				result, err := Transform([]byte(`{"a":1,"b":{"c":2}}`), keys)
+				assert.NoError(t, err)
+				assert.Equal(t, `{"b":{}}`, string(result))
+			}
+		})
+	}
+	wg.Wait()
+
+	keys, err = NewKeySet([]string{`$browser\.version`})
+	assert.NoError(t, err)
+	result, err = Transform([]byte(`{"$browser.version":1,"$browser":{"version":2}}`), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"$browser":{"version":2}}`, string(result))
+
+	result, err = Transform([]byte(`{"a":1}`), KeySet{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(result))
+
+	_, err = Transform([]byte(`{"a":1`), keys)
+	assert.ErrorContains(t, err, "json parse error")
+	_, err = ParseKeySet(`['a'`)
+	assert.Error(t, err)
+	_, err = NewKeySet([]string{"re:("})
+	assert.Error(t, err)
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(`['a', 'b\'c', 'd\\.e']`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b'c", `d\.e`}, keys)
+	keys, err = ParseKeys(`["a", "b.c"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b.c"}, keys)
+}
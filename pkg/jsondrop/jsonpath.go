@@ -0,0 +1,148 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// isJSONPath reports whether a key is a JSONPath expression rather than a dotted path. Plain keys
+// often start with $ in PostHog ($browser, $set), so only $ followed by . or [ counts.
+func isJSONPath(key string) bool {
+	return strings.HasPrefix(key, "$.") || strings.HasPrefix(key, "$[")
+}
+
+// jsonPathPaths converts the supported JSONPath subset into path segments:
+//
+//	$.a.b, $['a.b'], $["a"]  members, quoted names are literal
+//	$..token                 recursive descent
+//	$.a.*, $.a[*]            wildcard, matches members and array elements
+//	$.a[0], $.a[-1]          array elements
+//	$.a['x','y'], $.a[0,1]   unions
+//	$.a[?(@.type=='secret')] members and elements matching a filter, see compileFilter
+//
+// A path is returned for every alternative of wildcards and unions.
+func jsonPathPaths(expr string) ([][]string, error) {
+	paths := [][]string{nil}
+	appendAlternatives := func(segments ...string) {
+		expanded := make([][]string, 0, len(paths)*len(segments))
+		for _, path := range paths {
+			for _, segment := range segments {
+				expanded = append(expanded, append(append([]string(nil), path...), segment))
+			}
+		}
+		paths = expanded
+	}
+
+	s := expr[1:]
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			appendAlternatives("**")
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				continue
+			}
+			fallthrough
+		case s[0] == '.':
+			if len(s) > 0 && s[0] == '.' {
+				s = s[1:]
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("invalid JSONPath %q: empty member name", expr)
+			case "*":
+				appendAlternatives("*", "[*]")
+			default:
+				appendAlternatives(escapePathSegment(name))
+			}
+		case s[0] == '[':
+			segments, rest, err := parseJSONPathBracket(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSONPath %q: %w", expr, err)
+			}
+			appendAlternatives(segments...)
+			s = rest
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", expr, s)
+		}
+	}
+	if len(paths[0]) == 0 {
+		return nil, fmt.Errorf("invalid JSONPath %q: the whole document can't be selected", expr)
+	}
+	if paths[0][len(paths[0])-1] == "**" {
+		return nil, fmt.Errorf("invalid JSONPath %q: recursive descent needs a member to select", expr)
+	}
+	return paths, nil
+}
+
+// parseJSONPathBracket parses a [...] selector, returning its segment alternatives and the rest of the expression
+func parseJSONPathBracket(s string) ([]string, string, error) {
+	if strings.HasPrefix(s, "[?(") {
+		end, err := filterEnd(s)
+		if err != nil {
+			return nil, "", err
+		}
+		return []string{s[:end]}, s[end:], nil
+	}
+
+	var segments []string
+	s = s[1:]
+	for {
+		s = strings.TrimLeft(s, " ")
+		if len(s) == 0 {
+			return nil, "", fmt.Errorf("missing ]")
+		}
+		switch {
+		case s[0] == '\'' || s[0] == '"':
+			p := &filterParser{s: s}
+			name, err := p.parseQuoted()
+			if err != nil {
+				return nil, "", err
+			}
+			segments = append(segments, escapePathSegment(name))
+			s = s[p.pos:]
+		case s[0] == '*':
+			segments = append(segments, "*", "[*]")
+			s = s[1:]
+		default:
+			end := strings.IndexAny(s, ",]")
+			if end < 0 {
+				return nil, "", fmt.Errorf("missing ]")
+			}
+			token := strings.TrimSpace(s[:end])
+			if _, err := strconv.Atoi(token); err != nil {
+				return nil, "", fmt.Errorf("unsupported selector %q", token)
+			}
+			segments = append(segments, "["+token+"]")
+			s = s[end:]
+		}
+		s = strings.TrimLeft(s, " ")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+			continue
+		}
+		if strings.HasPrefix(s, "]") {
+			return segments, s[1:], nil
+		}
+		return nil, "", fmt.Errorf("missing ]")
+	}
+}
+
+// filterEnd returns the length of the [?(...)] selector at the start of s
+func filterEnd(s string) (int, error) {
+	end, err := closingParen(s, 2)
+	if err != nil {
+		return 0, err
+	}
+	if end+1 >= len(s) || s[end+1] != ']' {
+		return 0, fmt.Errorf("missing ] after filter")
+	}
+	return end + 2, nil
+}
@@ -0,0 +1,96 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONPathPaths(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    [][]string
+		wantErr bool
+	}{
+		{input: "$.a.b", want: [][]string{{"a", "b"}}},
+		{input: "$['a.b'].c", want: [][]string{{`a\.b`, "c"}}},
+		{input: "$..token", want: [][]string{{"**", "token"}}},
+		{input: "$..[0]", want: [][]string{{"**", "[0]"}}},
+		{input: "$.a.*", want: [][]string{{"a", "*"}, {"a", "[*]"}}},
+		{input: "$.a[1].b", want: [][]string{{"a", "[1]", "b"}}},
+		{input: `$.a['x', "y"]`, want: [][]string{{"a", "x"}, {"a", "y"}}},
+		{input: "$.props[?(@.type=='secret')]", want: [][]string{{"props", "[?(@.type=='secret')]"}}},
+		{input: "$.a[?(@.b==')]')].c", want: [][]string{{"a", "[?(@.b==')]')]", "c"}}},
+		{input: "$.", wantErr: true},
+		{input: "$..", wantErr: true},
+		{input: "$.a[", wantErr: true},
+		{input: "$.a[foo]", wantErr: true},
+		{input: "$.a[?(@.b==1]", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := jsonPathPaths(c.input)
+			if c.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, c.want, got)
+			}
+		})
+	}
+}
+
+func TestDropKeysJSONPath(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			name:  "member path",
+			input: `{"id":1,"props":{"secret":"xxx","public":"yyy"}}`,
+			want:  `{"id":1,"props":{"public":"yyy"}}`,
+			keys:  []string{"$.props.secret"},
+		},
+		{
+			name:  "recursive descent",
+			input: `{"token":1,"a":{"token":2,"b":[{"token":3,"c":4}]}}`,
+			want:  `{"a":{"b":[{"c":4}]}}`,
+			keys:  []string{"$..token"},
+		},
+		{
+			name:  "filter on array elements",
+			input: `{"props":[{"type":"secret","v":1},{"type":"public","v":2}]}`,
+			want:  `{"props":[{"type":"public","v":2}]}`,
+			keys:  []string{"$.props[?(@.type=='secret')]"},
+		},
+		{
+			name:  "filter on object members",
+			input: `{"props":{"a":{"type":"secret"},"b":{"type":"public"},"c":1}}`,
+			want:  `{"props":{"b":{"type":"public"},"c":1}}`,
+			keys:  []string{"$.props[?(@.type=='secret')]"},
+		},
+		{
+			name:  "filter with a key below it",
+			input: `{"items":[{"kind":"card","number":"4242","id":1},{"kind":"cash","number":"1","id":2}]}`,
+			want:  `{"items":[{"kind":"card","id":1},{"kind":"cash","number":"1","id":2}]}`,
+			keys:  []string{"$.items[?(@.kind=='card')].number"},
+		},
+		{
+			name:  "wildcard matches members and elements",
+			input: `{"a":{"x":{"s":1}},"b":[{"s":2,"t":3}]}`,
+			want:  `{"a":{"x":{}},"b":[{"t":3}]}`,
+			keys:  []string{"$.*.*.s"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := processLine(mustKeyDict(t, c.keys), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// keyCases are the key normalizations -case selects from
+var keyCases = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"snake": snakeCase,
+	"camel": camelCase,
+}
+
+// transformKeysFunc rewrites every key at every depth with caseFunc. Keys that end up the same
+// become duplicate keys, both are kept like any other duplicate.
+func transformKeysFunc(caseName string) (transformFunc, error) {
+	caseFunc, ok := keyCases[caseName]
+	if !ok {
+		return nil, fmt.Errorf("unknown key case %q, expected lower, snake or camel", caseName)
+	}
+	var transform func(n node) node
+	transform = func(n node) node {
+		switch v := n.(type) {
+		case *objectNode:
+			for i := range v.entries {
+				v.entries[i].key = caseFunc(v.entries[i].key)
+				v.entries[i].value = transform(v.entries[i].value)
+			}
+		case *arrayNode:
+			for i, value := range v.values {
+				v.values[i] = transform(value)
+			}
+		}
+		return n
+	}
+	return transform, nil
+}
+
+// keyWords splits a key into words at _, - and spaces and where the case changes, e.g.
+// "userID", "user_id" and "User-Id" are all "user", "id". Leading and trailing separators aren't
+// part of any word, they're returned as they are so "_id" and "$set" keep their prefix.
+func keyWords(key string) (prefix string, words []string, suffix string) {
+	isSeparator := func(r rune) bool { return r == '_' || r == '-' || r == ' ' }
+	start := strings.IndexFunc(key, func(r rune) bool { return !isSeparator(r) })
+	if start < 0 {
+		return key, nil, ""
+	}
+	end := strings.LastIndexFunc(key, func(r rune) bool { return !isSeparator(r) }) + 1
+	for end < len(key) && !isSeparator(rune(key[end])) {
+		end++
+	}
+	prefix, suffix = key[:start], key[end:]
+
+	runes := []rune(key[start:end])
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for i, r := range runes {
+		switch {
+		case isSeparator(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return prefix, words, suffix
+}
+
+// snakeCase turns "userId" and "User Name" into "user_id" and "user_name"
+func snakeCase(key string) string {
+	prefix, words, suffix := keyWords(key)
+	return prefix + strings.ToLower(strings.Join(words, "_")) + suffix
+}
+
+// camelCase turns "user_id" and "User Name" into "userId" and "userName"
+func camelCase(key string) string {
+	prefix, words, suffix := keyWords(key)
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if i > 0 {
+			r := []rune(word)
+			r[0] = unicode.ToUpper(r[0])
+			word = string(r)
+		}
+		sb.WriteString(word)
+	}
+	sb.WriteString(suffix)
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyCases(t *testing.T) {
+	cases := []struct {
+		key, snake, camel string
+	}{
+		{"userId", "user_id", "userId"},
+		{"user_id", "user_id", "userId"},
+		{"UserName", "user_name", "userName"},
+		{"User Name", "user_name", "userName"},
+		{"user-name", "user_name", "userName"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"utm2Source", "utm2_source", "utm2Source"},
+		{"$browserVersion", "$browser_version", "$browserVersion"},
+		{"$set_once", "$set_once", "$setOnce"},
+		{"_id", "_id", "_id"},
+		{"id_", "id_", "id_"},
+		{"__", "__", "__"},
+		{"ÉtéFini", "été_fini", "étéFini"},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.snake, snakeCase(c.key), "snake %q", c.key)
+		assert.Equal(t, c.camel, camelCase(c.key), "camel %q", c.key)
+	}
+}
+
+func TestTransformKeysJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want, keyCase string
+	}{
+		{"lower", `{"UserId":1,"Props":{"Plan":"X"}}`, `{"userid":1,"props":{"plan":"X"}}`, "lower"},
+		{"snake in arrays", `{"items":[{"skuId":1}]}`, `{"items":[{"sku_id":1}]}`, "snake"},
+		{"camel", `{"user_id":{"first_name":"a"}}`, `{"userId":{"firstName":"a"}}`, "camel"},
+		{"collisions are kept", `{"userId":1,"user_id":2}`, `{"user_id":1,"user_id":2}`, "snake"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			transform, err := transformKeysFunc(c.keyCase)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			err = transformLine(transform, []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+
+	_, err := transformKeysFunc("kebab")
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+package jsondrop
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// subtreeModes are the modes applying to the whole value a path ends at, so a path inside another
+// listed path does nothing more
+var subtreeModes = map[string]bool{"drop": true, "keep": true, "extract": true, "redact": true, "hash": true, "anonymize-ip": true, "elements-chain": true}
+
+// validatePath rejects dotted paths that can't be what was meant, like "a..b", ".a" and "a."
+// with their empty segments, which used to silently never match. JSONPath and JSON Pointer keys
+// have syntaxes of their own, a pointer can still name an empty key.
+func validatePath(key string) error {
+	if isJSONPath(key) || strings.HasPrefix(key, "/") {
+		return nil
+	}
+	path := strings.TrimPrefix(key, deepPrefix)
+	if path == "" {
+		return errors.New("empty path")
+	}
+	for _, part := range splitPath(path) {
+		if part == "" {
+			return errors.New(`empty segment, a path can't start or end with a dot or have two in a row, use \. for a dot in a key`)
+		}
+	}
+	return nil
+}
+
+// keyWarning is an entry of a key list that has no effect
+type keyWarning struct {
+	key, reason string
+}
+
+// checkKeyList removes the entries of keys listed before, as they would be when matching, and
+// warns about them and, for subtreeModes, about paths inside another listed path. Renaming a path
+// to two different names is an error.
+func checkKeyList(keys []string, mode string, ignoreCase bool) ([]string, []keyWarning, error) {
+	var warnings []keyWarning
+	normalize := func(key string) string {
+		if ignoreCase {
+			return strings.ToLower(key)
+		}
+		return key
+	}
+	seen := make(map[string]bool, len(keys))
+	unique := keys[:0:0]
+	for _, key := range keys {
+		if seen[normalize(key)] {
+			warnings = append(warnings, keyWarning{key, "is listed more than once"})
+			continue
+		}
+		seen[normalize(key)] = true
+		unique = append(unique, key)
+	}
+	if mode == "rename" {
+		renamed := make(map[string]string, len(unique))
+		for _, mapping := range unique {
+			path, _, err := splitRename(mapping)
+			if err != nil {
+				// newRenameDict reports it
+				continue
+			}
+			if earlier, ok := renamed[normalize(path)]; ok {
+				return nil, nil, fmt.Errorf("mapping %q: %q is already renamed by %q", mapping, path, earlier)
+			}
+			renamed[normalize(path)] = mapping
+		}
+	}
+	if !subtreeModes[mode] {
+		return unique, warnings, nil
+	}
+
+	// paths are compared segment by segment, so "a" covers "a.b" and "a[0]" but not "ab"
+	segments := func(key string) []string {
+		if isJSONPath(key) || strings.HasPrefix(key, "/") {
+			return nil
+		}
+		if strings.HasPrefix(key, deepPrefix) {
+			key = "**." + key[len(deepPrefix):]
+		}
+		return splitPath(normalize(key))
+	}
+	listed := make(map[string]string, len(unique))
+	for _, key := range unique {
+		if parts := segments(key); parts != nil {
+			listed[strings.Join(parts, "\x00")] = key
+		}
+	}
+	for _, key := range unique {
+		parts := segments(key)
+		for n := len(parts) - 1; n > 0; n-- {
+			if parent, ok := listed[strings.Join(parts[:n], "\x00")]; ok {
+				warnings = append(warnings, keyWarning{key, fmt.Sprintf("is inside %q, which -mode=%s already applies to as a whole", parent, mode)})
+				break
+			}
+		}
+	}
+	return unique, warnings, nil
+}
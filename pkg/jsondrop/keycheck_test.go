@@ -0,0 +1,71 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePath(t *testing.T) {
+	for _, key := range []string{"a", "a.b", `a\.b`, "items[0].secret", "[0]", "deep:email", "**.x", "re:^a.b$", "a?(@.v=='x.y').b", "$.a.b", "/a//b", "a.*"} {
+		assert.NoError(t, validatePath(key), key)
+	}
+	for _, key := range []string{"", "deep:", "a..b", ".a", "a.", "a.b.", "items[0]..x"} {
+		assert.Error(t, validatePath(key), key)
+	}
+
+	_, err := makeKeyDict([]string{"a", "b..c"})
+	assert.EqualError(t, err, `key "b..c": empty segment, a path can't start or end with a dot or have two in a row, use \. for a dot in a key`)
+	_, err = makeKeyDict([]string{"re:("})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `key "re:("`)
+	}
+	_, err = newRenameDict([]string{"a.:b"}, keyDictOptions{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `mapping "a.:b"`)
+	}
+}
+
+func TestCheckKeyList(t *testing.T) {
+	keys, warnings, err := checkKeyList([]string{"a", "b", "a", "c.d", "B"}, "drop-by-value", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c.d", "B"}, keys)
+	assert.Equal(t, []keyWarning{{"a", "is listed more than once"}}, warnings)
+
+	keys, warnings, err = checkKeyList([]string{"props", "props.email", "items[0]", "items[0].x", "deep:token", "**.token.v", "propsx", "B", "b"}, "drop", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"props", "props.email", "items[0]", "items[0].x", "deep:token", "**.token.v", "propsx", "B"}, keys)
+	assert.Equal(t, []keyWarning{
+		{"b", "is listed more than once"},
+		{"props.email", `is inside "props", which -mode=drop already applies to as a whole`},
+		{"items[0].x", `is inside "items[0]", which -mode=drop already applies to as a whole`},
+		{"**.token.v", `is inside "deep:token", which -mode=drop already applies to as a whole`},
+	}, warnings)
+
+	// counting and the like look at the paths on their own
+	_, warnings, err = checkKeyList([]string{"a", "a.b"}, "count-keys", false)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	_, _, err = checkKeyList([]string{"a.b:c", "x:y", "a.b:d"}, "rename", false)
+	assert.EqualError(t, err, `mapping "a.b:d": "a.b" is already renamed by "a.b:c"`)
+}
+
+func TestLineFuncKeyWarnings(t *testing.T) {
+	c, err := parseConfig([]string{"['a', 'a', 'a.b', 'c']"})
+	assert.NoError(t, err)
+	var warned []keyWarning
+	c.warn = func(key, reason string) { warned = append(warned, keyWarning{key, reason}) }
+	process, err := c.lineFunc([]string{"c"}, true)
+	assert.NoError(t, err)
+	assert.Len(t, warned, 3)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte(`{"a":{"b":1},"c":2,"d":3}`), &buf))
+	assert.Equal(t, `{"d":3}`, buf.String())
+
+	c, err = parseConfig([]string{"['a..b']"})
+	assert.NoError(t, err)
+	_, err = c.lineFunc(nil, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,785 @@
+package jsondrop
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// regexPrefix marks a segment as a regular expression, e.g. "re:^\$ph_.*". Regular expressions
+// contain dots themselves, so the segment extends to the end of the path.
+const regexPrefix = "re:"
+
+// prefixMatcher and suffixMatcher match keys starting or ending with a string, e.g. "prefix:$" or
+// "props.suffix:_token". Unlike regex segments they end at the next unescaped dot.
+const (
+	prefixMatcher = "prefix:"
+	suffixMatcher = "suffix:"
+)
+
+// filterPrefix and filterSuffix delimit a filter segment, e.g. "[?(@.type=='secret')]" matches members
+// and array elements whose value satisfies the expression, see compileFilter
+const (
+	filterPrefix = "[?("
+	filterSuffix = ")]"
+)
+
+// conditionPrefix starts a condition on a segment, e.g. "props?(@.type=='password').value" only
+// matches props if its value satisfies the filter expression, see compileFilter
+const conditionPrefix = "?("
+
+// escapeChar makes the next character of a path literal, e.g. "$browser\.version" is a single key with
+// a dot in its name and "\*" is a key named "*"
+const escapeChar = '\\'
+
+// deepPrefix matches a path at any depth, including inside arrays, "deep:email" is the same as "**.email"
+const deepPrefix = "deep:"
+
+// a trie of hierarchical keys, e.g. if someone wants to drop "properties.foo.bar" or "items[0].secret"
+type jsonKey struct {
+	// leaf marks the end of a path, the matched value is dropped (or kept) as a whole
+	leaf bool
+	// target is the new name of keys matched by a leaf in a rename mapping
+	target string
+	// hits counts the drops by a leaf for -path-stats, it's nil when they aren't counted
+	hits     *atomic.Uint64
+	children map[string]*jsonKey
+	// wildcard is the subtree for a "*" segment, it matches any key at this level
+	wildcard *jsonKey
+	// deep is the subtree for a "**" segment, it applies at this level and at any depth below
+	deep *jsonKey
+	// patterns are segments matched by a predicate instead of an exact key
+	patterns []*keyPattern
+	// elements are the subtrees for "[n]" segments, negative indexes count from the end of the array
+	elements map[int]*jsonKey
+	// anyElement is the subtree for a "[*]" segment, it matches every element of an array
+	anyElement *jsonKey
+	// ignoreCase is set on every node of a trie built with keyDictOptions.ignoreCase, exact
+	// children are stored lower-cased then
+	ignoreCase bool
+	// recursive is set on deep subtrees, they stay active when descending into objects and arrays
+	recursive bool
+	// self is a keySet holding this node and its deep subtree, so matching a single path doesn't allocate
+	self keySet
+	// lengths and firstBytes have a bit set for the length, lengths over 63 sharing the last bit,
+	// and the first byte of each key in children, so most members of a wide object are ruled out
+	// without hashing their keys
+	lengths    uint64
+	firstBytes [4]uint64
+	// withWildcard is self and the parent's wildcard subtree, set by optimize on exact children
+	// that have a wildcard next to them, so matching them doesn't merge the two sets every time
+	withWildcard keySet
+}
+
+// keyPattern is a segment matched by a predicate, e.g. a regular expression or a filter expression
+type keyPattern struct {
+	source string
+	match  func(key string, value node) bool
+	// elements is set for patterns that match array elements too, they're matched with an empty key
+	elements bool
+	child    *jsonKey
+}
+
+// keySet is the set of trie nodes that apply at one level of the document. There's more
+// than one when exact and wildcard paths overlap, e.g. "a.b" and "*.c".
+type keySet []*jsonKey
+
+func newJSONKey() *jsonKey {
+	k := &jsonKey{}
+	k.self = keySet{k}
+	return k
+}
+
+func (k *jsonKey) newChild() *jsonKey {
+	c := newJSONKey()
+	c.ignoreCase = k.ignoreCase
+	return c
+}
+
+// set returns the keySet for the root of the trie, nil matches nothing
+func (k *jsonKey) set() keySet {
+	if k == nil {
+		return nil
+	}
+	return k.self
+}
+
+func (k *jsonKey) child(part string) (*jsonKey, error) {
+	if strings.HasPrefix(part, regexPrefix) {
+		return k.pattern(part, false, func() (func(string, node) bool, error) {
+			expr := part[len(regexPrefix):]
+			if k.ignoreCase {
+				expr = "(?i)" + expr
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, err
+			}
+			return func(key string, _ node) bool { return re.MatchString(key) }, nil
+		})
+	}
+	if strings.HasPrefix(part, filterPrefix) && strings.HasSuffix(part, filterSuffix) {
+		return k.pattern(part, true, func() (func(string, node) bool, error) {
+			filter, err := compileFilter(part[len(filterPrefix) : len(part)-len(filterSuffix)])
+			if err != nil {
+				return nil, err
+			}
+			return func(_ string, value node) bool { return filter(value) }, nil
+		})
+	}
+	if base, expr, ok := splitCondition(part); ok {
+		return k.pattern(part, false, func() (func(string, node) bool, error) {
+			filter, err := compileFilter(expr)
+			if err != nil {
+				return nil, err
+			}
+			if base == "*" {
+				return func(_ string, value node) bool { return filter(value) }, nil
+			}
+			name := k.fold(unescapePathSegment(base))
+			return func(key string, value node) bool { return k.fold(key) == name && filter(value) }, nil
+		})
+	}
+	if strings.HasPrefix(part, prefixMatcher) || strings.HasPrefix(part, suffixMatcher) {
+		return k.pattern(part, false, func() (func(string, node) bool, error) {
+			matcher, has := prefixMatcher, strings.HasPrefix
+			if strings.HasPrefix(part, suffixMatcher) {
+				matcher, has = suffixMatcher, strings.HasSuffix
+			}
+			affix := unescapePathSegment(part[len(matcher):])
+			if k.ignoreCase {
+				affix = strings.ToLower(affix)
+				return func(key string, _ node) bool { return has(strings.ToLower(key), affix) }, nil
+			}
+			return func(key string, _ node) bool { return has(key, affix) }, nil
+		})
+	}
+	if strings.IndexByte(part, escapeChar) >= 0 {
+		return k.exactChild(unescapePathSegment(part)), nil
+	}
+	if part == "[*]" {
+		if k.anyElement == nil {
+			k.anyElement = k.newChild()
+		}
+		return k.anyElement, nil
+	}
+	if index, ok := parseIndexSegment(part); ok {
+		if k.elements == nil {
+			k.elements = make(map[int]*jsonKey)
+		}
+		c := k.elements[index]
+		if c == nil {
+			c = k.newChild()
+			k.elements[index] = c
+		}
+		return c, nil
+	}
+	if part == "**" {
+		if k.deep == nil {
+			k.deep = k.newChild()
+			k.deep.recursive = true
+			k.self = keySet{k, k.deep}
+		}
+		return k.deep, nil
+	}
+	if part == "*" {
+		if k.wildcard == nil {
+			k.wildcard = k.newChild()
+		}
+		return k.wildcard, nil
+	}
+	return k.exactChild(part), nil
+}
+
+func (k *jsonKey) exactChild(part string) *jsonKey {
+	if k.ignoreCase {
+		part = strings.ToLower(part)
+	}
+	if k.children == nil {
+		k.children = make(map[string]*jsonKey)
+	}
+	c := k.children[part]
+	if c == nil {
+		c = k.newChild()
+		k.children[part] = c
+		k.lengths |= lengthBit(len(part))
+		if part != "" {
+			k.firstBytes[part[0]>>6] |= 1 << (part[0] & 63)
+		}
+	}
+	return c
+}
+
+func lengthBit(n int) uint64 {
+	return 1 << min(n, 63)
+}
+
+// exactMatch returns the exact child for key, if any
+func (k *jsonKey) exactMatch(key string) *jsonKey {
+	if k.children == nil {
+		return nil
+	}
+	// keys lower-cased for ignoreCase may change length, and bytes of multibyte characters case
+	if !k.ignoreCase {
+		if k.lengths&lengthBit(len(key)) == 0 {
+			return nil
+		}
+		if key != "" && k.firstBytes[key[0]>>6]&(1<<(key[0]&63)) == 0 {
+			return nil
+		}
+	} else if key != "" && key[0] < utf8.RuneSelf {
+		b := key[0]
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		if k.firstBytes[b>>6]&(1<<(b&63)) == 0 {
+			return nil
+		}
+	}
+	return k.children[k.fold(key)]
+}
+
+// pattern returns the subtree for a predicate segment, compile is only called the first time source is seen
+func (k *jsonKey) pattern(source string, elements bool, compile func() (func(string, node) bool, error)) (*jsonKey, error) {
+	for _, p := range k.patterns {
+		if p.source == source {
+			return p.child, nil
+		}
+	}
+	match, err := compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid key pattern %q: %w", source, err)
+	}
+	p := &keyPattern{source: source, match: match, elements: elements, child: k.newChild()}
+	k.patterns = append(k.patterns, p)
+	return p.child, nil
+}
+
+// fold returns the key used to look up exact children, ToLower doesn't allocate for keys that are already lower-case
+func (k *jsonKey) fold(key string) string {
+	if k.ignoreCase {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+// match returns the trie nodes that apply below the member key and whether any path ends at it
+func (s keySet) match(key string, value node) (keySet, bool) {
+	next, leaf := s.matchLeaf(key, value)
+	return next, leaf != nil
+}
+
+// matchLeaf is match returning the leaf of the first path ending at key
+func (s keySet) matchLeaf(key string, value node) (keySet, *jsonKey) {
+	var next keySet
+	for _, k := range s {
+		merged := false
+		if c := k.exactMatch(key); c != nil {
+			if c.leaf {
+				return nil, c
+			}
+			if merged = c.withWildcard != nil; merged && len(next) == 0 {
+				next = c.withWildcard
+			} else if merged {
+				next = next.union(c.withWildcard)
+			} else {
+				next = next.add(c)
+			}
+		}
+		if c := k.wildcard; c != nil && !merged {
+			if c.leaf {
+				return nil, c
+			}
+			next = next.add(c)
+		}
+		for _, p := range k.patterns {
+			if !p.match(key, value) {
+				continue
+			}
+			if p.child.leaf {
+				return nil, p.child
+			}
+			next = next.add(p.child)
+		}
+		if k.recursive {
+			next = next.add(k)
+		}
+	}
+	return next, nil
+}
+
+// element returns the trie nodes that apply below element i of an array of length n and
+// whether any path ends at it
+func (s keySet) element(i, n int, value node) (keySet, bool) {
+	next, leaf := s.elementLeaf(i, n, value)
+	return next, leaf != nil
+}
+
+// elementLeaf is element returning the leaf of the first path ending at element i
+func (s keySet) elementLeaf(i, n int, value node) (keySet, *jsonKey) {
+	var next keySet
+	for _, k := range s {
+		if k.elements != nil {
+			for _, index := range [2]int{i, i - n} {
+				if c := k.elements[index]; c != nil {
+					if c.leaf {
+						return nil, c
+					}
+					next = next.add(c)
+				}
+			}
+		}
+		if c := k.anyElement; c != nil {
+			if c.leaf {
+				return nil, c
+			}
+			next = next.add(c)
+		}
+		for _, p := range k.patterns {
+			if !p.elements || !p.match("", value) {
+				continue
+			}
+			if p.child.leaf {
+				return nil, p.child
+			}
+			next = next.add(p.child)
+		}
+		if k.recursive {
+			next = next.add(k)
+		}
+	}
+	return next, nil
+}
+
+// hasLiteral reports whether key, which contains a dot, is matched as a literal key rather than
+// as a nested path. Such keys only come from escaped paths like "$browser\.version".
+func (s keySet) hasLiteral(key string) bool {
+	for _, k := range s {
+		if _, ok := k.children[k.fold(key)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// reachesElements reports whether any path continues into the elements of an array
+func (s keySet) reachesElements() bool {
+	for _, k := range s {
+		if k.elements != nil || k.anyElement != nil || k.recursive {
+			return true
+		}
+		for _, p := range k.patterns {
+			if p.elements {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s keySet) add(k *jsonKey) keySet {
+	if len(s) == 0 {
+		return k.self
+	}
+	merged := s
+	for _, c := range k.self {
+		if !s.contains(c) {
+			if len(merged) == len(s) {
+				merged = make(keySet, 0, len(s)+len(k.self))
+				merged = append(merged, s...)
+			}
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+func (s keySet) union(other keySet) keySet {
+	for _, k := range other {
+		s = s.add(k)
+	}
+	return s
+}
+
+func (s keySet) contains(k *jsonKey) bool {
+	for _, c := range s {
+		if c == k {
+			return true
+		}
+	}
+	return false
+}
+
+// paths lists the paths stored in the trie, sorted, mostly useful for debugging
+func (k *jsonKey) paths() []string {
+	var result []string
+	var walk func(k *jsonKey, prefix string)
+	walk = func(k *jsonKey, prefix string) {
+		if k.leaf {
+			result = append(result, prefix)
+			return
+		}
+		join := func(part string) string {
+			if prefix == "" || part[0] == '[' {
+				return prefix + part
+			}
+			return prefix + "." + part
+		}
+		for part, c := range k.children {
+			walk(c, join(escapePathSegment(part)))
+		}
+		if k.wildcard != nil {
+			walk(k.wildcard, join("*"))
+		}
+		if k.deep != nil {
+			walk(k.deep, join("**"))
+		}
+		for _, p := range k.patterns {
+			walk(p.child, join(p.source))
+		}
+		for index, c := range k.elements {
+			walk(c, join("["+strconv.Itoa(index)+"]"))
+		}
+		if k.anyElement != nil {
+			walk(k.anyElement, join("[*]"))
+		}
+	}
+	if k != nil {
+		walk(k, "")
+	}
+	sort.Strings(result)
+	return result
+}
+
+// splitPath splits a dotted path into segments, a regex segment takes the rest of the path.
+// Array indexes become segments of their own, e.g. "items[*].secret" is "items", "[*]", "secret".
+// Escaped characters are left in the segments, they are resolved when the trie is built.
+func splitPath(key string) []string {
+	var parts []string
+	for {
+		if strings.HasPrefix(key, regexPrefix) {
+			return append(parts, key)
+		}
+		dot := segmentEnd(key)
+		if dot < 0 {
+			return appendIndexSegments(parts, key)
+		}
+		parts = appendIndexSegments(parts, key[:dot])
+		key = key[dot+1:]
+	}
+}
+
+// appendIndexSegments appends part, with any trailing "[n]", "[*]" or "[?(...)]" suffixes split into segments of their own
+func appendIndexSegments(parts []string, part string) []string {
+	if strings.HasSuffix(part, filterSuffix) {
+		if open := strings.Index(part, filterPrefix); open >= 0 && !isEscaped(part, open) {
+			if open > 0 {
+				parts = appendIndexSegments(parts, part[:open])
+			}
+			return append(parts, part[open:])
+		}
+	}
+	end := len(part)
+	for end > 0 && part[end-1] == ']' {
+		open := strings.LastIndexByte(part[:end], '[')
+		if open < 0 || isEscaped(part, open) {
+			break
+		}
+		if _, ok := parseIndexSegment(part[open:end]); !ok && part[open:end] != "[*]" {
+			break
+		}
+		end = open
+	}
+	if end > 0 || end == len(part) {
+		parts = append(parts, part[:end])
+	}
+	for end < len(part) {
+		closing := end + strings.IndexByte(part[end:], ']')
+		parts = append(parts, part[end:closing+1])
+		end = closing + 1
+	}
+	return parts
+}
+
+// segmentEnd returns the index of the dot ending the first segment of a path, or -1 if there's just one.
+// Escaped dots and dots inside conditions and filters like "?(@.type=='x')" don't count.
+func segmentEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case escapeChar:
+			i++
+		case '?':
+			if i+1 < len(s) && s[i+1] == '(' {
+				end, err := closingParen(s, i+1)
+				if err != nil {
+					// leave it to compileFilter to report
+					return -1
+				}
+				i = end
+			}
+		case '.':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitCondition splits a "name?(expr)" segment
+func splitCondition(part string) (base, expr string, ok bool) {
+	if !strings.HasSuffix(part, ")") {
+		return "", "", false
+	}
+	for i := 0; i+1 < len(part); i++ {
+		switch part[i] {
+		case escapeChar:
+			i++
+		case '?':
+			if part[i+1] != '(' {
+				continue
+			}
+			end, err := closingParen(part, i+1)
+			if err != nil || end != len(part)-1 {
+				return "", "", false
+			}
+			return part[:i], part[i+len(conditionPrefix) : end], true
+		}
+	}
+	return "", "", false
+}
+
+// isEscaped reports whether s[i] is preceded by an odd number of escape characters
+func isEscaped(s string, i int) bool {
+	n := 0
+	for i > 0 && s[i-1] == escapeChar {
+		n++
+		i--
+	}
+	return n%2 == 1
+}
+
+func unescapePathSegment(part string) string {
+	var sb strings.Builder
+	sb.Grow(len(part))
+	for i := 0; i < len(part); i++ {
+		if part[i] == escapeChar && i+1 < len(part) {
+			i++
+		}
+		sb.WriteByte(part[i])
+	}
+	return sb.String()
+}
+
+// escapePathSegment is the inverse of unescapePathSegment for exact keys
+func escapePathSegment(part string) string {
+	special := part == "*" || part == "**" || strings.HasPrefix(part, regexPrefix) || strings.HasPrefix(part, deepPrefix) ||
+		strings.HasPrefix(part, prefixMatcher) || strings.HasPrefix(part, suffixMatcher)
+	if !special && strings.IndexAny(part, ".[\\") < 0 {
+		return part
+	}
+	var sb strings.Builder
+	if special {
+		sb.WriteByte(escapeChar)
+	}
+	for i := 0; i < len(part); i++ {
+		switch part[i] {
+		case '.', '[', escapeChar:
+			sb.WriteByte(escapeChar)
+		}
+		sb.WriteByte(part[i])
+	}
+	return sb.String()
+}
+
+// parseIndexSegment parses a "[n]" segment
+func parseIndexSegment(part string) (int, bool) {
+	if len(part) < 3 || part[0] != '[' || part[len(part)-1] != ']' {
+		return 0, false
+	}
+	index, err := strconv.Atoi(part[1 : len(part)-1])
+	if err != nil {
+		return 0, false
+	}
+	return index, true
+}
+
+// pointerPaths converts a JSON Pointer (RFC 6901) like "/props/secret" or "/a/0/b" into path segments.
+// A numeric token addresses an array element or an object key, so a path is returned for each combination.
+func pointerPaths(pointer string) [][]string {
+	paths := [][]string{nil}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		segment := escapePathSegment(token)
+		if !isArrayIndexToken(token) {
+			for i := range paths {
+				paths[i] = append(paths[i], segment)
+			}
+			continue
+		}
+		expanded := make([][]string, 0, 2*len(paths))
+		for _, path := range paths {
+			asKey := append(append([]string(nil), path...), segment)
+			asIndex := append(append([]string(nil), path...), "["+token+"]")
+			expanded = append(expanded, asKey, asIndex)
+		}
+		paths = expanded
+	}
+	return paths
+}
+
+// isArrayIndexToken reports whether a JSON Pointer token is an array index, i.e. "0" or a number without leading zeros
+func isArrayIndexToken(token string) bool {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return false
+	}
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// keyDictOptions changes how paths are matched
+type keyDictOptions struct {
+	// ignoreCase matches exact and regex segments case-insensitively, e.g. "email" matches "Email" and "EMAIL"
+	ignoreCase bool
+	// recursive matches every path at any depth, see recursiveKeys
+	recursive bool
+	// hits has the leaves count their drops by the path they were listed as, if set
+	hits *pathHitCounts
+}
+
+func makeKeyDict(keys []string) (*jsonKey, error) {
+	return newKeyDict(keys, keyDictOptions{})
+}
+
+func newKeyDict(keys []string, opts keyDictOptions) (*jsonKey, error) {
+	listed := keys
+	if opts.recursive {
+		keys = recursiveKeys(keys)
+	}
+	dict := newJSONKey()
+	dict.ignoreCase = opts.ignoreCase
+	for i, key := range keys {
+		if err := dict.insertKey(key, "", opts.hits.counter(listed[i])); err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+	}
+	dict.optimize()
+	return dict, nil
+}
+
+// insertKey adds a key in any of the supported syntaxes, target and hits are set on the leaves of
+// its paths
+func (k *jsonKey) insertKey(key, target string, hits *atomic.Uint64) error {
+	if err := validatePath(key); err != nil {
+		return err
+	}
+	if isJSONPath(key) {
+		paths, err := jsonPathPaths(key)
+		if err != nil {
+			return err
+		}
+		for _, parts := range paths {
+			if err := k.insert(parts, target, hits); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if strings.HasPrefix(key, "/") {
+		for _, parts := range pointerPaths(key) {
+			if err := k.insert(parts, target, hits); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if strings.HasPrefix(key, deepPrefix) {
+		key = "**." + key[len(deepPrefix):]
+	}
+	return k.insert(splitPath(key), target, hits)
+}
+
+// insert adds a path split into segments to the trie
+func (k *jsonKey) insert(parts []string, target string, hits *atomic.Uint64) error {
+	if parts[len(parts)-1] == "**" {
+		// everything below the parent matches, the same as a trailing "*"
+		parts[len(parts)-1] = "*"
+	}
+	current := k
+	for _, part := range parts {
+		var err error
+		current, err = current.child(part)
+		if err != nil {
+			return err
+		}
+		if current.leaf {
+			// a parent path is already dropped as a whole
+			return nil
+		}
+	}
+	current.leaf = true
+	current.target = target
+	current.hits = hits
+	current.children = nil
+	current.wildcard = nil
+	current.deep = nil
+	current.patterns = nil
+	current.elements = nil
+	current.anyElement = nil
+	current.self = current.self[:1]
+	current.lengths = 0
+	current.firstBytes = [4]uint64{}
+	return nil
+}
+
+// optimize is run on a trie once every path is inserted. Below a wildcard leaf, which drops (or
+// keeps) every member as a whole, exact and pattern subtrees are left out, and below an [*] leaf
+// the [n] ones, as insert does for paths under a leaf. Rename tries keep them, their leaves have
+// names of their own. Exact children next to a wildcard get withWildcard.
+func (k *jsonKey) optimize() {
+	if w := k.wildcard; w != nil && w.leaf && w.target == "" {
+		k.children = nil
+		k.patterns = nil
+		k.lengths = 0
+		k.firstBytes = [4]uint64{}
+	}
+	if e := k.anyElement; e != nil && e.leaf && e.target == "" {
+		k.elements = nil
+	}
+	for _, c := range k.children {
+		if k.wildcard != nil && !k.wildcard.leaf {
+			c.withWildcard = c.self.union(k.wildcard.self)
+		}
+		c.optimize()
+	}
+	for _, c := range []*jsonKey{k.wildcard, k.deep, k.anyElement} {
+		if c != nil {
+			c.optimize()
+		}
+	}
+	for _, p := range k.patterns {
+		p.child.optimize()
+	}
+	for _, c := range k.elements {
+		c.optimize()
+	}
+}
+
+// recursiveKeys makes every path match at any depth, as if it had the deep: prefix
+func recursiveKeys(keys []string) []string {
+	result := make([]string, len(keys))
+	for i, key := range keys {
+		if strings.HasPrefix(key, deepPrefix) || strings.HasPrefix(key, "**.") {
+			result[i] = key
+			continue
+		}
+		result[i] = deepPrefix + key
+	}
+	return result
+}
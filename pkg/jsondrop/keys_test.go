@@ -0,0 +1,232 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustKeyDict(t *testing.T, keys []string) *jsonKey {
+	t.Helper()
+	dict, err := makeKeyDict(keys)
+	require.NoError(t, err)
+	return dict
+}
+
+func TestMakeKeyDict(t *testing.T) {
+	cases := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{
+			name: "nil input",
+			keys: nil,
+			want: nil,
+		},
+		{
+			name: "empty input",
+			keys: []string{},
+			want: nil,
+		},
+		{
+			name: "single top-level key",
+			keys: []string{"a"},
+			want: []string{"a"},
+		},
+		{
+			name: "multiple top-level keys",
+			keys: []string{"a", "b", "c"},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "single nested key",
+			keys: []string{"a.b"},
+			want: []string{"a.b"},
+		},
+		{
+			name: "deeply nested key",
+			keys: []string{"a.b.c.d"},
+			want: []string{"a.b.c.d"},
+		},
+		{
+			name: "mixed top-level and nested keys",
+			keys: []string{"x", "a.b"},
+			want: []string{"a.b", "x"},
+		},
+		{
+			name: "multiple nested keys under same parent",
+			keys: []string{"a.b", "a.c"},
+			want: []string{"a.b", "a.c"},
+		},
+		{
+			name: "nested key and parent key both specified",
+			keys: []string{"a.b", "a"},
+			want: []string{"a"},
+		},
+		{
+			name: "parent key and nested key both specified",
+			keys: []string{"a", "a.b"},
+			want: []string{"a"},
+		},
+		{
+			name: "wildcard segments",
+			keys: []string{"*.token", "props.*.secret"},
+			want: []string{"*.token", "props.*.secret"},
+		},
+		{
+			name: "recursive descent segments",
+			keys: []string{"**.password", "a.**.b", "c.**"},
+			want: []string{"**.password", "a.**.b", "c.*"},
+		},
+		{
+			name: "regex segment takes the rest of the path",
+			keys: []string{`re:^\$ph_.*`, `props.re:^a.b$`},
+			want: []string{`props.re:^a.b$`, `re:^\$ph_.*`},
+		},
+		{
+			name: "deep prefix",
+			keys: []string{"deep:email", "deep:a.b"},
+			want: []string{"**.a.b", "**.email"},
+		},
+		{
+			name: "escaped segments",
+			keys: []string{`$browser\.version`, `a.\*`, `x\[0]`, `\re:y`},
+			want: []string{`$browser\.version`, `\re:y`, `a.\*`, `x\[0]`},
+		},
+		{
+			name: "json pointer",
+			keys: []string{"/props/secret", "/a~1b/c~0d", "/x.y/*"},
+			want: []string{`a/b.c~d`, "props.secret", `x\.y.\*`},
+		},
+		{
+			name: "json pointer numeric tokens address keys and elements",
+			keys: []string{"/a/0/b", "/c/01"},
+			want: []string{"a.0.b", "a[0].b", "c.01"},
+		},
+		{
+			name: "prefix and suffix matchers",
+			keys: []string{"prefix:$", "props.suffix:_token", `\prefix:x`},
+			want: []string{`\prefix:x`, "prefix:$", "props.suffix:_token"},
+		},
+		{
+			name: "array index segments",
+			keys: []string{"items[0].secret", "m[1][-1]", "[2]", "a.b[*].c"},
+			want: []string{"[2]", "a.b[*].c", "items[0].secret", "m[1][-1]"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := mustKeyDict(t, c.keys)
+			assert.Equal(t, c.want, got.paths())
+		})
+	}
+}
+
+func TestKeySetMatch(t *testing.T) {
+	set := mustKeyDict(t, []string{"a.b", "*.c", "d"}).set()
+
+	next, leaf := set.match("d", nil)
+	assert.True(t, leaf)
+	assert.Nil(t, next)
+
+	next, leaf = set.match("a", nil)
+	assert.False(t, leaf)
+	assert.Len(t, next, 2)
+
+	next, leaf = set.match("x", nil)
+	assert.False(t, leaf)
+	assert.Len(t, next, 1)
+
+	_, leaf = next.match("c", nil)
+	assert.True(t, leaf)
+}
+
+func TestOptimizeKeyDict(t *testing.T) {
+	// a wildcard leaf drops every member as a whole, the paths below it do nothing
+	dict := mustKeyDict(t, []string{"props.a.b", "props.re:^x", "props.*", "items[0].x", "items[*]"})
+	assert.Equal(t, []string{"items[*]", "props.*"}, dict.paths())
+
+	// renamed leaves keep their own names
+	renames, err := newRenameDict([]string{"a.b:c", "a.*:d"}, keyDictOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.*", "a.b"}, renames.paths())
+
+	set := mustKeyDict(t, []string{"a.b", "*.c"}).set()
+	next, _ := set.match("a", nil)
+	assert.Equal(t, set[0].children["a"].withWildcard, next)
+	assert.Len(t, next, 2)
+}
+
+func TestExactMatch(t *testing.T) {
+	dict := mustKeyDict(t, []string{"email", "$ip", "a very long key that is over sixty three bytes in length, it shares a bit", "/"})
+	for _, key := range []string{"email", "$ip", "a very long key that is over sixty three bytes in length, it shares a bit", ""} {
+		assert.NotNil(t, dict.exactMatch(key), key)
+	}
+	for _, key := range []string{"Email", "emails", "$op", "a very long key that is over sixty three bytes in length, it shares a bi!", "x"} {
+		assert.Nil(t, dict.exactMatch(key), key)
+	}
+
+	folded, err := newKeyDict([]string{"Email", "\u00c9t\u00e9", "\u212aelvin"}, keyDictOptions{ignoreCase: true})
+	assert.NoError(t, err)
+	for _, key := range []string{"email", "EMAIL", "ÉTÉ", "été", "kelvin", "\u212aELVIN"} {
+		assert.NotNil(t, folded.exactMatch(key), key)
+	}
+	assert.Nil(t, folded.exactMatch("mail"))
+}
+
+func TestMakeKeyDictInvalidRegex(t *testing.T) {
+	_, err := makeKeyDict([]string{"props.re:("})
+	assert.Error(t, err)
+}
+
+func TestMakeKeyDictInvalidCondition(t *testing.T) {
+	_, err := makeKeyDict([]string{"props?(@.type=).value"})
+	assert.Error(t, err)
+}
+
+func TestSplitPath(t *testing.T) {
+	cases := []struct {
+		input string
+		want  []string
+	}{
+		{"a", []string{"a"}},
+		{"a.b", []string{"a", "b"}},
+		{"items[0].secret", []string{"items", "[0]", "secret"}},
+		{"m[0][-1]", []string{"m", "[0]", "[-1]"}},
+		{"[0].a", []string{"[0]", "a"}},
+		{"a[b]", []string{"a[b]"}},
+		{"a.b[*].c", []string{"a", "b", "[*]", "c"}},
+		{"a.re:^x.y[0]", []string{"a", "re:^x.y[0]"}},
+		{`$browser\.version`, []string{`$browser\.version`}},
+		{`a\[0].b`, []string{`a\[0]`, "b"}},
+		{`a\\.b`, []string{`a\\`, "b"}},
+		{"props?(@.type=='a.b').value", []string{"props?(@.type=='a.b')", "value"}},
+		{"items[?(@.a.b==1)].c", []string{"items", "[?(@.a.b==1)]", "c"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			assert.Equal(t, c.want, splitPath(c.input))
+		})
+	}
+}
+
+func TestRecursiveKeys(t *testing.T) {
+	got := recursiveKeys([]string{"email", "a.b", "deep:c", "**.d"})
+	assert.Equal(t, []string{"deep:email", "deep:a.b", "deep:c", "**.d"}, got)
+}
+
+func TestDropKeysIgnoreCase(t *testing.T) {
+	dict, err := newKeyDict([]string{"email", "props.Token", `re:^secret_`, `$browser\.version`, "suffix:_ID"}, keyDictOptions{ignoreCase: true})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	input := `{"Email":1,"EMAIL":2,"email":3,"PROPS":{"token":4,"x":5},"Secret_A":6,"$Browser.Version":7,"id":8,"user_id":9}`
+	err = processLine(dict, []byte(input), &buf)
+	require.NoError(t, err)
+	assert.Equal(t, `{"PROPS":{"x":5},"id":8}`, buf.String())
+}
@@ -0,0 +1,68 @@
+package jsondrop
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// keysFile is a key list on disk with one path per line, blank lines and lines starting with # are
+// skipped. Paths use the same syntax as the key array argument, without the quoting.
+type keysFile struct {
+	path    string
+	modTime time.Time
+	// stale is set by watch and cleared by the main loop, which rebuilds the trie between rows
+	stale atomic.Bool
+}
+
+func (f *keysFile) read() ([]string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	f.modTime = info.ModTime()
+	return parseKeysFile(string(data)), nil
+}
+
+func parseKeysFile(data string) []string {
+	var keys []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys
+}
+
+// watch marks the file stale on SIGHUP and whenever its mtime changes, polling every interval.
+// It must be called after the first read.
+func (f *keysFile) watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	lastMod := f.modTime
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hup:
+				f.stale.Store(true)
+			case <-ticker.C:
+				info, err := os.Stat(f.path)
+				if err == nil && !info.ModTime().Equal(lastMod) {
+					lastMod = info.ModTime()
+					f.stale.Store(true)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package jsondrop
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseKeysFile(t *testing.T) {
+	got := parseKeysFile("# PII\nemail\n\n  props.phone  \r\n#props.secret\n**.token\n")
+	want := []string{"email", "props.phone", "**.token"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestKeysFileWatchDetectsChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := &keysFile{path: path}
+	if keys, err := f.read(); err != nil || !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Fatalf("read: %q, %v", keys, err)
+	}
+	f.watch(5 * time.Millisecond)
+
+	if err := os.WriteFile(path, []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := f.modTime.Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !f.stale.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("change not detected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if keys, err := f.read(); err != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("reread: %q, %v", keys, err)
+	}
+}
+
+func TestKeysFileReadMissing(t *testing.T) {
+	f := &keysFile{path: filepath.Join(t.TempDir(), "missing.txt")}
+	if _, err := f.read(); err == nil {
+		t.Fatal("expected error")
+	}
+}
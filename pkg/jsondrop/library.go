@@ -0,0 +1,91 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxLibraryTransforms is how many flag and key combinations the library keeps transforms for,
+// it forgets them all past that rather than grow without bound
+const maxLibraryTransforms = 256
+
+// libraryTransforms are the transforms built for TransformDocument's calls, by flags and keys.
+// Transforms keep state between rows, so each is used by one call at a time from a pool.
+var libraryTransforms = struct {
+	sync.Mutex
+	byArgs map[[2]string]*libraryTransform
+}{byArgs: map[[2]string]*libraryTransform{}}
+
+type libraryTransform struct {
+	build func() (lineFunc, error)
+	pool  sync.Pool
+}
+
+// libraryRow is a transform and its output buffer, pooled together
+type libraryRow struct {
+	process lineFunc
+	buf     bytes.Buffer
+}
+
+// TransformDocument runs a document through the transform flags and key argument build, flags
+// being the UDF's separated by spaces, e.g. "-mode=redact -placeholder=x" and "['email']". It's
+// safe for concurrent use, the transform for each flags and keys is built once and reused.
+func TransformDocument(flags, keys string, document []byte) ([]byte, error) {
+	t, err := libraryTransformFor(flags, keys)
+	if err != nil {
+		return nil, err
+	}
+	row, _ := t.pool.Get().(*libraryRow)
+	if row == nil {
+		process, err := t.build()
+		if err != nil {
+			return nil, err
+		}
+		row = &libraryRow{process: process}
+	}
+	defer t.pool.Put(row)
+	if err := row.process(document, &row.buf); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(row.buf.Bytes()), nil
+}
+
+// libraryTransformFor returns the transform for flags and keys, checking they build one the
+// first time
+func libraryTransformFor(flags, keys string) (*libraryTransform, error) {
+	libraryTransforms.Lock()
+	defer libraryTransforms.Unlock()
+	if t, ok := libraryTransforms.byArgs[[2]string{flags, keys}]; ok {
+		return t, nil
+	}
+	args := strings.Fields(flags)
+	if keys != "" {
+		args = append(args, keys)
+	}
+	c, err := parseConfig(args)
+	if err != nil {
+		return nil, err
+	}
+	if layout, err := c.rowLayout(); err != nil || layout != nil {
+		return nil, fmt.Errorf("the library transforms one document at a time, -format=%s doesn't apply", c.format)
+	}
+	var fileKeys []string
+	if c.keysFile != "" {
+		if fileKeys, err = (&keysFile{path: c.keysFile}).read(); err != nil {
+			return nil, err
+		}
+	}
+	t := &libraryTransform{build: func() (lineFunc, error) { return c.lineFunc(fileKeys, c.keysFile != "") }}
+	process, err := t.build()
+	if err != nil {
+		return nil, err
+	}
+	t.pool.Put(&libraryRow{process: process})
+	if len(libraryTransforms.byArgs) >= maxLibraryTransforms {
+		clear(libraryTransforms.byArgs)
+	}
+	libraryTransforms.byArgs[[2]string{flags, keys}] = t
+	return t, nil
+}
@@ -0,0 +1,61 @@
+package jsondrop
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformDocument(t *testing.T) {
+	result, err := TransformDocument("", "['a', 'b.c']", []byte(`{"a":1,"b":{"c":2,"d":3}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"b":{"d":3}}`, string(result))
+
+	// the cached transform gives the same results, from any number of goroutines
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 100 {
+				result, err := TransformDocument("", "['a', 'b.c']", []byte(`{"a":1,"b":{"c":2}}`))
+				assert.NoError(t, err)
+				assert.Equal(t, `{"b":{}}`, string(result))
+			}
+		})
+	}
+	wg.Wait()
+
+	_, err = TransformDocument("", "['a']", []byte(`{"a":1`))
+	assert.ErrorContains(t, err, "parse error")
+
+	result, err = TransformDocument("-mode=redact  -placeholder=x", "['a']", []byte(`{"a":1,"b":2}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"x","b":2}`, string(result))
+
+	result, err = TransformDocument("-mode=validate", "", []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(result))
+
+	keys := filepath.Join(t.TempDir(), "keys.txt")
+	assert.NoError(t, os.WriteFile(keys, []byte("a\n"), 0o644))
+	result, err = TransformDocument("-keys-file="+keys, "", []byte(`{"a":1,"b":2}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"b":2}`, string(result))
+
+	for _, flags := range []string{"-mode=nope", "-format=rowbinary", "-format=csv"} {
+		_, err := TransformDocument(flags, "['a']", []byte(`{}`))
+		assert.Error(t, err, flags)
+	}
+	_, err = TransformDocument("", "['a'", []byte(`{}`))
+	assert.Error(t, err)
+
+	// a WASM reactor runs without any arguments
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = nil
+	result, err = TransformDocument("-mode=keep", "['a']", []byte(`{"a":1,"b":2}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(result))
+}
@@ -0,0 +1,157 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// localCommand is the first argument that transforms JSON lines from files or a terminal, for
+// trying drop lists out, instead of running the UDF
+const localCommand = "local"
+
+// runLocal is the local subcommand: it transforms the JSON lines of the files given, or of stdin
+// without any, with the same flags the UDF takes and -keys as a comma separated list, writing a
+// result per line. A row that fails is reported on stderr and the rest go on, so it can be typed
+// at interactively.
+func runLocal(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &config{}
+	fs := newFlagSet(c)
+	fs.Init(localCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	keys := fs.String("keys", "", "the keys, comma separated like a,b.c with \\, for a comma in a key, or a key argument like ['a', 'b.c']")
+	if err := c.parseFlags(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if c.format != "raw" || c.chunkHeader {
+		fmt.Fprintln(stderr, "local reads plain JSON lines, -format and -chunk-header don't apply")
+		return 2
+	}
+	c.keysArg = c.keyArgument(localKeysArg(*keys))
+	c.flagArgs = stripFlags(args[:len(args)-fs.NArg()], "keys")
+	c.warn = func(key, reason string) {
+		fmt.Fprintf(stderr, "warning: key %q %s\n", key, reason)
+	}
+	var fileKeys []string
+	if c.keysFile != "" {
+		var err error
+		if fileKeys, err = (&keysFile{path: c.keysFile}).read(); err != nil {
+			fmt.Fprintf(stderr, "keys file error: %v\n", err)
+			return 1
+		}
+	}
+	process, err := c.lineFunc(fileKeys, c.keysFile != "")
+	if err != nil {
+		fmt.Fprintf(stderr, "keysToDrop parse error: %v\n", err)
+		return 1
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	failed := false
+	for _, input := range inputs {
+		r := stdin
+		if input != "-" {
+			f, err := os.Open(input)
+			if err != nil {
+				fmt.Fprintf(stderr, "input error: %v\n", err)
+				return 1
+			}
+			defer f.Close()
+			r = f
+		}
+		ok, err := localRows(c, process, input, r, out, stderr)
+		if err != nil {
+			out.Flush()
+			fmt.Fprintf(stderr, "%s: read error: %v\n", input, err)
+			return 1
+		}
+		failed = failed || !ok
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// localRows transforms the rows of one input, flushing the results whenever the rows read so far
+// run out, and reports whether none failed
+func localRows(c *config, process lineFunc, name string, r io.Reader, out *bufio.Writer, stderr io.Writer) (bool, error) {
+	reader := bufio.NewReader(r)
+	lines := newLineReader(reader, c.maxLineBytes)
+	tooLongPolicy, tsv := c.tooLongPolicy()
+	var buf bytes.Buffer
+	ok := true
+	for row := 1; ; row++ {
+		line, _, err := lines.next()
+		var tooLong *lineTooLongError
+		switch {
+		case errors.As(err, &tooLong):
+			// -on-error applies to rows over -max-line-bytes as it does in the UDF
+			if _, err = tooLongRow(lines, line, tooLongPolicy, tsv, out, &buf); err == nil {
+				out.WriteByte('\n')
+			} else if !errors.As(err, &tooLong) {
+				return ok, err
+			}
+		case err == io.EOF && len(line) == 0:
+			return ok, nil
+		case err != nil && err != io.EOF:
+			return ok, err
+		default:
+			if err = process(line, &buf); err == nil {
+				out.Write(buf.Bytes())
+				out.WriteByte('\n')
+			}
+		}
+		if err != nil {
+			ok = false
+			out.Flush()
+			fmt.Fprintf(stderr, "%s:%d: %v\n", name, row, err)
+		}
+		if reader.Buffered() == 0 {
+			out.Flush()
+		}
+	}
+}
+
+// localKeysArg turns -keys into the key argument, a comma separated list into a JSON array of its
+// keys. A backslash before a comma makes it part of the key, other escapes are the key syntax's.
+func localKeysArg(keys string) string {
+	trimmed := strings.TrimSpace(keys)
+	if trimmed == "" || strings.HasPrefix(trimmed, "[") {
+		return trimmed
+	}
+	var list []string
+	var key strings.Builder
+	for i := 0; i < len(keys); i++ {
+		switch {
+		case keys[i] == '\\' && i+1 < len(keys) && keys[i+1] == ',':
+			key.WriteByte(',')
+			i++
+		case keys[i] == '\\' && i+1 < len(keys):
+			key.WriteString(keys[i : i+2])
+			i++
+		case keys[i] == ',':
+			list = append(list, strings.TrimSpace(key.String()))
+			key.Reset()
+		default:
+			key.WriteByte(keys[i])
+		}
+	}
+	list = append(list, strings.TrimSpace(key.String()))
+	array, _ := json.Marshal(list)
+	return string(array)
+}
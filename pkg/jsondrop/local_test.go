@@ -0,0 +1,58 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("{\"a\":1,\"b\":{\"c\":2,\"d\":3},\"x,y\":1}\n{\"a\":\n{\"b\":{\"c\":1}}")
+	code := runLocal([]string{"-keys", `a, b.c,x\,y`}, stdin, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "{\"b\":{\"d\":3}}\n{\"b\":{}}\n", stdout.String())
+	assert.Regexp(t, `^-:2: json parse error: `, stderr.String())
+
+	file := filepath.Join(t.TempDir(), "events.ndjson")
+	assert.NoError(t, os.WriteFile(file, []byte("{\"a\":1}\r\n"), 0o644))
+	stdout.Reset()
+	code = runLocal([]string{"-mode=redact", "-keys", "['a']", file, "-"}, strings.NewReader(`{"b":2}`), &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "{\"a\":\"[REDACTED]\"}\n{\"b\":2}\n", stdout.String())
+
+	// rows over -max-line-bytes are handled as the UDF handles them
+	stdout.Reset()
+	stdin = strings.NewReader("{\"a\":1}\n{\"aaaaaaaaaaaaaaaaaaaaaaaaa\":1}\n{\"a\":2}\n")
+	assert.Equal(t, 0, runLocal([]string{"-max-line-bytes=20", "-on-error=empty", "-keys=a"}, stdin, &stdout, &stderr))
+	assert.Equal(t, "{}\n{}\n{}\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, runLocal([]string{"-mode=validate"}, strings.NewReader("{}\n[\n"), &stdout, &stderr))
+	assert.Equal(t, "1\n0\n", stdout.String())
+
+	for _, args := range [][]string{{"-format=tsv"}, {"-chunk-header"}, {"-nope"}} {
+		assert.Equal(t, 2, runLocal(args, strings.NewReader(""), &stdout, &stderr), args)
+	}
+	assert.Equal(t, 1, runLocal([]string{"-keys=a", filepath.Join(t.TempDir(), "missing")}, nil, &stdout, &stderr))
+	assert.Equal(t, 1, runLocal([]string{"-keys=re:("}, nil, &stdout, &stderr))
+}
+
+func TestLocalKeysArg(t *testing.T) {
+	for keys, want := range map[string]string{
+		"":                 "",
+		"a":                `["a"]`,
+		" a , b.c ":        `["a","b.c"]`,
+		`a\,b,c\.d`:        `["a,b","c\\.d"]`,
+		`['a', 'b,c']`:     `['a', 'b,c']`,
+		`["a"]`:            `["a"]`,
+		`items[*].secret`:  `["items[*].secret"]`,
+		`re:^\$ph_.*,name`: `["re:^\\$ph_.*","name"]`,
+	} {
+		assert.Equal(t, want, localKeysArg(keys), keys)
+	}
+}
@@ -0,0 +1,159 @@
+package jsondrop
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode/utf8"
+)
+
+// debugLogPath is where -debug logs when -log-file isn't given
+const debugLogPath = "/tmp/json_drop_keys_udf.log"
+
+// logSampleBytes is how much of a failing row a log record quotes
+const logSampleBytes = 256
+
+// rowError is a row that failed with err, with its number in the input, counting from 1, and
+// the start of it to log
+type rowError struct {
+	row    int
+	sample string
+	err    error
+}
+
+func newRowError(row int, line []byte, err error) *rowError {
+	return &rowError{row: row, sample: logSample(line), err: err}
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rowError) Unwrap() error {
+	return e.err
+}
+
+// attrs are what a log record says about the row
+func (e *rowError) attrs() []any {
+	return []any{"row", e.row, "sample", e.sample, "error", e.err.Error()}
+}
+
+// logSample cuts line to logSampleBytes at a UTF-8 boundary, marking that it was cut
+func logSample(line []byte) string {
+	if len(line) <= logSampleBytes {
+		return string(line)
+	}
+	end := logSampleBytes
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return string(line[:end]) + "..."
+}
+
+// parseLogLevel parses the -log-level flag
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+	}
+}
+
+// newLogger returns the JSON logger -log-level and -log-file ask for, writing to stderr, which
+// ClickHouse keeps in its server log, unless -log-file is given. -debug logs at the debug level
+// to debugLogPath. file is the log file, nil for stderr.
+func (c *config) newLogger(stderr io.Writer) (log *slog.Logger, file *logFile, err error) {
+	level, err := parseLogLevel(c.logLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := c.logFile
+	if c.debug {
+		level = slog.LevelDebug
+		if path == "" {
+			path = debugLogPath
+		}
+	}
+	w := stderr
+	if path != "" {
+		if file, err = openLogFile(path); err != nil {
+			return nil, nil, err
+		}
+		w = file
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})), file, nil
+}
+
+// logFile is a file log records are appended to. SIGHUP reopens it at the same path, so it can
+// be rotated by moving it away.
+type logFile struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open log file error: %w", err)
+	}
+	return &logFile{path: path, f: f}, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// reopen closes the file and opens its path again, records keep going to the old file if that
+// fails
+func (l *logFile) reopen() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("reopen log file error: %w", err)
+	}
+	l.mu.Lock()
+	old := l.f
+	l.f = f
+	l.mu.Unlock()
+	return old.Close()
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// reopenOnHangup reopens files on SIGHUP. The keys file is reloaded on SIGHUP as well, by
+// keysFile.watch. With no files it still keeps SIGHUP from killing the process, as it does by
+// default, so a reload signal sent to every UDF process is safe.
+func reopenOnHangup(log *slog.Logger, files ...*logFile) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			for _, f := range files {
+				if err := f.reopen(); err != nil {
+					log.Warn("log file reopen error", "path", f.path, "error", err.Error())
+				}
+			}
+			if len(files) > 0 {
+				log.Info("reopened log files on SIGHUP")
+			}
+		}
+	}()
+}
@@ -0,0 +1,86 @@
+package jsondrop
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, nil))
+}
+
+// logRecords decodes the JSON log records in r
+func logRecords(t *testing.T, r io.Reader) []map[string]any {
+	var records []map[string]any
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record), scanner.Text())
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "udf.log")
+	c, err := parseConfig([]string{"-log-level=warn", "-log-file=" + path})
+	assert.NoError(t, err)
+	log, file, err := c.newLogger(io.Discard)
+	assert.NoError(t, err)
+	log.Info("left out")
+	err = newRowError(3, []byte(`{"a":`+strings.Repeat("é", 200)+`}`), errors.New("json parse error"))
+	log.Error("line processing error", err.(*rowError).attrs()...)
+	assert.NoError(t, file.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	records := logRecords(t, f)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "ERROR", records[0]["level"])
+	assert.Equal(t, "line processing error", records[0]["msg"])
+	assert.Equal(t, 3.0, records[0]["row"])
+	assert.Equal(t, "json parse error", records[0]["error"])
+	sample := records[0]["sample"].(string)
+	assert.True(t, strings.HasPrefix(sample, `{"a":éé`), sample)
+	assert.True(t, strings.HasSuffix(sample, "é..."), sample)
+
+	c, err = parseConfig([]string{"-log-level=loud"})
+	assert.NoError(t, err)
+	_, _, err = c.newLogger(io.Discard)
+	assert.ErrorContains(t, err, `unknown log level "loud"`)
+}
+
+func TestLogFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "udf.log")
+	file, err := openLogFile(path)
+	assert.NoError(t, err)
+	log := jsonLogger(file)
+	log.Info("before")
+	assert.NoError(t, os.Rename(path, path+".1"))
+	log.Info("after rename")
+	assert.NoError(t, file.reopen())
+	log.Info("after reopen")
+	assert.NoError(t, file.Close())
+
+	for name, want := range map[string][]string{path + ".1": {"before", "after rename"}, path: {"after reopen"}} {
+		f, err := os.Open(name)
+		assert.NoError(t, err)
+		var msgs []string
+		for _, record := range logRecords(t, f) {
+			msgs = append(msgs, record["msg"].(string))
+		}
+		f.Close()
+		assert.Equal(t, want, msgs, name)
+	}
+}
@@ -0,0 +1,1516 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fastjson"
+)
+
+type emptyT struct{}
+
+type node interface {
+	Write(*bytes.Buffer)
+	DropKeys(keys keySet) node
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindBool
+	kindNull
+)
+
+type valueNode struct {
+	kind valueKind
+	str  string
+	num  string
+	b    bool
+}
+
+func (v *valueNode) Write(buf *bytes.Buffer) {
+	switch v.kind {
+	case kindString:
+		writeJSONString(buf, v.str)
+	case kindNumber:
+		buf.WriteString(v.num)
+	case kindBool:
+		if v.b {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case kindNull:
+		buf.WriteString("null")
+	}
+}
+
+func (v *valueNode) DropKeys(keySet) node {
+	return v
+}
+
+type objectEntry struct {
+	key   string
+	value node
+}
+
+type objectNode struct {
+	entries []objectEntry
+}
+
+type entryInfo struct {
+	firstNonEmpty int
+	last          int
+	hasNonEmpty   bool
+}
+
+var entryInfoPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[string]entryInfo)
+	},
+}
+
+func (o *objectNode) Write(buf *bytes.Buffer) {
+	writeNode(buf, o)
+}
+
+type writeFrame struct {
+	object *objectNode
+	array  *arrayNode
+	next   int
+}
+
+// writeNode writes a document as compact JSON, the containers still open wait on a stack rather
+// than recursing
+func writeNode(buf *bytes.Buffer, n node) {
+	var scratch [32]writeFrame
+	stack := scratch[:0]
+	for n != nil {
+		switch v := n.(type) {
+		case *objectNode:
+			buf.WriteByte('{')
+			stack = append(stack, writeFrame{object: v})
+		case *arrayNode:
+			buf.WriteByte('[')
+			stack = append(stack, writeFrame{array: v})
+		default:
+			n.Write(buf)
+		}
+
+		// n becomes the next member of the innermost container with members left
+		n = nil
+		for n == nil && len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			switch {
+			case top.object != nil && top.next < len(top.object.entries):
+				if top.next > 0 {
+					buf.WriteByte(',')
+				}
+				entry := top.object.entries[top.next]
+				writeJSONString(buf, entry.key)
+				buf.WriteByte(':')
+				n = entry.value
+				top.next++
+			case top.array != nil && top.next < len(top.array.values):
+				if top.next > 0 {
+					buf.WriteByte(',')
+				}
+				n = top.array.values[top.next]
+				top.next++
+			case top.object != nil:
+				buf.WriteByte('}')
+				stack = stack[:len(stack)-1]
+			default:
+				buf.WriteByte(']')
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+func (o *objectNode) DropKeys(keysToDrop keySet) node {
+	return dropKeys(o, keysToDrop)
+}
+
+type dropFrame struct {
+	n    node
+	keys keySet
+	// path is n's, only kept track of for dropKeysPaths
+	path string
+}
+
+var dropStackPool = sync.Pool{
+	New: func() interface{} {
+		stack := make([]dropFrame, 0, 64)
+		return &stack
+	},
+}
+
+// dropKeys removes the keys matched by keys from n in place. The containers still to be visited
+// wait on a stack rather than recursing, so deep documents don't grow the goroutine stack.
+func dropKeys(n node, keys keySet) node {
+	return dropKeysPaths(n, keys, "", nil)
+}
+
+// dropKeysPaths is dropKeys, appending the path of everything it drops to paths unless it's nil,
+// n being at path
+func dropKeysPaths(n node, keys keySet, path string, paths *[]string) node {
+	pooled := dropStackPool.Get().(*[]dropFrame)
+	stack := append((*pooled)[:0], dropFrame{n: n, keys: keys, path: path})
+	dropped := uint64(0)
+	defer func() {
+		*pooled = stack[:0]
+		dropStackPool.Put(pooled)
+		if dropped > 0 && paths == nil {
+			droppedKeys.Add(dropped)
+		}
+	}()
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch v := f.n.(type) {
+		case *objectNode:
+			if len(v.entries) == 0 {
+				continue
+			}
+			v.entries = expandDottedEntries(v.entries, f.keys)
+
+			writeIdx := 0
+			for _, entry := range v.entries {
+				next, leaf := f.keys.matchLeaf(entry.key, entry.value)
+				var path string
+				if paths != nil && (leaf != nil || next != nil) {
+					path = joinPath(f.path, entry.key)
+				}
+				if leaf != nil {
+					recycleNode(entry.value)
+					dropped++
+					if paths != nil {
+						*paths = append(*paths, path)
+					} else {
+						countHit(leaf)
+					}
+					continue
+				}
+				if next != nil {
+					stack = append(stack, dropFrame{n: entry.value, keys: next, path: path})
+				}
+				v.entries[writeIdx] = entry
+				writeIdx++
+			}
+			v.entries = v.entries[:writeIdx]
+		case *arrayNode:
+			writeIdx := 0
+			count := len(v.values)
+			for i, value := range v.values {
+				next, leaf := f.keys.elementLeaf(i, count, value)
+				var path string
+				if paths != nil {
+					path = f.path + "[" + strconv.Itoa(i) + "]"
+				}
+				if leaf != nil {
+					recycleNode(value)
+					dropped++
+					if paths != nil {
+						*paths = append(*paths, path)
+					} else {
+						countHit(leaf)
+					}
+					continue
+				}
+				stack = append(stack, dropFrame{n: value, keys: next, path: path})
+				v.values[writeIdx] = value
+				writeIdx++
+			}
+			v.values = v.values[:writeIdx]
+		}
+	}
+	return n
+}
+
+// KeepKeys is the inverse of DropKeys: only entries on a path in keysToKeep survive.
+// Parent objects of a kept path are preserved even if they end up empty, unless prune is set.
+func (o *objectNode) KeepKeys(keysToKeep keySet, prune bool) node {
+	if len(o.entries) == 0 {
+		return o
+	}
+
+	o.entries = expandDottedEntries(o.entries, keysToKeep)
+
+	writeIdx := 0
+	for _, entry := range o.entries {
+		next, whole := keysToKeep.match(entry.key, entry.value)
+		if !whole {
+			if next == nil {
+				recycleNode(entry.value)
+				continue
+			}
+			kept, ok := keepNested(entry.value, next, prune)
+			if !ok {
+				// the path continues below a scalar, so nothing under it is kept
+				recycleNode(entry.value)
+				continue
+			}
+			entry.value = kept
+		}
+		o.entries[writeIdx] = entry
+		writeIdx++
+	}
+	o.entries = o.entries[:writeIdx]
+
+	return o
+}
+
+// KeepKeys keeps the array elements on a path in keysToKeep
+func (a *arrayNode) KeepKeys(keysToKeep keySet, prune bool) node {
+	writeIdx := 0
+	n := len(a.values)
+	for i, value := range a.values {
+		next, whole := keysToKeep.element(i, n, value)
+		if !whole {
+			if next == nil {
+				recycleNode(value)
+				continue
+			}
+			kept, ok := keepNested(value, next, prune)
+			if !ok {
+				recycleNode(value)
+				continue
+			}
+			value = kept
+		}
+		a.values[writeIdx] = value
+		writeIdx++
+	}
+	a.values = a.values[:writeIdx]
+	return a
+}
+
+// keepNested applies keep to a container reached by a partially matched path, with prune
+// set a container nothing was kept in doesn't survive either
+func keepNested(n node, keysToKeep keySet, prune bool) (node, bool) {
+	var kept node
+	switch v := n.(type) {
+	case *objectNode:
+		kept = v.KeepKeys(keysToKeep, prune)
+	case *arrayNode:
+		if !keysToKeep.reachesElements() {
+			return nil, false
+		}
+		kept = v.KeepKeys(keysToKeep, prune)
+	default:
+		return nil, false
+	}
+	if prune && isEmptyContainer(kept) {
+		return nil, false
+	}
+	return kept, true
+}
+
+func isEmptyContainer(n node) bool {
+	switch v := n.(type) {
+	case *objectNode:
+		return len(v.entries) == 0
+	case *arrayNode:
+		return len(v.values) == 0
+	default:
+		return false
+	}
+}
+
+// keepKeys applies KeepKeys to a top-level object or to the objects in a top-level array,
+// anything else passes through unchanged
+func keepKeys(n node, keysToKeep keySet, prune bool) node {
+	switch v := n.(type) {
+	case *objectNode:
+		return v.KeepKeys(keysToKeep, prune)
+	case *arrayNode:
+		count := len(v.values)
+		for i, value := range v.values {
+			next, whole := keysToKeep.element(i, count, value)
+			if obj, ok := value.(*objectNode); ok && !whole {
+				v.values[i] = obj.KeepKeys(next.union(keysToKeep), prune)
+			}
+		}
+		return v
+	default:
+		return n
+	}
+}
+
+type mergeKey struct {
+	parent *objectNode
+	key    string
+}
+
+var dottedIndexPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[mergeKey]*objectNode)
+	},
+}
+
+// expandDottedEntries turns keys containing dots into nested objects, e.g. {"a.b":1} into {"a":{"b":1}},
+// unless the key is matched literally by an escaped path in keys
+func expandDottedEntries(entries []objectEntry, keys keySet) []objectEntry {
+	needsExpand := false
+	for _, entry := range entries {
+		if indexByte(entry.key, '.') >= 0 && !keys.hasLiteral(entry.key) {
+			needsExpand = true
+			break
+		}
+	}
+	if !needsExpand {
+		return entries
+	}
+
+	expanded := make([]objectEntry, 0, len(entries))
+	index := dottedIndexPool.Get().(map[mergeKey]*objectNode)
+	for _, entry := range entries {
+		if indexByte(entry.key, '.') < 0 || keys.hasLiteral(entry.key) {
+			appendEntry(nil, &expanded, entry.key, entry.value, index)
+			continue
+		}
+		insertDottedKey(nil, &expanded, entry.key, entry.value, index)
+	}
+
+	for key := range index {
+		delete(index, key)
+	}
+	dottedIndexPool.Put(index)
+
+	return expanded
+}
+
+func appendEntry(parent *objectNode, entries *[]objectEntry, key string, value node, index map[mergeKey]*objectNode) {
+	*entries = append(*entries, objectEntry{key: key, value: value})
+	mk := mergeKey{parent: parent, key: key}
+	if obj, ok := value.(*objectNode); ok {
+		index[mk] = obj
+	} else {
+		delete(index, mk)
+	}
+}
+
+func insertDottedKey(parent *objectNode, entries *[]objectEntry, key string, value node, index map[mergeKey]*objectNode) {
+	for {
+		dot := indexByte(key, '.')
+		if dot < 0 {
+			appendEntry(parent, entries, key, value, index)
+			return
+		}
+		head := key[:dot]
+		rest := key[dot+1:]
+		mk := mergeKey{parent: parent, key: head}
+		target := index[mk]
+		if target == nil {
+			target = objectNodePool.Get().(*objectNode)
+			target.entries = target.entries[:0]
+			appendEntry(parent, entries, head, target, index)
+		}
+		parent = target
+		entries = &parent.entries
+		key = rest
+	}
+}
+
+func indexByte(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+type arrayNode struct {
+	values []node
+}
+
+func (a *arrayNode) Write(buf *bytes.Buffer) {
+	writeNode(buf, a)
+}
+
+// dropKeysFromElements treats every element of a top-level array as a document of its own,
+// paths apply to each element as well as "[n]" paths to the array itself
+func (a *arrayNode) dropKeysFromElements(keys keySet) node {
+	writeIdx := 0
+	n := len(a.values)
+	for i, value := range a.values {
+		next, leaf := keys.elementLeaf(i, n, value)
+		if leaf != nil {
+			countHit(leaf)
+			recycleNode(value)
+			droppedKeys.Add(1)
+			continue
+		}
+		a.values[writeIdx] = value.DropKeys(next.union(keys))
+		writeIdx++
+	}
+	a.values = a.values[:writeIdx]
+	return a
+}
+
+func (a *arrayNode) DropKeys(keys keySet) node {
+	return dropKeys(a, keys)
+}
+
+func isNonEmptyValue(n node) bool {
+	switch v := n.(type) {
+	case *valueNode:
+		switch v.kind {
+		case kindNull:
+			return false
+		case kindString:
+			return v.str != ""
+		default:
+			return true
+		}
+	default:
+		return true
+	}
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 0x20 && ch != '\\' && ch != '"' {
+			continue
+		}
+		if start < i {
+			buf.WriteString(s[start:i])
+		}
+		switch ch {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(ch)
+		case '\b':
+			buf.WriteString("\\b")
+		case '\f':
+			buf.WriteString("\\f")
+		case '\n':
+			buf.WriteString("\\n")
+		case '\r':
+			buf.WriteString("\\r")
+		case '\t':
+			buf.WriteString("\\t")
+		default:
+			buf.WriteString("\\u00")
+			const hex = "0123456789abcdef"
+			buf.WriteByte(hex[ch>>4])
+			buf.WriteByte(hex[ch&0x0f])
+		}
+		start = i + 1
+	}
+	if start < len(s) {
+		buf.WriteString(s[start:])
+	}
+	buf.WriteByte('"')
+}
+
+// decoder is the state parsing a row needs, pooled so rows reuse it rather than allocate it
+type decoder struct {
+	parser fastjson.Parser
+	stack  []convertFrame
+	root   node
+	// keys interns object keys, which mostly repeat from one row to the next
+	keys   map[string]string
+	number []byte
+}
+
+var decoderPool = sync.Pool{
+	New: func() interface{} {
+		return &decoder{keys: make(map[string]string)}
+	},
+}
+
+const (
+	// maxInternedKeys bounds a decoder's interned keys, they're forgotten once there are more
+	maxInternedKeys = 4096
+	// maxInternedKeyBytes is the longest key interned, longer ones are rarely shared
+	maxInternedKeyBytes = 64
+)
+
+// key returns key as a string, the same string every time it's seen
+func (d *decoder) key(key []byte) string {
+	if s, ok := d.keys[string(key)]; ok {
+		return s
+	}
+	s := string(key)
+	if len(key) <= maxInternedKeyBytes {
+		if len(d.keys) >= maxInternedKeys {
+			clear(d.keys)
+		}
+		d.keys[s] = s
+	}
+	return s
+}
+
+// scratchBufferPool holds buffers for building values that don't outlive the call
+var scratchBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+var valueNodePool = sync.Pool{
+	New: func() interface{} {
+		return &valueNode{}
+	},
+}
+
+var objectNodePool = sync.Pool{
+	New: func() interface{} {
+		return &objectNode{}
+	},
+}
+
+var arrayNodePool = sync.Pool{
+	New: func() interface{} {
+		return &arrayNode{}
+	},
+}
+
+// recycleNode puts a document back in the pools, nested containers wait on a stack rather than
+// recursing
+func recycleNode(n node) {
+	if v, ok := n.(*valueNode); ok {
+		v.str = ""
+		v.num = ""
+		valueNodePool.Put(v)
+		return
+	}
+	var scratch [32]node
+	stack := append(scratch[:0], n)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch v := n.(type) {
+		case *valueNode:
+			v.str = ""
+			v.num = ""
+			valueNodePool.Put(v)
+		case *objectNode:
+			for _, entry := range v.entries {
+				stack = append(stack, entry.value)
+			}
+			v.entries = v.entries[:0]
+			objectNodePool.Put(v)
+		case *arrayNode:
+			stack = append(stack, v.values...)
+			v.values = v.values[:0]
+			arrayNodePool.Put(v)
+		}
+	}
+}
+
+// depthLimit caps how deep documents are converted, maxDepth 0 leaves it to fastjson's MaxDepth
+type depthLimit struct {
+	maxDepth int
+	// prune drops objects and arrays with members deeper than maxDepth instead of failing
+	prune bool
+}
+
+// exceeded reports whether v, depth below the document, has members deeper than the limit
+func (l depthLimit) exceeded(depth int, v *fastjson.Value) bool {
+	return l.maxDepth > 0 && depth >= l.maxDepth && hasMembers(v)
+}
+
+// depthError fails documents nested deeper than -max-depth
+type depthError struct {
+	maxDepth int
+}
+
+func (e *depthError) Error() string {
+	return fmt.Sprintf("document is nested more than -max-depth=%d deep", e.maxDepth)
+}
+
+type convertFrame struct {
+	value *fastjson.Value
+	slot  *node
+	depth int
+}
+
+func convertFastJSON(value *fastjson.Value) (node, error) {
+	d := decoderPool.Get().(*decoder)
+	defer decoderPool.Put(d)
+	return d.convert(value, depthLimit{})
+}
+
+// convert converts a parsed document into pooled nodes. It keeps the containers still to be
+// filled on a stack rather than recursing, so stack use doesn't grow with nesting. Values are
+// depth keys or indexes below the document, the document itself is 0.
+func (d *decoder) convert(value *fastjson.Value, limit depthLimit) (node, error) {
+	if t := value.Type(); t != fastjson.TypeObject && t != fastjson.TypeArray {
+		return d.scalar(value)
+	}
+
+	stack := append(d.stack[:0], convertFrame{value: value, slot: &d.root})
+	defer func() {
+		d.stack = stack[:0]
+		d.root = nil
+	}()
+	var err error
+	// member converts a member of the container f is filling, scalars right away and containers
+	// once they're popped. slot adds the member and returns where its value goes, it isn't called
+	// for pruned containers.
+	member := func(f convertFrame, v *fastjson.Value, slot func() *node) {
+		switch v.Type() {
+		case fastjson.TypeObject, fastjson.TypeArray:
+			if limit.prune && limit.exceeded(f.depth+1, v) {
+				return
+			}
+			stack = append(stack, convertFrame{value: v, slot: slot(), depth: f.depth + 1})
+		default:
+			var child node
+			child, err = d.scalar(v)
+			*slot() = child
+		}
+	}
+
+	for len(stack) > 0 && err == nil {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !limit.prune && limit.exceeded(f.depth, f.value) {
+			err = &depthError{maxDepth: limit.maxDepth}
+			break
+		}
+
+		if f.value.Type() == fastjson.TypeObject {
+			obj, _ := f.value.Object()
+			objNode := objectNodePool.Get().(*objectNode)
+			if cap(objNode.entries) >= obj.Len() {
+				objNode.entries = objNode.entries[:0]
+			} else {
+				objNode.entries = make([]objectEntry, 0, obj.Len())
+			}
+			*f.slot = objNode
+			// entries has room for every member, so the slots taken here stay put
+			obj.Visit(func(key []byte, v *fastjson.Value) {
+				if err != nil {
+					return
+				}
+				member(f, v, func() *node {
+					objNode.entries = append(objNode.entries, objectEntry{key: d.key(key)})
+					return &objNode.entries[len(objNode.entries)-1].value
+				})
+			})
+			continue
+		}
+
+		values, _ := f.value.Array()
+		arrNode := arrayNodePool.Get().(*arrayNode)
+		if cap(arrNode.values) >= len(values) {
+			arrNode.values = arrNode.values[:0]
+		} else {
+			arrNode.values = make([]node, 0, len(values))
+		}
+		*f.slot = arrNode
+		for _, item := range values {
+			member(f, item, func() *node {
+				arrNode.values = append(arrNode.values, nil)
+				return &arrNode.values[len(arrNode.values)-1]
+			})
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		recycleConverted(d.root)
+		return nil, err
+	}
+	return d.root, nil
+}
+
+// scalar converts a value that isn't an object or array
+func (d *decoder) scalar(value *fastjson.Value) (node, error) {
+	vn := valueNodePool.Get().(*valueNode)
+	vn.str = ""
+	vn.num = ""
+	switch value.Type() {
+	case fastjson.TypeString:
+		vn.kind = kindString
+		vn.str = string(value.GetStringBytes())
+	case fastjson.TypeNumber:
+		vn.kind = kindNumber
+		d.number = value.MarshalTo(d.number[:0])
+		vn.num = string(d.number)
+	case fastjson.TypeTrue:
+		vn.kind = kindBool
+		vn.b = true
+	case fastjson.TypeFalse:
+		vn.kind = kindBool
+		vn.b = false
+	case fastjson.TypeNull:
+		vn.kind = kindNull
+	default:
+		valueNodePool.Put(vn)
+		return nil, fmt.Errorf("unexpected fastjson type %v", value.Type())
+	}
+	return vn, nil
+}
+
+// hasMembers reports whether v is an object or array that isn't empty
+func hasMembers(v *fastjson.Value) bool {
+	switch v.Type() {
+	case fastjson.TypeObject:
+		o, _ := v.Object()
+		return o.Len() > 0
+	case fastjson.TypeArray:
+		a, _ := v.Array()
+		return len(a) > 0
+	}
+	return false
+}
+
+// recycleConverted recycles a document convertFastJSONLimited gave up on, whose containers may
+// still have unfilled members
+func recycleConverted(root node) {
+	if root != nil {
+		recycleNode(root)
+	}
+}
+
+// transformFunc rewrites a parsed document, e.g. by dropping keys
+type transformFunc func(node) node
+
+func dropKeysFunc(keys *jsonKey) transformFunc {
+	return func(n node) node {
+		if arr, ok := n.(*arrayNode); ok {
+			return arr.dropKeysFromElements(keys.set())
+		}
+		return n.DropKeys(keys.set())
+	}
+}
+
+func keepKeysFunc(keys *jsonKey) transformFunc {
+	return func(n node) node {
+		return keepKeys(n, keys.set(), false)
+	}
+}
+
+// extractPathsFunc is a projection of the listed paths: like keepKeysFunc, but objects and arrays
+// are only there if something under them was kept, so missing paths leave no trace
+func extractPathsFunc(keys *jsonKey) transformFunc {
+	return func(n node) node {
+		return keepKeys(n, keys.set(), true)
+	}
+}
+
+func processLine(keys *jsonKey, rawLine []byte, buf *bytes.Buffer) error {
+	return transformLine(dropKeysFunc(keys), rawLine, buf)
+}
+
+// lineFunc turns one input row into its output row
+type lineFunc func(rawLine []byte, buf *bytes.Buffer) error
+
+func transformLine(transform transformFunc, rawLine []byte, buf *bytes.Buffer) error {
+	parsed, err := parseNode(rawLine)
+	if err != nil {
+		return err
+	}
+	result := transform(parsed)
+	buf.Reset()
+	buf.Grow(len(rawLine))
+	result.Write(buf)
+	recycleNode(result)
+	return nil
+}
+
+// parseNode parses a JSON document into a tree of pooled nodes
+func parseNode(raw []byte) (node, error) {
+	return parseNodeLimited(raw, depthLimit{})
+}
+
+// parseNodeLimited is parseNode with the nesting depth of the document capped by limit
+func parseNodeLimited(raw []byte, limit depthLimit) (node, error) {
+	d := decoderPool.Get().(*decoder)
+	defer decoderPool.Put(d)
+
+	value, err := d.parser.ParseBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("json parse error: %w", err)
+	}
+
+	parsed, err := d.convert(value, limit)
+	if err != nil {
+		if _, tooDeep := err.(*depthError); tooDeep {
+			return nil, err
+		}
+		return nil, fmt.Errorf("json parse error: %w", err)
+	}
+	return parsed, nil
+}
+
+// parseKeysArray parses the key argument, either ClickHouse's Array(String) text form ['a', 'b'] or a
+// JSON array ["a", "b"], whichever quote the first element uses
+func parseKeysArray(s string) ([]string, error) {
+	trimmed := strings.TrimLeft(strings.TrimSpace(s), "[ \t")
+	if !strings.HasPrefix(trimmed, `"`) {
+		return parseSingleQuotedArray(s)
+	}
+	v, err := fastjson.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %w", err)
+	}
+	values, err := v.Array()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(values))
+	for i, value := range values {
+		key, err := value.StringBytes()
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		result = append(result, string(key))
+	}
+	return result, nil
+}
+
+// parseSingleQuotedArray parses a Python-style array like ['a', 'b\'c'], ClickHouse also escapes
+// backslashes as \\ so that paths like 'a\\.b' arrive as a\.b
+func parseSingleQuotedArray(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, fmt.Errorf("expected array wrapped in []")
+	}
+	s = s[1 : len(s)-1] // strip [ ]
+
+	var result []string
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t")
+		if len(s) == 0 {
+			break
+		}
+		if s[0] != '\'' {
+			return nil, fmt.Errorf("expected single quote at start of string, got %q", s)
+		}
+		s = s[1:] // skip opening '
+
+		var sb strings.Builder
+		for {
+			if len(s) == 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			if s[0] == '\\' && len(s) > 1 && (s[1] == '\'' || s[1] == '\\') {
+				sb.WriteByte(s[1])
+				s = s[2:]
+				continue
+			}
+			if s[0] == '\'' {
+				s = s[1:] // skip closing '
+				break
+			}
+			sb.WriteByte(s[0])
+			s = s[1:]
+		}
+		result = append(result, sb.String())
+
+		s = strings.TrimLeft(s, " \t")
+		if len(s) > 0 && s[0] == ',' {
+			s = s[1:]
+		}
+	}
+	return result, nil
+}
+
+// transformOptions are the flags the modes are built with
+type transformOptions struct {
+	keyDict keyDictOptions
+	// placeholder replaces redacted values
+	placeholder string
+	// salt is prepended to values before hashing them
+	salt string
+	// ipv4Bits and ipv6Bits are the prefixes of addresses anonymize-ip keeps
+	ipv4Bits, ipv6Bits int
+	// recursive applies keyless modes to nested objects too
+	recursive bool
+	// empty lists the kinds of empty values drop-empty removes
+	empty string
+	// types lists the JSON types drop-by-type removes
+	types string
+	// maxBytes is the size shrink cuts documents down to
+	maxBytes int
+	// depth and prunePlaceholder configure prune-depth
+	depth            int
+	prunePlaceholder string
+	// delimiter and arrays configure flatten
+	delimiter, arrays string
+	// keyCase is the case transform-keys converts keys to
+	keyCase string
+	// detectors lists the PII detectors mask-pii runs
+	detectors string
+	// reportErrors makes validate output parse errors instead of 1/0
+	reportErrors bool
+	// collision is how promote resolves keys the parent already has
+	collision string
+	// wrapKey is the key wrap nests documents or members under
+	wrapKey string
+	// where is the filter expression array-filter keeps elements by
+	where string
+	// chainAttributes lists the attributes elements-chain removes
+	chainAttributes string
+	// erasures is the file of ids and the paths -mode=erase drops for them
+	erasures string
+	// document is applied to documents before they're transformed
+	document documentOptions
+	// truncate configures -mode=truncate
+	truncate truncateOptions
+}
+
+// hashSaltEnv is the environment variable holding the salt for -mode=hash, so it doesn't have to be
+// in the UDF XML or show up in the process list
+const hashSaltEnv = "JSON_UDF_HASH_SALT"
+
+// transformMode builds the transform for a -mode from the parsed key argument
+type transformMode struct {
+	build func(keys []string, opts transformOptions) (transformFunc, error)
+	// keyless modes work on the whole document, the key argument can be left out
+	keyless bool
+	// line is set instead of build by modes that don't output a transformed document
+	line func(opts transformOptions) (lineFunc, error)
+	// tsv modes take more than one argument per row, they read and write TabSeparated rows
+	// rather than Raw documents
+	tsv bool
+}
+
+var transformModes = map[string]transformMode{
+	"drop": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return dropKeysFunc(keyDict), nil
+	}},
+	"keep": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return keepKeysFunc(keyDict), nil
+	}},
+	"extract": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return extractPathsFunc(keyDict), nil
+	}},
+	"rename": {build: func(mappings []string, opts transformOptions) (transformFunc, error) {
+		keyDict, err := newRenameDict(mappings, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return renameKeysFunc(keyDict), nil
+	}},
+	"redact": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return redactKeysFunc(keyDict, opts.placeholder), nil
+	}},
+	"hash": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return hashValuesFunc(keyDict, opts.salt), nil
+	}},
+	"anonymize-ip": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		if opts.ipv4Bits < 0 || opts.ipv4Bits > 32 || opts.ipv6Bits < 0 || opts.ipv6Bits > 128 {
+			return nil, fmt.Errorf("-ipv4-prefix must be between 0 and 32 and -ipv6-prefix between 0 and 128")
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return anonymizeIPsFunc(keyDict, opts.ipv4Bits, opts.ipv6Bits, opts.placeholder), nil
+	}},
+	"drop-nulls": {keyless: true, build: func(_ []string, opts transformOptions) (transformFunc, error) {
+		return dropNullsFunc(opts.recursive), nil
+	}},
+	"drop-empty": {keyless: true, build: func(_ []string, opts transformOptions) (transformFunc, error) {
+		classes, err := parseEmptyClasses(opts.empty)
+		if err != nil {
+			return nil, err
+		}
+		return dropEmptyFunc(classes), nil
+	}},
+	"drop-by-value": {build: func(values []string, _ transformOptions) (transformFunc, error) {
+		set, err := newValueSet(values)
+		if err != nil {
+			return nil, err
+		}
+		return dropByValueFunc(set), nil
+	}},
+	"drop-by-type": {keyless: true, build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		types, err := parseJSONTypes(opts.types)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return dropByTypeFunc(nil, types), nil
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return dropByTypeFunc(keyDict, types), nil
+	}},
+	"prune-depth": {keyless: true, build: func(_ []string, opts transformOptions) (transformFunc, error) {
+		if opts.depth < 1 {
+			return nil, fmt.Errorf("-depth must be at least 1")
+		}
+		return pruneDepthFunc(opts.depth, opts.prunePlaceholder), nil
+	}},
+	"shrink": {keyless: true, build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		if opts.maxBytes < 2 {
+			return nil, fmt.Errorf("-max-bytes must be at least 2")
+		}
+		// one trie per path, so they're applied in order
+		priority := make([]*jsonKey, 0, len(keys))
+		for _, key := range keys {
+			keyDict, err := newKeyDict([]string{key}, opts.keyDict)
+			if err != nil {
+				return nil, err
+			}
+			priority = append(priority, keyDict)
+		}
+		return shrinkFunc(priority, opts.maxBytes), nil
+	}},
+	"flatten": {keyless: true, build: func(_ []string, opts transformOptions) (transformFunc, error) {
+		indexArrays, err := parseArrayPolicy(opts.arrays)
+		if err != nil {
+			return nil, err
+		}
+		return flattenFunc(flattenOptions{delimiter: opts.delimiter, indexArrays: indexArrays}), nil
+	}},
+	"unflatten": {keyless: true, build: func(_ []string, opts transformOptions) (transformFunc, error) {
+		indexArrays, err := parseArrayPolicy(opts.arrays)
+		if err != nil {
+			return nil, err
+		}
+		return unflattenFunc(flattenOptions{delimiter: opts.delimiter, indexArrays: indexArrays}), nil
+	}},
+	"sort-keys": {keyless: true, build: func([]string, transformOptions) (transformFunc, error) {
+		return sortKeysFunc(), nil
+	}},
+	"truncate": {keyless: true, build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		if opts.truncate.maxBytes < 0 {
+			return nil, fmt.Errorf("-max-string-bytes must not be negative")
+		}
+		if len(keys) == 0 {
+			return truncateStringsFunc(nil, opts.truncate), nil
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return truncateStringsFunc(keyDict, opts.truncate), nil
+	}},
+	"coerce-numbers": {keyless: true, build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		if len(keys) == 0 {
+			return coerceNumbersFunc(nil), nil
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return coerceNumbersFunc(keyDict), nil
+	}},
+	"promote": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		overwrite, err := parseCollisionPolicy(opts.collision)
+		if err != nil {
+			return nil, err
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return promoteFunc(keyDict, overwrite), nil
+	}},
+	"wrap": {keyless: true, build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		if opts.wrapKey == "" {
+			return nil, fmt.Errorf("-mode=wrap needs a -wrap-key")
+		}
+		if len(keys) == 0 {
+			return wrapFunc(nil, opts.wrapKey), nil
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return wrapFunc(keyDict, opts.wrapKey), nil
+	}},
+	"array-filter": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		if opts.where == "" {
+			return nil, fmt.Errorf("-mode=array-filter needs a -where expression")
+		}
+		keep, err := compileFilter(opts.where)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -where expression: %w", err)
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return arrayFilterFunc(keyDict, keep), nil
+	}},
+	"list-paths": {keyless: true, build: func([]string, transformOptions) (transformFunc, error) {
+		return listPathsFunc(), nil
+	}},
+	"count-keys": {keyless: true, build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		if len(keys) == 0 {
+			return countKeysFunc(nil, opts.recursive), nil
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return countKeysFunc(keyDict, opts.recursive), nil
+	}},
+	"transform-keys": {keyless: true, build: func(_ []string, opts transformOptions) (transformFunc, error) {
+		return transformKeysFunc(opts.keyCase)
+	}},
+	"mask-pii": {keyless: true, build: func(_ []string, opts transformOptions) (transformFunc, error) {
+		detectors, err := parsePIIDetectors(opts.detectors)
+		if err != nil {
+			return nil, err
+		}
+		return maskPIIFunc(detectors), nil
+	}},
+	"validate": {keyless: true, line: func(opts transformOptions) (lineFunc, error) {
+		return validateLineFunc(opts.reportErrors, opts.document.duplicateKeys), nil
+	}},
+	"merge-patch": {keyless: true, tsv: true, line: func(transformOptions) (lineFunc, error) {
+		return mergePatchLineFunc(), nil
+	}},
+	"set-defaults": {keyless: true, tsv: true, line: func(transformOptions) (lineFunc, error) {
+		return setDefaultsLineFunc(), nil
+	}},
+	"diff": {keyless: true, tsv: true, line: func(transformOptions) (lineFunc, error) {
+		return diffLineFunc(), nil
+	}},
+	"elements-chain": {build: func(keys []string, opts transformOptions) (transformFunc, error) {
+		attrs, err := parseChainAttributes(opts.chainAttributes)
+		if err != nil {
+			return nil, err
+		}
+		keyDict, err := newKeyDict(keys, opts.keyDict)
+		if err != nil {
+			return nil, err
+		}
+		return elementsChainFunc(keyDict, attrs), nil
+	}},
+	eraseMode: {keyless: true, tsv: true, line: eraseLineFunc},
+}
+
+// Main runs the UDF binary with os.Args, or the subcommand they name, and exits when it's done.
+// cmd/json_drop_keys_udf is only this.
+func Main() {
+	if len(os.Args) > 1 && os.Args[1] == benchCommand {
+		os.Exit(runBench(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == genconfigCommand {
+		os.Exit(runGenconfig(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == installCommand {
+		os.Exit(runInstall(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == sqlCommand {
+		os.Exit(runSQL(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == serveCommand {
+		os.Exit(runServe(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == grpcCommand {
+		os.Exit(runGRPC(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == replayCommand {
+		os.Exit(runReplay(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == localCommand {
+		os.Exit(runLocal(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	args := append(programFunctionArgs(os.Args[0]), os.Args[1:]...)
+	cfg, err := parseConfig(args)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if cfg.version {
+		if err := writeBuildInfo(os.Stdout, currentBuild()); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if cfg.handshake {
+		// written directly rather than logged, so it's the same line whatever -log-file says
+		b := currentBuild()
+		b.Flags = cfg.flagArgs
+		_ = writeBuildInfo(os.Stderr, b)
+	}
+	logger, mainLog, err := cfg.newLogger(os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	var exit shutdown
+	defer exit.finish()
+	var logFiles []*logFile
+	if mainLog != nil {
+		logFiles = append(logFiles, mainLog)
+		exit.atExit(func() { _ = mainLog.Close() })
+	}
+	logger.Debug("starting", "keysToDrop", cfg.keysArg, "flags", cfg.flagArgs)
+	cfg.warn = func(key, reason string) {
+		logger.Warn("key list entry has no effect", "key", key, "reason", reason)
+	}
+	if errorSample = newSampledErrorLog(logger, cfg.errorLogSample); errorSample != nil {
+		exit.atExit(errorSample.close)
+	}
+
+	var stats *runStats
+	if cfg.statsInterval > 0 || cfg.statsRows > 0 || cfg.metricsListen != "" || cfg.pathStats {
+		statsLog := logger
+		if cfg.statsFile != "" {
+			f, err := openLogFile(cfg.statsFile)
+			if err != nil {
+				logger.Error("open stats file error", "error", err.Error())
+				exit.exit(1)
+			}
+			logFiles = append(logFiles, f)
+			exit.atExit(func() { _ = f.Close() })
+			statsLog = slog.New(slog.NewJSONHandler(f, nil))
+		}
+		stats = newRunStats(statsLog, cfg.statsInterval, cfg.statsRows)
+		if cfg.pathStats {
+			stats.paths = &pathHits
+		}
+		exit.atExit(stats.close)
+		if cfg.metricsListen != "" {
+			stats.latency = &latencyHistogram{}
+			// the pool may run several processes of a function, only the first gets the port
+			if err := listenMetrics(cfg.metricsListen, stats); err != nil {
+				logger.Warn("metrics listener not started", "error", err.Error())
+			}
+		}
+	}
+
+	reopenOnHangup(logger, logFiles...)
+
+	binaryRows, err := cfg.rowBinary()
+	if err != nil {
+		logger.Error("format error", "error", err.Error())
+		exit.exit(2)
+	}
+	csv, err := cfg.csvRows()
+	if err != nil {
+		logger.Error("format error", "error", err.Error())
+		exit.exit(2)
+	}
+	var native *nativeReader
+	if cfg.format == "native" || cfg.format == "arrowstream" {
+		native = newNativeReader(binaryRows)
+	}
+	if cfg.format == "arrowstream" {
+		native.arrow = &arrowReader{native: native}
+	}
+
+	var file *keysFile
+	if cfg.keysFile != "" {
+		file = &keysFile{path: cfg.keysFile}
+	}
+
+	// buildTransform parses the key argument and the keys file. The key argument is a query parameter
+	// rather than a column, so this runs once per process and again only when the keys file changes.
+	buildTransform := func() (lineFunc, error) {
+		var fileKeys []string
+		if file != nil {
+			var err error
+			fileKeys, err = file.read()
+			if err != nil {
+				return nil, err
+			}
+		}
+		process, err := cfg.lineFunc(fileKeys, file != nil)
+		if err != nil {
+			return nil, err
+		}
+		if binaryRows != nil {
+			process = binaryRows.lineFunc(process)
+		}
+		if csv != nil {
+			process = csv.lineFunc(process)
+		}
+		if native != nil && cfg.workers <= 1 {
+			var paths *pathHitCounts
+			if cfg.pathStats {
+				paths = &pathHits
+			}
+			process = repeatedRows(process, native.constantRow, paths)
+		}
+		if stats != nil {
+			process = stats.lineFunc(process)
+		}
+		return process, nil
+	}
+
+	process, err := buildTransform()
+	if err != nil {
+		logger.Error("keysToDrop parse error", "error", err.Error())
+		exit.exit(1)
+	}
+	if file != nil {
+		file.watch(cfg.keysFileInterval)
+	}
+
+	stopProfiling, err := cfg.startProfiling(logger)
+	if err != nil {
+		logger.Error("profiling error", "error", err.Error())
+		exit.exit(1)
+	}
+	exit.atExit(func() {
+		if err := stopProfiling(); err != nil {
+			logger.Error("profiling error", "error", err.Error())
+		}
+	})
+
+	reader := bufio.NewReaderSize(os.Stdin, 4*1024*1024)
+	stdout := bufio.NewWriterSize(os.Stdout, 4*1024*1024)
+	var writer rowWriter = stdout
+	closeOutput := stdout.Flush
+	if native != nil {
+		blocks := newNativeWriter(stdout, binaryRows)
+		if native.arrow != nil {
+			blocks.arrow = &arrowWriter{}
+		}
+		writer, closeOutput = blocks, blocks.Close
+	}
+	exit.atExit(func() { _ = closeOutput() })
+	exit.onSignals(logger)
+	buf := bytes.NewBuffer(make([]byte, 0, 64*1024))
+
+	lines := newLineReader(reader, cfg.maxLineBytes)
+	lines.chunked = cfg.chunkHeader
+	lines.binary = binaryRows
+	lines.native = native
+	lines.csv = csv != nil
+	if stats != nil {
+		lines.startChunk = stats.startChunk
+	}
+	tooLongPolicy, tsv := cfg.tooLongPolicy()
+
+	if cfg.workers > 1 {
+		err := runWorkers(cfg.workers, rowLoop{
+			lines:    lines,
+			buffered: reader.Buffered,
+			w:        writer,
+			flush:    writer.Flush,
+			build:    buildTransform,
+			stale: func() bool {
+				return file != nil && file.stale.Swap(false)
+			},
+			tooLongPolicy: tooLongPolicy,
+			tsv:           tsv,
+			log:           logger,
+			output:        &exit.output,
+		})
+		var readErr *readError
+		var rowErr *rowError
+		if errors.As(err, &readErr) {
+			logger.Error("stdin read error", "error", err.Error())
+		} else if errors.As(err, &rowErr) {
+			logger.Error("line processing error", rowErr.attrs()...)
+			exit.exit(1)
+		} else if err != nil {
+			logger.Error("line processing error", "error", err.Error())
+			exit.exit(1)
+		}
+		return
+	}
+
+	for {
+		line, hadNewline, err := lines.next()
+		var tooLong *lineTooLongError
+		if errors.As(err, &tooLong) {
+			sample := logSample(line)
+			exit.output.Lock()
+			hadNewline, err = tooLongRow(lines, line, tooLongPolicy, tsv, writer, buf)
+			if err == nil && hadNewline {
+				_, _ = writer.WriteString("\n")
+			}
+			if err == nil && lines.flushDue(reader.Buffered()) {
+				_ = writer.Flush()
+			}
+			exit.output.Unlock()
+			if errors.As(err, &tooLong) {
+				logger.Error("line processing error", "row", lines.row, "sample", sample, "error", err.Error())
+				exit.exit(1)
+			}
+			if err != nil {
+				logger.Error("stdin read error", "error", err.Error())
+				return
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			logger.Error("stdin read error", "error", err.Error())
+			return
+		}
+
+		if len(line) == 0 && err == io.EOF {
+			return
+		}
+
+		if file != nil && file.stale.Swap(false) {
+			if reloaded, err := buildTransform(); err != nil {
+				logger.Warn("keys file reload error, keeping previous keys", "error", err.Error())
+			} else {
+				process = reloaded
+				logger.Info("keys file reloaded", "path", file.path)
+			}
+		}
+
+		procErr := process(line, buf)
+		if procErr != nil {
+			logger.Error("line processing error", newRowError(lines.row, line, procErr).attrs()...)
+			exit.exit(1)
+		}
+
+		exit.output.Lock()
+		_, _ = writer.Write(buf.Bytes())
+		if hadNewline {
+			_, _ = writer.WriteString("\n")
+		}
+		// executable_pool waits for a block's results before sending the next one, so they're
+		// flushed at the end of every chunk and, for lines, whenever there's no more input to go
+		// on with
+		if lines.flushDue(reader.Buffered()) {
+			_ = writer.Flush()
+		}
+		exit.output.Unlock()
+
+		if err == io.EOF {
+			return
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// udfCommand runs the test binary again as the UDF started with args, for tests of what the
+// process does as a whole
+func udfCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUDFProcess$")
+	cmd.Env = append(os.Environ(), "JSONDROP_UDF_ARGS="+strings.Join(args, "\n"))
+	return cmd
+}
+
+// TestUDFProcess is the process udfCommand starts, it does nothing in a plain test run
+func TestUDFProcess(t *testing.T) {
+	args, ok := os.LookupEnv("JSONDROP_UDF_ARGS")
+	if !ok {
+		t.Skip("only run by udfCommand")
+	}
+	os.Args = append([]string{"json_drop_keys_udf"}, strings.Split(args, "\n")...)
+	Main()
+	// as the binary would, rather than going on to report the test
+	os.Exit(0)
+}
+
+func TestProcessLineErrorsOnMalformedJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := processLine(nil, []byte("{\"a\":"), &buf)
+	assert.Error(t, err, "expected error for malformed JSON, got nil")
+}
+
+func TestDropKeysJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			"empty",
+			"{}",
+			"{}",
+			nil,
+		},
+		{
+			"empty2",
+			"{}",
+			"{}",
+			[]string{"jeden"},
+		},
+		{
+			"one one key to be dropped",
+			`{"jeden": 1}`,
+			`{}`,
+			[]string{"jeden"},
+		},
+		{
+			name:  "one key to be dropped, one to be kept",
+			input: `{"jeden": 1, "dwa": 2}`,
+			want:  `{"dwa":2}`,
+			keys:  []string{"jeden"},
+		},
+		{
+			name:  "one key to be dropped one to be kept (order doesnt matter)",
+			input: `{"dwa": 2, "jeden": 1}`,
+			want:  `{"dwa":2}`,
+			keys:  []string{"jeden"},
+		},
+		{
+			name:  "multiple keys to be dropped one to be kept (order doesnt matter)",
+			input: `{"dwa": 2, "jeden": 1, "trzy": 3, "cztery": 4, "piec": {"dwa": 1}}`,
+			want:  `{"jeden":1,"cztery":4,"piec":{"dwa":1}}`,
+			keys:  []string{"dwa", "trzy"},
+		},
+		{
+			name:  "drop nested key with dot notation",
+			input: `{"id":1,"props":{"secret":"xxx","public":"yyy"}}`,
+			want:  `{"id":1,"props":{"public":"yyy"}}`,
+			keys:  []string{"props.secret"},
+		},
+		{
+			name:  "drop deeply nested key",
+			input: `{"a":{"b":{"c":1,"d":2}}}`,
+			want:  `{"a":{"b":{"d":2}}}`,
+			keys:  []string{"a.b.c"},
+		},
+		{
+			name:  "drop entire nested object",
+			input: `{"a":{"b":1},"c":2}`,
+			want:  `{"c":2}`,
+			keys:  []string{"a"},
+		},
+		{
+			name:  "wildcard drops every top-level key",
+			input: `{"a":1,"b":{"c":2}}`,
+			want:  `{}`,
+			keys:  []string{"*"},
+		},
+		{
+			name:  "wildcard parent",
+			input: `{"a":{"token":1,"x":2},"b":{"token":3},"token":4}`,
+			want:  `{"a":{"x":2},"b":{},"token":4}`,
+			keys:  []string{"*.token"},
+		},
+		{
+			name:  "wildcard in the middle of a path",
+			input: `{"props":{"a":{"secret":1,"ok":2},"b":{"secret":3}},"secret":4}`,
+			want:  `{"props":{"a":{"ok":2},"b":{}},"secret":4}`,
+			keys:  []string{"props.*.secret"},
+		},
+		{
+			name:  "wildcard and exact paths overlap",
+			input: `{"a":{"b":1,"c":2,"d":3},"x":{"b":4,"c":5}}`,
+			want:  `{"a":{"d":3},"x":{"b":4}}`,
+			keys:  []string{"a.b", "*.c"},
+		},
+		{
+			name:  "recursive descent drops a key at any depth",
+			input: `{"password":1,"a":{"password":2,"b":{"password":3,"c":4}},"d":[{"password":5},[{"password":6}]]}`,
+			want:  `{"a":{"b":{"c":4}},"d":[{},[{}]]}`,
+			keys:  []string{"**.password"},
+		},
+		{
+			name:  "recursive descent below a parent",
+			input: `{"token":1,"a":{"token":2,"b":{"token":3}}}`,
+			want:  `{"token":1,"a":{"b":{}}}`,
+			keys:  []string{"a.**.token"},
+		},
+		{
+			name:  "recursive descent with a nested path",
+			input: `{"a":{"b":1,"c":2},"x":{"y":{"a":{"b":3}}},"b":4}`,
+			want:  `{"a":{"c":2},"x":{"y":{"a":{}}},"b":4}`,
+			keys:  []string{"**.a.b"},
+		},
+		{
+			name:  "trailing recursive descent drops everything below",
+			input: `{"a":{"b":{"c":1}},"d":2}`,
+			want:  `{"a":{},"d":2}`,
+			keys:  []string{"a.**"},
+		},
+		{
+			name:  "regex drops matching top-level keys",
+			input: `{"$ph_a":1,"$ph_b":{"c":2},"ph_c":3,"x":4}`,
+			want:  `{"ph_c":3,"x":4}`,
+			keys:  []string{`re:^\$ph_.*`},
+		},
+		{
+			name:  "regex at a nested level",
+			input: `{"props":{"secret_a":1,"secret_b":2,"public":3},"secret_c":4}`,
+			want:  `{"props":{"public":3},"secret_c":4}`,
+			keys:  []string{"props.re:^secret_"},
+		},
+		{
+			name:  "regex under recursive descent",
+			input: `{"a":{"x_token":1,"b":[{"y_token":2,"z":3}]}}`,
+			want:  `{"a":{"b":[{"z":3}]}}`,
+			keys:  []string{"**.re:_token$"},
+		},
+		{
+			name:  "prefix matcher",
+			input: `{"$set":1,"$ip":2,"id":3,"props":{"$lib":4}}`,
+			want:  `{"id":3,"props":{"$lib":4}}`,
+			keys:  []string{"prefix:$"},
+		},
+		{
+			name:  "suffix matcher at a nested level",
+			input: `{"props":{"access_token":1,"refresh_token":2,"token_type":3},"id_token":4}`,
+			want:  `{"props":{"token_type":3},"id_token":4}`,
+			keys:  []string{"props.suffix:_token"},
+		},
+		{
+			name:  "conditional drop based on a sibling value",
+			input: `{"props":{"type":"password","value":"hunter2"},"other":{"type":"text","value":"hi"}}`,
+			want:  `{"props":{"type":"password"},"other":{"type":"text","value":"hi"}}`,
+			keys:  []string{"props?(@.type=='password').value"},
+		},
+		{
+			name:  "conditional drop is skipped when the condition fails",
+			input: `{"props":{"type":"text","value":"hi"}}`,
+			want:  `{"props":{"type":"text","value":"hi"}}`,
+			keys:  []string{"props?(@.type=='password').value"},
+		},
+		{
+			name:  "conditional wildcard",
+			input: `{"a":{"type":"password","value":1},"b":{"type":"text","value":2},"c":3}`,
+			want:  `{"a":{"type":"password"},"b":{"type":"text","value":2},"c":3}`,
+			keys:  []string{"*?(@.type=='password' || @.type=='token').value"},
+		},
+		{
+			name:  "condition on the dropped value itself",
+			input: `{"props":{"a":"undefined","b":"x"}}`,
+			want:  `{"props":{"b":"x"}}`,
+			keys:  []string{"props.*?(@=='undefined')"},
+		},
+		{
+			name:  "filter segment in a dotted path",
+			input: `{"items":[{"kind":"card","number":"4242"},{"kind":"cash","number":"1"}]}`,
+			want:  `{"items":[{"kind":"card"},{"kind":"cash","number":"1"}]}`,
+			keys:  []string{"items[?(@.kind=='card')].number"},
+		},
+		{
+			name:  "array index drops a key from one element",
+			input: `{"items":[{"secret":1,"a":2},{"secret":3}]}`,
+			want:  `{"items":[{"a":2},{"secret":3}]}`,
+			keys:  []string{"items[0].secret"},
+		},
+		{
+			name:  "array index drops a whole element",
+			input: `{"items":[1,2,3]}`,
+			want:  `{"items":[1,3]}`,
+			keys:  []string{"items[1]"},
+		},
+		{
+			name:  "negative array index counts from the end",
+			input: `{"items":[1,2,3]}`,
+			want:  `{"items":[1,2]}`,
+			keys:  []string{"items[-1]"},
+		},
+		{
+			name:  "nested array indexes",
+			input: `{"m":[[1,{"x":1,"y":2}],[3]]}`,
+			want:  `{"m":[[1,{"y":2}],[3]]}`,
+			keys:  []string{"m[0][1].x"},
+		},
+		{
+			name:  "array index on a top-level array",
+			input: `[{"a":1},{"a":2}]`,
+			want:  `[{"a":1},{}]`,
+			keys:  []string{"[1].a"},
+		},
+		{
+			name:  "array wildcard drops a key from every element",
+			input: `{"items":[{"secret":1,"a":2},{"secret":3},4]}`,
+			want:  `{"items":[{"a":2},{},4]}`,
+			keys:  []string{"items[*].secret"},
+		},
+		{
+			name:  "array wildcard in the middle of a path",
+			input: `{"a":{"b":[{"c":1,"d":2},{"c":3}]}}`,
+			want:  `{"a":{"b":[{"d":2},{}]}}`,
+			keys:  []string{"a.b[*].c"},
+		},
+		{
+			name:  "array wildcard drops all elements",
+			input: `{"items":[1,2],"x":1}`,
+			want:  `{"items":[],"x":1}`,
+			keys:  []string{"items[*]"},
+		},
+		{
+			name:  "deep prefix drops a key by name at any depth",
+			input: `{"email":1,"a":{"email":2,"b":[{"email":3,"c":4}]},"d":[[{"email":5}]]}`,
+			want:  `{"a":{"b":[{"c":4}]},"d":[[{}]]}`,
+			keys:  []string{"deep:email"},
+		},
+		{
+			name:  "escaped dot drops a literal dotted key only",
+			input: `{"$browser.version":"1","$browser":{"version":"2","name":"x"}}`,
+			want:  `{"$browser":{"version":"2","name":"x"}}`,
+			keys:  []string{`$browser\.version`},
+		},
+		{
+			name:  "dotted path matches the expanded literal key too",
+			input: `{"$browser.version":"1","other.key":2}`,
+			want:  `{"$browser":{},"other":{"key":2}}`,
+			keys:  []string{"$browser.version"},
+		},
+		{
+			name:  "escaped literal key below a parent",
+			input: `{"props":{"a.b":1,"a":{"b":2}}}`,
+			want:  `{"props":{"a":{"b":2}}}`,
+			keys:  []string{`props.a\.b`},
+		},
+		{
+			name:  "escaped wildcard is a literal key",
+			input: `{"*":1,"a":2}`,
+			want:  `{"a":2}`,
+			keys:  []string{`\*`},
+		},
+		{
+			name:  "json pointer",
+			input: `{"id":1,"props":{"secret":"xxx","public":"yyy"}}`,
+			want:  `{"id":1,"props":{"public":"yyy"}}`,
+			keys:  []string{"/props/secret"},
+		},
+		{
+			name:  "json pointer with escaped slash and literal dot",
+			input: `{"a/b":1,"c.d":2,"c":{"d":3}}`,
+			want:  `{"c":{"d":3}}`,
+			keys:  []string{"/a~1b", "/c.d"},
+		},
+		{
+			name:  "json pointer numeric token on arrays and objects",
+			input: `{"a":[{"b":1,"c":2}],"o":{"0":{"b":3,"c":4}}}`,
+			want:  `{"a":[{"c":2}],"o":{"0":{"c":4}}}`,
+			keys:  []string{"/a/0/b", "/o/0/b"},
+		},
+		{
+			name:  "top-level array applies drops to each element",
+			input: `[{"id":1,"a":"x"},{"id":2,"a":"y","b":{"a":1}},3,[{"a":2}]]`,
+			want:  `[{"id":1},{"id":2,"b":{"a":1}},3,[{"a":2}]]`,
+			keys:  []string{"a"},
+		},
+		{
+			name:  "top-level array with nested and recursive paths",
+			input: `[{"props":{"secret":1,"ok":2}},{"x":{"token":3}}]`,
+			want:  `[{"props":{"ok":2}},{"x":{}}]`,
+			keys:  []string{"props.secret", "**.token"},
+		},
+		{
+			name:  "array index on an object is a no-op",
+			input: `{"items":{"0":{"secret":1}}}`,
+			want:  `{"items":{"0":{"secret":1}}}`,
+			keys:  []string{"items[0].secret"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := processLine(mustKeyDict(t, c.keys), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+// TestDropKeysRoundTrip checks what survives a drop untouched: key order, duplicate keys and
+// number formatting are kept as they were, only whitespace and string escapes are normalized
+func TestDropKeysRoundTrip(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+	}{
+		{"key order", `{"z":1,"a":2,"m":{"y":1,"b":2}}`, `{"z":1,"a":2,"m":{"y":1,"b":2}}`},
+		{"duplicate keys", `{"a":1,"a":2,"drop":3}`, `{"a":1,"a":2}`},
+		{"big integers", `{"id":12345678901234567890,"neg":-9223372036854775809}`, `{"id":12345678901234567890,"neg":-9223372036854775809}`},
+		{"number formatting", `{"e":1e2,"f":1.50,"E":2E-3,"z":-0}`, `{"e":1e2,"f":1.50,"E":2E-3,"z":-0}`},
+		{"whitespace", `{ "a" : [ 1 , 2 ] , "drop" : 3 }`, `{"a":[1,2]}`},
+		{"escapes", `{"a":"\/\u00e9\n"}`, `{"a":"/é\n"}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := processLine(mustKeyDict(t, []string{"drop"}), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestKeepKeysJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			name:  "no keys keeps nothing",
+			input: `{"a":1,"b":2}`,
+			want:  `{}`,
+			keys:  nil,
+		},
+		{
+			name:  "keep top-level keys",
+			input: `{"a":1,"b":2,"c":3}`,
+			want:  `{"a":1,"c":3}`,
+			keys:  []string{"a", "c"},
+		},
+		{
+			name:  "keep whole nested object",
+			input: `{"id":1,"props":{"secret":"xxx","public":"yyy"}}`,
+			want:  `{"props":{"secret":"xxx","public":"yyy"}}`,
+			keys:  []string{"props"},
+		},
+		{
+			name:  "keep nested key with dot notation",
+			input: `{"id":1,"props":{"secret":"xxx","public":"yyy"}}`,
+			want:  `{"id":1,"props":{"public":"yyy"}}`,
+			keys:  []string{"id", "props.public"},
+		},
+		{
+			name:  "parent is kept even if nested key is missing",
+			input: `{"props":{"secret":"xxx"}}`,
+			want:  `{"props":{}}`,
+			keys:  []string{"props.public"},
+		},
+		{
+			name:  "nested path through non-object is not kept",
+			input: `{"props":"flat","other":1}`,
+			want:  `{}`,
+			keys:  []string{"props.public"},
+		},
+		{
+			name:  "dotted input keys are matched as paths",
+			input: `{"props.public":"yyy","props.secret":"xxx"}`,
+			want:  `{"props":{"public":"yyy"}}`,
+			keys:  []string{"props.public"},
+		},
+		{
+			name:  "keep with wildcard parent",
+			input: `{"a":{"id":1,"x":2},"b":{"id":3},"c":4}`,
+			want:  `{"a":{"id":1},"b":{"id":3}}`,
+			keys:  []string{"*.id"},
+		},
+		{
+			name:  "keep with recursive descent",
+			input: `{"id":1,"a":{"id":2,"x":3},"items":[{"id":4,"y":5},6],"z":7}`,
+			want:  `{"id":1,"a":{"id":2},"items":[{"id":4}]}`,
+			keys:  []string{"**.id"},
+		},
+		{
+			name:  "keep a key from one array element",
+			input: `{"items":[{"id":1,"x":2},{"id":3}],"z":4}`,
+			want:  `{"items":[{"id":1}]}`,
+			keys:  []string{"items[0].id"},
+		},
+		{
+			name:  "keep a key from every array element",
+			input: `{"items":[{"id":1,"x":2},{"id":3},4],"z":5}`,
+			want:  `{"items":[{"id":1},{"id":3}]}`,
+			keys:  []string{"items[*].id"},
+		},
+		{
+			name:  "nested path through array is not kept",
+			input: `{"items":[{"id":1}],"z":2}`,
+			want:  `{}`,
+			keys:  []string{"items.id"},
+		},
+		{
+			name:  "keep a literal dotted key without expanding it",
+			input: `{"$browser.version":"1","$browser":{"version":"2"}}`,
+			want:  `{"$browser.version":"1"}`,
+			keys:  []string{`$browser\.version`},
+		},
+		{
+			name:  "top-level array of scalars passes through",
+			input: `[1,2]`,
+			want:  `[1,2]`,
+			keys:  []string{"a"},
+		},
+		{
+			name:  "top-level array applies keep to each object",
+			input: `[{"id":1,"a":2},{"b":3},4]`,
+			want:  `[{"id":1},{},4]`,
+			keys:  []string{"id"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(keepKeysFunc(mustKeyDict(t, c.keys)), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestExtractPathsJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			name:  "extract nested path keeps structure",
+			input: `{"id":1,"props":{"secret":"xxx","public":"yyy"}}`,
+			want:  `{"id":1,"props":{"public":"yyy"}}`,
+			keys:  []string{"id", "props.public"},
+		},
+		{
+			name:  "missing path leaves no empty parent",
+			input: `{"id":1,"props":{"secret":"xxx"}}`,
+			want:  `{"id":1}`,
+			keys:  []string{"id", "props.public"},
+		},
+		{
+			name:  "listed empty object is kept",
+			input: `{"props":{},"x":1}`,
+			want:  `{"props":{}}`,
+			keys:  []string{"props"},
+		},
+		{
+			name:  "array elements without the path are dropped",
+			input: `{"items":[{"id":1,"x":1},{"x":2}],"y":1}`,
+			want:  `{"items":[{"id":1}]}`,
+			keys:  []string{"items[*].id"},
+		},
+		{
+			name:  "array left empty is dropped",
+			input: `{"items":[{"x":2}]}`,
+			want:  `{}`,
+			keys:  []string{"items[*].id"},
+		},
+		{
+			name:  "path below a scalar",
+			input: `{"props":"str"}`,
+			want:  `{}`,
+			keys:  []string{"props.a"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(extractPathsFunc(mustKeyDict(t, c.keys)), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestParseSingleQuotedArray(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{"empty array", "[]", nil, false},
+		{"single element", "['foo']", []string{"foo"}, false},
+		{"two elements", "['foo', 'bar']", []string{"foo", "bar"}, false},
+		{"escaped single quote", `['some other \'string']`, []string{"some other 'string"}, false},
+		{"escaped backslash", `['a\\.b', 're:^\\$ph_']`, []string{`a\.b`, `re:^\$ph_`}, false},
+		{"mixed", `['some string', 'some other \'string']`, []string{"some string", "some other 'string"}, false},
+		{"with spaces", "[ 'a' , 'b' ]", []string{"a", "b"}, false},
+		{"no brackets", "foo", nil, true},
+		{"unterminated string", "['foo", nil, true},
+		{"missing quote", "[foo]", nil, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseSingleQuotedArray(c.input)
+			if c.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, c.want, got)
+			}
+		})
+	}
+}
+
+func TestParseKeysArray(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{"single quoted", "['a', 'b']", []string{"a", "b"}, false},
+		{"json", `["a", "b"]`, []string{"a", "b"}, false},
+		{"json escapes", `["a\\.b", "say \"hi\"", "\u00e9"]`, []string{`a\.b`, `say "hi"`, "é"}, false},
+		{"json with spaces", ` [ "a" ] `, []string{"a"}, false},
+		{"empty", "[]", nil, false},
+		{"json non-string element", `["a", 1]`, nil, true},
+		{"json unterminated", `["a"`, nil, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseKeysArray(c.input)
+			if c.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package jsondrop
+
+import "bytes"
+
+// mergePatchLineFunc applies the JSON merge patch (RFC 7386) in the second column of a
+// TabSeparated row to the document in the first one
+func mergePatchLineFunc() lineFunc {
+	var out bytes.Buffer
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		target, patch, err := parseColumnPair(rawLine, "target", "patch")
+		if err != nil {
+			return err
+		}
+		result := mergePatch(target, patch)
+
+		out.Reset()
+		result.Write(&out)
+		recycleNode(result)
+		buf.Reset()
+		writeTSVEscaped(buf, out.Bytes())
+		return nil
+	}
+}
+
+// mergePatch applies patch to target as described in RFC 7386: members of an object patch are
+// merged into the target recursively, null members remove the key, anything else replaces the
+// target as a whole. Both arguments are consumed, nodes that aren't part of the result are recycled.
+func mergePatch(target, patch node) node {
+	p, ok := patch.(*objectNode)
+	if !ok {
+		recycleNode(target)
+		return patch
+	}
+	t, ok := target.(*objectNode)
+	if !ok {
+		recycleNode(target)
+		t = objectNodePool.Get().(*objectNode)
+		t.entries = t.entries[:0]
+	}
+	for _, member := range p.entries {
+		if isNull(member.value) {
+			t.entries = removeMembers(t.entries, member.key)
+			recycleNode(member.value)
+			continue
+		}
+		i := memberIndex(t.entries, member.key)
+		if i < 0 {
+			t.entries = append(t.entries, objectEntry{key: member.key, value: mergePatch(nil, member.value)})
+			continue
+		}
+		t.entries[i].value = mergePatch(t.entries[i].value, member.value)
+	}
+	p.entries = p.entries[:0]
+	objectNodePool.Put(p)
+	return t
+}
+
+func memberIndex(entries []objectEntry, key string) int {
+	for i, entry := range entries {
+		if entry.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeMembers removes every member named key, duplicates included
+func removeMembers(entries []objectEntry, key string) []objectEntry {
+	writeIdx := 0
+	for _, entry := range entries {
+		if entry.key == key {
+			recycleNode(entry.value)
+			continue
+		}
+		entries[writeIdx] = entry
+		writeIdx++
+	}
+	return entries[:writeIdx]
+}
+
+// setDefaultsLineFunc fills in the defaults object in the second column of a TabSeparated row
+// wherever the document in the first column doesn't have the key, see setDefaults. A top-level
+// array gets the defaults for each of its elements.
+func setDefaultsLineFunc() lineFunc {
+	var out bytes.Buffer
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		doc, defaults, err := parseColumnPair(rawLine, "document", "defaults")
+		if err != nil {
+			return err
+		}
+		if arr, ok := doc.(*arrayNode); ok {
+			for _, value := range arr.values {
+				setDefaults(value, defaults)
+			}
+		} else {
+			setDefaults(doc, defaults)
+		}
+
+		out.Reset()
+		doc.Write(&out)
+		recycleNode(doc)
+		recycleNode(defaults)
+		buf.Reset()
+		writeTSVEscaped(buf, out.Bytes())
+		return nil
+	}
+}
+
+// setDefaults adds the members of defaults that doc doesn't have, recursing where both have an
+// object. Keys that are present keep their value even if it's null. defaults isn't modified, the
+// values added are copies.
+func setDefaults(doc, defaults node) {
+	obj, ok := doc.(*objectNode)
+	if !ok {
+		return
+	}
+	d, ok := defaults.(*objectNode)
+	if !ok {
+		return
+	}
+	for _, member := range d.entries {
+		existing := memberValue(obj, member.key)
+		if existing == nil {
+			obj.entries = append(obj.entries, objectEntry{key: member.key, value: copyNode(member.value)})
+			continue
+		}
+		setDefaults(existing, member.value)
+	}
+}
+
+// copyNode deep copies n into pooled nodes
+func copyNode(n node) node {
+	switch v := n.(type) {
+	case *objectNode:
+		c := objectNodePool.Get().(*objectNode)
+		c.entries = c.entries[:0]
+		for _, entry := range v.entries {
+			c.entries = append(c.entries, objectEntry{key: entry.key, value: copyNode(entry.value)})
+		}
+		return c
+	case *arrayNode:
+		c := arrayNodePool.Get().(*arrayNode)
+		c.values = c.values[:0]
+		for _, value := range v.values {
+			c.values = append(c.values, copyNode(value))
+		}
+		return c
+	case *valueNode:
+		c := valueNodePool.Get().(*valueNode)
+		*c = *v
+		return c
+	default:
+		return n
+	}
+}
@@ -0,0 +1,85 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the examples from RFC 7386 appendix A
+func TestMergePatch(t *testing.T) {
+	cases := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target+" "+c.patch, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := mergePatchLineFunc()([]byte(c.target+"\t"+c.patch), &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+}
+
+func TestMergePatchRemovesDuplicateKeys(t *testing.T) {
+	var buf bytes.Buffer
+	err := mergePatchLineFunc()([]byte(`{"a":1,"b":2,"a":3}`+"\t"+`{"a":null}`), &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"b":2}`, buf.String())
+}
+
+func TestMergePatchTSVEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	// ClickHouse escapes the backslash of the JSON escape in the input column
+	err := mergePatchLineFunc()([]byte(`{"a":"x\\ty"}`+"\t"+`{"b":"\\\\"}`), &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"x\\ty","b":"\\\\"}`, buf.String())
+}
+
+func TestMergePatchErrors(t *testing.T) {
+	for _, line := range []string{`{"a":1}`, "{}\t{}\t{}", "{\t{}", "{}\t{"} {
+		var buf bytes.Buffer
+		assert.Error(t, mergePatchLineFunc()([]byte(line), &buf), line)
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	cases := []struct {
+		name, doc, defaults, want string
+	}{
+		{"missing keys are added", `{"a":1}`, `{"a":2,"b":3}`, `{"a":1,"b":3}`},
+		{"nested objects are filled", `{"p":{"x":1}}`, `{"p":{"x":0,"y":0},"q":{"z":[1]}}`, `{"p":{"x":1,"y":0},"q":{"z":[1]}}`},
+		{"null counts as present", `{"a":null}`, `{"a":1}`, `{"a":null}`},
+		{"scalar isn't replaced by an object", `{"p":"str"}`, `{"p":{"x":1}}`, `{"p":"str"}`},
+		{"top-level array elements", `[{"a":1},{},2]`, `{"a":0}`, `[{"a":1},{"a":0},2]`},
+		{"non-object document", `"x"`, `{"a":0}`, `"x"`},
+		{"non-object defaults", `{"a":1}`, `[1]`, `{"a":1}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := setDefaultsLineFunc()([]byte(c.doc+"\t"+c.defaults), &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the row latency histogram, in seconds. Most rows take
+// microseconds, the top buckets are for big documents and stalls.
+var latencyBuckets = [...]float64{1e-6, 2.5e-6, 5e-6, 1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 1e-2, 0.1, 1}
+
+// latencyHistogram counts row latencies into latencyBuckets, concurrent rows can observe at once
+type latencyHistogram struct {
+	// counts are per bucket, the last one for rows slower than every bound, they're summed up
+	// when written
+	counts [len(latencyBuckets) + 1]atomic.Uint64
+	sumNs  atomic.Uint64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := 0
+	for i < len(latencyBuckets) && seconds > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sumNs.Add(uint64(d))
+}
+
+// labelEscaper escapes label values for the text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics writes s in the Prometheus text exposition format
+func writeMetrics(buf *bytes.Buffer, s *runStats) {
+	counter := func(name, help string, value uint64) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	counter("json_drop_keys_udf_rows_total", "Rows transformed.", s.rows.Load())
+	counter("json_drop_keys_udf_row_errors_total", "Rows that failed, whether -on-error replaced them or not.", s.errors.Load()+rowErrors.Load())
+	counter("json_drop_keys_udf_dropped_keys_total", "Members and elements removed by -mode=drop.", droppedKeys.Load())
+	counter("json_drop_keys_udf_input_bytes_total", "Bytes of rows read, without line endings.", s.bytesIn.Load())
+	counter("json_drop_keys_udf_output_bytes_total", "Bytes of rows written, without line endings.", s.bytesOut.Load())
+
+	if s.paths != nil {
+		const name = "json_drop_keys_udf_path_hits_total"
+		fmt.Fprintf(buf, "# HELP %s Members and elements each path of -mode=drop removed, from -path-stats.\n# TYPE %s counter\n", name, name)
+		for _, h := range s.paths.snapshot() {
+			fmt.Fprintf(buf, "%s{path=\"%s\"} %d\n", name, labelEscaper.Replace(h.path), h.hits)
+		}
+	}
+
+	const name = "json_drop_keys_udf_row_duration_seconds"
+	fmt.Fprintf(buf, "# HELP %s Time taken to transform a row.\n# TYPE %s histogram\n", name, name)
+	total := uint64(0)
+	for i := range s.latency.counts {
+		total += s.latency.counts[i].Load()
+		bound := "+Inf"
+		if i < len(latencyBuckets) {
+			bound = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(buf, "%s_bucket{le=\"%s\"} %d\n", name, bound, total)
+	}
+	fmt.Fprintf(buf, "%s_sum %g\n%s_count %d\n", name, time.Duration(s.latency.sumNs.Load()).Seconds(), name, total)
+}
+
+// listenMetrics serves s at /metrics on addr in the background
+func listenMetrics(addr string, s *runStats) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return &listenError{"metrics-listen", err}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		writeMetrics(&buf, s)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write(buf.Bytes())
+	})
+	go func() { _ = http.Serve(l, mux) }()
+	return nil
+}
@@ -0,0 +1,515 @@
+package jsondrop
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/valyala/fastjson"
+)
+
+// MessagePack documents are decoded into the same nodes as JSON ones, so every mode that
+// transforms documents works on them unchanged, and encoded back afterwards,
+// https://github.com/msgpack/msgpack/blob/master/spec.md. Integers are written back in their
+// shortest encoding and floats as float64, so the values stay the same but not always their
+// bytes.
+
+// msgpackRaw is a bin or ext value, kept as it's encoded since JSON has nothing like it
+type msgpackRaw struct {
+	raw []byte
+}
+
+// Write writes the value as a JSON string of its base64 encoded bytes, for the modes that hash or
+// measure values
+func (m *msgpackRaw) Write(buf *bytes.Buffer) {
+	writeJSONString(buf, base64.StdEncoding.EncodeToString(m.raw))
+}
+
+func (m *msgpackRaw) DropKeys(keySet) node {
+	return m
+}
+
+// msgpackLineFunc is documentLineFunc for MessagePack documents
+func msgpackLineFunc(transform transformFunc, opts documentOptions) lineFunc {
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		parsed, err := decodeMsgpack(rawLine, opts.depth)
+		if err != nil {
+			return err
+		}
+		if _, isObject := parsed.(*objectNode); !isObject && opts.nonObject != nonObjectElements {
+			kind := typeName(parsed)
+			recycleNode(parsed)
+			if opts.nonObject == nonObjectError {
+				return fmt.Errorf("document is %s, not a map", kind)
+			}
+			buf.Reset()
+			buf.Write(rawLine)
+			return nil
+		}
+		parsed, err = resolveDuplicateKeys(parsed, opts.duplicateKeys)
+		if err != nil {
+			recycleNode(parsed)
+			return err
+		}
+		result := transform(parsed)
+		buf.Reset()
+		buf.Grow(len(rawLine))
+		err = writeMsgpack(buf, result)
+		recycleNode(result)
+		return err
+	}
+}
+
+// msgpackFrame is a map or array being decoded
+type msgpackFrame struct {
+	object *objectNode
+	array  *arrayNode
+	// left is how many members are still to be decoded
+	left  int
+	depth int
+	key   string
+}
+
+// msgpackDecoder reads values from data, keeping where it's at
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("msgpack parse error at offset %d: %s", d.pos, fmt.Sprintf(format, args...))
+}
+
+// take returns the next n bytes
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, d.errorf("unexpected end of document")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads an n byte big endian unsigned integer
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// decodeMsgpack decodes a MessagePack document. Maps and arrays still being filled wait on a
+// stack rather than recursing, like JSON documents.
+func decodeMsgpack(data []byte, limit depthLimit) (node, error) {
+	maxDepth := limit.maxDepth
+	if maxDepth == 0 {
+		maxDepth = fastjson.MaxDepth
+	}
+	d := &msgpackDecoder{data: data}
+	var root node
+	var stack []msgpackFrame
+	fail := func(err error) (node, error) {
+		// members are added as soon as they're read, so root holds everything decoded
+		if root != nil {
+			recycleNode(root)
+		}
+		return nil, err
+	}
+
+	for {
+		for len(stack) > 0 && stack[len(stack)-1].left == 0 {
+			stack = stack[:len(stack)-1]
+		}
+		if root != nil && len(stack) == 0 {
+			break
+		}
+		depth := 0
+		var top *msgpackFrame
+		if len(stack) > 0 {
+			top = &stack[len(stack)-1]
+			depth = top.depth + 1
+		}
+		if top != nil && top.object != nil {
+			key, err := d.key()
+			if err != nil {
+				return fail(err)
+			}
+			top.key = key
+		}
+
+		start := d.pos
+		value, members, err := d.value()
+		if err != nil {
+			return fail(err)
+		}
+		if members > 0 && depth >= maxDepth {
+			if !limit.prune || top == nil {
+				return fail(&depthError{maxDepth: maxDepth})
+			}
+			d.pos = start
+			if err := d.skip(); err != nil {
+				return fail(err)
+			}
+			top.left--
+			continue
+		}
+		switch {
+		case top == nil:
+			root = value
+		case top.object != nil:
+			top.object.entries = append(top.object.entries, objectEntry{key: top.key, value: value})
+			top.left--
+		default:
+			top.array.values = append(top.array.values, value)
+			top.left--
+		}
+		switch v := value.(type) {
+		case *objectNode:
+			if members > 0 {
+				stack = append(stack, msgpackFrame{object: v, left: members, depth: depth})
+			}
+		case *arrayNode:
+			if members > 0 {
+				stack = append(stack, msgpackFrame{array: v, left: members, depth: depth})
+			}
+		}
+	}
+	if d.pos != len(data) {
+		recycleNode(root)
+		return nil, d.errorf("%d bytes after the document", len(data)-d.pos)
+	}
+	return root, nil
+}
+
+// key reads a map key, which has to be a string
+func (d *msgpackDecoder) key() (string, error) {
+	start := d.pos
+	value, _, err := d.value()
+	if err != nil {
+		return "", err
+	}
+	if v, ok := value.(*valueNode); ok && v.kind == kindString {
+		key := v.str
+		recycleNode(v)
+		return key, nil
+	}
+	recycleNode(value)
+	d.pos = start
+	return "", d.errorf("map key isn't a string")
+}
+
+// value reads the next value. Maps and arrays come back empty with how many members they have,
+// members counting a map's keys and values as one.
+func (d *msgpackDecoder) value() (node, int, error) {
+	header, err := d.take(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	c, start := header[0], d.pos-1
+	switch {
+	case c <= 0x7f:
+		return numberNode(strconv.FormatUint(uint64(c), 10)), 0, nil
+	case c >= 0xe0:
+		return numberNode(strconv.FormatInt(int64(int8(c)), 10)), 0, nil
+	case c <= 0x8f:
+		return d.container(true, int(c&0x0f))
+	case c <= 0x9f:
+		return d.container(false, int(c&0x0f))
+	case c <= 0xbf:
+		return d.string(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		v := valueNodePool.Get().(*valueNode)
+		v.kind = kindNull
+		return v, 0, nil
+	case 0xc2, 0xc3:
+		v := valueNodePool.Get().(*valueNode)
+		v.kind, v.b = kindBool, c == 0xc3
+		return v, 0, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, 0, err
+		}
+		return d.raw(start, int(n))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, 0, err
+		}
+		// the payload is led by the ext type
+		return d.raw(start, int(n)+1)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.raw(start, 1+1<<(c-0xd4))
+	case 0xca:
+		bits, err := d.uint(4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return numberNode(formatMsgpackFloat(float64(math.Float32frombits(uint32(bits))))), 0, nil
+	case 0xcb:
+		bits, err := d.uint(8)
+		if err != nil {
+			return nil, 0, err
+		}
+		return numberNode(formatMsgpackFloat(math.Float64frombits(bits))), 0, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, 0, err
+		}
+		return numberNode(strconv.FormatUint(v, 10)), 0, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		v, err := d.uint(size)
+		if err != nil {
+			return nil, 0, err
+		}
+		// sign extend from size bytes
+		shift := 64 - 8*size
+		return numberNode(strconv.FormatInt(int64(v<<shift)>>shift, 10)), 0, nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, 0, err
+		}
+		return d.string(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, 0, err
+		}
+		return d.container(false, int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, 0, err
+		}
+		return d.container(true, int(n))
+	}
+	d.pos--
+	return nil, 0, d.errorf("0x%02x isn't a MessagePack type", c)
+}
+
+func (d *msgpackDecoder) container(isMap bool, members int) (node, int, error) {
+	// every member takes at least a byte, which stops a bogus length from being allocated for
+	if members > len(d.data)-d.pos {
+		return nil, 0, d.errorf("unexpected end of document")
+	}
+	if isMap {
+		obj := objectNodePool.Get().(*objectNode)
+		obj.entries = obj.entries[:0]
+		return obj, members, nil
+	}
+	arr := arrayNodePool.Get().(*arrayNode)
+	arr.values = arr.values[:0]
+	return arr, members, nil
+}
+
+func (d *msgpackDecoder) string(n int) (node, int, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return nil, 0, err
+	}
+	v := valueNodePool.Get().(*valueNode)
+	v.kind, v.str = kindString, string(b)
+	return v, 0, nil
+}
+
+// raw reads a bin or ext value of n bytes after its header, which started at start
+func (d *msgpackDecoder) raw(start, n int) (node, int, error) {
+	if _, err := d.take(n); err != nil {
+		return nil, 0, err
+	}
+	return &msgpackRaw{raw: append([]byte(nil), d.data[start:d.pos]...)}, 0, nil
+}
+
+// skip reads past the next value, members included
+func (d *msgpackDecoder) skip() error {
+	for left := 1; left > 0; left-- {
+		value, members, err := d.value()
+		if err != nil {
+			return err
+		}
+		if _, isMap := value.(*objectNode); isMap {
+			members *= 2
+		}
+		left += members
+		recycleNode(value)
+	}
+	return nil
+}
+
+func numberNode(num string) node {
+	v := valueNodePool.Get().(*valueNode)
+	v.kind, v.num = kindNumber, num
+	return v
+}
+
+// formatMsgpackFloat formats f so it parses back as the same float64
+func formatMsgpackFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// msgpackItem is a node or a map key still to be written
+type msgpackItem struct {
+	n     node
+	key   string
+	isKey bool
+}
+
+// writeMsgpack writes a document as MessagePack. What's still to be written waits on a stack in
+// reverse order rather than recursing.
+func writeMsgpack(buf *bytes.Buffer, n node) error {
+	var scratch [32]msgpackItem
+	stack := append(scratch[:0], msgpackItem{n: n})
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if item.isKey {
+			writeMsgpackString(buf, item.key)
+			continue
+		}
+		switch v := item.n.(type) {
+		case *objectNode:
+			writeMsgpackHeader(buf, 0x80, 0xde, len(v.entries))
+			for i := len(v.entries) - 1; i >= 0; i-- {
+				stack = append(stack, msgpackItem{n: v.entries[i].value}, msgpackItem{key: v.entries[i].key, isKey: true})
+			}
+		case *arrayNode:
+			writeMsgpackHeader(buf, 0x90, 0xdc, len(v.values))
+			for i := len(v.values) - 1; i >= 0; i-- {
+				stack = append(stack, msgpackItem{n: v.values[i]})
+			}
+		case *msgpackRaw:
+			buf.Write(v.raw)
+		case *valueNode:
+			if err := writeMsgpackValue(buf, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeMsgpackValue(buf *bytes.Buffer, v *valueNode) error {
+	switch v.kind {
+	case kindString:
+		writeMsgpackString(buf, v.str)
+	case kindBool:
+		if v.b {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case kindNull:
+		buf.WriteByte(0xc0)
+	case kindNumber:
+		return writeMsgpackNumber(buf, v.num)
+	}
+	return nil
+}
+
+// writeMsgpackNumber writes num, which may have come from JSON, as the shortest integer encoding
+// that holds it or as a float64
+func writeMsgpackNumber(buf *bytes.Buffer, num string) error {
+	var b [9]byte
+	if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+		switch {
+		case i >= 0:
+			writeMsgpackUint(buf, uint64(i))
+		case i >= -32:
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt8:
+			buf.Write([]byte{0xd0, byte(int8(i))})
+		case i >= math.MinInt16:
+			b[0] = 0xd1
+			binary.BigEndian.PutUint16(b[1:], uint16(int16(i)))
+			buf.Write(b[:3])
+		case i >= math.MinInt32:
+			b[0] = 0xd2
+			binary.BigEndian.PutUint32(b[1:], uint32(int32(i)))
+			buf.Write(b[:5])
+		default:
+			b[0] = 0xd3
+			binary.BigEndian.PutUint64(b[1:], uint64(i))
+			buf.Write(b[:9])
+		}
+		return nil
+	}
+	if u, err := strconv.ParseUint(num, 10, 64); err == nil {
+		writeMsgpackUint(buf, u)
+		return nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return fmt.Errorf("number %s can't be written as MessagePack", num)
+	}
+	b[0] = 0xcb
+	binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+	buf.Write(b[:9])
+	return nil
+}
+
+func writeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	var b [9]byte
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(u)})
+	case u <= math.MaxUint16:
+		b[0] = 0xcd
+		binary.BigEndian.PutUint16(b[1:], uint16(u))
+		buf.Write(b[:3])
+	case u <= math.MaxUint32:
+		b[0] = 0xce
+		binary.BigEndian.PutUint32(b[1:], uint32(u))
+		buf.Write(b[:5])
+	default:
+		b[0] = 0xcf
+		binary.BigEndian.PutUint64(b[1:], u)
+		buf.Write(b[:9])
+	}
+}
+
+func writeMsgpackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{0xd9, byte(n)})
+	default:
+		writeMsgpackHeader(buf, 0, 0xda, n)
+	}
+	buf.WriteString(s)
+}
+
+// writeMsgpackHeader writes the header of a map or array of n members, fix is its fix type and
+// wide its 16 bit type, the 32 bit one follows it. Strings have no fix type here.
+func writeMsgpackHeader(buf *bytes.Buffer, fix, wide byte, n int) {
+	var b [5]byte
+	switch {
+	case fix != 0 && n <= 15:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		b[0] = wide
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		buf.Write(b[:3])
+	default:
+		b[0] = wide + 1
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		buf.Write(b[:5])
+	}
+}
@@ -0,0 +1,99 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	for _, doc := range [][]byte{
+		// {"a":1,"b":[true,nil,-5,-33,300,65536,"s"],"c":{}}
+		{0x83, 0xa1, 'a', 0x01, 0xa1, 'b', 0x97, 0xc3, 0xc0, 0xfb, 0xd0, 0xdf, 0xcd, 0x01, 0x2c, 0xce, 0x00, 0x01, 0x00, 0x00, 0xa1, 's', 0xa1, 'c', 0x80},
+		// bin, fixext and ext values are kept as they are
+		{0x82, 0xa1, 'b', 0xc4, 0x02, 0x00, 0xff, 0xa1, 'e', 0xd6, 0xff, 0x01, 0x02, 0x03, 0x04},
+		{0x91, 0xc7, 0x03, 0x01, 'x', 'y', 'z'},
+		// the largest integers and a float64
+		{0x93, 0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0},
+		// str8 and array16 lengths
+		append([]byte{0xd9, 0x20}, bytes.Repeat([]byte{'x'}, 32)...),
+		append([]byte{0xdc, 0x00, 0x10}, bytes.Repeat([]byte{0x01}, 16)...),
+	} {
+		n, err := decodeMsgpack(doc, depthLimit{})
+		assert.NoError(t, err, doc)
+		var buf bytes.Buffer
+		assert.NoError(t, writeMsgpack(&buf, n))
+		assert.Equal(t, doc, buf.Bytes())
+	}
+
+	// other encodings come back in the shortest one
+	for doc, want := range map[string]string{
+		"\xcc\x05":              "\x05",
+		"\xd1\xff\xff":          "\xff",
+		"\xca\x3f\xc0\x00\x00":  "\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00",
+		"\xde\x00\x00":          "\x80",
+		"\xdb\x00\x00\x00\x01a": "\xa1a",
+	} {
+		n, err := decodeMsgpack([]byte(doc), depthLimit{})
+		assert.NoError(t, err)
+		var buf bytes.Buffer
+		assert.NoError(t, writeMsgpack(&buf, n))
+		assert.Equal(t, want, buf.String())
+	}
+
+	for doc, want := range map[string]string{
+		"\x81\x01\x02":     "map key isn't a string",
+		"\x82\xa1a\x01":    "unexpected end of document",
+		"\x01\x02":         "1 bytes after the document",
+		"\xc1":             "0xc1 isn't a MessagePack type",
+		"\xdd\xff\xff\xff": "unexpected end of document",
+	} {
+		_, err := decodeMsgpack([]byte(doc), depthLimit{})
+		assert.ErrorContains(t, err, want, doc)
+	}
+
+	// {"a":{"b":[1]},"c":1}
+	deep := []byte{0x82, 0xa1, 'a', 0x81, 0xa1, 'b', 0x91, 0x01, 0xa1, 'c', 0x01}
+	_, err := decodeMsgpack(deep, depthLimit{maxDepth: 2})
+	assert.ErrorContains(t, err, "-max-depth=2")
+	n, err := decodeMsgpack(deep, depthLimit{maxDepth: 1, prune: true})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	n.Write(&buf)
+	assert.Equal(t, `{"c":1}`, buf.String())
+}
+
+func TestMsgpackLineFunc(t *testing.T) {
+	// {"a":1,"b":{"c":2,"d":"x"},"e":bin}
+	doc := []byte{0x83, 0xa1, 'a', 0x01, 0xa1, 'b', 0x82, 0xa1, 'c', 0x02, 0xa1, 'd', 0xa1, 'x', 0xa1, 'e', 0xc4, 0x01, 0x00}
+	c, err := parseConfig([]string{"-encoding=msgpack"})
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc([]string{"a", "b.c"})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, process(doc, &buf))
+	assert.Equal(t, []byte{0x82, 0xa1, 'b', 0x81, 0xa1, 'd', 0xa1, 'x', 0xa1, 'e', 0xc4, 0x01, 0x00}, buf.Bytes())
+	assert.ErrorContains(t, process([]byte{0x81}, &buf), "msgpack parse error")
+
+	c, err = parseConfig([]string{"-encoding=msgpack", "-mode=redact", "-placeholder=?", "-non-object=passthrough"})
+	assert.NoError(t, err)
+	process, err = c.buildLineFunc([]string{"b.d"})
+	assert.NoError(t, err)
+	assert.NoError(t, process(doc, &buf))
+	assert.Equal(t, []byte{0x83, 0xa1, 'a', 0x01, 0xa1, 'b', 0x82, 0xa1, 'c', 0x02, 0xa1, 'd', 0xa1, '?', 0xa1, 'e', 0xc4, 0x01, 0x00}, buf.Bytes())
+	assert.NoError(t, process([]byte{0x91, 0x01}, &buf))
+	assert.Equal(t, []byte{0x91, 0x01}, buf.Bytes())
+
+	for _, flags := range [][]string{
+		{"-encoding=msgpack", "-mode=validate"},
+		{"-encoding=msgpack", "-on-error=empty"},
+		{"-encoding=msgpack", "-output=pretty"},
+		{"-encoding=bson"},
+	} {
+		c, err := parseConfig(flags)
+		assert.NoError(t, err)
+		_, err = c.buildLineFunc(nil)
+		assert.Error(t, err, flags)
+	}
+}
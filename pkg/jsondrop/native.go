@@ -0,0 +1,397 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// A Native block is its number of columns and of rows as unsigned LEB128 varints, then every
+// column as its name, its type and its values. String values are laid out as in RowBinary, one
+// after the other, and a Nullable column has a byte per row that's 1 for NULL before them,
+// https://clickhouse.com/docs/interfaces/formats/Native
+
+// nativeResult is the name of the column the results are written in, ClickHouse only takes
+// the first column of the output and doesn't look at its name
+const nativeResult = "result"
+
+// nativeColumn is a column of the block being read
+type nativeColumn struct {
+	// nulls has a byte per row, 1 for NULL, and is nil unless the column is Nullable
+	nulls []byte
+	// the value of row i is data[ends[i-1]:ends[i]]
+	ends []int
+	data []byte
+	// constant is set when every row of the column has the same value
+	constant bool
+}
+
+// reset empties the column, nulls is left nil unless nullable
+func (c *nativeColumn) reset(nullable bool) {
+	c.ends, c.data = c.ends[:0], c.data[:0]
+	if nullable {
+		c.nulls = append(c.nulls, 0)[:0]
+	} else {
+		c.nulls = nil
+	}
+}
+
+// add appends a row's value, its nulls byte is the caller's
+func (c *nativeColumn) add(value []byte) {
+	c.data = append(c.data, value...)
+	c.ends = append(c.ends, len(c.data))
+}
+
+// findConstant sets constant for the column's rows values
+func (c *nativeColumn) findConstant(rows int) {
+	c.constant = true
+	for i := 1; i < rows && c.constant; i++ {
+		prevNull, prev := c.value(i - 1)
+		null, value := c.value(i)
+		c.constant = prevNull == null && bytes.Equal(prev, value)
+	}
+}
+
+func (c *nativeColumn) value(i int) (null bool, value []byte) {
+	if c.nulls != nil && c.nulls[i] == 1 {
+		return true, nil
+	}
+	start := 0
+	if i > 0 {
+		start = c.ends[i-1]
+	}
+	return false, c.data[start:c.ends[i]]
+}
+
+// nativeReader reads Native blocks a whole column at a time and returns their rows one by one as
+// the text rows the mode takes
+type nativeReader struct {
+	format  *rowBinary
+	columns []nativeColumn
+	// rows is how many rows the block has and next the row next returns
+	rows, next int
+	field      []byte
+	row        bytes.Buffer
+	// arrow reads ArrowStream record batches into columns instead of Native blocks
+	arrow *arrowReader
+}
+
+func newNativeReader(format *rowBinary) *nativeReader {
+	return &nativeReader{format: format, columns: make([]nativeColumn, format.columns)}
+}
+
+// readRow returns the next row and whether it's the first or the last of its block, io.EOF if
+// there are no more. The row is only valid until the next call.
+func (n *nativeReader) readRow(r *bufio.Reader) (row []byte, first, last bool, err error) {
+	for n.next == n.rows {
+		read := n.readBlock
+		if n.arrow != nil {
+			read = n.arrow.readBatch
+		}
+		if err := read(r); err != nil {
+			return nil, false, false, err
+		}
+		first = true
+	}
+	n.row.Reset()
+	for i := range n.columns {
+		null, value := n.columns[i].value(n.next)
+		n.format.appendColumn(&n.row, i, null, value)
+	}
+	n.next++
+	return n.row.Bytes(), first, n.next == n.rows, nil
+}
+
+// constant reports whether every column of the block being read has the same value in every
+// row, as they do when a function is called with constant arguments
+func (n *nativeReader) constant() bool {
+	for i := range n.columns {
+		if !n.columns[i].constant {
+			return false
+		}
+	}
+	return true
+}
+
+// constantRow reports whether the row readRow returned last is of a block of constant arguments,
+// and whether it's the block's first
+func (n *nativeReader) constantRow() (constant, first bool) {
+	return n.constant(), n.next == 1
+}
+
+func (n *nativeReader) readBlock(r *bufio.Reader) error {
+	columns, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	rows, err := binary.ReadUvarint(r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if columns != uint64(len(n.columns)) {
+		return fmt.Errorf("Native block has %d columns, expected %d", columns, len(n.columns))
+	}
+	if rows > maxRowBinaryString {
+		return fmt.Errorf("Native block of %d rows is larger than %d", rows, maxRowBinaryString)
+	}
+	n.rows, n.next = int(rows), 0
+	for i := range n.columns {
+		if err := n.readColumn(r, &n.columns[i]); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	return nil
+}
+
+func (n *nativeReader) readColumn(r *bufio.Reader, c *nativeColumn) error {
+	field, err := readNativeString(r, &n.field)
+	if err != nil {
+		return err
+	}
+	name := string(field)
+	typ, err := readNativeString(r, &n.field)
+	if err != nil {
+		return err
+	}
+	switch string(typ) {
+	case "String":
+		c.reset(false)
+	case "Nullable(String)":
+		c.reset(true)
+		c.nulls = append(c.nulls, make([]byte, n.rows)...)
+		if _, err := io.ReadFull(r, c.nulls); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("column %s is %s, expected String or Nullable(String)", name, typ)
+	}
+
+	for i := 0; i < n.rows; i++ {
+		value, err := readNativeString(r, &n.field)
+		if err != nil {
+			return err
+		}
+		c.add(value)
+	}
+	c.findConstant(n.rows)
+	return nil
+}
+
+// readNativeString reads a String into field
+func readNativeString(r *bufio.Reader, field *[]byte) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxRowBinaryString {
+		return nil, fmt.Errorf("Native string of %d bytes is longer than %d", n, maxRowBinaryString)
+	}
+	if cap(*field) < int(n) {
+		*field = make([]byte, n)
+	}
+	*field = (*field)[:n]
+	_, err = io.ReadFull(r, *field)
+	return *field, err
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// rowWriter is where rows are written, a bufio.Writer or a nativeWriter
+type rowWriter interface {
+	io.Writer
+	io.StringWriter
+	Flush() error
+}
+
+// nativeWriter collects the RowBinary rows format.lineFunc writes and writes them to w as a
+// Native block, or an ArrowStream record batch with arrow set, on Flush, so the rows of a block
+// go out together
+type nativeWriter struct {
+	w      *bufio.Writer
+	format *rowBinary
+	arrow  *arrowWriter
+	rows   bytes.Buffer
+	// results and errs are the columns of the block being written, errs is only used for
+	// -on-error=tuple
+	results, errs nativeColumn
+	count         int
+}
+
+func newNativeWriter(w *bufio.Writer, format *rowBinary) *nativeWriter {
+	return &nativeWriter{w: w, format: format}
+}
+
+func (n *nativeWriter) Write(p []byte) (int, error) {
+	return n.rows.Write(p)
+}
+
+func (n *nativeWriter) WriteString(s string) (int, error) {
+	return n.rows.WriteString(s)
+}
+
+// Flush writes the rows written since the last Flush as a block, if there are any, and flushes
+// w
+func (n *nativeWriter) Flush() error {
+	if n.rows.Len() > 0 {
+		if err := n.writeBlock(); err != nil {
+			return err
+		}
+	}
+	return n.w.Flush()
+}
+
+// Close flushes the last rows and ends the ArrowStream
+func (n *nativeWriter) Close() error {
+	if n.rows.Len() > 0 {
+		if err := n.writeBlock(); err != nil {
+			return err
+		}
+	}
+	if n.arrow != nil {
+		if err := n.arrow.end(n.w, n.format); err != nil {
+			return err
+		}
+	}
+	return n.w.Flush()
+}
+
+func (n *nativeWriter) writeBlock() error {
+	if err := n.readRows(); err != nil {
+		return err
+	}
+	if n.arrow != nil {
+		return n.arrow.writeBatch(n.w, n.format, n.count, &n.results, &n.errs)
+	}
+
+	typ := "String"
+	switch {
+	case n.format.tuple:
+		typ = "Tuple(String, String)"
+	case n.format.nullable:
+		typ = "Nullable(String)"
+	}
+	var block bytes.Buffer
+	var length [binary.MaxVarintLen64]byte
+	block.Write(length[:binary.PutUvarint(length[:], 1)])
+	block.Write(length[:binary.PutUvarint(length[:], uint64(n.count))])
+	writeRowBinaryString(&block, []byte(nativeResult))
+	writeRowBinaryString(&block, []byte(typ))
+	block.Write(n.results.nulls)
+	columns := []*nativeColumn{&n.results}
+	if n.format.tuple {
+		columns = append(columns, &n.errs)
+	}
+	for _, c := range columns {
+		for i := 0; i < n.count; i++ {
+			_, value := c.value(i)
+			writeRowBinaryString(&block, value)
+		}
+	}
+	_, err := n.w.Write(block.Bytes())
+	return err
+}
+
+// readRows turns the rows written since the last block into its columns
+func (n *nativeWriter) readRows() error {
+	rows := n.rows.Bytes()
+	n.results.reset(n.format.nullable && !n.format.tuple)
+	n.errs.reset(false)
+	n.count = 0
+	for len(rows) > 0 {
+		null := false
+		if n.results.nulls != nil {
+			null = rows[0] == 1
+			n.results.nulls = append(n.results.nulls, rows[0])
+			rows = rows[1:]
+		}
+		var value []byte
+		if !null {
+			var err error
+			if value, rows, err = cutRowBinaryString(rows); err != nil {
+				return err
+			}
+		}
+		n.results.add(value)
+		if n.format.tuple {
+			var err error
+			if value, rows, err = cutRowBinaryString(rows); err != nil {
+				return err
+			}
+			n.errs.add(value)
+		}
+		n.count++
+	}
+	n.rows.Reset()
+	return nil
+}
+
+// cutRowBinaryString returns the String at the start of rows and what follows it
+func cutRowBinaryString(rows []byte) (value, rest []byte, err error) {
+	length, n := binary.Uvarint(rows)
+	if n <= 0 || uint64(len(rows)-n) < length {
+		return nil, nil, fmt.Errorf("RowBinary row is cut short")
+	}
+	end := n + int(length)
+	return rows[n:end], rows[end:], nil
+}
+
+// repeatedRows skips process for the rows of a block of constant arguments after the first,
+// writing its result again, so the block is only transformed once. block reports whether the
+// row's block is one and whether the row is its first, which only holds while rows are
+// transformed in the order they're read, so it isn't used with -workers. The result is only kept
+// for the rest of its block, a pooled process's next query starts again from its own first row.
+// Rows -on-error replaced are transformed every time, so they're still counted and sampled.
+// paths is what -path-stats counts into, nil without it, and the hits of the first row are added
+// again for each repeat.
+func repeatedRows(process lineFunc, block func() (constant, first bool), paths *pathHitCounts) lineFunc {
+	type pathDelta struct {
+		counter *atomic.Uint64
+		hits    uint64
+	}
+	var last, result []byte
+	var dropped uint64
+	var hits []pathDelta
+	repeatable := false
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		constant, first := block()
+		if !constant {
+			repeatable = false
+			return process(rawLine, buf)
+		}
+		if repeatable && !first && bytes.Equal(rawLine, last) {
+			buf.Reset()
+			buf.Write(result)
+			droppedKeys.Add(dropped)
+			for _, h := range hits {
+				h.counter.Add(h.hits)
+			}
+			return nil
+		}
+		droppedBefore, errorsBefore := droppedKeys.Load(), rowErrors.Load()
+		hitsBefore := paths.counts()
+		repeatable = false
+		if err := process(rawLine, buf); err != nil {
+			return err
+		}
+		repeatable = rowErrors.Load() == errorsBefore
+		dropped = droppedKeys.Load() - droppedBefore
+		hits = hits[:0]
+		for counter, n := range paths.counts() {
+			if n > hitsBefore[counter] {
+				hits = append(hits, pathDelta{counter, n - hitsBefore[counter]})
+			}
+		}
+		last = append(last[:0], rawLine...)
+		result = append(result[:0], buf.Bytes()...)
+		return nil
+	}
+}
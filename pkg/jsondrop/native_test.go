@@ -0,0 +1,195 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// nativeBlock encodes a block of String columns, Nullable if typ says so, nil values are NULL
+func nativeBlock(typ string, columns ...[]*string) []byte {
+	var buf bytes.Buffer
+	var length [binary.MaxVarintLen64]byte
+	rows := 0
+	if len(columns) > 0 {
+		rows = len(columns[0])
+	}
+	buf.Write(length[:binary.PutUvarint(length[:], uint64(len(columns)))])
+	buf.Write(length[:binary.PutUvarint(length[:], uint64(rows))])
+	for _, column := range columns {
+		writeRowBinaryString(&buf, []byte(nativeResult))
+		writeRowBinaryString(&buf, []byte(typ))
+		if typ == "Nullable(String)" {
+			for _, value := range column {
+				if value == nil {
+					buf.WriteByte(1)
+				} else {
+					buf.WriteByte(0)
+				}
+			}
+		}
+		for _, value := range column {
+			if value == nil {
+				value = str("")
+			}
+			writeRowBinaryString(&buf, []byte(*value))
+		}
+	}
+	return buf.Bytes()
+}
+
+// runNative transforms Native input the way main does
+func runNative(t *testing.T, input []byte, keys []string, flags ...string) ([]byte, error) {
+	c, err := parseConfig(append([]string{"-format=native"}, flags...))
+	assert.NoError(t, err)
+	f, err := c.rowBinary()
+	assert.NoError(t, err)
+	native := newNativeReader(f)
+	process, err := c.buildLineFunc(keys)
+	assert.NoError(t, err)
+	var paths *pathHitCounts
+	if c.pathStats {
+		paths = &pathHits
+	}
+	process = repeatedRows(f.lineFunc(process), native.constantRow, paths)
+
+	lines := newLineReader(bufio.NewReaderSize(bytes.NewReader(input), 16), 0)
+	lines.native = native
+	var out bytes.Buffer
+	stdout := bufio.NewWriter(&out)
+	w := newNativeWriter(stdout, f)
+	var buf bytes.Buffer
+	for {
+		line, _, err := lines.next()
+		if err == io.EOF {
+			return out.Bytes(), w.Flush()
+		}
+		if err != nil {
+			_ = w.Flush()
+			return out.Bytes(), err
+		}
+		if err := process(line, &buf); err != nil {
+			return out.Bytes(), err
+		}
+		_, _ = w.Write(buf.Bytes())
+		if lines.endOfChunk() {
+			assert.NoError(t, w.Flush())
+		}
+	}
+}
+
+func TestNative(t *testing.T) {
+	input := append(nativeBlock("String", []*string{str("{\"a\":1,\n\"b\":2}"), str(`{"a":2}`)}),
+		nativeBlock("String", []*string{str(`{"c":{"a":1}}`)})...)
+	out, err := runNative(t, input, []string{"a"})
+	assert.NoError(t, err)
+	assert.Equal(t, append(nativeBlock("String", []*string{str(`{"b":2}`), str(`{}`)}),
+		nativeBlock("String", []*string{str(`{"c":{"a":1}}`)})...), out)
+
+	out, err = runNative(t, nativeBlock("Nullable(String)", []*string{nil, str(`{"a":1,"b":2}`), str(`{`)}),
+		[]string{"a"}, "-nullable", "-on-error=null")
+	assert.NoError(t, err)
+	assert.Equal(t, nativeBlock("Nullable(String)", []*string{nil, str(`{"b":2}`), nil}), out)
+
+	out, err = runNative(t, nativeBlock("String", []*string{str("{\"a\":\"\t\"}")}, []*string{str(`{"b":1}`)}), nil,
+		"-mode=merge-patch")
+	assert.NoError(t, err)
+	assert.Equal(t, nativeBlock("String", []*string{str(`{"a":"\t","b":1}`)}), out)
+
+	out, err = runNative(t, nativeBlock("String", []*string{str(`{"a":1}`), str(`{`)}), []string{"a"}, "-on-error=tuple")
+	assert.NoError(t, err)
+	tuple := nativeBlock("Tuple(String, String)", []*string{str(`{}`), str("")})
+	assert.True(t, bytes.HasPrefix(out, tuple[:len(tuple)-1]), out)
+
+	_, err = runNative(t, nativeBlock("String", []*string{str(`{}`)})[:8], nil)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = runNative(t, nativeBlock("UInt8", []*string{str("1")}), nil)
+	assert.ErrorContains(t, err, "expected String or Nullable(String)")
+	_, err = runNative(t, nativeBlock("String", []*string{str("1")}, []*string{str("1")}), nil)
+	assert.ErrorContains(t, err, "has 2 columns, expected 1")
+
+	c, err := parseConfig([]string{"-format=native", "-chunk-header"})
+	assert.NoError(t, err)
+	_, err = c.rowBinary()
+	assert.Error(t, err)
+}
+
+func TestNativeConstant(t *testing.T) {
+	doc := str(`{"a":1,"b":{"a":2,"c":3}}`)
+	before := droppedKeys.Load()
+	out, err := runNative(t, append(nativeBlock("String", []*string{doc, doc, doc}),
+		nativeBlock("String", []*string{doc, str(`{"a":1}`)})...), []string{"a", "b.a"})
+	assert.NoError(t, err)
+	want := str(`{"b":{"c":3}}`)
+	assert.Equal(t, append(nativeBlock("String", []*string{want, want, want}),
+		nativeBlock("String", []*string{want, str(`{}`)})...), out)
+	// repeated rows still count the keys they'd have dropped
+	assert.Equal(t, uint64(9), droppedKeys.Load()-before)
+	// and with -path-stats the paths that would have dropped them
+	pathHits.paths = nil
+	_, err = runNative(t, append(nativeBlock("String", []*string{doc, doc, doc}),
+		nativeBlock("String", []*string{doc, str(`{"a":1}`)})...), []string{"a", "b.a", "c"}, "-path-stats")
+	assert.NoError(t, err)
+	assert.Equal(t, []pathHit{{"a", 5}, {"b.a", 4}, {"c", 0}}, pathHits.snapshot())
+
+	calls := 0
+	first := false
+	process := repeatedRows(func(rawLine []byte, buf *bytes.Buffer) error {
+		calls++
+		buf.Reset()
+		buf.Write(rawLine)
+		return nil
+	}, func() (bool, bool) { return true, first }, nil)
+	var buf bytes.Buffer
+	for _, row := range []string{"a", "a", "b", "b", "a"} {
+		assert.NoError(t, process([]byte(row), &buf))
+		assert.Equal(t, row, buf.String())
+	}
+	assert.Equal(t, 3, calls)
+	// the first row of the next block is transformed again, even with the same arguments
+	first = true
+	assert.NoError(t, process([]byte("a"), &buf))
+	first = false
+	assert.NoError(t, process([]byte("a"), &buf))
+	assert.Equal(t, 4, calls)
+}
+
+// TestNativeBlockOutput checks the UDF writes a block of results for each block it reads, even
+// when the whole block has been read off stdin before its first row is transformed
+func TestNativeBlockOutput(t *testing.T) {
+	for _, workers := range []string{"-workers=1", "-workers=2"} {
+		cmd := udfCommand("-format=native", workers, "['a']")
+		stdin, err := cmd.StdinPipe()
+		assert.NoError(t, err)
+		stdout, err := cmd.StdoutPipe()
+		assert.NoError(t, err)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		assert.NoError(t, cmd.Start())
+
+		var out []byte
+		for _, n := range []string{"1", "2"} {
+			block := nativeBlock("String", []*string{str(`{"a":1,"b":` + n + `}`), str(`{"a":2,"c":` + n + `}`)})
+			want := nativeBlock("String", []*string{str(`{"b":` + n + `}`), str(`{"c":` + n + `}`)})
+			_, err := stdin.Write(block)
+			assert.NoError(t, err)
+			// the next block is only sent once the results of this one are in, as
+			// executable_pool does
+			got := make([]byte, len(want))
+			_, err = io.ReadFull(stdout, got)
+			assert.NoError(t, err, workers)
+			assert.Equal(t, want, got, workers)
+			out = append(out, got...)
+		}
+		assert.NoError(t, stdin.Close())
+		rest, err := io.ReadAll(stdout)
+		assert.NoError(t, err)
+		assert.Empty(t, rest, workers)
+		assert.NoError(t, cmd.Wait(), stderr.String())
+	}
+}
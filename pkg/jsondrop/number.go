@@ -0,0 +1,146 @@
+package jsondrop
+
+import (
+	"strconv"
+	"strings"
+)
+
+// decimal is a JSON number as an exact decimal, digits × 10^exp, so numbers can be compared and
+// canonicalized without rounding them to a float64 first
+type decimal struct {
+	neg bool
+	// digits has no leading or trailing zeros, it's empty for zero
+	digits string
+	exp    int
+}
+
+// parseDecimal parses a number as JSON writes it, false if it isn't one or its exponent doesn't
+// fit an int
+func parseDecimal(num string) (decimal, bool) {
+	if !isJSONNumber(num) {
+		return decimal{}, false
+	}
+	var d decimal
+	if strings.HasPrefix(num, "-") {
+		d.neg = true
+		num = num[1:]
+	}
+	mantissa, exponent, hasExp := strings.Cut(strings.ToLower(num), "e")
+	if hasExp {
+		e, err := strconv.Atoi(exponent)
+		if err != nil {
+			return decimal{}, false
+		}
+		d.exp = e
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	d.exp -= len(fracPart)
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	trimmed := strings.TrimRight(digits, "0")
+	d.exp += len(digits) - len(trimmed)
+	d.digits = trimmed
+	if d.digits == "" {
+		d.neg, d.exp = false, 0
+	}
+	return d, true
+}
+
+// pointPos is where the decimal point goes in digits, it may be outside of them
+func (d decimal) pointPos() int {
+	return len(d.digits) + d.exp
+}
+
+// String writes integers of up to 21 trailing zeros in full (1e2 is 100), other numbers whose
+// exponent is below -4 or 21 and up in exponent form (1e-05, 1e+22) and the rest as decimals,
+// like strconv.FormatFloat's shortest 'g' format but without the rounding
+func (d decimal) String() string {
+	if d.digits == "" {
+		return "0"
+	}
+	var b strings.Builder
+	if d.neg {
+		b.WriteByte('-')
+	}
+	point := d.pointPos()
+	exp10 := point - 1
+	switch {
+	case d.exp >= 0 && d.exp <= 21:
+		b.WriteString(d.digits)
+		b.WriteString(strings.Repeat("0", d.exp))
+	case exp10 < -4 || exp10 >= 21:
+		b.WriteByte(d.digits[0])
+		if len(d.digits) > 1 {
+			b.WriteByte('.')
+			b.WriteString(d.digits[1:])
+		}
+		b.WriteByte('e')
+		if exp10 < 0 {
+			b.WriteByte('-')
+			exp10 = -exp10
+		} else {
+			b.WriteByte('+')
+		}
+		if exp10 < 10 {
+			b.WriteByte('0')
+		}
+		b.WriteString(strconv.Itoa(exp10))
+	case point <= 0:
+		b.WriteString("0.")
+		b.WriteString(strings.Repeat("0", -point))
+		b.WriteString(d.digits)
+	default:
+		b.WriteString(d.digits[:point])
+		b.WriteByte('.')
+		b.WriteString(d.digits[point:])
+	}
+	return b.String()
+}
+
+// compareDecimals returns -1, 0 or 1 as a is less than, equal to or greater than b
+func compareDecimals(a, b decimal) int {
+	sign := func(d decimal) int {
+		switch {
+		case d.digits == "":
+			return 0
+		case d.neg:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if sa, sb := sign(a), sign(b); sa != sb || sa == 0 {
+		switch {
+		case sa < sb:
+			return -1
+		case sa > sb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	cmp := 0
+	if pa, pb := a.pointPos(), b.pointPos(); pa != pb {
+		cmp = 1
+		if pa < pb {
+			cmp = -1
+		}
+	} else {
+		// same magnitude, the digits compare like strings padded with zeros
+		cmp = strings.Compare(a.digits, b.digits)
+	}
+	if a.neg {
+		return -cmp
+	}
+	return cmp
+}
+
+// canonicalNumber formats a number so equal numbers are written the same, 1.0, 1e0 and 1 are all
+// 1, without rounding, so 12345678901234567890 and 0.1000000000000000000001 stay what they are.
+// Anything that isn't a JSON number is returned as it is.
+func canonicalNumber(num string) string {
+	d, ok := parseDecimal(num)
+	if !ok {
+		return num
+	}
+	return d.String()
+}
@@ -0,0 +1,62 @@
+package jsondrop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalNumber(t *testing.T) {
+	cases := []struct {
+		num, want string
+	}{
+		{"0", "0"},
+		{"-0", "0"},
+		{"-0.0e10", "0"},
+		{"1.0", "1"},
+		{"1e0", "1"},
+		{"1e2", "100"},
+		{"1.50", "1.5"},
+		{"-2.5E-3", "-0.0025"},
+		{"0.0001", "0.0001"},
+		{"0.00001", "1e-05"},
+		{"1e21", "1000000000000000000000"},
+		{"1e22", "1e+22"},
+		{"1.5e300", "1.5e+300"},
+		{"12345678901234567890", "12345678901234567890"},
+		{"12345678901234567890.0", "12345678901234567890"},
+		{"0.1000000000000000000001", "0.1000000000000000000001"},
+		{"9007199254740993", "9007199254740993"},
+		{"123.456e1", "1234.56"},
+		{"not a number", "not a number"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, canonicalNumber(c.num), c.num)
+	}
+}
+
+func TestCompareDecimals(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "1.0", 0},
+		{"-0", "0", 0},
+		{"12345678901234567890", "12345678901234567891", -1},
+		{"9007199254740993", "9007199254740992", 1},
+		{"-1", "1", -1},
+		{"-10", "-9", -1},
+		{"0.1", "0.09", 1},
+		{"1e2", "99.999", 1},
+		{"-1e-5", "0", -1},
+		{"2", "10", -1},
+	}
+	for _, c := range cases {
+		a, ok := parseDecimal(c.a)
+		assert.True(t, ok, c.a)
+		b, ok := parseDecimal(c.b)
+		assert.True(t, ok, c.b)
+		assert.Equal(t, c.want, compareDecimals(a, b), "%s vs %s", c.a, c.b)
+		assert.Equal(t, -c.want, compareDecimals(b, a), "%s vs %s", c.b, c.a)
+	}
+}
@@ -0,0 +1,122 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// errorPolicy is what a row that fails to transform is replaced with
+type errorPolicy int
+
+const (
+	// errorFail stops the process, failing the query, the default
+	errorFail errorPolicy = iota
+	// errorPassthrough writes the input document unchanged
+	errorPassthrough
+	// errorEmpty writes an empty object
+	errorEmpty
+	// errorNull writes \N, NULL for a Nullable return type
+	errorNull
+	// errorTuple turns every row into a TabSeparated (result, error) pair, the error is empty for
+	// rows that succeed and the result for rows that fail
+	errorTuple
+)
+
+// parseErrorPolicy parses the -on-error flag
+func parseErrorPolicy(s string) (errorPolicy, error) {
+	switch s {
+	case "fail":
+		return errorFail, nil
+	case "passthrough":
+		return errorPassthrough, nil
+	case "empty":
+		return errorEmpty, nil
+	case "null":
+		return errorNull, nil
+	case "tuple":
+		return errorTuple, nil
+	default:
+		return 0, fmt.Errorf("unknown error policy %q, expected fail, passthrough, empty, null or tuple", s)
+	}
+}
+
+// onErrorLineFunc replaces the output of rows process fails on according to policy, so one
+// malformed document doesn't fail the whole query. Rows of TabSeparated modes pass their first
+// column through, still escaped.
+func onErrorLineFunc(process lineFunc, policy errorPolicy, tsv bool) lineFunc {
+	switch policy {
+	case errorFail:
+		return process
+	case errorTuple:
+		return tupleLineFunc(process, tsv)
+	}
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		if err := process(rawLine, buf); err != nil {
+			writeErrorRow(buf, policy, tsv, rawLine, err)
+		}
+		return nil
+	}
+}
+
+// writeErrorRow replaces buf with what policy writes for a row rawLine that failed with err
+func writeErrorRow(buf *bytes.Buffer, policy errorPolicy, tsv bool, rawLine []byte, err error) {
+	if n := rowErrors.Add(1); errorSample != nil {
+		errorSample.observe(n, rawLine, err)
+	}
+	buf.Reset()
+	switch policy {
+	case errorPassthrough:
+		if tsv {
+			rawLine, _, _ = bytes.Cut(rawLine, []byte{'\t'})
+		}
+		buf.Write(rawLine)
+	case errorEmpty:
+		buf.WriteString("{}")
+	case errorNull:
+		buf.Write(nullTSV)
+	case errorTuple:
+		buf.WriteByte('\t')
+		writeTSVEscaped(buf, []byte(err.Error()))
+	}
+}
+
+// tupleLineFunc writes each row as a TabSeparated result and error column, for a
+// Tuple(result String, error String) return type. Rows are TabSeparated on the way in too, so
+// single document modes unescape them first.
+func tupleLineFunc(process lineFunc, tsv bool) lineFunc {
+	var out bytes.Buffer
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		var err error
+		if tsv {
+			err = process(rawLine, buf)
+		} else {
+			err = process(unescapeTSV(rawLine), &out)
+			if err == nil {
+				buf.Reset()
+				writeTSVEscaped(buf, out.Bytes())
+			}
+		}
+		if err != nil {
+			writeErrorRow(buf, errorTuple, tsv, rawLine, err)
+			return nil
+		}
+		buf.WriteByte('\t')
+		return nil
+	}
+}
+
+// nullTSV is how TabSeparated and Raw rows write NULL
+var nullTSV = []byte(`\N`)
+
+// nullableLineFunc maps NULL and empty rows to NULL instead of failing to parse them, for
+// functions declared with Nullable(String) arguments and return type
+func nullableLineFunc(process lineFunc) lineFunc {
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		if len(rawLine) == 0 || bytes.Equal(rawLine, nullTSV) {
+			buf.Reset()
+			buf.Write(nullTSV)
+			return nil
+		}
+		return process(rawLine, buf)
+	}
+}
@@ -0,0 +1,82 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnError(t *testing.T) {
+	drop := documentLineFunc(dropKeysFunc(mustKeyDict(t, []string{"a"})), documentOptions{})
+	cases := []struct {
+		policy, input, want string
+		tsv                 bool
+	}{
+		{"passthrough", `{"a":`, `{"a":`, false},
+		{"empty", `{"a":`, `{}`, false},
+		{"null", `{"a":`, `\N`, false},
+		{"null", `{"a":1,"b":2}`, `{"b":2}`, false},
+		{"passthrough", "{\"a\":\"x\\\\ty\"\t{broken", `{"a":"x\\ty"`, true},
+	}
+	for _, c := range cases {
+		t.Run(c.policy+" "+c.input, func(t *testing.T) {
+			policy, err := parseErrorPolicy(c.policy)
+			assert.NoError(t, err)
+			process := drop
+			if c.tsv {
+				process = mergePatchLineFunc()
+			}
+			var buf bytes.Buffer
+			assert.NoError(t, onErrorLineFunc(process, policy, c.tsv)([]byte(c.input), &buf))
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+
+	var buf bytes.Buffer
+	assert.Error(t, onErrorLineFunc(drop, errorFail, false)([]byte(`{"a":`), &buf))
+	_, err := parseErrorPolicy("skip")
+	assert.Error(t, err)
+}
+
+func TestOnErrorTuple(t *testing.T) {
+	drop := documentLineFunc(dropKeysFunc(mustKeyDict(t, []string{"a"})), documentOptions{})
+	process := onErrorLineFunc(drop, errorTuple, false)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte("{\"a\":1,\"b\":\"x\\\\ty\"}"), &buf))
+	assert.Equal(t, "{\"b\":\"x\\\\ty\"}\t", buf.String())
+
+	assert.NoError(t, process([]byte(`{"a":`), &buf))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("\tjson parse error: ")), buf.String())
+	assert.NotContains(t, buf.String()[1:], "\t")
+
+	merge := onErrorLineFunc(mergePatchLineFunc(), errorTuple, true)
+	assert.NoError(t, merge([]byte("{\"a\":1}\t{\"b\":2}"), &buf))
+	assert.Equal(t, "{\"a\":1,\"b\":2}\t", buf.String())
+	assert.NoError(t, merge([]byte("{\"a\":1}\t{"), &buf))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("\t")), buf.String())
+}
+
+func TestNullable(t *testing.T) {
+	drop := documentLineFunc(dropKeysFunc(mustKeyDict(t, []string{"a"})), documentOptions{})
+	process := onErrorLineFunc(nullableLineFunc(drop), errorNull, false)
+	var buf bytes.Buffer
+	for input, want := range map[string]string{
+		`\N`:            `\N`,
+		``:              `\N`,
+		`{broken`:       `\N`,
+		`{"a":1,"b":2}`: `{"b":2}`,
+	} {
+		assert.NoError(t, process([]byte(input), &buf), input)
+		assert.Equal(t, want, buf.String(), input)
+	}
+
+	dispatch := dispatchLineFunc([]string{"-nullable"}, nil)
+	assert.NoError(t, dispatch([]byte("drop\t\\N\t['a']"), &buf))
+	assert.Equal(t, `\N`, buf.String())
+
+	c, err := parseConfig([]string{"-nullable", "-on-error=tuple"})
+	assert.NoError(t, err)
+	_, err = c.buildLineFunc([]string{"a"})
+	assert.Error(t, err)
+}
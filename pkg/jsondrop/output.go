@@ -0,0 +1,46 @@
+package jsondrop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// parseOutputFormat parses -output, it returns whether documents are indented
+func parseOutputFormat(s string) (pretty bool, err error) {
+	switch s {
+	case "compact":
+		return false, nil
+	case "pretty":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown output format %q, expected compact or pretty", s)
+	}
+}
+
+// prettyLineFunc indents the documents process writes by two spaces. Rows of TabSeparated modes
+// are indented before they're escaped, so their newlines survive as \n. Output that isn't JSON,
+// like validation errors, is left as it is.
+func prettyLineFunc(process lineFunc, tsv bool) lineFunc {
+	var out bytes.Buffer
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		if err := process(rawLine, buf); err != nil {
+			return err
+		}
+		doc := buf.Bytes()
+		if tsv {
+			doc = unescapeTSV(doc)
+		}
+		out.Reset()
+		if json.Indent(&out, doc, "", "  ") != nil {
+			return nil
+		}
+		buf.Reset()
+		if tsv {
+			writeTSVEscaped(buf, out.Bytes())
+		} else {
+			buf.Write(out.Bytes())
+		}
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrettyLineFunc(t *testing.T) {
+	process := prettyLineFunc(func(rawLine []byte, buf *bytes.Buffer) error {
+		return transformLine(dropKeysFunc(mustKeyDict(t, []string{"b"})), rawLine, buf)
+	}, false)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte(`{"a":{"x":[1,2]},"b":1,"c":{}}`), &buf))
+	assert.Equal(t, "{\n  \"a\": {\n    \"x\": [\n      1,\n      2\n    ]\n  },\n  \"c\": {}\n}", buf.String())
+}
+
+func TestPrettyLineFuncTSV(t *testing.T) {
+	process := prettyLineFunc(mergePatchLineFunc(), true)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte("{\"a\":\"x\\\\ty\"}\t{\"b\":1}"), &buf))
+	assert.Equal(t, `{\n  "a": "x\\ty",\n  "b": 1\n}`, buf.String())
+}
+
+func TestPrettyLineFuncNotJSON(t *testing.T) {
+	process := prettyLineFunc(validateLineFunc(true, duplicatesKeep), false)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte(`{"a":`), &buf))
+	assert.Contains(t, buf.String(), "json parse error")
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	pretty, err := parseOutputFormat("pretty")
+	assert.NoError(t, err)
+	assert.True(t, pretty)
+	pretty, err = parseOutputFormat("compact")
+	assert.NoError(t, err)
+	assert.False(t, pretty)
+	_, err = parseOutputFormat("yaml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package jsondrop
+
+import "strconv"
+
+// listPathsFunc replaces a document with a JSON array of the key paths in it, parents before
+// their children, in the order they first appear, without duplicates. Paths use the drop list
+// syntax, [*] for array elements and escapes for special characters, so they can be copied into a
+// key list as they are. The elements of a top-level array are documents, their paths are merged.
+func listPathsFunc() transformFunc {
+	return func(n node) node {
+		l := &pathLister{seen: make(map[string]struct{})}
+		if arr, ok := n.(*arrayNode); ok {
+			for _, value := range arr.values {
+				l.walk(value, "")
+			}
+		} else {
+			l.walk(n, "")
+		}
+		recycleNode(n)
+		return l.result()
+	}
+}
+
+type pathLister struct {
+	paths []string
+	seen  map[string]struct{}
+}
+
+func (l *pathLister) add(path string) {
+	if _, ok := l.seen[path]; ok {
+		return
+	}
+	l.seen[path] = struct{}{}
+	l.paths = append(l.paths, path)
+}
+
+func (l *pathLister) walk(n node, prefix string) {
+	switch v := n.(type) {
+	case *objectNode:
+		for _, entry := range v.entries {
+			path := escapePathSegment(entry.key)
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			l.add(path)
+			l.walk(entry.value, path)
+		}
+	case *arrayNode:
+		for _, value := range v.values {
+			// paths below elements only, the array itself was listed by its parent
+			l.walk(value, prefix+"[*]")
+		}
+	}
+}
+
+func (l *pathLister) result() node {
+	arr := arrayNodePool.Get().(*arrayNode)
+	arr.values = arr.values[:0]
+	for _, path := range l.paths {
+		arr.values = append(arr.values, stringNode(path))
+	}
+	return arr
+}
+
+// countKeysFunc replaces a document with the number of its members, only the top-level ones unless
+// recursive is set. With keys it counts the members and elements the paths match instead, i.e.
+// what drop would remove. The elements of a top-level array are documents, their counts are added up.
+func countKeysFunc(keys *jsonKey, recursive bool) transformFunc {
+	count := func(n node) int {
+		return countMembers(n, recursive)
+	}
+	if keys != nil {
+		count = func(n node) int {
+			return countMatches(n, keys.set())
+		}
+	}
+	return func(n node) node {
+		total := 0
+		if arr, ok := n.(*arrayNode); ok {
+			for i, value := range arr.values {
+				if keys == nil {
+					total += count(value)
+					continue
+				}
+				next, leaf := keys.set().elementLeaf(i, len(arr.values), value)
+				if leaf != nil {
+					total++
+					continue
+				}
+				total += countMatches(value, next.union(keys.set()))
+			}
+		} else {
+			total = count(n)
+		}
+		recycleNode(n)
+		v := valueNodePool.Get().(*valueNode)
+		*v = valueNode{kind: kindNumber, num: strconv.Itoa(total)}
+		return v
+	}
+}
+
+func countMembers(n node, recursive bool) int {
+	total := 0
+	switch v := n.(type) {
+	case *objectNode:
+		total = len(v.entries)
+		if recursive {
+			for _, entry := range v.entries {
+				total += countMembers(entry.value, true)
+			}
+		}
+	case *arrayNode:
+		if recursive {
+			for _, value := range v.values {
+				total += countMembers(value, true)
+			}
+		}
+	}
+	return total
+}
+
+func countMatches(n node, keys keySet) int {
+	total := 0
+	switch v := n.(type) {
+	case *objectNode:
+		v.entries = expandDottedEntries(v.entries, keys)
+		for _, entry := range v.entries {
+			next, leaf := keys.matchLeaf(entry.key, entry.value)
+			if leaf != nil {
+				total++
+			} else if next != nil {
+				total += countMatches(entry.value, next)
+			}
+		}
+	case *arrayNode:
+		for i, value := range v.values {
+			next, leaf := keys.elementLeaf(i, len(v.values), value)
+			if leaf != nil {
+				total++
+			} else if next != nil {
+				total += countMatches(value, next)
+			}
+		}
+	}
+	return total
+}
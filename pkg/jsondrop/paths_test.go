@@ -0,0 +1,63 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPathsJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+	}{
+		{"flat", `{"a":1,"b":2}`, `["a","b"]`},
+		{"nested", `{"a":{"b":{"c":1}},"d":null}`, `["a","a.b","a.b.c","d"]`},
+		{"arrays", `{"items":[{"sku":1},{"sku":2,"qty":3}],"tags":["x"]}`, `["items","items[*].sku","items[*].qty","tags"]`},
+		{"nested arrays", `{"m":[[{"a":1}]]}`, `["m","m[*][*].a"]`},
+		{"special keys are escaped", `{"$browser.version":1,"*":2}`, `["$browser\\.version","\\*"]`},
+		{"top-level array elements are merged", `[{"a":1},{"b":{"c":2}},3]`, `["a","b","b.c"]`},
+		{"scalar", `"x"`, `[]`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(listPathsFunc(), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestCountKeysJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+		recursive         bool
+	}{
+		{name: "top-level", input: `{"a":{"b":1,"c":2},"d":[{"e":1}]}`, want: `2`},
+		{name: "recursive", input: `{"a":{"b":1,"c":2},"d":[{"e":1}]}`, want: `5`, recursive: true},
+		{name: "empty", input: `{}`, want: `0`},
+		{name: "scalar", input: `"x"`, want: `0`},
+		{name: "matching paths", input: `{"a":{"b":1,"c":2},"b":3}`, want: `2`, keys: []string{"a.*"}},
+		{name: "matching at any depth", input: `{"token":1,"a":{"token":2,"x":[{"token":3}]}}`, want: `3`, keys: []string{"**.token"}},
+		{name: "dotted input keys", input: `{"a.b":1,"a":{"b":2}}`, want: `2`, keys: []string{"a.b"}},
+		{name: "array elements", input: `{"a":[1,2,3]}`, want: `3`, keys: []string{"a[*]"}},
+		{name: "top-level array", input: `[{"a":1,"b":2},{"a":3}]`, want: `3`},
+		{name: "top-level array matching", input: `[{"a":1,"b":2},{"a":3}]`, want: `2`, keys: []string{"a"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var keys *jsonKey
+			if c.keys != nil {
+				keys = mustKeyDict(t, c.keys)
+			}
+			var buf bytes.Buffer
+			err := transformLine(countKeysFunc(keys, c.recursive), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
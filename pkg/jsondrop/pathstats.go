@@ -0,0 +1,96 @@
+package jsondrop
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// pathHitCounts counts how many members and elements each listed path has dropped, for
+// -path-stats. Counters are kept by the path as it's listed, so they carry on when the keys file
+// is reloaded, and paths that never match show up as 0.
+type pathHitCounts struct {
+	mu    sync.Mutex
+	paths map[string]*atomic.Uint64
+}
+
+// pathHits is the process's counts, tries are built counting into it with -path-stats
+var pathHits pathHitCounts
+
+// counter returns the counter for path, nil for a nil p
+func (p *pathHitCounts) counter(path string) *atomic.Uint64 {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paths == nil {
+		p.paths = make(map[string]*atomic.Uint64)
+	}
+	c := p.paths[path]
+	if c == nil {
+		c = new(atomic.Uint64)
+		p.paths[path] = c
+	}
+	return c
+}
+
+// counts returns each path's counter and its count so far, nil for a nil p
+func (p *pathHitCounts) counts() map[*atomic.Uint64]uint64 {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts := make(map[*atomic.Uint64]uint64, len(p.paths))
+	for _, c := range p.paths {
+		counts[c] = c.Load()
+	}
+	return counts
+}
+
+// pathHit is a path's count
+type pathHit struct {
+	path string
+	hits uint64
+}
+
+// snapshot returns the counts so far, the paths that matched most first
+func (p *pathHitCounts) snapshot() []pathHit {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hits := make([]pathHit, 0, len(p.paths))
+	for path, c := range p.paths {
+		hits = append(hits, pathHit{path, c.Load()})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].hits != hits[j].hits {
+			return hits[i].hits > hits[j].hits
+		}
+		return hits[i].path < hits[j].path
+	})
+	return hits
+}
+
+// report logs the counts as one record, with the paths that never matched listed on their own as
+// the ones to consider removing
+func (p *pathHitCounts) report(log *slog.Logger, label string) {
+	hits := p.snapshot()
+	counts := make(map[string]uint64, len(hits))
+	unmatched := []string{}
+	for _, h := range hits {
+		counts[h.path] = h.hits
+		if h.hits == 0 {
+			unmatched = append(unmatched, h.path)
+		}
+	}
+	log.Info(label, "paths", counts, "unmatched", unmatched)
+}
+
+// countHit counts a drop by leaf, if its trie counts them
+func countHit(leaf *jsonKey) {
+	if leaf.hits != nil {
+		leaf.hits.Add(1)
+	}
+}
@@ -0,0 +1,100 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathStats(t *testing.T) {
+	for _, flags := range [][]string{{"-path-stats"}, {"-path-stats", "-verbatim"}} {
+		pathHits.paths = nil
+		c, err := parseConfig(flags)
+		assert.NoError(t, err)
+		process, err := c.buildLineFunc([]string{"email", "items[*].token", "/a/0", "props", "props.old", "never"})
+		assert.NoError(t, err, flags)
+		var buf bytes.Buffer
+		for _, row := range []string{
+			`{"email":1,"items":[{"token":1},{"token":2},{"x":1}]}`,
+			`{"email":2,"a":[1,2],"props":{}}`,
+			`{"a":{"0":1}}`,
+		} {
+			assert.NoError(t, process([]byte(row), &buf), flags)
+		}
+		hits := pathHits.snapshot()
+		assert.Equal(t, []pathHit{{"/a/0", 2}, {"email", 2}, {"items[*].token", 2}, {"props", 1}, {"never", 0}, {"props.old", 0}}, hits, flags)
+	}
+
+	// paths are counted as listed
+	// elements of a top-level array
+	pathHits.paths = nil
+	c, err := parseConfig([]string{"-path-stats"})
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc([]string{"[0]", "a"})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte(`[{"a":1},{"b":2,"a":3}]`), &buf))
+	assert.Equal(t, `[{"b":2}]`, buf.String())
+	assert.Equal(t, []pathHit{{"[0]", 1}, {"a", 1}}, pathHits.snapshot())
+
+	// and the repeated rows of a constant Native block
+	pathHits.paths = nil
+	doc := str(`[{"a":1},{"b":2}]`)
+	_, err = runNative(t, nativeBlock("String", []*string{doc, doc, doc}), []string{"[0]", "a"}, "-path-stats")
+	assert.NoError(t, err)
+	assert.Equal(t, []pathHit{{"[0]", 3}, {"a", 0}}, pathHits.snapshot())
+
+	pathHits.paths = nil
+	c, err = parseConfig([]string{"-path-stats", "-recursive"})
+	assert.NoError(t, err)
+	process, err = c.buildLineFunc([]string{"email"})
+	assert.NoError(t, err)
+	assert.NoError(t, process([]byte(`{"email":1,"a":{"email":2}}`), &buf))
+	assert.Equal(t, []pathHit{{"email", 2}}, pathHits.snapshot())
+
+	pathHits.paths = nil
+	c, err = parseConfig([]string{"-path-stats", "-dry-run"})
+	assert.NoError(t, err)
+	process, err = c.buildLineFunc([]string{"email"})
+	assert.NoError(t, err)
+	assert.NoError(t, process([]byte(`{"email":1}`), &buf))
+	assert.Equal(t, []pathHit{{"email", 0}}, pathHits.snapshot())
+
+	c, err = parseConfig([]string{"-path-stats", "-mode=keep"})
+	assert.NoError(t, err)
+	_, err = c.buildLineFunc([]string{"email"})
+	assert.Error(t, err)
+
+	// counting without -path-stats would slow every drop down
+	pathHits.paths = nil
+	c, err = parseConfig(nil)
+	assert.NoError(t, err)
+	process, err = c.buildLineFunc([]string{"email"})
+	assert.NoError(t, err)
+	assert.NoError(t, process([]byte(`{"email":1}`), &buf))
+	assert.Empty(t, pathHits.snapshot())
+}
+
+func TestPathStatsReport(t *testing.T) {
+	pathHits.paths = nil
+	pathHits.counter("a").Add(3)
+	pathHits.counter(`b"\`)
+	pathHits.counter("c")
+
+	var out bytes.Buffer
+	stats := newRunStats(jsonLogger(&out), 0, 0)
+	stats.paths = &pathHits
+	stats.latency = &latencyHistogram{}
+	var metrics bytes.Buffer
+	writeMetrics(&metrics, stats)
+	assert.Contains(t, metrics.String(), "# TYPE json_drop_keys_udf_path_hits_total counter\njson_drop_keys_udf_path_hits_total{path=\"a\"} 3\njson_drop_keys_udf_path_hits_total{path=\"b\\\"\\\\\"} 0\n")
+
+	stats.close()
+	records := logRecords(t, &out)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "path stats total", records[0]["msg"])
+		assert.Equal(t, map[string]any{"a": 3.0, `b"\`: 0.0, "c": 0.0}, records[0]["paths"])
+		assert.Equal(t, []any{`b"\`, "c"}, records[0]["unmatched"])
+	}
+}
@@ -0,0 +1,67 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// personPropertyObjects are the members of an event's properties that set person properties,
+// copies of what the event itself has
+var personPropertyObjects = []string{"$set", "$set_once"}
+
+// personPropertyModes are the modes -person-properties works with, those hiding what paths match
+var personPropertyModes = map[string]bool{"drop": true, "redact": true, "hash": true, "anonymize-ip": true}
+
+// personPropertyKeys adds the same paths under $set and $set_once to keys, for -person-properties,
+// and if unset is set the elements of $unset naming top-level keys, so the person properties an
+// event sets or unsets don't keep what's removed from the event. Paths that are already inside one
+// of them, or match at any depth, are left as they are.
+func personPropertyKeys(keys []string, unset bool) []string {
+	listed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		listed[key] = true
+	}
+	result := append([]string(nil), keys...)
+	add := func(key string) {
+		if !listed[key] {
+			listed[key] = true
+			result = append(result, key)
+		}
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, deepPrefix) || strings.HasPrefix(key, "**.") || isPersonProperties(key) {
+			continue
+		}
+		for _, object := range personPropertyObjects {
+			switch {
+			case isJSONPath(key):
+				add("$['" + object + "']" + key[1:])
+			case strings.HasPrefix(key, "/"):
+				add("/" + object + key)
+			default:
+				add(object + "." + key)
+			}
+		}
+		if unset && isTopLevelKey(key) {
+			add(fmt.Sprintf("$['$unset'][?(@=='%s')]", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(key)))
+		}
+	}
+	return result
+}
+
+// isPersonProperties reports whether key is $set, $set_once or $unset or a path inside one
+func isPersonProperties(key string) bool {
+	for _, object := range []string{"$set", "$set_once", "$unset"} {
+		for _, prefix := range []string{object, "/" + object, "$['" + object + "']", "$." + object} {
+			if rest, ok := strings.CutPrefix(key, prefix); ok && (rest == "" || strings.ContainsRune("./[", rune(rest[0]))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTopLevelKey reports whether key is a single plain key, as $unset lists them
+func isTopLevelKey(key string) bool {
+	return key != "" && !isJSONPath(key) && !strings.HasPrefix(key, "/") && !strings.ContainsAny(key, `.[]?*:\`)
+}
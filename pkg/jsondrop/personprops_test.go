@@ -0,0 +1,48 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonPropertyKeys(t *testing.T) {
+	assert.Equal(t, []string{
+		"email", "$.a.b", "/x/0", "deep:secret", "$set.plan", "it's",
+		"$set.email", "$set_once.email", "$['$unset'][?(@=='email')]",
+		"$['$set'].a.b", "$['$set_once'].a.b",
+		"/$set/x/0", "/$set_once/x/0",
+		"$set.it's", "$set_once.it's", `$['$unset'][?(@=='it\'s')]`,
+	}, personPropertyKeys([]string{"email", "$.a.b", "/x/0", "deep:secret", "$set.plan", "it's"}, true))
+
+	// $set.props.token is listed already
+	keys := personPropertyKeys([]string{"props.token", "$set.props.token", "$setting"}, false)
+	assert.Equal(t, []string{"props.token", "$set.props.token", "$setting", "$set_once.props.token", "$set.$setting", "$set_once.$setting"}, keys)
+}
+
+func TestPersonProperties(t *testing.T) {
+	line := `{"email":"a","$set":{"email":"a","plan":"pro"},"$set_once":{"email":"a"},"$unset":["email","name"]}`
+	for _, tc := range []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"-person-properties"}, `{"$set":{"plan":"pro"},"$set_once":{},"$unset":["name"]}`},
+		{[]string{"-person-properties", "-verbatim"}, `{"$set":{"plan":"pro"},"$set_once":{},"$unset":["name"]}`},
+		{[]string{"-person-properties", "-mode=redact"}, `{"email":"[REDACTED]","$set":{"email":"[REDACTED]","plan":"pro"},"$set_once":{"email":"[REDACTED]"},"$unset":["email","name"]}`},
+		{nil, `{"$set":{"email":"a","plan":"pro"},"$set_once":{"email":"a"},"$unset":["email","name"]}`},
+	} {
+		c, err := parseConfig(append(tc.flags, "['email']"))
+		assert.NoError(t, err)
+		process, err := c.lineFunc(nil, false)
+		assert.NoError(t, err, tc.flags)
+		var buf bytes.Buffer
+		assert.NoError(t, process([]byte(line), &buf), tc.flags)
+		assert.Equal(t, tc.want, buf.String(), tc.flags)
+	}
+
+	c, err := parseConfig([]string{"-person-properties", "-mode=keep", "['email']"})
+	assert.NoError(t, err)
+	_, err = c.lineFunc(nil, false)
+	assert.EqualError(t, err, "-person-properties only works with -mode=drop, redact, hash and anonymize-ip")
+}
@@ -0,0 +1,189 @@
+package jsondrop
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// piiDetector finds one kind of PII in strings, valid rejects regexp matches that aren't really
+// PII, like card numbers failing the Luhn check, and isolated those that are part of something
+// longer, given the text before and after them
+type piiDetector struct {
+	name     string
+	token    string
+	re       *regexp.Regexp
+	valid    func(match string) bool
+	isolated func(before, after string) bool
+}
+
+// piiDetectors run in this order, card numbers go before phone numbers so they're not taken for one
+var piiDetectors = []piiDetector{
+	{
+		name:  "email",
+		token: "[EMAIL]",
+		re:    regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	{
+		name:  "card",
+		token: "[CARD]",
+		re:    regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+		valid: luhnValid,
+	},
+	{
+		name:  "ipv6",
+		token: "[IP]",
+		re:    regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:(?:\.\d{1,3}){3})?`),
+		valid: func(match string) bool {
+			addr, err := netip.ParseAddr(match)
+			return err == nil && addr.Is6() && strings.ContainsAny(match, "0123456789abcdefABCDEF")
+		},
+	},
+	{
+		name:  "ipv4",
+		token: "[IP]",
+		re:    regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+		// four numbers of a longer dotted version like 1.2.3.4.5 aren't an address
+		isolated: func(before, after string) bool {
+			return !separatedDigit(before, after, '.')
+		},
+	},
+	{
+		name:  "phone",
+		token: "[PHONE]",
+		re:    regexp.MustCompile(`(?:\+|\b)(?:\(?\d{1,4}\)?[ .\-]?){2,6}\d{2,4}\b`),
+		valid: phoneValid,
+		// digits next to a colon are the hour or minutes of a time, and next to a dot part of a
+		// longer dotted version
+		isolated: func(before, after string) bool {
+			return !separatedDigit(before, after, ':') && !separatedDigit(before, after, '.')
+		},
+	},
+}
+
+// parsePIIDetectors parses a comma separated list of detector names
+func parsePIIDetectors(s string) ([]piiDetector, error) {
+	var detectors []piiDetector
+	enabled := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, d := range piiDetectors {
+			if d.name == name {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown PII detector %q, expected email, card, ipv6, ipv4 or phone", name)
+		}
+		enabled[name] = true
+	}
+	for _, d := range piiDetectors {
+		if enabled[d.name] {
+			detectors = append(detectors, d)
+		}
+	}
+	return detectors, nil
+}
+
+// maskPIIFunc replaces PII in string values at any depth with a token naming what was there,
+// e.g. "mail a@b.co" becomes "mail [EMAIL]". Keys aren't scanned.
+func maskPIIFunc(detectors []piiDetector) transformFunc {
+	var mask func(n node) node
+	mask = func(n node) node {
+		switch v := n.(type) {
+		case *valueNode:
+			if v.kind == kindString {
+				v.str = maskPII(v.str, detectors)
+			}
+		case *objectNode:
+			for i := range v.entries {
+				v.entries[i].value = mask(v.entries[i].value)
+			}
+		case *arrayNode:
+			for i, value := range v.values {
+				v.values[i] = mask(value)
+			}
+		}
+		return n
+	}
+	return mask
+}
+
+func maskPII(s string, detectors []piiDetector) string {
+	for _, d := range detectors {
+		var out strings.Builder
+		last := 0
+		for _, m := range d.re.FindAllStringIndex(s, -1) {
+			if d.valid != nil && !d.valid(s[m[0]:m[1]]) || d.isolated != nil && !d.isolated(s[:m[0]], s[m[1]:]) {
+				continue
+			}
+			out.WriteString(s[last:m[0]])
+			out.WriteString(d.token)
+			last = m[1]
+		}
+		if last > 0 {
+			out.WriteString(s[last:])
+			s = out.String()
+		}
+	}
+	return s
+}
+
+// separatedDigit reports whether before ends with a digit and sep or after starts with sep and a
+// digit
+func separatedDigit(before, after string, sep byte) bool {
+	isDigit := func(ch byte) bool { return ch >= '0' && ch <= '9' }
+	return len(before) >= 2 && before[len(before)-1] == sep && isDigit(before[len(before)-2]) ||
+		len(after) >= 2 && after[0] == sep && isDigit(after[1])
+}
+
+func digitsOf(s string) []byte {
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits = append(digits, s[i]-'0')
+		}
+	}
+	return digits
+}
+
+// luhnValid checks the Luhn checksum of the digits in a card number
+func luhnValid(number string) bool {
+	digits := digitsOf(number)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i])
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// datePattern matches dates like 2024-01-15 or 15.01.2024 in a phone number match
+var datePattern = regexp.MustCompile(`(?:^|\D)(?:\d{4}[-/.]\d{1,2}[-/.]\d{1,2}|\d{1,2}[-/.]\d{1,2}[-/.]\d{4})(?:\D|$)`)
+
+// phoneValid accepts 7 to 15 digits (the E.164 maximum) written like a phone number, with a
+// leading + or separators, so plain numeric IDs, timestamps and dates aren't masked
+func phoneValid(match string) bool {
+	digits := digitsOf(match)
+	if len(digits) < 7 || len(digits) > 15 {
+		return false
+	}
+	if datePattern.MatchString(match) {
+		return false
+	}
+	return strings.HasPrefix(match, "+") || strings.ContainsAny(match, " .-()")
+}
@@ -0,0 +1,53 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskPII(t *testing.T) {
+	all, err := parsePIIDetectors("email,card,ipv6,ipv4,phone")
+	assert.NoError(t, err)
+	cases := []struct {
+		input, want string
+	}{
+		{"mail me at john.doe+tag@example.co.uk today", "mail me at [EMAIL] today"},
+		{"card 4111 1111 1111 1111 ok", "card [CARD] ok"},
+		{"card 4111-1111-1111-1111", "card [CARD]"},
+		{"not a card 4111111111111112", "not a card 4111111111111112"},
+		{"from 192.168.0.1:8080", "from [IP]:8080"},
+		{"not an ip 999.1.1.1", "not an ip 999.1.1.1"},
+		{"v6 2001:db8::8a2e:370:7334 and ::1", "v6 [IP] and [IP]"},
+		{"time 12:30:45", "time 12:30:45"},
+		{"call +1 (555) 123-4567", "call [PHONE]"},
+		{"call 555-123-4567 now", "call [PHONE] now"},
+		{"id 1700000000123", "id 1700000000123"},
+		{"version 1.2.3", "version 1.2.3"},
+		{"version 1.2.3.4.5", "version 1.2.3.4.5"},
+		{"build 9.10.11.12.13.14.15.16", "build 9.10.11.12.13.14.15.16"},
+		{"from 10.0.0.1.", "from [IP]."},
+		{`{"date":"2024-01-15"}`, `{"date":"2024-01-15"}`},
+		{"at 2024-01-15 10:30:00", "at 2024-01-15 10:30:00"},
+		{"on 15.01.2024 and 01/15/2024", "on 15.01.2024 and 01/15/2024"},
+		{"call 555-123-4567 at 10:30", "call [PHONE] at 10:30"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, maskPII(c.input, all), c.input)
+	}
+}
+
+func TestMaskPIIJSON(t *testing.T) {
+	detectors, err := parsePIIDetectors("email, ipv4")
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	input := `{"email":"a@b.co","a@b.co":1,"nested":[{"ip":"10.0.0.1","phone":"+1 555 123 4567"}],"n":5}`
+	err = transformLine(maskPIIFunc(detectors), []byte(input), &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"email":"[EMAIL]","a@b.co":1,"nested":[{"ip":"[IP]","phone":"+1 555 123 4567"}],"n":5}`, buf.String())
+
+	_, err = parsePIIDetectors("email,ssn")
+	assert.Error(t, err)
+}
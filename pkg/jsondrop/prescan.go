@@ -0,0 +1,115 @@
+package jsondrop
+
+import "bytes"
+
+// prescan rules out from the raw bytes of a row that dropping keys changes it, so the row can
+// be written out as it is without parsing it
+type prescan struct {
+	// needles hold the deepest exact key of every path, a path can only match a row that has it
+	needles [][]byte
+}
+
+// newPrescan returns nil for tries a substring scan can't rule out: case-insensitive keys can
+// appear in any case, and paths with no exact key, like "*" or "[0]", match keys it can't name
+func newPrescan(keys *jsonKey) *prescan {
+	if keys.ignoreCase {
+		return nil
+	}
+	needles := make(map[string]struct{})
+	ok := true
+	var walk func(k *jsonKey, literal string)
+	walk = func(k *jsonKey, literal string) {
+		if k.leaf {
+			if literal == "" {
+				ok = false
+			}
+			needles[literal] = struct{}{}
+			return
+		}
+		for part, c := range k.children {
+			walk(c, part)
+		}
+		for _, c := range []*jsonKey{k.wildcard, k.deep, k.anyElement} {
+			if c != nil {
+				walk(c, literal)
+			}
+		}
+		for _, p := range k.patterns {
+			walk(p.child, literal)
+		}
+		for _, c := range k.elements {
+			walk(c, literal)
+		}
+	}
+	walk(keys, "")
+	if !ok {
+		return nil
+	}
+	p := &prescan{}
+	for needle := range needles {
+		p.needles = append(p.needles, []byte(needle))
+	}
+	return p
+}
+
+// mayMatch reports whether dropping keys could change line. A key only counts between quotes
+// or dots, which DropKeys expands nested objects at. Rows with a backslash might spell a key
+// with escapes, and rows with dotted keys have them expanded whether a path matches or not, so
+// they always could.
+func (p *prescan) mayMatch(line []byte) bool {
+	if bytes.IndexByte(line, '\\') >= 0 || hasDottedKey(line) {
+		return true
+	}
+	for _, needle := range p.needles {
+		for from := 0; ; {
+			i := bytes.Index(line[from:], needle)
+			if i < 0 {
+				break
+			}
+			start, end := from+i, from+i+len(needle)
+			if start > 0 && end < len(line) && isKeyBoundary(line[start-1]) && isKeyBoundary(line[end]) {
+				return true
+			}
+			from = start + 1
+		}
+	}
+	return false
+}
+
+// hasDottedKey reports whether a key in line, which has no backslashes, has a dot in it.
+// Without escapes every string runs from one quote to the next, and keys are the strings
+// followed by a colon.
+func hasDottedKey(line []byte) bool {
+	for i := 0; ; {
+		open := bytes.IndexByte(line[i:], '"')
+		if open < 0 {
+			return false
+		}
+		open += i
+		end := bytes.IndexByte(line[open+1:], '"')
+		if end < 0 {
+			return false
+		}
+		end += open + 1
+		i = skipSpace(line, end+1)
+		if i < len(line) && line[i] == ':' && bytes.IndexByte(line[open:end], '.') >= 0 {
+			return true
+		}
+	}
+}
+
+func isKeyBoundary(c byte) bool {
+	return c == '"' || c == '.'
+}
+
+// prescanLineFunc writes rows p rules out unchanged, and hands the rest to process
+func prescanLineFunc(p *prescan, process lineFunc) lineFunc {
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		if p.mayMatch(rawLine) {
+			return process(rawLine, buf)
+		}
+		buf.Reset()
+		buf.Write(rawLine)
+		return nil
+	}
+}
@@ -0,0 +1,57 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrescan(t *testing.T) {
+	p := newPrescan(mustKeyDict(t, []string{"props.email", "items[*].secret", "deep:token"}))
+	assert.NotNil(t, p)
+	for line, want := range map[string]bool{
+		`{"props":{"name":"x"}}`:          false,
+		`{"props":{"email":"a@b.c"}}`:     true,
+		`{"props.email":"a@b.c"}`:         true,
+		`{"emails":1,"my_email":2}`:       false,
+		`{"items":[{"secret":1}]}`:        true,
+		`{"a":{"b":{"token":1}}}`:         true,
+		`{"a":"token"}`:                   true,
+		`{"text":"no token here"}`:        false,
+		`{"text":"email"}`:                true,
+		`{ "props" : { "name" : "x" } } `: false,
+	} {
+		assert.Equal(t, want, p.mayMatch([]byte(line)), line)
+	}
+
+	assert.NotNil(t, newPrescan(mustKeyDict(t, []string{"props.*"})))
+	for _, keys := range [][]string{{"*"}, {"[0]"}, {"props.x", "re:^ab"}} {
+		assert.Nil(t, newPrescan(mustKeyDict(t, keys)), keys)
+	}
+	caseless, err := newKeyDict([]string{"email"}, keyDictOptions{ignoreCase: true})
+	assert.NoError(t, err)
+	assert.Nil(t, newPrescan(caseless))
+
+	empty := newPrescan(mustKeyDict(t, nil))
+	assert.False(t, empty.mayMatch([]byte(`{"a":{"b":"c.d"}}`)))
+	// dotted keys are expanded by DropKeys even when nothing is dropped
+	assert.True(t, empty.mayMatch([]byte(`{"a":{"b.c" : 1}}`)))
+	assert.True(t, empty.mayMatch([]byte(`{"a\\"b":1}`)))
+}
+
+func TestPrescanLineFunc(t *testing.T) {
+	c, err := parseConfig([]string{"-prescan"})
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc([]string{"props.email"})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	for line, want := range map[string]string{
+		`{ "props": {"name": "x"} }`:          `{ "props": {"name": "x"} }`,
+		`{"props": {"email": "a", "n": 1}}`:   `{"props":{"n":1}}`,
+		`{"props": {"email": "a", "n": 1} } `: `{"props":{"n":1}}`,
+	} {
+		assert.NoError(t, process([]byte(line), &buf), line)
+		assert.Equal(t, want, buf.String(), line)
+	}
+}
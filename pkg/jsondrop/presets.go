@@ -0,0 +1,86 @@
+package jsondrop
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// presets are curated lists of PostHog's own properties, for -preset. Paths are relative to an
+// event's properties, as the document a function gets is the properties column.
+var presets = map[string][]string{
+	// what the SDKs attach about the flags evaluated for an event, and $feature_flag_called's own
+	"posthog-feature-flags": {
+		"$active_feature_flags",
+		"prefix:$feature/",
+		"$feature_flag",
+		"$feature_flag_response",
+		"$feature_flag_payload",
+		"$feature_flag_bootstrapped_response",
+		"$feature_flag_bootstrapped_payload",
+	},
+	// the GeoIP lookup on ingestion, on the event and in the person properties it sets
+	"posthog-geoip": {
+		"prefix:$geoip_",
+		"prefix:$initial_geoip_",
+		"$set.prefix:$geoip_",
+		"$set_once.prefix:$initial_geoip_",
+	},
+	// SDK and pipeline bookkeeping no query reads
+	"posthog-internal": {
+		"$lib",
+		"$lib_version",
+		"$lib_custom_api_host",
+		"$insert_id",
+		"$time",
+		"$configured_session_timeout_ms",
+		"$plugins_succeeded",
+		"$plugins_failed",
+		"$plugins_deferred",
+	},
+}
+
+// presetNames lists the presets, sorted
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// presetsValue is -preset, which may be given more than once or as a comma separated list
+type presetsValue struct {
+	names *[]string
+}
+
+func (v presetsValue) String() string {
+	if v.names == nil {
+		return ""
+	}
+	return strings.Join(*v.names, ",")
+}
+
+func (v presetsValue) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := presets[name]; !ok {
+			return fmt.Errorf("unknown preset %q, expected one of %s", name, strings.Join(presetNames(), ", "))
+		}
+		if !slices.Contains(*v.names, name) {
+			*v.names = append(*v.names, name)
+		}
+	}
+	return nil
+}
+
+// presetKeys returns the paths of the presets named
+func presetKeys(names []string) []string {
+	var keys []string
+	for _, name := range names {
+		keys = append(keys, presets[name]...)
+	}
+	return keys
+}
@@ -0,0 +1,41 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresets(t *testing.T) {
+	for _, name := range presetNames() {
+		_, err := makeKeyDict(presets[name])
+		assert.NoError(t, err, name)
+		_, warnings, err := checkKeyList(presets[name], "drop", false)
+		assert.NoError(t, err, name)
+		assert.Empty(t, warnings, name)
+	}
+
+	for _, tc := range []struct {
+		flags      []string
+		line, want string
+	}{
+		{[]string{"-preset", "posthog-feature-flags"}, `{"$feature/beta":true,"$active_feature_flags":["beta"],"$feature_flag":"beta","$browser":"x"}`, `{"$browser":"x"}`},
+		{[]string{"-preset=posthog-geoip"}, `{"$geoip_city_name":"x","$set":{"$geoip_country_code":"y","email":"z"},"$set_once":{"$initial_geoip_city_name":"w"},"$ip":"1"}`, `{"$set":{"email":"z"},"$set_once":{},"$ip":"1"}`},
+		{[]string{"-preset=posthog-internal,posthog-geoip", "['$ip']"}, `{"$lib":"web","$insert_id":"x","$geoip_city_name":"y","$ip":"1","a":2}`, `{"a":2}`},
+		{[]string{"-preset=posthog-internal", "-preset=posthog-internal", "-mode=keep"}, `{"$lib":"web","a":2}`, `{"$lib":"web"}`},
+	} {
+		c, err := parseConfig(tc.flags)
+		assert.NoError(t, err, tc.flags)
+		process, err := c.lineFunc(nil, false)
+		assert.NoError(t, err, tc.flags)
+		var buf bytes.Buffer
+		assert.NoError(t, process([]byte(tc.line), &buf), tc.flags)
+		assert.Equal(t, tc.want, buf.String(), tc.flags)
+	}
+
+	_, err := parseConfig([]string{"-preset=posthog-everything"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown preset "posthog-everything", expected one of posthog-feature-flags, posthog-geoip, posthog-internal`)
+	}
+}
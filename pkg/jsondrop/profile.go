@@ -0,0 +1,100 @@
+package jsondrop
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts what -cpuprofile, -memprofile and -pprof-listen ask for. stop ends the
+// CPU profile and writes the heap profile, so it runs when the input is done. A pprof address
+// already in use is logged but isn't an error, another process of the same function has it.
+func (c *config) startProfiling(log *slog.Logger) (stop func() error, err error) {
+	var cpu *os.File
+	if c.cpuProfile != "" {
+		if cpu, err = os.Create(c.cpuProfile); err != nil {
+			return nil, fmt.Errorf("cpuprofile create error: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			_ = cpu.Close()
+			return nil, fmt.Errorf("cpuprofile start error: %w", err)
+		}
+	}
+	if c.pprofListen != "" {
+		err := listenPprof(c.pprofListen)
+		var inUse *listenError
+		if errors.As(err, &inUse) {
+			log.Warn("pprof listener not started", "error", err.Error())
+		} else if err != nil {
+			if cpu != nil {
+				pprof.StopCPUProfile()
+				_ = cpu.Close()
+			}
+			return nil, err
+		}
+	}
+
+	return func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			_ = cpu.Close()
+		}
+		if c.memProfile == "" {
+			return nil
+		}
+		f, err := os.Create(c.memProfile)
+		if err != nil {
+			return fmt.Errorf("memprofile create error: %w", err)
+		}
+		defer f.Close()
+		// the heap profile is as of the last GC, this makes it include the last rows
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return fmt.Errorf("memprofile write error: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// listenError is a -pprof-listen or -metrics-listen address that can't be listened on
+type listenError struct {
+	flag string
+	err  error
+}
+
+func (e *listenError) Error() string { return fmt.Sprintf("-%s: %v", e.flag, e.err) }
+
+// listenPprof serves the net/http/pprof handlers at addr in the background. The profiles show
+// the documents being transformed, so addr has to be a loopback address, and a bare :port
+// listens on 127.0.0.1.
+func listenPprof(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("-pprof-listen: %w", err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("-pprof-listen must be a loopback address, not %q", host)
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return &listenError{"pprof-listen", err}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	go func() { _ = http.Serve(l, mux) }()
+	return nil
+}
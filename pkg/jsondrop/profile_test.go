@@ -0,0 +1,52 @@
+package jsondrop
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfiling(t *testing.T) {
+	dir := t.TempDir()
+	c := &config{cpuProfile: filepath.Join(dir, "cpu.pprof"), memProfile: filepath.Join(dir, "mem.pprof")}
+	stop, err := c.startProfiling(jsonLogger(io.Discard))
+	assert.NoError(t, err)
+	assert.NoError(t, stop())
+	for _, path := range []string{c.cpuProfile, c.memProfile} {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.NotZero(t, info.Size(), path)
+	}
+}
+
+func TestPprofListen(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:6060", "example.com:6060", "6060"} {
+		assert.Error(t, listenPprof(addr), addr)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+	assert.NoError(t, listenPprof(addr))
+	var inUse *listenError
+	assert.ErrorAs(t, listenPprof(addr), &inUse)
+	var log bytes.Buffer
+	_, err = (&config{pprofListen: addr}).startProfiling(jsonLogger(&log))
+	assert.NoError(t, err)
+	assert.Contains(t, log.String(), `"level":"WARN","msg":"pprof listener not started","error":"-pprof-listen: `)
+
+	resp, err := http.Get("http://" + addr + "/debug/pprof/goroutine?debug=1")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "goroutine profile")
+}
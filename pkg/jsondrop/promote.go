@@ -0,0 +1,120 @@
+package jsondrop
+
+import "fmt"
+
+// parseCollisionPolicy parses the -collision flag, keep or overwrite, it returns whether promoted
+// members replace the parent's members with the same key
+func parseCollisionPolicy(s string) (overwrite bool, err error) {
+	switch s {
+	case "keep":
+		return false, nil
+	case "overwrite":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown collision policy %q, expected keep or overwrite", s)
+	}
+}
+
+// promoteFunc moves the members of the objects the paths match up into their parent, in place of
+// the object, e.g. with properties.$set {"properties":{"$set":{"a":1},"b":2}} becomes
+// {"properties":{"a":1,"b":2}}. A promoted member whose key the parent already has is discarded,
+// or with overwrite replaces the parent's value where it is. Matched values that aren't objects,
+// and objects that are array elements, have no members to move and are left alone.
+func promoteFunc(keys *jsonKey, overwrite bool) transformFunc {
+	return func(n node) node {
+		if arr, ok := n.(*arrayNode); ok {
+			for i, value := range arr.values {
+				arr.values[i] = promote(value, keys.set(), overwrite)
+			}
+			return arr
+		}
+		return promote(n, keys.set(), overwrite)
+	}
+}
+
+func promote(n node, keys keySet, overwrite bool) node {
+	switch v := n.(type) {
+	case *objectNode:
+		v.promote(keys, overwrite)
+	case *arrayNode:
+		count := len(v.values)
+		for i, value := range v.values {
+			next, _ := keys.elementLeaf(i, count, value)
+			v.values[i] = promote(value, next, overwrite)
+		}
+	}
+	return n
+}
+
+func (o *objectNode) promote(keys keySet, overwrite bool) {
+	if len(o.entries) == 0 {
+		return
+	}
+	o.entries = expandDottedEntries(o.entries, keys)
+
+	var promoted []bool
+	for i, entry := range o.entries {
+		next, leaf := keys.matchLeaf(entry.key, entry.value)
+		if _, isObject := entry.value.(*objectNode); leaf != nil && isObject {
+			if promoted == nil {
+				promoted = make([]bool, len(o.entries))
+			}
+			promoted[i] = true
+		} else if next != nil {
+			o.entries[i].value = promote(entry.value, next, overwrite)
+		}
+	}
+	if promoted == nil {
+		return
+	}
+
+	parentKeys := make(map[string]struct{}, len(o.entries))
+	for i, entry := range o.entries {
+		if !promoted[i] {
+			parentKeys[entry.key] = struct{}{}
+		}
+	}
+	// members colliding with the parent's are applied once the parent's entries are in place,
+	// members of two promoted objects colliding with each other are resolved as they're moved
+	overwrites := make(map[string]node)
+	lifted := make(map[string]int)
+	entries := make([]objectEntry, 0, len(o.entries))
+	for i, entry := range o.entries {
+		if !promoted[i] {
+			entries = append(entries, entry)
+			continue
+		}
+		child := entry.value.(*objectNode)
+		for _, member := range child.entries {
+			_, inParent := parentKeys[member.key]
+			at, inLifted := lifted[member.key]
+			switch {
+			case (inParent || inLifted) && !overwrite:
+				recycleNode(member.value)
+				continue
+			case inParent:
+				if previous, ok := overwrites[member.key]; ok {
+					recycleNode(previous)
+				}
+				overwrites[member.key] = member.value
+				continue
+			case inLifted:
+				recycleNode(entries[at].value)
+				entries[at].value = member.value
+				continue
+			}
+			lifted[member.key] = len(entries)
+			entries = append(entries, member)
+		}
+		child.entries = child.entries[:0]
+		objectNodePool.Put(child)
+	}
+	for i, entry := range entries {
+		if value, ok := overwrites[entry.key]; ok {
+			recycleNode(entry.value)
+			entries[i].value = value
+			delete(overwrites, entry.key)
+		}
+	}
+	o.entries = entries
+}
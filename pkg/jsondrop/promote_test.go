@@ -0,0 +1,96 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromoteJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+		overwrite         bool
+	}{
+		{
+			name:  "lift members in place",
+			input: `{"properties":{"a":1,"$set":{"x":1,"y":2},"b":2}}`,
+			want:  `{"properties":{"a":1,"x":1,"y":2,"b":2}}`,
+			keys:  []string{"properties.$set"},
+		},
+		{
+			name:  "parent wins by default",
+			input: `{"p":{"name":"old","$set":{"name":"new","age":3}}}`,
+			want:  `{"p":{"name":"old","age":3}}`,
+			keys:  []string{"p.$set"},
+		},
+		{
+			name:      "overwrite keeps the parent's position",
+			input:     `{"p":{"name":"old","$set":{"name":"new","age":3}}}`,
+			want:      `{"p":{"name":"new","age":3}}`,
+			keys:      []string{"p.$set"},
+			overwrite: true,
+		},
+		{
+			name:  "two promoted objects, first wins",
+			input: `{"p":{"$set":{"a":1},"$set_once":{"a":2,"b":3}}}`,
+			want:  `{"p":{"a":1,"b":3}}`,
+			keys:  []string{"p.$set", "p.$set_once"},
+		},
+		{
+			name:      "two promoted objects, last wins with overwrite",
+			input:     `{"p":{"$set":{"a":1},"$set_once":{"a":2,"b":3}}}`,
+			want:      `{"p":{"a":2,"b":3}}`,
+			keys:      []string{"p.$set", "p.$set_once"},
+			overwrite: true,
+		},
+		{
+			name:  "promote to top level",
+			input: `{"event":"x","properties":{"a":1}}`,
+			want:  `{"event":"x","a":1}`,
+			keys:  []string{"properties"},
+		},
+		{
+			name:  "non-objects are left alone",
+			input: `{"p":{"$set":"str","q":[{"a":1}]}}`,
+			want:  `{"p":{"$set":"str","q":[{"a":1}]}}`,
+			keys:  []string{"p.$set", "p.q[0]"},
+		},
+		{
+			name:  "inside array elements",
+			input: `{"items":[{"meta":{"a":1}},{"meta":{"b":2},"c":3}]}`,
+			want:  `{"items":[{"a":1},{"b":2,"c":3}]}`,
+			keys:  []string{"items[*].meta"},
+		},
+		{
+			name:  "empty object disappears",
+			input: `{"a":1,"$set":{}}`,
+			want:  `{"a":1}`,
+			keys:  []string{"$set"},
+		},
+		{
+			name:  "top-level array elements are documents",
+			input: `[{"$set":{"a":1}},{"$set":{"b":2}}]`,
+			want:  `[{"a":1},{"b":2}]`,
+			keys:  []string{"$set"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(promoteFunc(mustKeyDict(t, c.keys), c.overwrite), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestParseCollisionPolicy(t *testing.T) {
+	overwrite, err := parseCollisionPolicy("overwrite")
+	assert.NoError(t, err)
+	assert.True(t, overwrite)
+	_, err = parseCollisionPolicy("merge")
+	assert.Error(t, err)
+}
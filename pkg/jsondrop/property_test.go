@@ -0,0 +1,249 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fastjson"
+)
+
+// propertyKeys are the keys of generated documents, few enough that drop paths hit them. None has
+// a dot, top-level ones would be expanded into objects.
+var propertyKeys = []string{"a", "b", "c", "$ip", "é", "x y", `q"uote`, ""}
+
+// randomDocument writes a random object as the UDF writes documents, compact, with its strings
+// escaped the way writeJSONString escapes them
+func randomDocument(r *rand.Rand) []byte {
+	var buf bytes.Buffer
+	writeRandomObject(r, &buf, 0)
+	return buf.Bytes()
+}
+
+func writeRandomObject(r *rand.Rand, buf *bytes.Buffer, depth int) {
+	buf.WriteByte('{')
+	for i, k := range r.Perm(len(propertyKeys))[:r.IntN(len(propertyKeys)+1)] {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeExpectedString(buf, propertyKeys[k])
+		buf.WriteByte(':')
+		writeRandomValue(r, buf, depth+1)
+	}
+	buf.WriteByte('}')
+}
+
+func writeRandomValue(r *rand.Rand, buf *bytes.Buffer, depth int) {
+	kinds := 8
+	if depth >= 5 {
+		// only scalars this deep
+		kinds = 6
+	}
+	switch r.IntN(kinds) {
+	case 0:
+		buf.WriteString("null")
+	case 1:
+		fmt.Fprint(buf, r.IntN(2) == 0)
+	case 2:
+		buf.WriteString([]string{"0", "-7", "3.25", "1e-7", "-2.5E+30", "12345678901234567890123"}[r.IntN(6)])
+	case 3, 4, 5:
+		var s strings.Builder
+		for range r.IntN(8) {
+			s.WriteString([]string{"a", "Z", " ", "é", "😀", `"`, `\`, "\n", "\t", "\x01", "/", "<"}[r.IntN(12)])
+		}
+		writeExpectedString(buf, s.String())
+	case 6:
+		writeRandomObject(r, buf, depth)
+	default:
+		buf.WriteByte('[')
+		for i := range r.IntN(4) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeRandomValue(r, buf, depth+1)
+		}
+		buf.WriteByte(']')
+	}
+}
+
+// writeExpectedString escapes s as the UDF's output does, independently of writeJSONString
+func writeExpectedString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, ch := range []byte(s) {
+		switch ch {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(ch)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if ch < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, ch)
+			} else {
+				buf.WriteByte(ch)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// randomDropPath is a path of propertyKeys, "*" and "[*]" segments, never ending in "[*]"
+func randomDropPath(r *rand.Rand) []string {
+	var segments []string
+	for {
+		switch n := r.IntN(10); {
+		case n == 0:
+			segments = append(segments, "*")
+		case n == 1 && len(segments) > 0:
+			segments = append(segments, "[*]")
+			continue
+		default:
+			// the empty key can't be written as a path
+			segments = append(segments, propertyKeys[r.IntN(len(propertyKeys)-1)])
+		}
+		if r.IntN(2) == 0 {
+			return segments
+		}
+	}
+}
+
+// dropPathString writes segments in the key syntax, escaping what needs it
+func dropPathString(segments []string) string {
+	var s strings.Builder
+	for i, segment := range segments {
+		if i > 0 && segment != "[*]" {
+			s.WriteByte('.')
+		}
+		if segment == "*" || segment == "[*]" {
+			s.WriteString(segment)
+			continue
+		}
+		for _, ch := range segment {
+			if strings.ContainsRune(`.\*[]"?`, ch) {
+				s.WriteByte('\\')
+			}
+			s.WriteRune(ch)
+		}
+	}
+	return s.String()
+}
+
+// documentPaths lists the path of every value in a document, array elements being "[n]" segments
+func documentPaths(t *testing.T, document []byte) [][]string {
+	v, err := fastjson.ParseBytes(document)
+	if !assert.NoError(t, err, "%s", document) {
+		return nil
+	}
+	var paths [][]string
+	var walk func(path []string, v *fastjson.Value)
+	walk = func(path []string, v *fastjson.Value) {
+		switch v.Type() {
+		case fastjson.TypeObject:
+			o, _ := v.Object()
+			o.Visit(func(key []byte, v *fastjson.Value) {
+				p := append(path[:len(path):len(path)], string(key))
+				paths = append(paths, p)
+				walk(p, v)
+			})
+		case fastjson.TypeArray:
+			a, _ := v.Array()
+			for i, v := range a {
+				p := append(path[:len(path):len(path)], fmt.Sprintf("[%d]", i))
+				paths = append(paths, p)
+				walk(p, v)
+			}
+		}
+	}
+	walk(nil, v)
+	return paths
+}
+
+// pathMatches reports whether a document path is the one a drop path names
+func pathMatches(path, drop []string) bool {
+	if len(path) != len(drop) {
+		return false
+	}
+	for i, segment := range drop {
+		isElement := strings.HasPrefix(path[i], "[")
+		switch {
+		case segment == "*" && !isElement, segment == "[*]" && isElement, segment == path[i] && !isElement:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// expectedSurvivors are the paths of document no drop path removes, a value goes with its parent
+func expectedSurvivors(paths [][]string, drops [][]string) map[string][]string {
+	survivors := map[string][]string{}
+	for _, path := range paths {
+		dropped := false
+		for n := 1; n <= len(path) && !dropped; n++ {
+			for _, drop := range drops {
+				dropped = dropped || pathMatches(path[:n], drop)
+			}
+		}
+		if !dropped {
+			survivors[fmt.Sprintf("%q", path)] = path
+		}
+	}
+	return survivors
+}
+
+func TestRandomDocumentProperties(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	none, err := makeKeyDict(nil)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	changed := 0
+	for i := 0; i < 2000; i++ {
+		document := randomDocument(r)
+
+		// dropping nothing is the identity
+		assert.NoError(t, processLine(none, document, &buf))
+		if !assert.Equal(t, string(document), buf.String(), "dropping nothing") {
+			return
+		}
+
+		var drops [][]string
+		var keys []string
+		for range 1 + r.IntN(4) {
+			drop := randomDropPath(r)
+			drops = append(drops, drop)
+			keys = append(keys, dropPathString(drop))
+		}
+		keyDict, err := makeKeyDict(keys)
+		if !assert.NoError(t, err, "%q", keys) {
+			return
+		}
+		assert.NoError(t, processLine(keyDict, document, &buf))
+		output := buf.String()
+
+		// the output is valid JSON, none of its paths is dropped and every other one survives:
+		// array elements aren't dropped, so their indexes stay the same
+		if !assert.NoError(t, fastjson.Validate(output), "%s", output) {
+			return
+		}
+		want := expectedSurvivors(documentPaths(t, document), drops)
+		got := expectedSurvivors(documentPaths(t, []byte(output)), nil)
+		if !assert.Equal(t, want, got, "%s dropping %q gave %s", document, keys, output) {
+			return
+		}
+		for _, path := range got {
+			for _, drop := range drops {
+				assert.False(t, pathMatches(path, drop), "%q survived %q", path, keys)
+			}
+		}
+		if len(got) < len(documentPaths(t, document)) {
+			changed++
+		}
+	}
+	// the paths are random, but enough of them hit
+	assert.Greater(t, changed, 500)
+}
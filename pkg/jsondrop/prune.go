@@ -0,0 +1,307 @@
+package jsondrop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dropNullsFunc removes object members whose value is null. Only the top-level object is
+// checked unless recursive is set, then nested objects, including those in arrays, are too.
+// Null array elements are kept, removing them would shift the other elements.
+func dropNullsFunc(recursive bool) transformFunc {
+	return func(n node) node {
+		if arr, ok := n.(*arrayNode); ok {
+			for i, value := range arr.values {
+				arr.values[i] = dropMembers(value, isNull, recursive)
+			}
+			return arr
+		}
+		return dropMembers(n, isNull, recursive)
+	}
+}
+
+// dropMembers removes the object members drop returns true for, in nested objects and arrays too
+// if recursive is set
+func dropMembers(n node, drop func(node) bool, recursive bool) node {
+	switch v := n.(type) {
+	case *objectNode:
+		writeIdx := 0
+		for _, entry := range v.entries {
+			if drop(entry.value) {
+				recycleNode(entry.value)
+				continue
+			}
+			if recursive {
+				entry.value = dropMembers(entry.value, drop, true)
+			}
+			v.entries[writeIdx] = entry
+			writeIdx++
+		}
+		v.entries = v.entries[:writeIdx]
+	case *arrayNode:
+		if recursive {
+			for i, value := range v.values {
+				v.values[i] = dropMembers(value, drop, true)
+			}
+		}
+	}
+	return n
+}
+
+func isNull(n node) bool {
+	v, ok := n.(*valueNode)
+	return ok && v.kind == kindNull
+}
+
+// emptyClasses are the kinds of empty values drop-empty removes
+type emptyClasses struct {
+	strings, objects, arrays bool
+}
+
+// parseEmptyClasses parses a comma separated list of strings, objects and arrays
+func parseEmptyClasses(s string) (emptyClasses, error) {
+	var classes emptyClasses
+	for _, class := range strings.Split(s, ",") {
+		switch strings.TrimSpace(class) {
+		case "strings":
+			classes.strings = true
+		case "objects":
+			classes.objects = true
+		case "arrays":
+			classes.arrays = true
+		case "":
+		default:
+			return classes, fmt.Errorf("unknown empty value class %q, expected strings, objects or arrays", class)
+		}
+	}
+	return classes, nil
+}
+
+// dropEmptyFunc removes object members that are empty strings, objects or arrays at any depth.
+// Nested values are compacted first, so {"a":{"b":""}} becomes {}. Like null elements for
+// drop-nulls, empty array elements are kept.
+func dropEmptyFunc(classes emptyClasses) transformFunc {
+	return func(n node) node {
+		return dropEmpty(n, classes)
+	}
+}
+
+func dropEmpty(n node, classes emptyClasses) node {
+	switch v := n.(type) {
+	case *objectNode:
+		writeIdx := 0
+		for _, entry := range v.entries {
+			entry.value = dropEmpty(entry.value, classes)
+			if classes.isEmpty(entry.value) {
+				recycleNode(entry.value)
+				continue
+			}
+			v.entries[writeIdx] = entry
+			writeIdx++
+		}
+		v.entries = v.entries[:writeIdx]
+	case *arrayNode:
+		for i, value := range v.values {
+			v.values[i] = dropEmpty(value, classes)
+		}
+	}
+	return n
+}
+
+func (c emptyClasses) isEmpty(n node) bool {
+	switch v := n.(type) {
+	case *valueNode:
+		return c.strings && v.kind == kindString && v.str == ""
+	case *objectNode:
+		return c.objects && len(v.entries) == 0
+	case *arrayNode:
+		return c.arrays && len(v.values) == 0
+	default:
+		return false
+	}
+}
+
+// jsonValuePrefix marks a drop-by-value entry as a JSON literal rather than a string, e.g.
+// "json:null" matches null while "null" matches the string "null"
+const jsonValuePrefix = "json:"
+
+// valueSet is the set of values drop-by-value removes
+type valueSet struct {
+	strings map[string]struct{}
+	// literals are the json: values, they're compared like the values in a diff
+	literals []*valueNode
+}
+
+func newValueSet(values []string) (valueSet, error) {
+	set := valueSet{strings: make(map[string]struct{}, len(values))}
+	for _, value := range values {
+		if !strings.HasPrefix(value, jsonValuePrefix) {
+			set.strings[value] = struct{}{}
+			continue
+		}
+		literal, err := parseNode([]byte(value[len(jsonValuePrefix):]))
+		if err != nil {
+			return set, fmt.Errorf("invalid value %q: %w", value, err)
+		}
+		v, ok := literal.(*valueNode)
+		if !ok {
+			return set, fmt.Errorf("invalid value %q: only strings, numbers, true, false and null can be matched", value)
+		}
+		set.literals = append(set.literals, v)
+	}
+	return set, nil
+}
+
+func (s valueSet) contains(n node) bool {
+	v, ok := n.(*valueNode)
+	if !ok {
+		return false
+	}
+	if v.kind == kindString {
+		if _, ok := s.strings[v.str]; ok {
+			return true
+		}
+	}
+	for _, literal := range s.literals {
+		if equalValues(v, literal) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropByValueFunc removes object members whose value is in values, at any depth. Array elements
+// are kept, like null elements for drop-nulls.
+func dropByValueFunc(values valueSet) transformFunc {
+	return func(n node) node {
+		return dropMembers(n, values.contains, true)
+	}
+}
+
+// jsonTypes is a set of JSON types for drop-by-type
+type jsonTypes struct {
+	object, array, string, number, boolean, null bool
+}
+
+// parseJSONTypes parses a comma separated list of object, array, string, number, boolean and null
+func parseJSONTypes(s string) (jsonTypes, error) {
+	var types jsonTypes
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "object":
+			types.object = true
+		case "array":
+			types.array = true
+		case "string":
+			types.string = true
+		case "number":
+			types.number = true
+		case "boolean", "bool":
+			types.boolean = true
+		case "null":
+			types.null = true
+		case "":
+		default:
+			return types, fmt.Errorf("unknown JSON type %q, expected object, array, string, number, boolean or null", name)
+		}
+	}
+	return types, nil
+}
+
+func (t jsonTypes) contains(n node) bool {
+	switch v := n.(type) {
+	case *objectNode:
+		return t.object
+	case *arrayNode:
+		return t.array
+	case *valueNode:
+		switch v.kind {
+		case kindString:
+			return t.string
+		case kindNumber:
+			return t.number
+		case kindBool:
+			return t.boolean
+		default:
+			return t.null
+		}
+	default:
+		return false
+	}
+}
+
+// dropByTypeFunc removes object members whose value is one of types. Without keys every member
+// at any depth is checked, with keys only those the paths match, so dropping objects and arrays
+// under "props.*" leaves props flat.
+func dropByTypeFunc(keys *jsonKey, types jsonTypes) transformFunc {
+	if keys != nil {
+		return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+			if types.contains(value) {
+				recycleNode(value)
+				return "", nil, false
+			}
+			return key, value, true
+		})
+	}
+	return func(n node) node {
+		return dropMembers(n, types.contains, true)
+	}
+}
+
+// pruneDepthFunc removes everything more than maxDepth keys or indexes below the document. The
+// containers at maxDepth that still have something in them are replaced with the placeholder
+// string, or dropped when it's empty. The elements of a top-level array are documents.
+func pruneDepthFunc(maxDepth int, placeholder string) transformFunc {
+	var prune func(n node, depth int) node
+	// pruned returns what to keep of a value at depth, drop is set if it goes without a placeholder
+	pruned := func(value node, depth int) (node, bool) {
+		if depth < maxDepth || isEmptyContainer(value) {
+			return prune(value, depth), false
+		}
+		if _, ok := value.(*valueNode); ok {
+			return value, false
+		}
+		recycleNode(value)
+		if placeholder == "" {
+			return nil, true
+		}
+		return stringNode(placeholder), false
+	}
+	prune = func(n node, depth int) node {
+		switch v := n.(type) {
+		case *objectNode:
+			writeIdx := 0
+			for _, entry := range v.entries {
+				value, drop := pruned(entry.value, depth+1)
+				if drop {
+					continue
+				}
+				entry.value = value
+				v.entries[writeIdx] = entry
+				writeIdx++
+			}
+			v.entries = v.entries[:writeIdx]
+		case *arrayNode:
+			writeIdx := 0
+			for _, value := range v.values {
+				value, drop := pruned(value, depth+1)
+				if drop {
+					continue
+				}
+				v.values[writeIdx] = value
+				writeIdx++
+			}
+			v.values = v.values[:writeIdx]
+		}
+		return n
+	}
+	return func(n node) node {
+		if arr, ok := n.(*arrayNode); ok {
+			for i, value := range arr.values {
+				arr.values[i] = prune(value, 0)
+			}
+			return arr
+		}
+		return prune(n, 0)
+	}
+}
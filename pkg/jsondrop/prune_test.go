@@ -0,0 +1,265 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropNullsJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		recursive         bool
+	}{
+		{
+			name:  "top-level nulls",
+			input: `{"a":null,"b":1,"c":{"d":null}}`,
+			want:  `{"b":1,"c":{"d":null}}`,
+		},
+		{
+			name:      "recursive",
+			input:     `{"a":null,"b":1,"c":{"d":null,"e":[{"f":null,"g":0}]}}`,
+			want:      `{"b":1,"c":{"e":[{"g":0}]}}`,
+			recursive: true,
+		},
+		{
+			name:      "null array elements are kept",
+			input:     `{"a":[null,1]}`,
+			want:      `{"a":[null,1]}`,
+			recursive: true,
+		},
+		{
+			name:  "falsy values are kept",
+			input: `{"a":false,"b":0,"c":"","d":{},"e":[]}`,
+			want:  `{"a":false,"b":0,"c":"","d":{},"e":[]}`,
+		},
+		{
+			name:  "top-level array elements are documents",
+			input: `[{"a":null,"b":1},null]`,
+			want:  `[{"b":1},null]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(dropNullsFunc(c.recursive), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestDropEmptyJSON(t *testing.T) {
+	all := emptyClasses{strings: true, objects: true, arrays: true}
+	cases := []struct {
+		name, input, want string
+		classes           emptyClasses
+	}{
+		{
+			name:    "all classes",
+			input:   `{"a":"","b":{},"c":[],"d":0,"e":null,"f":"x"}`,
+			want:    `{"d":0,"e":null,"f":"x"}`,
+			classes: all,
+		},
+		{
+			name:    "objects emptied by pruning are removed",
+			input:   `{"a":{"b":"","c":{"d":[]}},"e":1}`,
+			want:    `{"e":1}`,
+			classes: all,
+		},
+		{
+			name:    "only strings",
+			input:   `{"a":"","b":{},"c":[]}`,
+			want:    `{"b":{},"c":[]}`,
+			classes: emptyClasses{strings: true},
+		},
+		{
+			name:    "only objects",
+			input:   `{"a":"","b":{"c":{}},"d":[]}`,
+			want:    `{"a":"","d":[]}`,
+			classes: emptyClasses{objects: true},
+		},
+		{
+			name:    "array elements are kept but compacted",
+			input:   `{"a":["",{"b":""}]}`,
+			want:    `{"a":["",{}]}`,
+			classes: all,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(dropEmptyFunc(c.classes), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestParseEmptyClasses(t *testing.T) {
+	classes, err := parseEmptyClasses("strings, arrays")
+	assert.NoError(t, err)
+	assert.Equal(t, emptyClasses{strings: true, arrays: true}, classes)
+
+	_, err = parseEmptyClasses("strings,numbers")
+	assert.Error(t, err)
+}
+
+func TestDropByValueJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		values            []string
+	}{
+		{
+			name:   "string values",
+			input:  `{"a":"undefined","b":"","c":"null","d":"x","e":null}`,
+			want:   `{"d":"x","e":null}`,
+			values: []string{"undefined", "", "null"},
+		},
+		{
+			name:   "nested and in arrays",
+			input:  `{"a":{"b":"undefined","c":1},"d":[{"e":"undefined"},"undefined"]}`,
+			want:   `{"a":{"c":1},"d":[{},"undefined"]}`,
+			values: []string{"undefined"},
+		},
+		{
+			name:   "json literals",
+			input:  `{"a":null,"b":0,"c":0.0,"d":false,"e":"0","f":"null"}`,
+			want:   `{"d":false,"e":"0","f":"null"}`,
+			values: []string{"json:null", "json:0"},
+		},
+		{
+			name:   "containers are never matched",
+			input:  `{"a":{},"b":[]}`,
+			want:   `{"a":{},"b":[]}`,
+			values: []string{""},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			values, err := newValueSet(c.values)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			err = transformLine(dropByValueFunc(values), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestNewValueSetErrors(t *testing.T) {
+	for _, value := range []string{"json:", "json:nul", "json:{}", "json:[1]"} {
+		_, err := newValueSet([]string{value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestDropByTypeJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want, types string
+		keys                     []string
+	}{
+		{
+			name:  "objects and arrays everywhere",
+			input: `{"a":1,"b":{"c":1},"d":[1],"e":"x"}`,
+			want:  `{"a":1,"e":"x"}`,
+			types: "object,array",
+		},
+		{
+			name:  "strings at any depth",
+			input: `{"a":"x","b":{"c":"y","d":2},"e":[{"f":"z"},"w"]}`,
+			want:  `{"b":{"d":2},"e":[{},"w"]}`,
+			types: "string",
+		},
+		{
+			name:  "only at the listed paths",
+			input: `{"props":{"a":{"x":1},"b":[1],"c":3},"other":{"d":{}}}`,
+			want:  `{"props":{"c":3},"other":{"d":{}}}`,
+			types: "object,array",
+			keys:  []string{"props.*"},
+		},
+		{
+			name:  "numbers, booleans and nulls",
+			input: `{"a":1,"b":true,"c":null,"d":"1"}`,
+			want:  `{"d":"1"}`,
+			types: "number,boolean,null",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			types, err := parseJSONTypes(c.types)
+			assert.NoError(t, err)
+			var keys *jsonKey
+			if c.keys != nil {
+				keys = mustKeyDict(t, c.keys)
+			}
+			var buf bytes.Buffer
+			err = transformLine(dropByTypeFunc(keys, types), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+
+	_, err := parseJSONTypes("object,date")
+	assert.Error(t, err)
+}
+
+func TestPruneDepthJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want, placeholder string
+		depth                          int
+	}{
+		{
+			name:  "drop deeper subtrees",
+			input: `{"a":{"b":{"c":1}},"d":1,"e":{"f":2}}`,
+			want:  `{"a":{},"d":1,"e":{"f":2}}`,
+			depth: 2,
+		},
+		{
+			name:        "placeholder",
+			input:       `{"a":{"b":{"c":1}},"d":1}`,
+			want:        `{"a":{"b":"[pruned]"},"d":1}`,
+			placeholder: "[pruned]",
+			depth:       2,
+		},
+		{
+			name:        "arrays count as a level",
+			input:       `{"a":[[1],2,{}]}`,
+			want:        `{"a":["…",2,{}]}`,
+			placeholder: "…",
+			depth:       2,
+		},
+		{
+			name:  "depth one",
+			input: `{"a":{"b":1},"c":[1],"d":{}}`,
+			want:  `{"d":{}}`,
+			depth: 1,
+		},
+		{
+			name:  "shallow documents are unchanged",
+			input: `{"a":{"b":1}}`,
+			want:  `{"a":{"b":1}}`,
+			depth: 5,
+		},
+		{
+			name:  "top-level array elements are documents",
+			input: `[{"a":{"b":1}},{"c":1}]`,
+			want:  `[{},{"c":1}]`,
+			depth: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(pruneDepthFunc(c.depth, c.placeholder), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// lineTooLongError is the row error for rows longer than -max-line-bytes
+type lineTooLongError struct {
+	max int
+}
+
+func (e *lineTooLongError) Error() string {
+	return fmt.Sprintf("row is longer than -max-line-bytes=%d", e.max)
+}
+
+// lineReader reads newline separated rows without holding more than about max bytes of any one
+// row, plus the reader's buffer, in memory. Rows longer than max come back cut short with a
+// *lineTooLongError, the rest of the row is still unread until skipRest.
+type lineReader struct {
+	r   *bufio.Reader
+	max int
+	buf []byte
+	// unread is set while the rest of a row cut short hasn't been read
+	unread bool
+	// hadNewline is whether the last row read in full had a line ending
+	hadNewline bool
+	// chunked is for the send_chunk_header protocol: every chunk of rows is led by a line with
+	// the number of rows in it
+	chunked bool
+	// left is how many rows of the current chunk are still to come
+	left int
+	// chunkEnd is whether the last row next returned was the last of its chunk
+	chunkEnd bool
+	// row is the number of the last row next returned, counting from 1 in each chunk
+	row int
+	// binary reads RowBinary rows instead of lines, they never have a line ending
+	binary *rowBinary
+	// native reads the rows of Native blocks instead, each block is a chunk
+	native *nativeReader
+	// csv keeps reading lines while a CSV row's quote is open, so quoted newlines stay in it
+	csv bool
+	// startChunk, if set, is called as each chunk or Native block starts, before its first row
+	startChunk func()
+}
+
+func newLineReader(r *bufio.Reader, max int) *lineReader {
+	return &lineReader{r: r, max: max}
+}
+
+// next returns the next row without its line ending, and whether it had one. err is io.EOF after
+// the last row, a *lineTooLongError for a row over max and otherwise a read error. The row is only
+// valid until the next call.
+func (l *lineReader) next() (line []byte, hadNewline bool, err error) {
+	if l.native != nil {
+		var first bool
+		line, first, l.chunkEnd, err = l.native.readRow(l.r)
+		if first {
+			l.row = 0
+			if l.startChunk != nil {
+				l.startChunk()
+			}
+		}
+		l.row++
+		return line, false, err
+	}
+	if l.chunked {
+		for l.left == 0 {
+			if l.left, err = l.chunkHeader(); err != nil {
+				return nil, false, err
+			}
+			l.row = 0
+		}
+		if l.row == 0 && l.startChunk != nil {
+			l.startChunk()
+		}
+		l.left--
+		l.chunkEnd = l.left == 0
+	}
+	l.row++
+	if l.binary != nil {
+		line, err = l.binary.readRow(l.r)
+		return line, false, err
+	}
+	l.buf = l.buf[:0]
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		l.buf = append(l.buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			if l.max > 0 && len(l.buf) > l.max {
+				l.unread = true
+				return l.buf, false, &lineTooLongError{max: l.max}
+			}
+			continue
+		}
+		if l.csv && err == nil && openCSVQuote(l.buf) {
+			continue
+		}
+		line, l.hadNewline = trimLineEnding(l.buf)
+		if (err == nil || err == io.EOF) && l.max > 0 && len(line) > l.max {
+			return line, l.hadNewline, &lineTooLongError{max: l.max}
+		}
+		return line, l.hadNewline, err
+	}
+}
+
+// chunkHeader reads the row count leading a chunk, io.EOF after the last chunk
+func (l *lineReader) chunkHeader() (int, error) {
+	header, err := l.r.ReadSlice('\n')
+	if err == io.EOF && len(header) == 0 {
+		return 0, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	header, _ = trimLineEnding(header)
+	rows, err := strconv.Atoi(string(header))
+	if err != nil || rows < 0 {
+		return 0, fmt.Errorf("chunk header %q is not a row count", header)
+	}
+	return rows, nil
+}
+
+// endOfChunk reports whether the row next returned last was the last of its chunk or Native
+// block, when the output has to be flushed for ClickHouse to send the next one. It's always
+// false without chunks.
+func (l *lineReader) endOfChunk() bool {
+	return l.chunkEnd
+}
+
+// flushDue reports whether the output has to be flushed after the row next returned last, given
+// how many bytes of input are buffered: at the end of a chunk, and for lines and RowBinary rows
+// whenever there's no more input to go on with. A Native block is read whole before its first
+// row, so nothing buffered says nothing about where it ends, and its rows are only flushed with
+// the block, as one block of results.
+func (l *lineReader) flushDue(buffered int) bool {
+	if l.native != nil {
+		return l.chunkEnd
+	}
+	return l.chunkEnd || buffered == 0
+}
+
+// skipRest reads the rest of a row next cut short, copying it to w unless w is nil, and returns
+// whether it ended with a newline
+func (l *lineReader) skipRest(w io.Writer) (hadNewline bool, err error) {
+	if !l.unread {
+		return l.hadNewline, nil
+	}
+	l.unread = false
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			if w != nil {
+				_, _ = w.Write(chunk)
+			}
+			continue
+		}
+		chunk, hadNewline = trimLineEnding(chunk)
+		if w != nil {
+			_, _ = w.Write(chunk)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		return hadNewline, err
+	}
+}
+
+func trimLineEnding(line []byte) (trimmed []byte, hadNewline bool) {
+	n := len(line)
+	if n > 0 && line[n-1] == '\n' {
+		hadNewline = true
+		n--
+	}
+	if n > 0 && line[n-1] == '\r' {
+		n--
+	}
+	return line[:n], hadNewline
+}
+
+// tooLongRow writes what a row over -max-line-bytes is replaced with under policy, for a row cut
+// short at line with the rest still unread. Passthrough copies the rest of the row, or its first
+// column for TabSeparated modes, straight to w, so the row is never held in memory as a whole.
+func tooLongRow(l *lineReader, line []byte, policy errorPolicy, tsv bool, w io.Writer, buf *bytes.Buffer) (hadNewline bool, err error) {
+	tooLong := &lineTooLongError{max: l.max}
+	if policy != errorPassthrough {
+		if hadNewline, err = l.skipRest(nil); err != nil {
+			return false, err
+		}
+		if policy == errorFail {
+			return false, tooLong
+		}
+		writeErrorRow(buf, policy, tsv, nil, tooLong)
+		_, _ = w.Write(buf.Bytes())
+		return hadNewline, nil
+	}
+
+	rest := w
+	if tsv {
+		if column, _, found := bytes.Cut(line, []byte{'\t'}); found {
+			line, rest = column, nil
+		} else {
+			rest = &firstColumnWriter{w: w}
+		}
+	}
+	_, _ = w.Write(line)
+	return l.skipRest(rest)
+}
+
+// firstColumnWriter passes writes through up to the first tab and drops the rest
+type firstColumnWriter struct {
+	w    io.Writer
+	done bool
+}
+
+func (f *firstColumnWriter) Write(p []byte) (int, error) {
+	if f.done {
+		return len(p), nil
+	}
+	column, _, found := bytes.Cut(p, []byte{'\t'})
+	f.done = found
+	_, err := f.w.Write(column)
+	return len(p), err
+}
@@ -0,0 +1,110 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readAll reads input through a lineReader with a small buffer, so long rows are read in
+// several chunks, writing rows the way main does
+func readAll(t *testing.T, input string, max int, policy errorPolicy, tsv bool) (string, error) {
+	lines := newLineReader(bufio.NewReaderSize(strings.NewReader(input), 16), max)
+	var out, buf bytes.Buffer
+	for {
+		line, hadNewline, err := lines.next()
+		if _, ok := err.(*lineTooLongError); ok {
+			hadNewline, err = tooLongRow(lines, line, policy, tsv, &out, &buf)
+			if err != nil {
+				return out.String(), err
+			}
+		} else {
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			if len(line) == 0 && err == io.EOF {
+				return out.String(), nil
+			}
+			out.Write(line)
+		}
+		if hadNewline {
+			out.WriteByte('\n')
+		}
+	}
+}
+
+func TestMaxLineBytes(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	input := "short\r\n" + long + "\nend"
+
+	got, err := readAll(t, input, 0, errorFail, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "short\n"+long+"\nend", got)
+
+	got, err = readAll(t, input, 20, errorPassthrough, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "short\n"+long+"\nend", got)
+
+	got, err = readAll(t, input, 20, errorEmpty, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "short\n{}\nend", got)
+
+	got, err = readAll(t, input, 20, errorTuple, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "short\n\trow is longer than -max-line-bytes=20\nend", got)
+
+	_, err = readAll(t, input, 20, errorFail, false)
+	assert.EqualError(t, err, "row is longer than -max-line-bytes=20")
+
+	// just over the limit and read in one chunk, and the last row without a newline
+	got, err = readAll(t, "abcdef\nabcdefgh", 6, errorNull, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef\n\\N", got)
+}
+
+func TestMaxLineBytesPassthroughTSV(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	for _, input := range []string{
+		long + "\t{}\n",
+		"{}\t" + long + "\n",
+		long + "\t" + long + "\n",
+	} {
+		got, err := readAll(t, input, 20, errorPassthrough, true)
+		assert.NoError(t, err)
+		first, _, _ := strings.Cut(input, "\t")
+		assert.Equal(t, first+"\n", got)
+	}
+}
+
+func TestChunkHeader(t *testing.T) {
+	lines := newLineReader(bufio.NewReaderSize(strings.NewReader("2\na\nb\n0\n1\nc\n"), 16), 0)
+	lines.chunked = true
+	starts := 0
+	lines.startChunk = func() { starts++ }
+	for _, want := range []struct {
+		line     string
+		chunkEnd bool
+		row      int
+		starts   int
+	}{{"a", false, 1, 1}, {"b", true, 2, 1}, {"c", true, 1, 2}} {
+		line, hadNewline, err := lines.next()
+		assert.NoError(t, err)
+		assert.True(t, hadNewline)
+		assert.Equal(t, want.line, string(line))
+		assert.Equal(t, want.chunkEnd, lines.endOfChunk(), want.line)
+		assert.Equal(t, want.row, lines.row, want.line)
+		assert.Equal(t, want.starts, starts, want.line)
+	}
+	_, _, err := lines.next()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, starts)
+
+	lines = newLineReader(bufio.NewReader(strings.NewReader("{\"a\":1}\n")), 0)
+	lines.chunked = true
+	_, _, err = lines.next()
+	assert.EqualError(t, err, `chunk header "{\"a\":1}" is not a row count`)
+}
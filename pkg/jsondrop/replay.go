@@ -0,0 +1,275 @@
+package jsondrop
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// replayCommand is the first argument that replays a corpus of recorded cases instead of running
+// the UDF
+const replayCommand = "replay"
+
+// A case is a directory in the corpus holding the files below. flags has the UDF's flags one per
+// line and keys the key argument, either may be missing. output has a row per row of input, the
+// rows that fail being errorRowPrefix and their error.
+const (
+	caseFlags  = "flags"
+	caseKeys   = "keys"
+	caseInput  = "input"
+	caseOutput = "output"
+)
+
+// errorRowPrefix starts the output rows recording a failure, neither JSON nor the modes' text
+// output starts with it
+const errorRowPrefix = "# error: "
+
+// maxReplayDiffs is how many differing rows are shown for a case
+const maxReplayDiffs = 5
+
+// replayCase is a recorded case
+type replayCase struct {
+	name   string
+	flags  []string
+	keys   string
+	input  []byte
+	output []byte
+}
+
+// runReplay is the replay subcommand: it runs every case in -corpus with the current binary and
+// shows the rows whose results differ from the recorded ones. With -record it records a case from
+// -input instead, with the UDF's flags and key argument given after it.
+func runReplay(args []string, stdout, stderr io.Writer) int {
+	c := &config{}
+	fs := newFlagSet(c)
+	fs.Init(replayCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	corpus := fs.String("corpus", "", "the directory of recorded cases")
+	record := fs.String("record", "", "record a case of this name from -input with the flags and key argument given, instead of replaying")
+	input := fs.String("input", "", "the newline delimited rows to record the case from")
+	if err := c.parseFlags(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *corpus == "" {
+		fmt.Fprintln(stderr, "replay needs -corpus")
+		return 2
+	}
+	flags := stripFlags(args[:len(args)-fs.NArg()], "corpus", "record", "input")
+	if *record == "" {
+		if len(flags) > 0 || fs.NArg() > 0 {
+			fmt.Fprintln(stderr, "replay runs each case with its own flags, only -record takes the UDF's")
+			return 2
+		}
+		failed, err := replayCorpus(stdout, *corpus)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay error: %v\n", err)
+			return 1
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+	}
+	if *input == "" || strings.ContainsAny(*record, `/\`) || *record == "." || *record == ".." {
+		fmt.Fprintln(stderr, "-record needs -input, and a case name that isn't a path")
+		return 2
+	}
+	rows, err := os.ReadFile(*input)
+	if err != nil {
+		fmt.Fprintf(stderr, "input error: %v\n", err)
+		return 1
+	}
+	rc := &replayCase{name: *record, flags: flags, keys: fs.Arg(0), input: rows}
+	if rc.output, err = rc.run(); err != nil {
+		fmt.Fprintf(stderr, "record error: %v\n", err)
+		return 1
+	}
+	if err := rc.write(filepath.Join(*corpus, rc.name)); err != nil {
+		fmt.Fprintf(stderr, "record error: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "recorded %s, %d rows\n", filepath.Join(*corpus, rc.name), bytes.Count(rc.output, []byte{'\n'}))
+	return 0
+}
+
+// replayCorpus replays every case in dir, writing which pass and how the others differ, and
+// returns how many didn't pass
+func replayCorpus(w io.Writer, dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	cases, failed := 0, 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		cases++
+		rc, err := readReplayCase(filepath.Join(dir, entry.Name()))
+		var got []byte
+		if err == nil {
+			got, err = rc.run()
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %v\n", entry.Name(), err)
+			continue
+		}
+		if bytes.Equal(got, rc.output) {
+			fmt.Fprintf(w, "ok   %s\n", rc.name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL %s\n", rc.name)
+		writeReplayDiff(w, rc.output, got)
+	}
+	if cases == 0 {
+		return 0, fmt.Errorf("no cases in %s", dir)
+	}
+	fmt.Fprintf(w, "%d of %d cases passed\n", cases-failed, cases)
+	return failed, nil
+}
+
+// writeReplayDiff writes the first rows whose results differ
+func writeReplayDiff(w io.Writer, want, got []byte) {
+	wantRows, gotRows := outputRows(want), outputRows(got)
+	diffs := 0
+	for i := 0; i < max(len(wantRows), len(gotRows)); i++ {
+		var wantRow, gotRow string
+		if i < len(wantRows) {
+			wantRow = wantRows[i]
+		}
+		if i < len(gotRows) {
+			gotRow = gotRows[i]
+		}
+		if wantRow == gotRow {
+			continue
+		}
+		if diffs++; diffs > maxReplayDiffs {
+			fmt.Fprintln(w, "    ...")
+			break
+		}
+		fmt.Fprintf(w, "    row %d\n    - %s\n    + %s\n", i+1, wantRow, gotRow)
+	}
+	if len(wantRows) != len(gotRows) {
+		fmt.Fprintf(w, "    %d rows recorded, %d now\n", len(wantRows), len(gotRows))
+	}
+}
+
+func outputRows(output []byte) []string {
+	if len(output) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+}
+
+func readReplayCase(dir string) (*replayCase, error) {
+	rc := &replayCase{name: filepath.Base(dir)}
+	flags, err := readCaseFile(dir, caseFlags)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(flags), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			rc.flags = append(rc.flags, line)
+		}
+	}
+	keys, err := readCaseFile(dir, caseKeys)
+	if err != nil {
+		return nil, err
+	}
+	rc.keys = strings.TrimSuffix(string(keys), "\n")
+	if rc.input, err = os.ReadFile(filepath.Join(dir, caseInput)); err != nil {
+		return nil, err
+	}
+	if rc.output, err = os.ReadFile(filepath.Join(dir, caseOutput)); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// readCaseFile reads one of the files a case may leave out
+func readCaseFile(dir, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (rc *replayCase) write(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	files := map[string][]byte{caseInput: rc.input, caseOutput: rc.output}
+	if len(rc.flags) > 0 {
+		files[caseFlags] = []byte(strings.Join(rc.flags, "\n") + "\n")
+	}
+	if rc.keys != "" {
+		files[caseKeys] = []byte(rc.keys + "\n")
+	}
+	for _, name := range []string{caseFlags, caseKeys} {
+		if _, ok := files[name]; !ok {
+			// a case recorded again may have had them
+			if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	for name, data := range files {
+		if err := writeFileAtomic(filepath.Join(dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run transforms the case's rows with its flags and keys, a row per line with the failures as
+// errorRowPrefix and their error
+func (rc *replayCase) run() ([]byte, error) {
+	args := rc.flags
+	if rc.keys != "" {
+		args = append(args[:len(args):len(args)], rc.keys)
+	}
+	c, err := parseConfig(args)
+	if err != nil {
+		return nil, err
+	}
+	if layout, err := c.rowLayout(); err != nil || layout != nil || c.format == "csv" {
+		return nil, fmt.Errorf("replay reads newline delimited rows, -format=%s doesn't apply", c.format)
+	}
+	var fileKeys []string
+	if c.keysFile != "" {
+		if fileKeys, err = (&keysFile{path: c.keysFile}).read(); err != nil {
+			return nil, err
+		}
+	}
+	process, err := c.lineFunc(fileKeys, c.keysFile != "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rc.input) == 0 {
+		return nil, nil
+	}
+	var out, buf bytes.Buffer
+	for _, row := range bytes.Split(bytes.TrimSuffix(rc.input, []byte{'\n'}), []byte{'\n'}) {
+		row, _ = trimLineEnding(row)
+		if err := process(row, &buf); err != nil {
+			out.WriteString(errorRowPrefix)
+			out.WriteString(strings.ReplaceAll(err.Error(), "\n", " "))
+		} else {
+			out.Write(buf.Bytes())
+		}
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReplayCorpus replays the cases in testdata, recorded from the integration test's rows
+func TestReplayCorpus(t *testing.T) {
+	var out bytes.Buffer
+	failed, err := replayCorpus(&out, "../../testdata/replay")
+	assert.NoError(t, err)
+	assert.Zero(t, failed, out.String())
+}
+
+func TestReplay(t *testing.T) {
+	corpus := t.TempDir()
+	input := filepath.Join(t.TempDir(), "sample.ndjson")
+	assert.NoError(t, os.WriteFile(input, []byte("{\"a\":1,\"b\":2}\n{\"a\":\n{\"b\":{\"a\":3}}\r\n"), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	code := runReplay([]string{"-corpus", corpus, "-record", "redact", "-input", input, "-mode=redact", "-placeholder", "x y", "['a', 'b.a']"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "recorded "+filepath.Join(corpus, "redact")+", 3 rows\n", stdout.String())
+	flags, _ := os.ReadFile(filepath.Join(corpus, "redact", caseFlags))
+	assert.Equal(t, "-mode=redact\n-placeholder\nx y\n", string(flags))
+	output, _ := os.ReadFile(filepath.Join(corpus, "redact", caseOutput))
+	assert.Regexp(t, `^\{"a":"x y","b":2\}\n# error: json parse error: .*\n\{"b":\{"a":"x y"\}\}\n$`, string(output))
+
+	code = runReplay([]string{"-corpus", corpus, "-record", "keyless", "-input", input, "-mode=validate"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	_, err := os.Stat(filepath.Join(corpus, "keyless", caseKeys))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	stdout.Reset()
+	assert.Equal(t, 0, runReplay([]string{"-corpus", corpus}, &stdout, &stderr))
+	assert.Equal(t, "ok   keyless\nok   redact\n2 of 2 cases passed\n", stdout.String())
+
+	// a behavior change shows the rows it changes
+	assert.NoError(t, os.WriteFile(filepath.Join(corpus, "redact", caseOutput), []byte("{\"a\":\"x y\",\"b\":2}\n{}\n"), 0o644))
+	stdout.Reset()
+	assert.Equal(t, 1, runReplay([]string{"-corpus", corpus}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "FAIL redact\n    row 2\n    - {}\n    + # error: json parse error")
+	assert.Contains(t, stdout.String(), "    row 3\n    - \n    + {\"b\":{\"a\":\"x y\"}}\n    2 rows recorded, 3 now\n")
+	assert.Contains(t, stdout.String(), "1 of 2 cases passed\n")
+
+	// cases that can't run fail too
+	assert.NoError(t, os.WriteFile(filepath.Join(corpus, "redact", caseFlags), []byte("-mode=nope\n"), 0o644))
+	stdout.Reset()
+	assert.Equal(t, 1, runReplay([]string{"-corpus", corpus}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), `FAIL redact: unknown mode "nope"`)
+
+	for _, args := range [][]string{
+		{},
+		{"-corpus", corpus, "-mode=keep"},
+		{"-corpus", corpus, "['a']"},
+		{"-corpus", corpus, "-record", "x"},
+		{"-corpus", corpus, "-record", "../x", "-input", input},
+	} {
+		assert.Equal(t, 2, runReplay(args, &stdout, &stderr), args)
+	}
+	assert.Equal(t, 1, runReplay([]string{"-corpus", t.TempDir()}, &stdout, &stderr))
+	assert.Equal(t, 1, runReplay([]string{"-corpus", corpus, "-record", "x", "-input", input, "-format=rowbinary", "['a']"}, &stdout, &stderr))
+}
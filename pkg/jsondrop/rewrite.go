@@ -0,0 +1,217 @@
+package jsondrop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+)
+
+// rewriteFunc is called for every member matched by a path, with the path's leaf, and returns the
+// entry's new key and value, ok=false drops it. Array elements are matched with an empty key and
+// only their new value is used.
+type rewriteFunc func(leaf *jsonKey, key string, value node) (newKey string, newValue node, ok bool)
+
+// rewrite is the traversal behind rename, redact and hash: the same as DropKeys, except matched
+// entries are handed to f instead of being dropped
+func rewrite(n node, keys keySet, f rewriteFunc) node {
+	switch v := n.(type) {
+	case *objectNode:
+		return v.rewrite(keys, f)
+	case *arrayNode:
+		return v.rewrite(keys, f)
+	default:
+		return n
+	}
+}
+
+func (o *objectNode) rewrite(keys keySet, f rewriteFunc) node {
+	if len(o.entries) == 0 {
+		return o
+	}
+
+	o.entries = expandDottedEntries(o.entries, keys)
+
+	writeIdx := 0
+	for _, entry := range o.entries {
+		next, leaf := keys.matchLeaf(entry.key, entry.value)
+		if leaf != nil {
+			key, value, ok := f(leaf, entry.key, entry.value)
+			if !ok {
+				continue
+			}
+			entry.key, entry.value = key, value
+		} else if next != nil {
+			entry.value = rewrite(entry.value, next, f)
+		}
+		o.entries[writeIdx] = entry
+		writeIdx++
+	}
+	o.entries = o.entries[:writeIdx]
+
+	return o
+}
+
+func (a *arrayNode) rewrite(keys keySet, f rewriteFunc) node {
+	writeIdx := 0
+	n := len(a.values)
+	for i, value := range a.values {
+		next, leaf := keys.elementLeaf(i, n, value)
+		if leaf != nil {
+			_, newValue, ok := f(leaf, "", value)
+			if !ok {
+				continue
+			}
+			value = newValue
+		} else {
+			value = rewrite(value, next, f)
+		}
+		a.values[writeIdx] = value
+		writeIdx++
+	}
+	a.values = a.values[:writeIdx]
+	return a
+}
+
+// rewriteTransform applies f to a top-level object, or to every element of a top-level array as a
+// document of its own like dropKeysFunc
+func rewriteTransform(keys *jsonKey, f rewriteFunc) transformFunc {
+	return func(n node) node {
+		arr, ok := n.(*arrayNode)
+		if !ok {
+			return rewrite(n, keys.set(), f)
+		}
+		writeIdx := 0
+		count := len(arr.values)
+		for i, value := range arr.values {
+			next, leaf := keys.set().elementLeaf(i, count, value)
+			if leaf != nil {
+				_, newValue, ok := f(leaf, "", value)
+				if !ok {
+					continue
+				}
+				value = newValue
+			} else {
+				value = rewrite(value, next.union(keys.set()), f)
+			}
+			arr.values[writeIdx] = value
+			writeIdx++
+		}
+		arr.values = arr.values[:writeIdx]
+		return arr
+	}
+}
+
+// newRenameDict builds the trie for rename mappings like "props.old_name:new_name". The part after
+// the last unescaped colon is the new name of the key the path ends at, it's a single key even if
+// it has dots in it.
+func newRenameDict(mappings []string, opts keyDictOptions) (*jsonKey, error) {
+	if opts.recursive {
+		mappings = recursiveKeys(mappings)
+	}
+	dict := newJSONKey()
+	dict.ignoreCase = opts.ignoreCase
+	for _, mapping := range mappings {
+		path, name, err := splitRename(mapping)
+		if err != nil {
+			return nil, err
+		}
+		if err := dict.insertKey(path, name, nil); err != nil {
+			return nil, fmt.Errorf("mapping %q: %w", mapping, err)
+		}
+	}
+	dict.optimize()
+	return dict, nil
+}
+
+func splitRename(mapping string) (path, name string, err error) {
+	for i := len(mapping) - 1; i >= 0; i-- {
+		if mapping[i] != ':' || isEscaped(mapping, i) {
+			continue
+		}
+		path, name = mapping[:i], unescapePathSegment(mapping[i+1:])
+		if path == "" || name == "" {
+			break
+		}
+		return path, name, nil
+	}
+	return "", "", fmt.Errorf("invalid rename mapping %q, expected old.path:new_name", mapping)
+}
+
+// renameKeysFunc renames the keys matched by the mappings' paths, the values stay where they are.
+// Paths ending at an array element leave it as it is, elements have no key to rename.
+func renameKeysFunc(keys *jsonKey) transformFunc {
+	return rewriteTransform(keys, func(leaf *jsonKey, _ string, value node) (string, node, bool) {
+		return leaf.target, value, true
+	})
+}
+
+// redactKeysFunc replaces the values of matched keys and elements with the placeholder string,
+// so the document keeps its shape
+func redactKeysFunc(keys *jsonKey, placeholder string) transformFunc {
+	return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+		recycleNode(value)
+		return key, stringNode(placeholder), true
+	})
+}
+
+// hashValuesFunc replaces the values of matched keys and elements with the hex SHA-256 of salt
+// followed by the value. Strings are hashed as they are, so the result matches
+// lower(hex(SHA256(concat(salt, s)))) in ClickHouse, other values as their compact JSON. Nulls
+// stay null, there's nothing to hide in them.
+func hashValuesFunc(keys *jsonKey, salt string) transformFunc {
+	return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+		if v, ok := value.(*valueNode); ok && v.kind == kindNull {
+			return key, value, true
+		}
+		buf := scratchBufferPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		buf.WriteString(salt)
+		if v, ok := value.(*valueNode); ok && v.kind == kindString {
+			buf.WriteString(v.str)
+		} else {
+			value.Write(buf)
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		scratchBufferPool.Put(buf)
+		recycleNode(value)
+		return key, stringNode(hex.EncodeToString(sum[:])), true
+	})
+}
+
+// anonymizeIPsFunc zeroes the host part of the IP addresses in matched keys and elements, keeping
+// the first ipv4Bits of IPv4 and ipv6Bits of IPv6 addresses, so 203.0.113.57 becomes 203.0.113.0
+// with 24, and geo lookups on the network still work. IPv4-mapped IPv6 addresses are masked as
+// IPv4 and keep their form, zones are dropped. Values that aren't addresses are replaced with the
+// placeholder rather than left as they are, nulls stay null.
+func anonymizeIPsFunc(keys *jsonKey, ipv4Bits, ipv6Bits int, placeholder string) transformFunc {
+	return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+		v, ok := value.(*valueNode)
+		if ok && v.kind == kindNull {
+			return key, value, true
+		}
+		if ok && v.kind == kindString {
+			if addr, err := netip.ParseAddr(v.str); err == nil {
+				bits := ipv6Bits
+				switch {
+				case addr.Is4():
+					bits = ipv4Bits
+				case addr.Is4In6():
+					bits = 96 + ipv4Bits
+				}
+				prefix, _ := addr.WithZone("").Prefix(bits)
+				return key, stringNode(prefix.Addr().String()), true
+			}
+		}
+		recycleNode(value)
+		return key, stringNode(placeholder), true
+	})
+}
+
+// stringNode returns a pooled string value, recycleNode puts it back with the rest of the document
+func stringNode(s string) *valueNode {
+	v := valueNodePool.Get().(*valueNode)
+	*v = valueNode{kind: kindString, str: s}
+	return v
+}
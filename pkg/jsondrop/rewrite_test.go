@@ -0,0 +1,230 @@
+package jsondrop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameKeysJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		mappings          []string
+	}{
+		{
+			name:     "rename top-level key",
+			input:    `{"a":1,"b":2}`,
+			want:     `{"alpha":1,"b":2}`,
+			mappings: []string{"a:alpha"},
+		},
+		{
+			name:     "rename nested key in place",
+			input:    `{"props":{"old":1,"other":2}}`,
+			want:     `{"props":{"new":1,"other":2}}`,
+			mappings: []string{"props.old:new"},
+		},
+		{
+			name:     "rename every match of a wildcard",
+			input:    `{"a":{"$lib":"web"},"b":{"$lib":"ios"}}`,
+			want:     `{"a":{"lib":"web"},"b":{"lib":"ios"}}`,
+			mappings: []string{"*.$lib:lib"},
+		},
+		{
+			name:     "rename inside array elements",
+			input:    `{"items":[{"sku":1},{"sku":2}]}`,
+			want:     `{"items":[{"id":1},{"id":2}]}`,
+			mappings: []string{"items[*].sku:id"},
+		},
+		{
+			name:     "new name with a dot is a single key",
+			input:    `{"browser_version":"1"}`,
+			want:     `{"$browser.version":"1"}`,
+			mappings: []string{"browser_version:$browser.version"},
+		},
+		{
+			name:     "escaped colon in new name",
+			input:    `{"a":1}`,
+			want:     `{"b:c":1}`,
+			mappings: []string{`a:b\:c`},
+		},
+		{
+			name:     "regex segment with a mapping",
+			input:    `{"$ph_a":1,"b":2}`,
+			want:     `{"ph":1,"b":2}`,
+			mappings: []string{`re:^\$ph_:ph`},
+		},
+		{
+			name:     "element paths are left alone",
+			input:    `{"items":[1,2]}`,
+			want:     `{"items":[1,2]}`,
+			mappings: []string{"items[0]:x"},
+		},
+		{
+			name:     "top-level array elements are documents",
+			input:    `[{"a":1},{"a":2}]`,
+			want:     `[{"b":1},{"b":2}]`,
+			mappings: []string{"a:b"},
+		},
+		{
+			name:     "missing key is a no-op",
+			input:    `{"x":1}`,
+			want:     `{"x":1}`,
+			mappings: []string{"a:b"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keys, err := newRenameDict(c.mappings, keyDictOptions{})
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			err = transformLine(renameKeysFunc(keys), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestNewRenameDictInvalidMapping(t *testing.T) {
+	for _, mapping := range []string{"a", "a:", ":b", `a\:b`} {
+		_, err := newRenameDict([]string{mapping}, keyDictOptions{})
+		assert.Error(t, err, mapping)
+	}
+}
+
+func TestRedactKeysJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			name:  "redact scalar",
+			input: `{"email":"a@b.c","id":1}`,
+			want:  `{"email":"[REDACTED]","id":1}`,
+			keys:  []string{"email"},
+		},
+		{
+			name:  "redact whole object",
+			input: `{"props":{"a":1},"id":1}`,
+			want:  `{"props":"[REDACTED]","id":1}`,
+			keys:  []string{"props"},
+		},
+		{
+			name:  "redact at any depth",
+			input: `{"a":{"token":"x"},"b":[{"token":null}]}`,
+			want:  `{"a":{"token":"[REDACTED]"},"b":[{"token":"[REDACTED]"}]}`,
+			keys:  []string{"**.token"},
+		},
+		{
+			name:  "redact array element",
+			input: `{"cards":["1111","2222"]}`,
+			want:  `{"cards":["[REDACTED]","2222"]}`,
+			keys:  []string{"cards[0]"},
+		},
+		{
+			name:  "missing key is a no-op",
+			input: `{"id":1}`,
+			want:  `{"id":1}`,
+			keys:  []string{"email"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(redactKeysFunc(mustKeyDict(t, c.keys), "[REDACTED]"), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestRedactKeysCustomPlaceholder(t *testing.T) {
+	var buf bytes.Buffer
+	err := transformLine(redactKeysFunc(mustKeyDict(t, []string{"a"}), `<"hidden">`), []byte(`{"a":1}`), &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"<\"hidden\">"}`, buf.String())
+}
+
+func TestHashValuesJSON(t *testing.T) {
+	sha := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	cases := []struct {
+		name, input, want, salt string
+		keys                    []string
+	}{
+		{
+			name:  "hash string",
+			input: `{"email":"a@b.c","id":1}`,
+			want:  `{"email":"` + sha("a@b.c") + `","id":1}`,
+			keys:  []string{"email"},
+		},
+		{
+			name:  "salted",
+			input: `{"email":"a@b.c"}`,
+			want:  `{"email":"` + sha("pepper"+"a@b.c") + `"}`,
+			salt:  "pepper",
+			keys:  []string{"email"},
+		},
+		{
+			name:  "number and object hashed as compact JSON",
+			input: `{"n":42,"o":{"a": [1, 2]}}`,
+			want:  `{"n":"` + sha("42") + `","o":"` + sha(`{"a":[1,2]}`) + `"}`,
+			keys:  []string{"n", "o"},
+		},
+		{
+			name:  "null stays null",
+			input: `{"email":null}`,
+			want:  `{"email":null}`,
+			keys:  []string{"email"},
+		},
+		{
+			name:  "array elements",
+			input: `{"ids":["x","y"]}`,
+			want:  `{"ids":["` + sha("x") + `","` + sha("y") + `"]}`,
+			keys:  []string{"ids[*]"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(hashValuesFunc(mustKeyDict(t, c.keys), c.salt), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
+
+func TestAnonymizeIPsJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want  string
+		ipv4Bits, ipv6Bits int
+	}{
+		{"ipv4", `{"$ip":"203.0.113.57","a":1}`, `{"$ip":"203.0.113.0","a":1}`, 24, 48},
+		{"ipv6", `{"$ip":"2001:db8:85a3:8d3:1319:8a2e:370:7348"}`, `{"$ip":"2001:db8:85a3::"}`, 24, 48},
+		{"ipv4-mapped keeps its form", `{"$ip":"::ffff:203.0.113.57"}`, `{"$ip":"::ffff:203.0.113.0"}`, 24, 48},
+		{"zone dropped", `{"$ip":"fe80::1:2%eth0"}`, `{"$ip":"fe80::"}`, 24, 48},
+		{"other prefixes", `{"$ip":"203.0.113.57","ips":["2001:db8:85a3:8d3::1"]}`, `{"$ip":"203.0.0.0","ips":["2001:db8:85a3:800::"]}`, 16, 53},
+		{"not an address", `{"$ip":"unknown","n":{"ip":1}}`, `{"$ip":"[REDACTED]","n":"[REDACTED]"}`, 24, 48},
+		{"null stays null", `{"$ip":null}`, `{"$ip":null}`, 24, 48},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(anonymizeIPsFunc(mustKeyDict(t, []string{"$ip", "n", "ips[*]"}), c.ipv4Bits, c.ipv6Bits, "[REDACTED]"), []byte(c.input), &buf)
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, buf.String())
+		})
+	}
+
+	c, err := parseConfig([]string{"-mode=anonymize-ip", "-ipv4-prefix=33", "['$ip']"})
+	assert.NoError(t, err)
+	_, err = c.lineFunc(nil, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RowBinary rows are their columns one after the other with nothing in between: a String is its
+// length as an unsigned LEB128 varint and then its bytes, and Nullable columns are led by a byte
+// that's 1 for NULL and 0 otherwise, https://clickhouse.com/docs/interfaces/formats/RowBinary
+
+// maxRowBinaryString is the longest String a RowBinary row may have, to catch input that isn't
+// RowBinary before allocating for it
+const maxRowBinaryString = 1 << 30
+
+// rowBinary reads RowBinary rows as the text rows modes take and writes their results back as
+// RowBinary, so the modes themselves don't change
+type rowBinary struct {
+	// columns is how many String arguments a row has
+	columns int
+	// nullable is for Nullable(String) arguments and return types
+	nullable bool
+	// tsv modes, dispatch and -on-error=tuple take a TabSeparated row and write TabSeparated
+	// columns, which are escaped on the way in and unescaped on the way out
+	tsv bool
+	// tuple results are two String columns, the result and the error
+	tuple bool
+
+	field []byte
+	row   bytes.Buffer
+}
+
+// rowBinary returns the RowBinary format -format asks for, or nil for Raw, TabSeparated and CSV
+// rows. Native blocks and ArrowStream record batches are read and written as RowBinary rows too,
+// see nativeReader.
+func (c *config) rowBinary() (*rowBinary, error) {
+	if c.format == "csv" {
+		return nil, nil
+	}
+	return c.rowLayout()
+}
+
+// rowLayout returns how the columns of -format rows map to the rows the mode takes, nil for Raw
+// and TabSeparated rows, which are those rows already
+func (c *config) rowLayout() (*rowBinary, error) {
+	switch c.format {
+	case "raw", "tsv":
+		return nil, nil
+	case "rowbinary", "native", "arrowstream", "csv":
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected raw, tsv, csv, rowbinary, native or arrowstream", c.format)
+	}
+	if c.maxLineBytes > 0 {
+		return nil, fmt.Errorf("-max-line-bytes only works with -format=raw and tsv")
+	}
+	if (c.format == "native" || c.format == "arrowstream") && c.chunkHeader {
+		return nil, fmt.Errorf("-chunk-header doesn't apply to -format=%s, blocks have their own row counts", c.format)
+	}
+	tsv := c.mode == dispatchMode || transformModes[c.mode].tsv
+	f := &rowBinary{
+		columns:  1,
+		nullable: c.nullable && !tsv,
+		tsv:      tsv || c.onError == "tuple",
+		tuple:    c.onError == "tuple" && c.mode != dispatchMode,
+	}
+	if tsv {
+		f.columns = 2
+	}
+	if c.columns > 0 {
+		if !tsv && c.columns != 1 {
+			return nil, fmt.Errorf("-mode=%s takes one column", c.mode)
+		}
+		f.columns = c.columns
+	}
+	return f, nil
+}
+
+// readRow reads the next row from r, io.EOF if there are no more. The row is only valid until
+// the next call.
+func (f *rowBinary) readRow(r *bufio.Reader) ([]byte, error) {
+	f.row.Reset()
+	for i := 0; i < f.columns; i++ {
+		null, err := f.readColumn(r)
+		if err == io.EOF && i > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.appendColumn(&f.row, i, null, f.field)
+	}
+	return f.row.Bytes(), nil
+}
+
+// appendColumn adds column i of a row to the text row the mode takes
+func (f *rowBinary) appendColumn(row *bytes.Buffer, i int, null bool, field []byte) {
+	if i > 0 {
+		row.WriteByte('\t')
+	}
+	switch {
+	case null:
+		row.Write(nullTSV)
+	case f.tsv:
+		writeTSVEscaped(row, field)
+	default:
+		row.Write(field)
+	}
+}
+
+// readColumn reads a column into field, null is set for NULL
+func (f *rowBinary) readColumn(r *bufio.Reader) (null bool, err error) {
+	if f.nullable {
+		flag, err := r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		if flag == 1 {
+			return true, nil
+		}
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF && f.nullable {
+			err = io.ErrUnexpectedEOF
+		}
+		return false, err
+	}
+	if n > maxRowBinaryString {
+		return false, fmt.Errorf("RowBinary string of %d bytes is longer than %d", n, maxRowBinaryString)
+	}
+	if cap(f.field) < int(n) {
+		f.field = make([]byte, n)
+	}
+	f.field = f.field[:n]
+	if _, err := io.ReadFull(r, f.field); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// lineFunc writes the results of process as RowBinary
+func (f *rowBinary) lineFunc(process lineFunc) lineFunc {
+	var text []byte
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		if err := process(rawLine, buf); err != nil {
+			return err
+		}
+		text = append(text[:0], buf.Bytes()...)
+		buf.Reset()
+		if f.tuple {
+			result, errColumn, _ := bytes.Cut(text, []byte{'\t'})
+			writeRowBinaryString(buf, unescapeTSV(result))
+			writeRowBinaryString(buf, unescapeTSV(errColumn))
+			return nil
+		}
+		if f.nullable {
+			if bytes.Equal(text, nullTSV) {
+				buf.WriteByte(1)
+				return nil
+			}
+			buf.WriteByte(0)
+		}
+		if f.tsv {
+			text = unescapeTSV(text)
+		}
+		writeRowBinaryString(buf, text)
+		return nil
+	}
+}
+
+func writeRowBinaryString(buf *bytes.Buffer, s []byte) {
+	var length [binary.MaxVarintLen64]byte
+	buf.Write(length[:binary.PutUvarint(length[:], uint64(len(s)))])
+	buf.Write(s)
+}
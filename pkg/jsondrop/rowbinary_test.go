@@ -0,0 +1,102 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rowBinaryStrings encodes columns as RowBinary Strings, nil for a NULL column of a Nullable one
+func rowBinaryStrings(nullable bool, columns ...*string) []byte {
+	var buf bytes.Buffer
+	for _, column := range columns {
+		if nullable {
+			if column == nil {
+				buf.WriteByte(1)
+				continue
+			}
+			buf.WriteByte(0)
+		}
+		writeRowBinaryString(&buf, []byte(*column))
+	}
+	return buf.Bytes()
+}
+
+func str(s string) *string { return &s }
+
+// runRowBinary transforms RowBinary input the way main does
+func runRowBinary(t *testing.T, input []byte, keys []string, flags ...string) ([]byte, error) {
+	c, err := parseConfig(flags)
+	assert.NoError(t, err)
+	f, err := c.rowBinary()
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc(keys)
+	assert.NoError(t, err)
+	process = f.lineFunc(process)
+
+	lines := newLineReader(bufio.NewReaderSize(bytes.NewReader(input), 16), 0)
+	lines.binary = f
+	var out, buf bytes.Buffer
+	for {
+		line, _, err := lines.next()
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return out.Bytes(), err
+		}
+		if err := process(line, &buf); err != nil {
+			return out.Bytes(), err
+		}
+		out.Write(buf.Bytes())
+	}
+}
+
+func TestRowBinary(t *testing.T) {
+	// newlines and tabs inside a document need no escaping
+	doc := "{\"a\":1,\n\"b\":\"x\\ty\",\"c\":\"\t\"}"
+	input := append(rowBinaryStrings(false, str(doc)), rowBinaryStrings(false, str(`{"a":2}`))...)
+	out, err := runRowBinary(t, input, []string{"a"}, "-format=rowbinary")
+	assert.NoError(t, err)
+	assert.Equal(t, append(rowBinaryStrings(false, str("{\"b\":\"x\\ty\",\"c\":\"\\t\"}")), rowBinaryStrings(false, str(`{}`))...), out)
+
+	long := `{"a":"` + strings.Repeat("x", 300) + `","b":1}`
+	out, err = runRowBinary(t, rowBinaryStrings(false, str(long)), []string{"a"}, "-format=rowbinary")
+	assert.NoError(t, err)
+	assert.Equal(t, rowBinaryStrings(false, str(`{"b":1}`)), out)
+
+	out, err = runRowBinary(t, rowBinaryStrings(true, nil, str(`{"a":1,"b":2}`), str(`{`)), []string{"a"},
+		"-format=rowbinary", "-nullable", "-on-error=null")
+	assert.NoError(t, err)
+	assert.Equal(t, rowBinaryStrings(true, nil, str(`{"b":2}`), nil), out)
+
+	out, err = runRowBinary(t, rowBinaryStrings(false, str("{\"a\":\"\t\"}"), str(`{"b":{"c":1}}`)), nil,
+		"-format=rowbinary", "-mode=merge-patch")
+	assert.NoError(t, err)
+	assert.Equal(t, rowBinaryStrings(false, str(`{"a":"\t","b":{"c":1}}`)), out)
+
+	out, err = runRowBinary(t, rowBinaryStrings(false, str(`{"a":1}`), str(`{`)), []string{"a"},
+		"-format=rowbinary", "-on-error=tuple")
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(out, rowBinaryStrings(false, str(`{}`), str(""), str(""))), out)
+
+	_, err = runRowBinary(t, rowBinaryStrings(false, str(`{"a":1}`))[:4], nil, "-format=rowbinary")
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = runRowBinary(t, rowBinaryStrings(false, str(`{}`))[:1], nil, "-format=rowbinary", "-mode=diff")
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	for _, flags := range [][]string{
+		{"-format=xml"},
+		{"-format=rowbinary", "-max-line-bytes=10"},
+		{"-format=rowbinary", "-columns=2"},
+	} {
+		c, err := parseConfig(flags)
+		assert.NoError(t, err)
+		_, err = c.rowBinary()
+		assert.Error(t, err, flags)
+	}
+}
@@ -0,0 +1,164 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scopedKeysDefault is the entry of a -team-keys or -event-keys file for the rows it doesn't list
+const scopedKeysDefault = "default"
+
+// keyScope is what -team-keys and -event-keys pick the keys of a row by, a column after the
+// document
+type keyScope struct {
+	// flag is the flag naming the file, path its value
+	flag, path string
+	// name is what the entries of the file are, in errors and warnings, kind what an entry has to
+	// be in the error for one that isn't
+	name, kind string
+	// column and typ declare the function's argument
+	column, typ string
+	// id returns an entry of the file as rows have it, ok=false if it can't be one
+	id func(entry string) (string, bool)
+}
+
+// keyScope returns the scope the flags pick keys by, nil if they don't
+func (c *config) keyScope() *keyScope {
+	switch {
+	case c.teamKeys != "":
+		return &keyScope{flag: "-team-keys", path: c.teamKeys, name: "team", kind: "a team id", column: "team_id", typ: "UInt64", id: func(entry string) (string, bool) {
+			// as ClickHouse writes a UInt64
+			id, err := strconv.ParseUint(entry, 10, 64)
+			return strconv.FormatUint(id, 10), err == nil
+		}}
+	case c.eventKeys != "":
+		return &keyScope{flag: "-event-keys", path: c.eventKeys, name: "event", kind: "an event name", column: "event", typ: "String", id: func(entry string) (string, bool) {
+			return entry, entry != ""
+		}}
+	}
+	return nil
+}
+
+// read reads the file, a YAML mapping of the scope's ids to the paths their rows drop, and
+// optionally default to those of the rows with an id it doesn't list
+func (s *keyScope) read() (map[string][]string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string][]string
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s file %s: %w", s.flag, s.path, err)
+	}
+	scoped := make(map[string][]string, len(entries))
+	for entry, keys := range entries {
+		if entry != scopedKeysDefault {
+			id, ok := s.id(entry)
+			if !ok {
+				return nil, fmt.Errorf("%s file %s: %q isn't %s or %s", s.flag, s.path, entry, s.kind, scopedKeysDefault)
+			}
+			if _, ok := scoped[id]; ok {
+				return nil, fmt.Errorf("%s file %s: %s %s is listed more than once", s.flag, s.path, s.name, id)
+			}
+			entry = id
+		}
+		scoped[entry] = keys
+	}
+	return scoped, nil
+}
+
+// checkKeyScope checks the flags work with -team-keys or -event-keys, whose rows are a document
+// and the id their keys are picked by
+func (c *config) checkKeyScope() error {
+	if c.teamKeys != "" && c.eventKeys != "" {
+		return fmt.Errorf("-team-keys and -event-keys can't be combined, the keys of a row are picked by one column")
+	}
+	flag := c.keyScope().flag
+	if c.mode == dispatchMode || transformModes[c.mode].keyless || transformModes[c.mode].line != nil {
+		return fmt.Errorf("%s picks the keys of each row, -mode=%s doesn't take any", flag, c.mode)
+	}
+	if c.format != "raw" && c.format != "tsv" {
+		return fmt.Errorf("%s reads TabSeparated rows, it only works with -format=raw and tsv", flag)
+	}
+	return nil
+}
+
+// scopedLineFunc builds the transform for -team-keys and -event-keys: each row is a TabSeparated
+// document and the scope's column, and the document goes through the transform of the keys the
+// file lists for the row's id added to keys, the ones every row drops. The file is read and every
+// id's transform built up front, so a bad entry fails the start rather than the row that uses it,
+// and reloading the keys file reads it again. Ids the file doesn't list get its default entry, or
+// keys alone.
+func (c *config) scopedLineFunc(scope *keyScope, keys []string) (lineFunc, error) {
+	onError, err := parseErrorPolicy(c.onError)
+	if err != nil {
+		return nil, err
+	}
+	scoped, err := scope.read()
+	if err != nil {
+		return nil, err
+	}
+	// every id's transform takes an unescaped document, the row's escaping, NULL and errors are
+	// handled here for all of them
+	document := *c
+	document.format, document.nullable, document.onError = "raw", false, "fail"
+	build := func(id string, scopedKeys []string) (lineFunc, error) {
+		all, warnings, err := checkKeyList(append(append([]string{}, keys...), scopedKeys...), c.mode, c.ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		if c.warn != nil {
+			for _, w := range warnings {
+				c.warn(w.key, w.reason+" for "+scope.name+" "+id)
+			}
+		}
+		return document.buildLineFunc(all)
+	}
+
+	ids := make([]string, 0, len(scoped))
+	for id := range scoped {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	transforms := make(map[string]lineFunc, len(scoped))
+	for _, id := range ids {
+		if transforms[id], err = build(id, scoped[id]); err != nil {
+			return nil, fmt.Errorf("%s file %s: %s: %w", scope.flag, scope.path, id, err)
+		}
+	}
+	fallback, ok := transforms[scopedKeysDefault]
+	if !ok {
+		if fallback, err = document.buildLineFunc(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	var process lineFunc = func(rawLine []byte, buf *bytes.Buffer) error {
+		column, id, ok := bytes.Cut(rawLine, []byte{'\t'})
+		if !ok {
+			return fmt.Errorf("expected a document column and a %s column", scope.column)
+		}
+		if c.nullable && bytes.Equal(column, nullTSV) {
+			buf.Reset()
+			buf.Write(nullTSV)
+			return nil
+		}
+		transform, ok := transforms[string(unescapeTSV(id))]
+		if !ok {
+			transform = fallback
+		}
+		if err := transform(unescapeTSV(column), &out); err != nil {
+			return err
+		}
+		buf.Reset()
+		writeTSVEscaped(buf, out.Bytes())
+		return nil
+	}
+	return onErrorLineFunc(process, onError, true), nil
+}
@@ -0,0 +1,134 @@
+package jsondrop
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeScopedKeys(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "scoped.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestTeamKeys(t *testing.T) {
+	path := writeScopedKeys(t, "1: [email]\n002: [name, email]\n3: []\ndefault: [phone]\n")
+	for _, tc := range []struct {
+		flags      []string
+		line, want string
+	}{
+		{nil, `{"email":1,"name":2,"phone":3,"$ip":4}` + "\t1", `{"name":2,"phone":3}`},
+		{nil, `{"email":1,"name":2,"phone":3,"$ip":4}` + "\t2", `{"phone":3}`},
+		{nil, `{"email":1,"name":2,"phone":3,"$ip":4}` + "\t3", `{"email":1,"name":2,"phone":3}`},
+		{nil, `{"email":1,"name":2,"phone":3,"$ip":4}` + "\t9", `{"email":1,"name":2}`},
+		{nil, `{"a":"x\ty"}` + "\t1", `{"a":"x\\ty"}`},
+		{[]string{"-nullable"}, `\N` + "\t1", `\N`},
+		{[]string{"-on-error=passthrough"}, `{"a":` + "\t1", `{"a":`},
+		{[]string{"-on-error=null"}, `{"a":` + "\t1", `\N`},
+		{[]string{"-on-error=tuple"}, `{"email":1}` + "\t1", "{}\t"},
+		{[]string{"-mode=keep"}, `{"email":1,"name":2,"$ip":4}` + "\t1", `{"email":1,"$ip":4}`},
+	} {
+		c, err := parseConfig(append([]string{"-team-keys=" + path}, append(tc.flags, `['$ip']`)...))
+		assert.NoError(t, err, tc.flags)
+		process, err := c.lineFunc(nil, false)
+		assert.NoError(t, err, tc.flags)
+		var buf bytes.Buffer
+		assert.NoError(t, process([]byte(tc.line), &buf), tc.flags)
+		assert.Equal(t, tc.want, buf.String(), tc.line)
+	}
+
+	// the key argument is optional, teams not listed get nothing without a default
+	c, err := parseConfig([]string{"-team-keys=" + writeScopedKeys(t, "1: [email, email]\n")})
+	assert.NoError(t, err)
+	var warned []keyWarning
+	c.warn = func(key, reason string) { warned = append(warned, keyWarning{key, reason}) }
+	process, err := c.lineFunc(nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []keyWarning{{"email", "is listed more than once for team 1"}}, warned)
+	var buf bytes.Buffer
+	assert.NoError(t, process([]byte(`{"email":1}`+"\t7"), &buf))
+	assert.Equal(t, `{"email":1}`, buf.String())
+	assert.EqualError(t, process([]byte(`{"email":1}`), &buf), "expected a document column and a team_id column")
+
+	for _, tc := range []struct {
+		content string
+		flags   []string
+		err     string
+	}{
+		{"acme: [email]\n", nil, `"acme" isn't a team id or default`},
+		{"1: [email]\n01: [name]\n", nil, "team 1 is listed more than once"},
+		{"1: [a..b]\n", nil, `1: key "a..b"`},
+		{"1: [email]\n", []string{"-mode=validate"}, "-mode=validate doesn't take any"},
+		{"1: [email]\n", []string{"-format=rowbinary"}, "only works with -format=raw and tsv"},
+	} {
+		c, err := parseConfig(append([]string{"-team-keys=" + writeScopedKeys(t, tc.content)}, tc.flags...))
+		assert.NoError(t, err)
+		_, err = c.lineFunc(nil, false)
+		if assert.Error(t, err, tc.content) {
+			assert.Contains(t, err.Error(), tc.err)
+		}
+	}
+}
+
+func TestEventKeys(t *testing.T) {
+	path := writeScopedKeys(t, "$pageview: [props.query]\n\"a\\tb\": [x]\ndefault: [$ip]\n")
+	for _, tc := range []struct{ line, want string }{
+		{`{"props":{"query":"q","page":1},"$ip":"1"}` + "\t$pageview", `{"props":{"page":1}}`},
+		{`{"props":{"query":"q","page":1},"$ip":"1"}` + "\t$autocapture", `{"props":{"query":"q","page":1}}`},
+		{`{"x":1,"y":2,"$ip":"1"}` + "\ta\\tb", `{"y":2}`},
+	} {
+		c, err := parseConfig([]string{"-event-keys=" + path, "['$ip']"})
+		assert.NoError(t, err)
+		process, err := c.lineFunc(nil, false)
+		assert.NoError(t, err)
+		var buf bytes.Buffer
+		assert.NoError(t, process([]byte(tc.line), &buf), tc.line)
+		assert.Equal(t, tc.want, buf.String(), tc.line)
+	}
+
+	c, err := parseConfig([]string{"-event-keys=" + writeScopedKeys(t, "\"\": [x]\n")})
+	assert.NoError(t, err)
+	_, err = c.lineFunc(nil, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `"" isn't an event name or default`)
+	}
+	c, err = parseConfig([]string{"-event-keys=" + path, "-team-keys=" + path})
+	assert.NoError(t, err)
+	_, err = c.lineFunc(nil, false)
+	assert.EqualError(t, err, "-team-keys and -event-keys can't be combined, the keys of a row are picked by one column")
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runSQL([]string{"-name=json_drop_event_keys", "-event-keys=events.yaml", "-table=events"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "ALTER TABLE events UPDATE properties = json_drop_event_keys(properties, event) WHERE 1;\n")
+}
+
+func TestTeamKeysGenconfig(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runGenconfig([]string{"-name=json_drop_team_keys", "-team-keys=/etc/clickhouse-server/teams.yaml", "-nullable"}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, `<functions>
+    <function>
+        <type>executable</type>
+        <name>json_drop_team_keys</name>
+        <return_type>Nullable(String)</return_type>
+        <argument>
+            <type>Nullable(String)</type>
+            <name>json</name>
+        </argument>
+        <argument>
+            <type>UInt64</type>
+            <name>team_id</name>
+        </argument>
+        <format>TabSeparated</format>
+        <command>json_drop_keys_udf -team-keys=/etc/clickhouse-server/teams.yaml -nullable</command>
+    </function>
+</functions>
+`, stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, runSQL([]string{"-name=json_drop_team_keys", "-team-keys=teams.yaml", "-table=events"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "ALTER TABLE events UPDATE properties = json_drop_team_keys(properties, team_id) WHERE 1;\n")
+}
@@ -0,0 +1,181 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// serveCommand is the first argument that serves the transform over HTTP instead of running the
+// UDF
+const serveCommand = "serve"
+
+// servePath is where rows are POSTed
+const servePath = "/transform"
+
+// runServe is the serve subcommand: it serves POST /transform, which transforms the newline
+// delimited rows of the request body with the same flags the UDF takes and streams the results
+// back a row per line. The keys query parameter is the key argument, the one given after the
+// flags for requests without it. Requests are transformed concurrently, -workers doesn't apply.
+func runServe(args []string, stderr io.Writer) int {
+	c := &config{}
+	fs := newFlagSet(c)
+	fs.Init(serveCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	listen := fs.String("listen", ":8080", "the address to serve on")
+	if err := c.parseFlags(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	c.keysArg = c.keyArgument(fs.Arg(0))
+	c.flagArgs = stripFlags(args[:len(args)-fs.NArg()], "listen")
+	log, logFile, err := c.newLogger(stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 2
+	}
+	if logFile != nil {
+		defer logFile.Close()
+		reopenOnHangup(log, logFile)
+	}
+	server, err := newTransformServer(c)
+	if err != nil {
+		log.Error("serve error", "error", err.Error())
+		return 2
+	}
+	server.log = log
+
+	srv := &http.Server{Addr: *listen, Handler: server}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	stopped := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Warn("stopping on signal", "signal", sig.String())
+		// requests being transformed are finished first
+		_ = srv.Shutdown(context.Background())
+		close(stopped)
+	}()
+	log.Info("serving", "listen", *listen, "path", servePath)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Error("serve error", "error", (&listenError{"listen", err}).Error())
+		return 1
+	}
+	<-stopped
+	return 0
+}
+
+// transformServer transforms the rows POSTed to servePath
+type transformServer struct {
+	config   *config
+	fileKeys []string
+	log      *slog.Logger
+}
+
+// newTransformServer reads the keys file once and checks the flags build a transform, with the
+// default key argument if there is one
+func newTransformServer(c *config) (*transformServer, error) {
+	if layout, err := c.rowLayout(); err != nil || layout != nil || c.format == "csv" {
+		return nil, fmt.Errorf("serve reads newline delimited rows, -format=%s doesn't apply", c.format)
+	}
+	s := &transformServer{config: c, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	if c.keysFile != "" {
+		var err error
+		if s.fileKeys, err = (&keysFile{path: c.keysFile}).read(); err != nil {
+			return nil, err
+		}
+	}
+	if c.keysArg != "" || c.keysFile != "" || len(c.presets) > 0 || c.keyScope() != nil || c.mode == dispatchMode || transformModes[c.mode].keyless {
+		if _, err := s.lineFunc(""); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// lineFunc builds the transform for a request's key argument, the default one if keys is empty.
+// Transforms keep state between rows, so every request builds its own.
+func (s *transformServer) lineFunc(keys string) (lineFunc, error) {
+	c := *s.config
+	if keys != "" {
+		c.keysArg = keys
+	}
+	return c.lineFunc(s.fileKeys, c.keysFile != "")
+}
+
+func (s *transformServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != servePath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "rows have to be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	process, err := s.lineFunc(r.URL.Query().Get("keys"))
+	if err != nil {
+		http.Error(w, "keysToDrop parse error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// results are sent whenever the request's rows run out, as the UDF flushes its output, so a
+	// client streaming rows gets theirs back as it goes
+	body := bufio.NewReaderSize(r.Body, 64*1024)
+	lines := newLineReader(body, s.config.maxLineBytes)
+	flusher, _ := w.(http.Flusher)
+	var pending, buf bytes.Buffer
+	sent := false
+	send := func() {
+		if pending.Len() == 0 {
+			return
+		}
+		if !sent {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			sent = true
+		}
+		_, _ = w.Write(pending.Bytes())
+		pending.Reset()
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for row := 1; ; row++ {
+		line, _, err := lines.next()
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err == nil || err == io.EOF {
+			err = process(line, &buf)
+		}
+		if err != nil {
+			s.log.Warn("request failed", "row", row, "error", err.Error())
+			if !sent {
+				http.Error(w, fmt.Sprintf("row %d: %v", row, err), http.StatusBadRequest)
+				return
+			}
+			// the response has started, cutting it short is the only way left to tell the client
+			panic(http.ErrAbortHandler)
+		}
+		pending.Write(buf.Bytes())
+		pending.WriteByte('\n')
+		if pending.Len() >= 64*1024 || body.Buffered() == 0 {
+			send()
+		}
+	}
+	if !sent {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	send()
+}
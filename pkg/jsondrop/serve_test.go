@@ -0,0 +1,74 @@
+package jsondrop
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// post sends rows to a server for flags and returns the response's status and body
+func post(t *testing.T, flags []string, keys, rows string) (int, string) {
+	c, err := parseConfig(flags)
+	assert.NoError(t, err)
+	server, err := newTransformServer(c)
+	assert.NoError(t, err)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	target := ts.URL + servePath
+	if keys != "" {
+		target += "?keys=" + url.QueryEscape(keys)
+	}
+	resp, err := http.Post(target, "application/x-ndjson", strings.NewReader(rows))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestServe(t *testing.T) {
+	status, body := post(t, []string{"['a']"}, "", "{\"a\":1,\"b\":2}\n{\"a\":{\"c\":1}}\n{}")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "{\"b\":2}\n{}\n{}\n", body)
+
+	status, body = post(t, []string{"-mode=redact", "['a']"}, "['b']", `{"a":1,"b":2}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"a":1,"b":"[REDACTED]"}`+"\n", body)
+
+	status, body = post(t, []string{"-mode=merge-patch"}, "", "{\"a\":1}\t{\"b\":2}\n")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"a":1,"b":2}`+"\n", body)
+
+	status, body = post(t, []string{"-on-error=null"}, "['a']", "{\n{\"a\":1}\n")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "\\N\n{}\n", body)
+
+	status, body = post(t, nil, "['a']", "{\"a\":1}{\n")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "row 1:")
+
+	status, _ = post(t, nil, "[", "{}\n")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	c, err := parseConfig(nil)
+	assert.NoError(t, err)
+	server, err := newTransformServer(c)
+	assert.NoError(t, err)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, servePath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	for _, flags := range [][]string{{"-format=rowbinary"}, {"-format=csv"}, {"-mode=redact", "["}} {
+		c, err := parseConfig(flags)
+		assert.NoError(t, err)
+		_, err = newTransformServer(c)
+		assert.Error(t, err, flags)
+	}
+}
@@ -0,0 +1,143 @@
+package jsondrop
+
+import (
+	"bytes"
+	"sort"
+)
+
+// shrinkFunc drops values until a document's compact JSON is at most maxBytes long. The paths in
+// priority go first, in order, each dropping everything it matches. Then the largest scalar
+// members at any depth go, largest first, and if the remaining keys are still too much, the
+// top-level members, largest first. Documents that already fit are unchanged.
+func shrinkFunc(priority []*jsonKey, maxBytes int) transformFunc {
+	var scratch bytes.Buffer
+	size := func(n node) int {
+		scratch.Reset()
+		n.Write(&scratch)
+		return scratch.Len()
+	}
+	return func(n node) node {
+		if size(n) <= maxBytes {
+			return n
+		}
+		for _, keys := range priority {
+			n = dropKeysFunc(keys)(n)
+			if size(n) <= maxBytes {
+				return n
+			}
+		}
+		obj, ok := n.(*objectNode)
+		if !ok {
+			return n
+		}
+
+		total := size(obj)
+		var members []shrinkCandidate
+		collectScalarMembers(obj, &members)
+		total = dropLargest(members, total, maxBytes)
+		if total > maxBytes {
+			compactDropped(obj)
+			total = size(obj)
+			members = members[:0]
+			for i := range obj.entries {
+				members = append(members, shrinkCandidate{parent: obj, index: i, size: entrySize(obj.entries[i])})
+			}
+			dropLargest(members, total, maxBytes)
+		}
+		compactDropped(obj)
+		return obj
+	}
+}
+
+// shrinkCandidate is a member that can be dropped, size is the length of "key":value
+type shrinkCandidate struct {
+	parent *objectNode
+	index  int
+	size   int
+}
+
+func collectScalarMembers(obj *objectNode, members *[]shrinkCandidate) {
+	for i, entry := range obj.entries {
+		switch v := entry.value.(type) {
+		case *valueNode:
+			*members = append(*members, shrinkCandidate{parent: obj, index: i, size: entrySize(entry)})
+		case *objectNode:
+			collectScalarMembers(v, members)
+		case *arrayNode:
+			for _, element := range v.values {
+				if nested, ok := element.(*objectNode); ok {
+					collectScalarMembers(nested, members)
+				}
+			}
+		}
+	}
+}
+
+func entrySize(entry objectEntry) int {
+	var buf bytes.Buffer
+	writeJSONString(&buf, entry.key)
+	buf.WriteByte(':')
+	entry.value.Write(&buf)
+	return buf.Len()
+}
+
+// dropLargest marks members as dropped, largest first, until total is at most maxBytes, and
+// returns the new total. Members are marked by setting their value to nil, compactDropped
+// removes them.
+func dropLargest(members []shrinkCandidate, total, maxBytes int) int {
+	sort.SliceStable(members, func(i, j int) bool { return members[i].size > members[j].size })
+	remaining := make(map[*objectNode]int)
+	for _, m := range members {
+		if _, ok := remaining[m.parent]; !ok {
+			remaining[m.parent] = liveEntries(m.parent)
+		}
+	}
+	for _, m := range members {
+		if total <= maxBytes {
+			break
+		}
+		entry := &m.parent.entries[m.index]
+		if entry.value == nil {
+			continue
+		}
+		total -= m.size
+		if remaining[m.parent] > 1 {
+			total-- // the comma
+		}
+		remaining[m.parent]--
+		recycleNode(entry.value)
+		entry.value = nil
+	}
+	return total
+}
+
+func liveEntries(obj *objectNode) int {
+	count := 0
+	for _, entry := range obj.entries {
+		if entry.value != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// compactDropped removes the members dropLargest marked, at any depth
+func compactDropped(n node) {
+	switch v := n.(type) {
+	case *objectNode:
+		writeIdx := 0
+		for _, entry := range v.entries {
+			if entry.value == nil {
+				continue
+			}
+			compactDropped(entry.value)
+			v.entries[writeIdx] = entry
+			writeIdx++
+		}
+		v.entries = v.entries[:writeIdx]
+	case *arrayNode:
+		for _, value := range v.values {
+			compactDropped(value)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShrinkJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		maxBytes          int
+		priority          []string
+	}{
+		{
+			name:     "fits already",
+			input:    `{"a":"xxxx","b":1}`,
+			want:     `{"a":"xxxx","b":1}`,
+			maxBytes: 18,
+		},
+		{
+			name:     "largest scalar first",
+			input:    `{"a":"xxxxxxxxxx","b":{"c":"yyyyy","d":1},"e":2}`,
+			want:     `{"b":{"c":"yyyyy","d":1},"e":2}`,
+			maxBytes: 35,
+		},
+		{
+			name:     "nested scalars",
+			input:    `{"a":"xx","b":{"c":"yyyyyyyy","d":1},"e":[{"f":"zzzzzz"}]}`,
+			want:     `{"a":"xx","b":{"d":1},"e":[{}]}`,
+			maxBytes: 35,
+		},
+		{
+			name:     "priority paths first",
+			input:    `{"a":"xxxxxxxxxx","b":{"c":"y","d":1}}`,
+			want:     `{"a":"xxxxxxxxxx","b":{"d":1}}`,
+			maxBytes: 30,
+			priority: []string{"b.c"},
+		},
+		{
+			name:     "top-level members when keys alone are too much",
+			input:    `{"aaaaaaaaaaaaaaaa":{"b":{}},"c":1,"d":{"e":{}}}`,
+			want:     `{"d":{"e":{}}}`,
+			maxBytes: 15,
+		},
+		{
+			name:     "non-objects pass through",
+			input:    `"xxxxxxxxxxxxxxx"`,
+			want:     `"xxxxxxxxxxxxxxx"`,
+			maxBytes: 5,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var priority []*jsonKey
+			for _, key := range c.priority {
+				priority = append(priority, mustKeyDict(t, []string{key}))
+			}
+			var buf bytes.Buffer
+			err := transformLine(shrinkFunc(priority, c.maxBytes), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+			if len(c.input) > c.maxBytes && c.input[0] == '{' {
+				assert.LessOrEqual(t, buf.Len(), c.maxBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package jsondrop
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// shutdown is what exiting involves once rows are being read: flushing the output, the final
+// stats and row error counts, the profiles. On SIGTERM or SIGINT, which ClickHouse sends a UDF
+// when a query is cancelled, it does the same from the row boundary it's at and exits with 128
+// plus the signal's number, as shells report a process killed by it.
+type shutdown struct {
+	// output is held while a row is written, so a signal never leaves half a row in the output
+	output  sync.Mutex
+	once    sync.Once
+	cleanup []func()
+}
+
+// atExit adds f to what finish runs, last added first like defer
+func (s *shutdown) atExit(f func()) {
+	s.cleanup = append(s.cleanup, f)
+}
+
+// finish runs the cleanup, once however many times it's called
+func (s *shutdown) finish() {
+	s.once.Do(func() {
+		for i := len(s.cleanup) - 1; i >= 0; i-- {
+			s.cleanup[i]()
+		}
+	})
+}
+
+// exit finishes and exits with code
+func (s *shutdown) exit(code int) {
+	s.finish()
+	os.Exit(code)
+}
+
+// onSignals stops the process at the next row boundary on SIGTERM or SIGINT
+func (s *shutdown) onSignals(log *slog.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Warn("stopping on signal", "signal", sig.String())
+		s.output.Lock()
+		s.exit(128 + int(sig.(syscall.Signal)))
+	}()
+}
@@ -0,0 +1,56 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownFinish(t *testing.T) {
+	var s shutdown
+	var ran []int
+	for i := 0; i < 3; i++ {
+		s.atExit(func() { ran = append(ran, i) })
+	}
+	s.finish()
+	s.finish()
+	assert.Equal(t, []int{2, 1, 0}, ran)
+}
+
+// TestShutdownSignal sends the UDF SIGTERM between rows and checks what it wrote before stopping
+func TestShutdownSignal(t *testing.T) {
+	cmd := udfCommand("-stats-interval=1h", "['email']")
+	stdin, err := cmd.StdinPipe()
+	assert.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	assert.NoError(t, err)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	assert.NoError(t, cmd.Start())
+
+	// each row is flushed once nothing more is buffered, so reading it back means the child is
+	// waiting for the next one
+	output := bufio.NewReader(stdout)
+	for i, row := range []string{`{"email":"a","n":1}`, `{"email":"b","n":2}`} {
+		_, err := stdin.Write([]byte(row + "\n"))
+		assert.NoError(t, err)
+		line, err := output.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, []string{`{"n":1}`, `{"n":2}`}[i]+"\n", line)
+	}
+	assert.NoError(t, cmd.Process.Signal(syscall.SIGTERM))
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if assert.True(t, errors.As(err, &exitErr), "exit error %v", err) {
+		assert.Equal(t, 128+int(syscall.SIGTERM), exitErr.ExitCode())
+	}
+	_ = stdin.Close()
+	assert.Contains(t, stderr.String(), "stopping on signal")
+	assert.Contains(t, stderr.String(), "stats total")
+	assert.Contains(t, stderr.String(), `"rows":2`)
+}
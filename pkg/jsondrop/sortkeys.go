@@ -0,0 +1,32 @@
+package jsondrop
+
+import "sort"
+
+// sortKeysFunc canonicalizes documents so that equal ones are byte for byte equal: object keys are
+// sorted by their UTF-8 bytes at every level, stable so duplicate keys keep their order, and
+// numbers are normalized. Output is compact like everywhere else and strings are re-escaped
+// consistently, "\u0041" and "A" both come out as "A".
+func sortKeysFunc() transformFunc {
+	return sortKeys
+}
+
+func sortKeys(n node) node {
+	switch v := n.(type) {
+	case *objectNode:
+		sort.SliceStable(v.entries, func(i, j int) bool {
+			return v.entries[i].key < v.entries[j].key
+		})
+		for i := range v.entries {
+			v.entries[i].value = sortKeys(v.entries[i].value)
+		}
+	case *arrayNode:
+		for i, value := range v.values {
+			v.values[i] = sortKeys(value)
+		}
+	case *valueNode:
+		if v.kind == kindNumber {
+			v.num = canonicalNumber(v.num)
+		}
+	}
+	return n
+}
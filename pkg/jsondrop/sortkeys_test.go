@@ -0,0 +1,30 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortKeysJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+	}{
+		{"top-level", `{"b":1,"a":2,"c":3}`, `{"a":2,"b":1,"c":3}`},
+		{"nested and in arrays", `{"z":{"y":1,"x":2},"a":[{"d":1,"c":2}]}`, `{"a":[{"c":2,"d":1}],"z":{"x":2,"y":1}}`},
+		{"duplicates keep their order", `{"b":1,"a":2,"b":3}`, `{"a":2,"b":1,"b":3}`},
+		{"whitespace and escapes", `{ "b" : "\u0041" , "a" : [ 1 , 2 ] }`, `{"a":[1,2],"b":"A"}`},
+		{"numbers", `[1.0,1e2,1.50,-0,-0.0,12345678901234567890,2.5E-3]`, `[1,100,1.5,0,0,12345678901234567890,0.0025]`},
+		{"scalars pass through", `"x"`, `"x"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := transformLine(sortKeysFunc(), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package jsondrop
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sqlCommand is the first argument that prints SQL using a function instead of running the UDF
+const sqlCommand = "sql"
+
+// sqlOptions are the sql flags that aren't the UDF's
+type sqlOptions struct {
+	name, command, keys, alias, cluster, table, column string
+}
+
+// runSQL is the sql subcommand: it prints the SQL to roll a function out with, for the same flags
+// genconfig declares it with. Executable functions can only be declared in XML, CREATE FUNCTION
+// makes SQL functions, so what it prints is a CREATE FUNCTION fixing the keys of the executable
+// one with -alias, an executable() query to try the binary on a table's rows before the function
+// is declared, a query calling it, and for the modes that rewrite documents an ALTER TABLE UPDATE
+// scrubbing the column.
+func runSQL(args []string, stdout, stderr io.Writer) int {
+	c := &config{}
+	fs := newFlagSet(c)
+	fs.Init(sqlCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var opts sqlOptions
+	fs.StringVar(&opts.name, "name", "", "the name of the function")
+	fs.StringVar(&opts.command, "command", "json_drop_keys_udf", "the binary the function runs, a name in user_scripts_path or a path")
+	fs.StringVar(&opts.keys, "keys", "", "the key argument, e.g. ['a', 'b.c']")
+	fs.StringVar(&opts.alias, "alias", "", "create a SQL function of this name calling the function with -keys")
+	fs.StringVar(&opts.cluster, "cluster", "", "the cluster CREATE FUNCTION and ALTER TABLE run ON CLUSTER")
+	fs.StringVar(&opts.table, "table", "events", "the table holding the documents")
+	fs.StringVar(&opts.column, "column", "properties", "the column holding the documents")
+	if err := c.parseFlags(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	opts.keys = c.keyArgument(opts.keys)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "sql takes no arguments, the key argument is -keys")
+		return 2
+	}
+	if err := writeSQL(stdout, c, opts, args); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func writeSQL(w io.Writer, c *config, opts sqlOptions, args []string) error {
+	if opts.name == "" {
+		return fmt.Errorf("sql needs -name")
+	}
+	signature, err := c.signature()
+	if err != nil {
+		return err
+	}
+	tsv := c.mode == dispatchMode || transformModes[c.mode].tsv
+	var keys []string
+	if opts.keys != "" {
+		if keys, err = parseKeysArray(opts.keys); err != nil {
+			return err
+		}
+	} else if !tsv && c.keyScope() == nil && !transformModes[c.mode].keyless {
+		return fmt.Errorf("-mode=%s needs -keys", c.mode)
+	}
+
+	// the function's arguments, the document column first
+	var arguments []string
+	for i, argument := range signature.arguments {
+		if i == 0 {
+			arguments = append(arguments, sqlIdentifier(opts.column))
+		} else {
+			arguments = append(arguments, sqlIdentifier(argument.name))
+		}
+	}
+	call := func(arguments []string) string {
+		if opts.keys == "" || tsv {
+			return sqlIdentifier(opts.name) + "(" + strings.Join(arguments, ", ") + ")"
+		}
+		literals := make([]string, len(keys))
+		for i, key := range keys {
+			literals[i] = sqlString(key)
+		}
+		return fmt.Sprintf("%s([%s])(%s)", sqlIdentifier(opts.name), strings.Join(literals, ", "), strings.Join(arguments, ", "))
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "-- %s is declared in its XML config, see genconfig, and picked up with\n", opts.name)
+	fmt.Fprintf(&out, "SYSTEM RELOAD FUNCTION %s;\n\n", sqlIdentifier(opts.name))
+
+	cluster := ""
+	if opts.cluster != "" {
+		cluster = " ON CLUSTER " + sqlIdentifier(opts.cluster)
+	}
+	if opts.alias != "" {
+		parameters := []string{"json"}
+		for _, argument := range signature.arguments[1:] {
+			parameters = append(parameters, sqlIdentifier(argument.name))
+		}
+		fmt.Fprintf(&out, "-- %s calls it with the same keys on every server\n", opts.alias)
+		fmt.Fprintf(&out, "CREATE FUNCTION IF NOT EXISTS %s%s AS (%s) -> %s;\n\n",
+			sqlIdentifier(opts.alias), cluster, strings.Join(parameters, ", "), call(parameters))
+	}
+
+	// executable() splits its command on spaces, the keys go in as a JSON array without any
+	command := []string{opts.command}
+	if c.format != "raw" {
+		command = append(command, "-format="+c.format)
+	}
+	command = append(command, stripFlags(args, "name", "command", "keys", "alias", "cluster", "table", "column", "format")...)
+	if opts.keys != "" {
+		array, _ := json.Marshal(keys)
+		if strings.ContainsAny(string(array), " \t\n") {
+			return fmt.Errorf("executable() splits its command on spaces, -keys can't have any")
+		}
+		command = append(command, string(array))
+	}
+	fmt.Fprintf(&out, "-- try the binary on some rows before the function is declared\n")
+	fmt.Fprintf(&out, "SELECT * FROM executable(%s, %s, %s, (SELECT %s FROM %s LIMIT 10));\n\n",
+		sqlString(strings.Join(command, " ")), sqlString(signature.format), sqlString("result "+signature.returnType),
+		strings.Join(arguments, ", "), sqlTable(opts.table))
+
+	fmt.Fprintf(&out, "SELECT %s FROM %s LIMIT 10;\n", call(arguments), sqlTable(opts.table))
+
+	build := transformModes[c.mode].build
+	if build != nil && !tsv && c.onError != "tuple" && c.mode != "list-paths" && c.mode != "count-keys" && c.dryRun == "" {
+		fmt.Fprintf(&out, "\n-- scrub the column in place, a mutation rewriting every part of the table\n")
+		fmt.Fprintf(&out, "ALTER TABLE %s%s UPDATE %s = %s WHERE 1;\n",
+			sqlTable(opts.table), cluster, sqlIdentifier(opts.column), call(arguments))
+	}
+	if c.mode == eraseMode {
+		// only the rows of the ids being erased change, the mutation skips the parts without any
+		erasures, err := readErasures(c.erasures)
+		if err != nil {
+			return err
+		}
+		ids := erasureIDs(erasures)
+		for i, id := range ids {
+			ids[i] = sqlString(id)
+		}
+		fmt.Fprintf(&out, "\n-- erase the listed paths of the ids in the erasures file\n")
+		fmt.Fprintf(&out, "ALTER TABLE %s%s UPDATE %s = %s WHERE %s IN (%s);\n",
+			sqlTable(opts.table), cluster, sqlIdentifier(opts.column), call(arguments), arguments[1], strings.Join(ids, ", "))
+	}
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// sqlString quotes s as a SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// sqlTable quotes each part of a table name like db.table
+func sqlTable(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = sqlIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// sqlIdentifier quotes name with backticks unless it's a plain identifier
+func sqlIdentifier(name string) string {
+	plain := name != ""
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			plain = false
+		}
+	}
+	if plain {
+		return name
+	}
+	return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+}
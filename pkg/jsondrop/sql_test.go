@@ -0,0 +1,59 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQL(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runSQL([]string{"-name=JSONDropKeys", "-keys=['$ip', 'it\\'s']", "-alias=scrub_properties",
+		"-cluster=posthog", "-table=default.events", "-format=TabSeparated"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, `-- JSONDropKeys is declared in its XML config, see genconfig, and picked up with
+SYSTEM RELOAD FUNCTION JSONDropKeys;
+
+-- scrub_properties calls it with the same keys on every server
+CREATE FUNCTION IF NOT EXISTS scrub_properties ON CLUSTER posthog AS (json) -> JSONDropKeys(['$ip', 'it\'s'])(json);
+
+-- try the binary on some rows before the function is declared
+SELECT * FROM executable('json_drop_keys_udf -format=tsv ["$ip","it\'s"]', 'TabSeparated', 'result String', (SELECT properties FROM default.events LIMIT 10));
+
+SELECT JSONDropKeys(['$ip', 'it\'s'])(properties) FROM default.events LIMIT 10;
+
+-- scrub the column in place, a mutation rewriting every part of the table
+ALTER TABLE default.events ON CLUSTER posthog UPDATE properties = JSONDropKeys(['$ip', 'it\'s'])(properties) WHERE 1;
+`, stdout.String())
+
+	stdout.Reset()
+	code = runSQL([]string{"-name=JSONIsValid", "-mode=validate", "-column=my col"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "executable('json_drop_keys_udf -mode=validate', 'Raw', 'result UInt8', (SELECT `my col` FROM events LIMIT 10))")
+	assert.Contains(t, stdout.String(), "SELECT JSONIsValid(`my col`) FROM events LIMIT 10;")
+	assert.NotContains(t, stdout.String(), "ALTER TABLE")
+
+	// a dry run previews the drop, it doesn't scrub anything
+	stdout.Reset()
+	code = runSQL([]string{"-name=JSONDropKeysDryRun", "-dry-run=count", "-keys=['a']"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "executable('json_drop_keys_udf -dry-run=count [\"a\"]', 'Raw', 'result UInt64', ")
+	assert.NotContains(t, stdout.String(), "ALTER TABLE")
+
+	stdout.Reset()
+	code = runSQL([]string{"-name=JSONMergePatch", "-mode=merge-patch"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "SELECT JSONMergePatch(properties, patch) FROM events LIMIT 10;")
+
+	for _, args := range [][]string{
+		{"-keys=['a']"},
+		{"-name=f"},
+		{"-name=f", "-keys=['a b']"},
+		{"-name=f", "['a']"},
+	} {
+		stderr.Reset()
+		assert.Equal(t, 2, runSQL(args, &stdout, &stderr), args)
+		assert.NotEmpty(t, stderr.String(), args)
+	}
+}
@@ -0,0 +1,135 @@
+package jsondrop
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// droppedKeys counts the members and elements -mode=drop has removed, for -stats-interval and
+// -stats-rows. Drops are counted per row and added once, so it costs next to nothing when stats
+// are off.
+var droppedKeys atomic.Uint64
+
+// rowErrors counts the rows -on-error replaced, which the rows' lineFuncs don't return
+var rowErrors atomic.Uint64
+
+// runStats counts what has gone through the UDF and reports it every interval and every
+// everyRows rows, operators can follow a long mutation in the server's stderr log
+type runStats struct {
+	log       *slog.Logger
+	everyRows uint64
+	start     time.Time
+
+	rows, errors, bytesIn, bytesOut atomic.Uint64
+	// latency is only timed for -metrics-listen, it's nil otherwise
+	latency *latencyHistogram
+	// reports is whether close writes the totals, it doesn't when stats are only kept for metrics
+	reports bool
+	// paths are the -path-stats counts, written by close and served with the metrics, if set
+	paths *pathHitCounts
+
+	// chunkRows is rows when the current chunk started, -stats-rows counts from it
+	chunkRows atomic.Uint64
+
+	// mu serializes reports, which last holds the rows of
+	mu       sync.Mutex
+	last     time.Time
+	lastRows uint64
+	stop     chan struct{}
+}
+
+func newRunStats(log *slog.Logger, interval time.Duration, everyRows int) *runStats {
+	now := time.Now()
+	s := &runStats{
+		log:       log,
+		everyRows: uint64(everyRows),
+		start:     now,
+		last:      now,
+		stop:      make(chan struct{}),
+		reports:   interval > 0 || everyRows > 0,
+	}
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.report("stats")
+				case <-s.stop:
+					return
+				}
+			}
+		}()
+	}
+	return s
+}
+
+// lineFunc counts the rows process transforms, a lineFunc per worker can share s
+func (s *runStats) lineFunc(process lineFunc) lineFunc {
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		var start time.Time
+		if s.latency != nil {
+			start = time.Now()
+		}
+		err := process(rawLine, buf)
+		if s.latency != nil {
+			s.latency.observe(time.Since(start))
+		}
+		if err != nil {
+			s.errors.Add(1)
+		}
+		s.bytesIn.Add(uint64(len(rawLine)))
+		s.bytesOut.Add(uint64(buf.Len()))
+		if rows := s.rows.Add(1); s.everyRows > 0 && (rows-s.chunkRows.Load())%s.everyRows == 0 {
+			s.report("stats")
+		}
+		return err
+	}
+}
+
+// startChunk starts the -stats-rows count and the rate of the next report again as a chunk
+// starts, so in an executable_pool they're a query's rather than running on from the last one and
+// the time waited for it. Totals and metrics stay the process's.
+func (s *runStats) startChunk() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := s.rows.Load()
+	s.chunkRows.Store(rows)
+	s.last, s.lastRows = time.Now(), rows
+}
+
+// close stops the interval reports and writes the totals
+func (s *runStats) close() {
+	close(s.stop)
+	if s.reports {
+		s.report("stats total")
+	}
+	if s.paths != nil {
+		s.paths.report(s.log, "path stats total")
+	}
+}
+
+// report writes the counts so far, and the rows per second since the last report
+func (s *runStats) report(label string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	rows := s.rows.Load()
+	var rate float64
+	if elapsed := now.Sub(s.last).Seconds(); elapsed > 0 {
+		rate = float64(rows-s.lastRows) / elapsed
+	}
+	s.last, s.lastRows = now, rows
+	s.log.Info(label,
+		"rows", rows,
+		"errors", s.errors.Load()+rowErrors.Load(),
+		"bytes_in", s.bytesIn.Load(),
+		"bytes_out", s.bytesOut.Load(),
+		"keys_dropped", droppedKeys.Load(),
+		"rows_per_sec", int64(rate),
+		"elapsed", now.Sub(s.start).Round(time.Millisecond).String())
+}
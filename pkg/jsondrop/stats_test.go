@@ -0,0 +1,112 @@
+package jsondrop
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunStats(t *testing.T) {
+	droppedKeys.Store(0)
+	rowErrors.Store(0)
+	c, err := parseConfig([]string{"-on-error=empty", "-stats-rows=2"})
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc([]string{"a", "b[0]"})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	stats := newRunStats(jsonLogger(&out), 0, c.statsRows)
+	process = stats.lineFunc(process)
+	var buf bytes.Buffer
+	for _, row := range []string{`{"a":1,"b":[1,2]}`, `not json`, `{"c":1}`} {
+		assert.NoError(t, process([]byte(row), &buf))
+	}
+	stats.close()
+
+	records := logRecords(t, &out)
+	assert.Len(t, records, 2)
+	for i, want := range []map[string]any{
+		{"msg": "stats", "rows": 2.0, "errors": 1.0, "bytes_in": 25.0, "bytes_out": 11.0, "keys_dropped": 2.0},
+		{"msg": "stats total", "rows": 3.0, "errors": 1.0, "bytes_in": 32.0, "bytes_out": 18.0, "keys_dropped": 2.0},
+	} {
+		for k, v := range want {
+			assert.Equal(t, v, records[i][k], k)
+		}
+	}
+
+	_, err = parseConfig([]string{"-stats-rows=-1"})
+	assert.Error(t, err)
+}
+
+func TestRunStatsChunks(t *testing.T) {
+	var out bytes.Buffer
+	stats := newRunStats(jsonLogger(&out), 0, 2)
+	process := stats.lineFunc(func(rawLine []byte, buf *bytes.Buffer) error {
+		buf.Reset()
+		return nil
+	})
+	var buf bytes.Buffer
+	for _, chunk := range []int{3, 2} {
+		stats.startChunk()
+		for i := 0; i < chunk; i++ {
+			assert.NoError(t, process([]byte("{}"), &buf))
+		}
+	}
+	stats.close()
+
+	// -stats-rows counts the rows of each chunk, the totals all of them
+	var rows []any
+	for _, record := range logRecords(t, &out) {
+		rows = append(rows, record["rows"])
+	}
+	assert.Equal(t, []any{2.0, 5.0, 5.0}, rows)
+}
+
+func TestMetrics(t *testing.T) {
+	droppedKeys.Store(0)
+	rowErrors.Store(0)
+	c, err := parseConfig([]string{"-on-error=null"})
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc([]string{"a"})
+	assert.NoError(t, err)
+	stats := newRunStats(jsonLogger(io.Discard), 0, 0)
+	stats.latency = &latencyHistogram{}
+	process = stats.lineFunc(process)
+	var buf bytes.Buffer
+	for _, row := range []string{`{"a":1}`, `{`, `{"b":2}`} {
+		assert.NoError(t, process([]byte(row), &buf))
+	}
+	stats.latency.observe(2 * time.Second)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+	assert.NoError(t, listenMetrics(addr, stats))
+	resp, err := http.Get("http://" + addr + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	for _, line := range []string{
+		"# TYPE json_drop_keys_udf_rows_total counter\njson_drop_keys_udf_rows_total 3\n",
+		"json_drop_keys_udf_row_errors_total 1\n",
+		"json_drop_keys_udf_dropped_keys_total 1\n",
+		"json_drop_keys_udf_input_bytes_total 15\n",
+		"json_drop_keys_udf_output_bytes_total 11\n",
+		"# TYPE json_drop_keys_udf_row_duration_seconds histogram\n",
+		"json_drop_keys_udf_row_duration_seconds_bucket{le=\"1\"} 3\n",
+		"json_drop_keys_udf_row_duration_seconds_bucket{le=\"+Inf\"} 4\n",
+		"json_drop_keys_udf_row_duration_seconds_count 4\n",
+	} {
+		assert.Contains(t, string(body), line)
+	}
+
+	var inUse *listenError
+	assert.ErrorAs(t, listenMetrics(addr, stats), &inUse)
+}
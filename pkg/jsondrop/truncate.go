@@ -0,0 +1,47 @@
+package jsondrop
+
+import "unicode/utf8"
+
+// truncateOptions configure truncate
+type truncateOptions struct {
+	// maxBytes is the longest a string can be, longer ones are cut to maxBytes
+	maxBytes int
+	// marker is appended to cut strings
+	marker string
+}
+
+// truncateStringsFunc cuts string values longer than maxBytes and appends the marker. Strings are
+// cut at a UTF-8 character boundary, so the result may be a few bytes shorter. With keys, only
+// the strings at and below the matched paths are truncated.
+func truncateStringsFunc(keys *jsonKey, opts truncateOptions) transformFunc {
+	if keys == nil {
+		return func(n node) node {
+			return truncateStrings(n, opts)
+		}
+	}
+	return rewriteTransform(keys, func(_ *jsonKey, key string, value node) (string, node, bool) {
+		return key, truncateStrings(value, opts), true
+	})
+}
+
+func truncateStrings(n node, opts truncateOptions) node {
+	switch v := n.(type) {
+	case *valueNode:
+		if v.kind == kindString && len(v.str) > opts.maxBytes {
+			end := opts.maxBytes
+			for end > 0 && !utf8.RuneStart(v.str[end]) {
+				end--
+			}
+			v.str = v.str[:end] + opts.marker
+		}
+	case *objectNode:
+		for i := range v.entries {
+			v.entries[i].value = truncateStrings(v.entries[i].value, opts)
+		}
+	case *arrayNode:
+		for i, value := range v.values {
+			v.values[i] = truncateStrings(value, opts)
+		}
+	}
+	return n
+}
@@ -0,0 +1,56 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateStringsJSON(t *testing.T) {
+	opts := truncateOptions{maxBytes: 4, marker: "..."}
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			name:  "every string",
+			input: `{"a":"abcdef","b":{"c":["abcdefgh","ab"]},"d":123456}`,
+			want:  `{"a":"abcd...","b":{"c":["abcd...","ab"]},"d":123456}`,
+		},
+		{
+			name:  "exactly max bytes is kept",
+			input: `{"a":"abcd"}`,
+			want:  `{"a":"abcd"}`,
+		},
+		{
+			name:  "cut at a character boundary",
+			input: `{"a":"abcé"}`,
+			want:  `{"a":"abc..."}`,
+		},
+		{
+			name:  "only listed paths",
+			input: `{"a":"abcdef","b":{"c":"abcdef"},"d":"abcdef"}`,
+			want:  `{"a":"abcd...","b":{"c":"abcd..."},"d":"abcdef"}`,
+			keys:  []string{"a", "b"},
+		},
+		{
+			name:  "keys are not truncated",
+			input: `{"abcdef":"x"}`,
+			want:  `{"abcdef":"x"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var keys *jsonKey
+			if c.keys != nil {
+				keys = mustKeyDict(t, c.keys)
+			}
+			var buf bytes.Buffer
+			err := transformLine(truncateStringsFunc(keys, opts), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package jsondrop
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// TabSeparated rows separate columns with a tab and escape tabs, newlines and backslashes
+// inside them, https://clickhouse.com/docs/interfaces/formats/TabSeparated
+
+// splitTSV splits a row into its columns, unescaping each of them
+func splitTSV(row []byte) [][]byte {
+	fields := bytes.Split(row, []byte{'\t'})
+	for i, field := range fields {
+		fields[i] = unescapeTSV(field)
+	}
+	return fields
+}
+
+func unescapeTSV(field []byte) []byte {
+	if bytes.IndexByte(field, '\\') < 0 {
+		return field
+	}
+	out := make([]byte, 0, len(field))
+	for i := 0; i < len(field); i++ {
+		ch := field[i]
+		if ch != '\\' || i+1 == len(field) {
+			out = append(out, ch)
+			continue
+		}
+		i++
+		switch field[i] {
+		case 'a':
+			out = append(out, '\a')
+		case 'b':
+			out = append(out, '\b')
+		case 'e':
+			out = append(out, 0x1b)
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case '0':
+			out = append(out, 0)
+		case 'x':
+			// \xHH is the byte with that hex value
+			if i+2 < len(field) {
+				if b, ok := unhex(field[i+1], field[i+2]); ok {
+					out = append(out, b)
+					i += 2
+					continue
+				}
+			}
+			out = append(out, 'x')
+		default:
+			// \\, \' and anything else stand for the character itself
+			out = append(out, field[i])
+		}
+	}
+	return out
+}
+
+func unhex(hi, lo byte) (byte, bool) {
+	h, ok1 := hexDigit(hi)
+	l, ok2 := hexDigit(lo)
+	return h<<4 | l, ok1 && ok2
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// writeTSVEscaped appends field to buf escaped as a TabSeparated column, as ClickHouse escapes
+// them
+func writeTSVEscaped(buf *bytes.Buffer, field []byte) {
+	start := 0
+	for i, ch := range field {
+		var escaped string
+		switch ch {
+		case '\\':
+			escaped = `\\`
+		case '\t':
+			escaped = `\t`
+		case '\n':
+			escaped = `\n`
+		case '\r':
+			escaped = `\r`
+		case '\b':
+			escaped = `\b`
+		case '\f':
+			escaped = `\f`
+		case 0:
+			escaped = `\0`
+		default:
+			continue
+		}
+		buf.Write(field[start:i])
+		buf.WriteString(escaped)
+		start = i + 1
+	}
+	buf.Write(field[start:])
+}
+
+// escapedLineFunc is for the single document modes declared with format TabSeparated rather
+// than Raw: rows are unescaped before process parses them and its result is escaped, so
+// backslashes in documents aren't taken for escapes and newlines in output don't split rows
+func escapedLineFunc(process lineFunc) lineFunc {
+	var out bytes.Buffer
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		if err := process(unescapeTSV(rawLine), &out); err != nil {
+			return err
+		}
+		buf.Reset()
+		writeTSVEscaped(buf, out.Bytes())
+		return nil
+	}
+}
+
+// parseColumnPair parses a row of two JSON columns, the names are used in errors
+func parseColumnPair(row []byte, first, second string) (node, node, error) {
+	fields := splitTSV(row)
+	if len(fields) != 2 {
+		return nil, nil, fmt.Errorf("expected 2 columns (%s and %s), got %d", first, second, len(fields))
+	}
+	a, err := parseNode(fields[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", first, err)
+	}
+	b, err := parseNode(fields[1])
+	if err != nil {
+		recycleNode(a)
+		return nil, nil, fmt.Errorf("%s: %w", second, err)
+	}
+	return a, b, nil
+}
@@ -0,0 +1,63 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTSV(t *testing.T) {
+	got := splitTSV([]byte(`a\tb` + "\t" + `c\\d\n` + "\t" + `\'e\0`))
+	assert.Equal(t, [][]byte{[]byte("a\tb"), []byte("c\\d\n"), []byte("'e\x00")}, got)
+}
+
+func TestWriteTSVEscaped(t *testing.T) {
+	var buf bytes.Buffer
+	writeTSVEscaped(&buf, []byte("a\tb\\c\nd\re\x00"))
+	assert.Equal(t, `a\tb\\c\nd\re\0`, buf.String())
+	assert.Equal(t, [][]byte{[]byte("a\tb\\c\nd\re\x00")}, splitTSV(buf.Bytes()))
+}
+
+func TestUnescapeTSV(t *testing.T) {
+	for escaped, want := range map[string]string{
+		`\a\b\e\f\v`:   "\a\b\x1b\f\v",
+		`\x41\x7e\xZZ`: "A~xZZ",
+		`\x4`:          "x4",
+		`end\`:         `end\`,
+	} {
+		assert.Equal(t, want, string(unescapeTSV([]byte(escaped))), escaped)
+	}
+	var buf bytes.Buffer
+	writeTSVEscaped(&buf, []byte("\b\f"))
+	assert.Equal(t, `\b\f`, buf.String())
+}
+
+func TestEscapedLineFunc(t *testing.T) {
+	c, err := parseConfig([]string{"-format=tsv"})
+	assert.NoError(t, err)
+	process, err := c.buildLineFunc([]string{"a"})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	// {"a":1,"b":"x\ny","c":"\\"} with a literal tab after x, as ClickHouse escapes it
+	assert.NoError(t, process([]byte(`{"a":1,"b":"x\t\\ny","c":"\\\\"}`), &buf))
+	assert.Equal(t, `{"b":"x\\t\\ny","c":"\\\\"}`, buf.String())
+
+	c, err = parseConfig([]string{"-format=tsv", "-output=pretty", "-on-error=passthrough", "-nullable"})
+	assert.NoError(t, err)
+	process, err = c.buildLineFunc([]string{"a"})
+	assert.NoError(t, err)
+	assert.NoError(t, process([]byte(`{"b":"\\n"}`), &buf))
+	assert.Equal(t, `{\n  "b": "\\n"\n}`, buf.String())
+	assert.NoError(t, process([]byte(`{\\`), &buf))
+	assert.Equal(t, `{\\`, buf.String())
+	assert.NoError(t, process([]byte(`\N`), &buf))
+	assert.Equal(t, `\N`, buf.String())
+
+	c, err = parseConfig([]string{"-format=tsv", "-on-error=tuple"})
+	assert.NoError(t, err)
+	process, err = c.buildLineFunc([]string{"a"})
+	assert.NoError(t, err)
+	assert.NoError(t, process([]byte(`{"a":1,"b":"\\\\"}`), &buf))
+	assert.Equal(t, `{"b":"\\\\"}`+"\t", buf.String())
+}
@@ -0,0 +1,34 @@
+package jsondrop
+
+import (
+	"bytes"
+	"strings"
+)
+
+// validateLineFunc outputs 1 for rows that parse as JSON and 0 for those that don't, with the same
+// parser the transforms use, so a row that validates never makes them exit with a parse error. With
+// reportErrors it outputs the parse error instead, and an empty string for valid rows. With
+// duplicatesError rows with duplicate keys are invalid too.
+func validateLineFunc(reportErrors bool, duplicates duplicateKeyPolicy) lineFunc {
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		buf.Reset()
+		parsed, err := parseNode(rawLine)
+		if err == nil {
+			if duplicates == duplicatesError {
+				_, err = resolveDuplicateKeys(parsed, duplicates)
+			}
+			recycleNode(parsed)
+		}
+		switch {
+		case reportErrors && err != nil:
+			// Raw output is one row per line, the error quotes part of the input
+			buf.WriteString(strings.NewReplacer("\n", " ", "\r", " ").Replace(err.Error()))
+		case reportErrors:
+		case err != nil:
+			buf.WriteByte('0')
+		default:
+			buf.WriteByte('1')
+		}
+		return nil
+	}
+}
@@ -0,0 +1,39 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		input, want string
+	}{
+		{`{"a":1}`, "1"},
+		{`[1,"x",null]`, "1"},
+		{`"just a string"`, "1"},
+		{`{"a":1`, "0"},
+		{`{'a':1}`, "0"},
+		{`{"a":1} trailing`, "0"},
+		{``, "0"},
+	}
+	validate := validateLineFunc(false, duplicatesKeep)
+	for _, c := range cases {
+		var buf bytes.Buffer
+		assert.NoError(t, validate([]byte(c.input), &buf))
+		assert.Equal(t, c.want, buf.String(), c.input)
+	}
+}
+
+func TestValidateReportErrors(t *testing.T) {
+	validate := validateLineFunc(true, duplicatesKeep)
+	var buf bytes.Buffer
+	assert.NoError(t, validate([]byte(`{"a":1}`), &buf))
+	assert.Equal(t, "", buf.String())
+
+	assert.NoError(t, validate([]byte(`{"a":`), &buf))
+	assert.Contains(t, buf.String(), "json parse error")
+	assert.NotContains(t, buf.String(), "\n")
+}
@@ -0,0 +1,263 @@
+package jsondrop
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/valyala/fastjson"
+)
+
+// errNeedsTree is returned by verbatimDrop for rows it can't transform from their bytes alone,
+// they go through the parsed tree instead
+var errNeedsTree = errors.New("row needs to be parsed")
+
+// verbatimDrop drops keys working on the bytes of a row rather than a parsed tree: members no
+// path reaches are copied from the row as they are, formatting and escapes included, instead of
+// being parsed and written out again. It reproduces DropKeys except for rows it gives up on:
+// keys with escapes, and dotted keys DropKeys would expand into nested objects.
+type verbatimDrop struct {
+	line []byte
+	out  *bytes.Buffer
+	d    *decoder
+	// dropped counts the members and elements left out, added to droppedKeys once the row is done
+	dropped uint64
+	// hits are the leaves that dropped them, for -path-stats, counted once the row is done too
+	hits []*jsonKey
+}
+
+// newVerbatimLineFunc returns nil for tries with patterns, regular expressions and filters
+// match values as well as keys, and values aren't parsed here
+func newVerbatimLineFunc(keys *jsonKey, process lineFunc) lineFunc {
+	if hasPatterns(keys) {
+		return nil
+	}
+	return func(rawLine []byte, buf *bytes.Buffer) error {
+		if fastjson.ValidateBytes(rawLine) != nil {
+			return process(rawLine, buf)
+		}
+		d := decoderPool.Get().(*decoder)
+		defer decoderPool.Put(d)
+		buf.Reset()
+		v := verbatimDrop{line: rawLine, out: buf, d: d}
+		if err := v.document(keys.set()); err != nil {
+			return process(rawLine, buf)
+		}
+		if v.dropped > 0 {
+			droppedKeys.Add(v.dropped)
+		}
+		for _, leaf := range v.hits {
+			countHit(leaf)
+		}
+		return nil
+	}
+}
+
+func hasPatterns(k *jsonKey) bool {
+	if k == nil {
+		return false
+	}
+	if len(k.patterns) > 0 {
+		return true
+	}
+	for _, c := range k.children {
+		if hasPatterns(c) {
+			return true
+		}
+	}
+	for _, c := range k.elements {
+		if hasPatterns(c) {
+			return true
+		}
+	}
+	return hasPatterns(k.wildcard) || hasPatterns(k.deep) || hasPatterns(k.anyElement)
+}
+
+// document is dropKeysFunc: the elements of a top-level array are documents of their own
+func (v *verbatimDrop) document(keys keySet) error {
+	start := skipSpace(v.line, 0)
+	end := valueEnd(v.line, start)
+	switch v.line[start] {
+	case '{':
+		return v.object(start, keys)
+	case '[':
+		return v.elements(start, keys, true)
+	}
+	v.out.Write(v.line[start:end])
+	return nil
+}
+
+// object writes the object at i without the members keys drops
+func (v *verbatimDrop) object(i int, keys keySet) error {
+	v.out.WriteByte('{')
+	wrote := false
+	for i = skipSpace(v.line, i+1); v.line[i] != '}'; {
+		keyEnd := stringEnd(v.line, i)
+		rawKey := v.line[i:keyEnd]
+		if bytes.IndexByte(rawKey, '\\') >= 0 {
+			return errNeedsTree
+		}
+		key := v.d.key(rawKey[1 : len(rawKey)-1])
+		if indexByte(key, '.') >= 0 && !keys.hasLiteral(key) {
+			return errNeedsTree
+		}
+		valueStart := skipSpace(v.line, skipSpace(v.line, keyEnd)+1)
+		end := valueEnd(v.line, valueStart)
+
+		if next, leaf := keys.matchLeaf(key, nil); leaf == nil {
+			if wrote {
+				v.out.WriteByte(',')
+			}
+			wrote = true
+			v.out.Write(rawKey)
+			v.out.WriteByte(':')
+			if err := v.value(valueStart, end, next, next != nil); err != nil {
+				return err
+			}
+		} else {
+			v.dropped++
+			if leaf.hits != nil {
+				v.hits = append(v.hits, leaf)
+			}
+		}
+
+		i = skipSpace(v.line, end)
+		if v.line[i] == ',' {
+			i = skipSpace(v.line, i+1)
+		}
+	}
+	v.out.WriteByte('}')
+	return nil
+}
+
+// elements writes the array at i without the elements keys drops. DropKeys visits every
+// element, whether or not a path reaches it, and top-level elements get keys as well.
+func (v *verbatimDrop) elements(i int, keys keySet, document bool) error {
+	count := 0
+	if keys.hasElements() {
+		count = countElements(v.line, i)
+	}
+	v.out.WriteByte('[')
+	wrote := false
+	for index, i := 0, skipSpace(v.line, i+1); v.line[i] != ']'; index++ {
+		end := valueEnd(v.line, i)
+		if next, leaf := keys.elementLeaf(index, count, nil); leaf == nil {
+			if document {
+				next = next.union(keys)
+			}
+			if wrote {
+				v.out.WriteByte(',')
+			}
+			wrote = true
+			if err := v.value(i, end, next, true); err != nil {
+				return err
+			}
+		} else {
+			v.dropped++
+			if leaf.hits != nil {
+				v.hits = append(v.hits, leaf)
+			}
+		}
+
+		i = skipSpace(v.line, end)
+		if v.line[i] == ',' {
+			i = skipSpace(v.line, i+1)
+		}
+	}
+	v.out.WriteByte(']')
+	return nil
+}
+
+// value writes the value between start and end, going into it if it's visited. Without keys
+// only the dotted keys of objects matter, so values without a dot are copied right away.
+func (v *verbatimDrop) value(start, end int, keys keySet, visited bool) error {
+	raw := v.line[start:end]
+	if !visited || (keys == nil && bytes.IndexByte(raw, '.') < 0) {
+		v.out.Write(raw)
+		return nil
+	}
+	switch raw[0] {
+	case '{':
+		return v.object(start, keys)
+	case '[':
+		return v.elements(start, keys, false)
+	}
+	v.out.Write(raw)
+	return nil
+}
+
+// hasElements reports whether any path in s has an element index, elements counted from the
+// end need the length of the array
+func (s keySet) hasElements() bool {
+	for _, k := range s {
+		if k.elements != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// stringEnd returns the index after the string starting at b[i], the row is valid JSON
+func stringEnd(b []byte, i int) int {
+	for i++; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(b)
+}
+
+// valueEnd returns the index after the value starting at b[i], the row is valid JSON
+func valueEnd(b []byte, i int) int {
+	switch b[i] {
+	case '"':
+		return stringEnd(b, i)
+	case '{', '[':
+		depth := 0
+		for i < len(b) {
+			switch b[i] {
+			case '"':
+				i = stringEnd(b, i)
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+		return len(b)
+	}
+	for i < len(b) {
+		switch b[i] {
+		case ',', ']', '}', ' ', '\t', '\n', '\r':
+			return i
+		}
+		i++
+	}
+	return len(b)
+}
+
+// countElements counts the elements of the array starting at b[i]
+func countElements(b []byte, i int) int {
+	count := 0
+	for i = skipSpace(b, i+1); b[i] != ']'; count++ {
+		i = skipSpace(b, valueEnd(b, i))
+		if b[i] == ',' {
+			i = skipSpace(b, i+1)
+		}
+	}
+	return count
+}
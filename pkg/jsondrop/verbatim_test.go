@@ -0,0 +1,55 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerbatimMatchesTree(t *testing.T) {
+	docs := []string{
+		`{"a":1,"b":{"c":2,"d":[1,{"a":3}]}}`,
+		`{"b":{"c":{"x":1},"e":"a.b"},"a.b":1}`,
+		`[{"a":1,"b":2},{"c":[{"a":null}]},3,"s"]`,
+		`{"items":[{"secret":1,"x":2},{"secret":{"y":3}}],"n":-1.5e3}`,
+		`{"a":{"b":{"c":{"d":true}}},"x":[[{"c.d":1}],[]]}`,
+		`"just a string"`,
+		`{}`,
+		`[]`,
+	}
+	keySets := [][]string{
+		{"a"}, {"b.c"}, {"a.b"}, {"items[*].secret"}, {"items[-1]"}, {"[0]"}, {"*.c"},
+		{"deep:a"}, {"a\\.b"}, {"x[0][0]"}, {},
+	}
+	for _, keys := range keySets {
+		dict := mustKeyDict(t, keys)
+		tree := documentLineFunc(dropKeysFunc(dict), documentOptions{})
+		verbatim := newVerbatimLineFunc(dict, tree)
+		for _, doc := range docs {
+			var want, got bytes.Buffer
+			assert.NoError(t, tree([]byte(doc), &want))
+			assert.NoError(t, verbatim([]byte(doc), &got))
+			assert.Equal(t, want.String(), got.String(), "%v %s", keys, doc)
+		}
+	}
+}
+
+func TestVerbatimKeepsFormatting(t *testing.T) {
+	dict := mustKeyDict(t, []string{"props.email"})
+	tree := documentLineFunc(dropKeysFunc(dict), documentOptions{})
+	verbatim := newVerbatimLineFunc(dict, tree)
+	var buf bytes.Buffer
+	for input, want := range map[string]string{
+		`{ "props" : { "email" : "a@b.c", "city": "café" }, "list": [ 1, 2 ] }`: `{"props":{"city":"café"},"list":[ 1, 2 ]}`,
+		// escaped keys and dotted keys go through the tree
+		`{"props": {"\u0065mail": 1, "x": [ 1 ]}}`: `{"props":{"x":[1]}}`,
+		`{"props.email": 1, "y": [ 1 ]}`:           `{"props":{},"y":[1]}`,
+	} {
+		assert.NoError(t, verbatim([]byte(input), &buf), input)
+		assert.Equal(t, want, buf.String(), input)
+	}
+
+	assert.ErrorContains(t, verbatim([]byte(`{"props":`), &buf), "json parse error")
+	assert.Nil(t, newVerbatimLineFunc(mustKeyDict(t, []string{"props.re:^e"}), tree))
+}
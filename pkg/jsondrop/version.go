@@ -0,0 +1,91 @@
+package jsondrop
+
+import (
+	"encoding/json"
+	"io"
+	"runtime/debug"
+	"sort"
+)
+
+// version and commit are the release and the commit it was built from, set with
+// -ldflags "-X json_drop_keys_udf/pkg/jsondrop.version=... -X json_drop_keys_udf/pkg/jsondrop.commit=...".
+// Builds without them report what the Go toolchain recorded.
+var (
+	version string
+	commit  string
+)
+
+// rowFormats and encodings are the values -format and -encoding take
+var (
+	rowFormats = []string{"raw", "tsv", "csv", "rowbinary", "native", "arrowstream"}
+	encodings  = []string{"json", "msgpack"}
+)
+
+// protocolFeatures are the parts of the protocol with ClickHouse a build supports beyond plain
+// rows, for tooling to check before relying on them
+var protocolFeatures = []string{"chunk-header", "nullable", "on-error", "max-line-bytes", "keys-file", "dispatch", "dry-run", "handshake", "team-keys", "event-keys", "workers", "person-properties", "path-stats", "preset"}
+
+// buildInfo is what -version writes, and -handshake with the flags the process was started with
+type buildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	Modified  bool     `json:"modified"`
+	GoVersion string   `json:"go_version"`
+	Functions []string `json:"functions"`
+	Modes     []string `json:"modes"`
+	Formats   []string `json:"formats"`
+	Encodings []string `json:"encodings"`
+	Features  []string `json:"features"`
+	Flags     []string `json:"flags,omitempty"`
+}
+
+func currentBuild() buildInfo {
+	b := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Formats:   rowFormats,
+		Encodings: encodings,
+		Features:  protocolFeatures,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		b.GoVersion = info.GoVersion
+		if b.Version == "" && info.Main.Version != "" {
+			b.Version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if b.Commit == "" {
+					b.Commit = setting.Value
+				}
+			case "vcs.modified":
+				b.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if b.Version == "" {
+		b.Version = "(devel)"
+	}
+
+	for name := range udfFunctions {
+		b.Functions = append(b.Functions, name)
+	}
+	b.Functions = append(b.Functions, dispatchFunction)
+	sort.Strings(b.Functions)
+	for mode := range transformModes {
+		b.Modes = append(b.Modes, mode)
+	}
+	b.Modes = append(b.Modes, dispatchMode)
+	sort.Strings(b.Modes)
+	return b
+}
+
+// writeBuildInfo writes b as a single line of JSON
+func writeBuildInfo(w io.Writer, b buildInfo) error {
+	line, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,83 @@
+package jsondrop
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfo(t *testing.T) {
+	b := currentBuild()
+	assert.NotEmpty(t, b.Version)
+	assert.NotEmpty(t, b.GoVersion)
+	assert.Contains(t, b.Functions, "JSONDropKeys")
+	assert.Contains(t, b.Functions, dispatchFunction)
+	assert.Len(t, b.Functions, len(udfFunctions)+1)
+	assert.Contains(t, b.Modes, "drop")
+	assert.Contains(t, b.Modes, dispatchMode)
+	assert.Len(t, b.Modes, len(transformModes)+1)
+	for _, format := range b.Formats {
+		c, err := parseConfig([]string{"-format=" + format})
+		assert.NoError(t, err, format)
+		_, err = c.rowLayout()
+		assert.NoError(t, err, format)
+	}
+
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+	version, commit = "v1.2.3", "abc123"
+	b = currentBuild()
+	b.Flags = []string{"-mode=keep"}
+	var buf bytes.Buffer
+	assert.NoError(t, writeBuildInfo(&buf, b))
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte{'\n'}))
+	var got map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "v1.2.3", got["version"])
+	assert.Equal(t, "abc123", got["commit"])
+	assert.Equal(t, []any{"-mode=keep"}, got["flags"])
+	assert.Contains(t, got["features"], "chunk-header")
+}
+
+// TestProtocolFeatures checks every flag is either a feature or known not to be one, so a new flag
+// can't be left out of -version by accident
+func TestProtocolFeatures(t *testing.T) {
+	notFeatures := map[string]bool{
+		"cpuprofile": true, "memprofile": true, "pprof-listen": true, "debug": true, "log-level": true,
+		"log-file": true, "error-log-sample": true, "stats-interval": true, "stats-rows": true,
+		"stats-file": true, "metrics-listen": true, "mode": true, "case": true, "detectors": true,
+		"output": true, "collision": true, "wrap-key": true, "where": true, "chain-attributes": true,
+		"erasures": true, "report-errors": true, "duplicate-keys": true, "non-object": true,
+		"max-depth": true, "max-depth-action": true, "format": true, "columns": true, "encoding": true,
+		"prescan": true, "verbatim": true, "max-string-bytes": true, "truncate-marker": true,
+		"delimiter": true, "arrays": true, "types": true, "depth": true, "ipv4-prefix": true,
+		"ipv6-prefix": true, "prune-placeholder": true, "max-bytes": true, "empty": true,
+		"placeholder": true, "recursive": true, "ignore-case": true, "keys-file-interval": true,
+		"config": true, "version": true,
+	}
+	features := make(map[string]bool)
+	for _, feature := range protocolFeatures {
+		features[feature] = true
+	}
+	newFlagSet(&config{}).VisitAll(func(f *flag.Flag) {
+		assert.True(t, features[f.Name] != notFeatures[f.Name], "-%s has to be listed in protocolFeatures or notFeatures, and only one", f.Name)
+		delete(features, f.Name)
+	})
+	// what's left are modes rather than flags
+	for feature := range features {
+		_, ok := transformModes[feature]
+		assert.True(t, ok || feature == dispatchMode, "%s is neither a flag nor a mode", feature)
+	}
+}
+
+func TestVersionFlags(t *testing.T) {
+	c, err := parseConfig([]string{"-version"})
+	assert.NoError(t, err)
+	assert.True(t, c.version)
+	c, err = parseConfig([]string{"-handshake", "-mode=keep", "['a']"})
+	assert.NoError(t, err)
+	assert.True(t, c.handshake)
+	assert.Equal(t, []string{"-handshake", "-mode=keep"}, c.flagArgs)
+}
@@ -0,0 +1,254 @@
+package jsondrop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// workerBatchRows is how many rows the reader hands a worker at a time, batches go out sooner
+// when there's no more input buffered, so a caller waiting on its rows isn't kept waiting
+const workerBatchRows = 256
+
+// rowLoop is what the main loop needs to read, transform and write rows
+type rowLoop struct {
+	lines *lineReader
+	// buffered returns how many bytes of input can be read without blocking
+	buffered func() int
+	w        io.Writer
+	// flush flushes w, after the last row of each chunk with -chunk-header and whenever the
+	// input runs dry
+	flush func() error
+	// build returns a new lineFunc with the current keys, lineFuncs aren't safe for concurrent use
+	build func() (lineFunc, error)
+	// stale reports and clears a pending keys file reload
+	stale         func() bool
+	tooLongPolicy errorPolicy
+	tsv           bool
+	log           *slog.Logger
+	// output is held while rows are written, it may be nil
+	output sync.Locker
+}
+
+// readError is a failure to read the input, the rows read so far are still written
+type readError struct {
+	err error
+}
+
+func (e *readError) Error() string {
+	return e.err.Error()
+}
+
+type batchRow struct {
+	end        int
+	hadNewline bool
+}
+
+// rowBatch is a run of rows one worker transforms, its output is written once every batch read
+// before it has been
+type rowBatch struct {
+	// gen counts the keys file reloads before the batch was read
+	gen uint64
+	// first is the number of the batch's first row in the input, or in its chunk
+	first int
+	input []byte
+	rows  []batchRow
+	out   bytes.Buffer
+	err   error
+	// flush is set for the batch ending a -chunk-header chunk, a Native block or the lines
+	// buffered so far, its output is flushed once written
+	flush bool
+	// stream, for a row too long to buffer, replaces the batch's rows: the writer runs it in turn
+	// and closes streamed, which the reader waits on before reading on
+	stream   func() error
+	streamed chan struct{}
+	done     chan struct{}
+}
+
+var rowBatchPool = sync.Pool{
+	New: func() interface{} {
+		return &rowBatch{done: make(chan struct{}, 1)}
+	},
+}
+
+func newRowBatch(gen uint64) *rowBatch {
+	b := rowBatchPool.Get().(*rowBatch)
+	b.gen = gen
+	b.input = b.input[:0]
+	b.rows = b.rows[:0]
+	b.out.Reset()
+	b.err = nil
+	b.flush = false
+	b.stream = nil
+	return b
+}
+
+func (b *rowBatch) add(line []byte, hadNewline bool) {
+	b.input = append(b.input, line...)
+	b.rows = append(b.rows, batchRow{end: len(b.input), hadNewline: hadNewline})
+}
+
+// run transforms the batch's rows into out, stopping at the first row that fails
+func (b *rowBatch) run(process lineFunc, buf *bytes.Buffer) {
+	start := 0
+	for i, row := range b.rows {
+		line := b.input[start:row.end]
+		if err := process(line, buf); err != nil {
+			b.err = newRowError(b.first+i, line, err)
+			return
+		}
+		b.out.Write(buf.Bytes())
+		if row.hadNewline {
+			b.out.WriteByte('\n')
+		}
+		start = row.end
+	}
+}
+
+// runWorkers is the main loop with n workers transforming batches of rows concurrently, each
+// with a lineFunc of its own. Batches are written in the order they were read, so output rows
+// line up with input rows as they do with one worker. It returns the first row error, as a
+// *rowError, or a *readError.
+func runWorkers(n int, loop rowLoop) error {
+	jobs := make(chan *rowBatch, n)
+	ordered := make(chan *rowBatch, 2*n)
+	var failed atomic.Bool
+
+	for i := 0; i < n; i++ {
+		go func() {
+			process, buildErr := loop.build()
+			var gen uint64
+			var buf bytes.Buffer
+			for b := range jobs {
+				if b.gen != gen {
+					if reloaded, err := loop.build(); err == nil {
+						process, buildErr = reloaded, nil
+					}
+					gen = b.gen
+				}
+				if buildErr != nil {
+					b.err = buildErr
+				} else {
+					b.run(process, &buf)
+				}
+				b.done <- struct{}{}
+			}
+		}()
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for b := range ordered {
+			<-b.done
+			if loop.output != nil {
+				loop.output.Lock()
+			}
+			if err == nil && b.stream != nil {
+				err = b.stream()
+			} else if err == nil {
+				_, _ = loop.w.Write(b.out.Bytes())
+				err = b.err
+			}
+			if err == nil && b.flush {
+				_ = loop.flush()
+			}
+			if loop.output != nil {
+				loop.output.Unlock()
+			}
+			if err != nil {
+				failed.Store(true)
+			}
+			if b.stream != nil {
+				close(b.streamed)
+			} else {
+				rowBatchPool.Put(b)
+			}
+		}
+		written <- err
+	}()
+
+	var gen uint64
+	batch := newRowBatch(gen)
+	send := func() {
+		if len(batch.rows) == 0 {
+			return
+		}
+		ordered <- batch
+		jobs <- batch
+		batch = newRowBatch(gen)
+	}
+
+	var readErr error
+	for !failed.Load() {
+		line, hadNewline, err := loop.lines.next()
+		var tooLong *lineTooLongError
+		if errors.As(err, &tooLong) {
+			send()
+			tooLongErr := &rowError{row: loop.lines.row, sample: logSample(line)}
+			s := &rowBatch{done: make(chan struct{}, 1), streamed: make(chan struct{}), flush: loop.lines.endOfChunk()}
+			s.stream = func() error {
+				hadNewline, err := tooLongRow(loop.lines, line, loop.tooLongPolicy, loop.tsv, loop.w, &s.out)
+				if errors.As(err, &tooLong) {
+					tooLongErr.err = err
+					return tooLongErr
+				}
+				if err != nil {
+					return &readError{err: err}
+				}
+				if hadNewline {
+					_, _ = loop.w.Write([]byte{'\n'})
+				}
+				return nil
+			}
+			s.done <- struct{}{}
+			ordered <- s
+			<-s.streamed
+			continue
+		}
+		if err != nil && err != io.EOF {
+			readErr = err
+			break
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+
+		if loop.stale() {
+			if _, buildErr := loop.build(); buildErr != nil {
+				loop.log.Warn("keys file reload error, keeping previous keys", "error", buildErr.Error())
+			} else {
+				send()
+				gen++
+				batch.gen = gen
+				loop.log.Info("keys file reloaded")
+			}
+		}
+
+		if len(batch.rows) == 0 {
+			batch.first = loop.lines.row
+		}
+		batch.add(line, hadNewline)
+		if loop.lines.flushDue(loop.buffered()) {
+			batch.flush = true
+			send()
+		} else if len(batch.rows) >= workerBatchRows || err == io.EOF {
+			send()
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	send()
+	close(jobs)
+	close(ordered)
+
+	err := <-written
+	if err == nil && readErr != nil {
+		err = &readError{err: readErr}
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package jsondrop
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func workerLoop(t *testing.T, input string, w io.Writer, flags ...string) rowLoop {
+	c, err := parseConfig(flags)
+	assert.NoError(t, err)
+	reader := bufio.NewReaderSize(strings.NewReader(input), 64)
+	policy, tsv := c.tooLongPolicy()
+	return rowLoop{
+		lines:    newLineReader(reader, c.maxLineBytes),
+		buffered: reader.Buffered,
+		w:        w,
+		flush:    func() error { return nil },
+		build: func() (lineFunc, error) {
+			return c.buildLineFunc([]string{"a"})
+		},
+		stale:         func() bool { return false },
+		tooLongPolicy: policy,
+		tsv:           tsv,
+		log:           slog.New(slog.NewJSONHandler(io.Discard, nil)),
+	}
+}
+
+func TestWorkersKeepOrder(t *testing.T) {
+	var input, want strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&input, `{"a":%d,"b":%d}`+"\n", i, i)
+		fmt.Fprintf(&want, `{"b":%d}`+"\n", i)
+	}
+	var out bytes.Buffer
+	assert.NoError(t, runWorkers(4, workerLoop(t, input.String(), &out)))
+	assert.Equal(t, want.String(), out.String())
+}
+
+func TestWorkersRowErrors(t *testing.T) {
+	input := "{\"a\":1,\"b\":2}\n{broken\n{\"b\":3}"
+	var out bytes.Buffer
+	err := runWorkers(3, workerLoop(t, input, &out))
+	assert.ErrorContains(t, err, "json parse error")
+	var rowErr *rowError
+	assert.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, 2, rowErr.row)
+	assert.Equal(t, "{broken", rowErr.sample)
+
+	out.Reset()
+	assert.NoError(t, runWorkers(3, workerLoop(t, input, &out, "-on-error=empty")))
+	assert.Equal(t, "{\"b\":2}\n{}\n{\"b\":3}", out.String())
+}
+
+func TestWorkersLongRows(t *testing.T) {
+	long := `{"a":"` + strings.Repeat("x", 500) + `"}`
+	input := "{\"a\":1,\"b\":2}\n" + long + "\n{\"b\":3}\n"
+
+	var out bytes.Buffer
+	assert.NoError(t, runWorkers(2, workerLoop(t, input, &out, "-max-line-bytes=100", "-on-error=passthrough")))
+	assert.Equal(t, "{\"b\":2}\n"+long+"\n{\"b\":3}\n", out.String())
+
+	out.Reset()
+	err := runWorkers(2, workerLoop(t, input, &out, "-max-line-bytes=100"))
+	assert.EqualError(t, err, "row is longer than -max-line-bytes=100")
+	var rowErr *rowError
+	assert.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, 2, rowErr.row)
+	assert.Equal(t, "{\"b\":2}\n", out.String())
+}
+
+func TestWorkersChunkHeader(t *testing.T) {
+	input := "3\n{\"a\":1,\"b\":1}\n{\"b\":2}\n{\"a\":3}\n1\n{\"b\":4}\n"
+	var out bytes.Buffer
+	loop := workerLoop(t, input, &out)
+	loop.lines.chunked = true
+	var flushed []string
+	loop.flush = func() error {
+		flushed = append(flushed, out.String())
+		return nil
+	}
+	assert.NoError(t, runWorkers(2, loop))
+	assert.Equal(t, []string{"{\"b\":1}\n{\"b\":2}\n{}\n", "{\"b\":1}\n{\"b\":2}\n{}\n{\"b\":4}\n"}, flushed)
+}
+
+func TestWorkersChunkRowNumbers(t *testing.T) {
+	var out bytes.Buffer
+	loop := workerLoop(t, "2\n{}\n{}\n2\n{}\n{\n", &out)
+	loop.lines.chunked = true
+	err := runWorkers(2, loop)
+	var rowErr *rowError
+	assert.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, 2, rowErr.row)
+	assert.Equal(t, "{}\n{}\n{}\n", out.String())
+}
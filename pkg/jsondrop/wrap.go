@@ -0,0 +1,97 @@
+package jsondrop
+
+// wrapFunc nests documents under key, {"a":1} becomes {"key":{"a":1}}. With paths, only the
+// members they match are moved, into an object under key inside their parent, e.g. with props.a
+// {"props":{"a":1,"b":2}} becomes {"props":{"key":{"a":1},"b":2}}, the inverse of promote. The
+// object takes the place of the first moved member, or if the parent already has an object under
+// key the members are added to it. Parents with something else under key are left alone.
+func wrapFunc(keys *jsonKey, key string) transformFunc {
+	wrapDocument := func(n node) node {
+		if keys == nil {
+			return wrapIn(key, n)
+		}
+		return wrap(n, keys.set(), key)
+	}
+	return func(n node) node {
+		if arr, ok := n.(*arrayNode); ok {
+			for i, value := range arr.values {
+				arr.values[i] = wrapDocument(value)
+			}
+			return arr
+		}
+		return wrapDocument(n)
+	}
+}
+
+// wrapIn returns a pooled object with value as its only member
+func wrapIn(key string, value node) *objectNode {
+	obj := objectNodePool.Get().(*objectNode)
+	obj.entries = append(obj.entries[:0], objectEntry{key: key, value: value})
+	return obj
+}
+
+func wrap(n node, keys keySet, key string) node {
+	switch v := n.(type) {
+	case *objectNode:
+		v.wrap(keys, key)
+	case *arrayNode:
+		count := len(v.values)
+		for i, value := range v.values {
+			next, _ := keys.elementLeaf(i, count, value)
+			v.values[i] = wrap(value, next, key)
+		}
+	}
+	return n
+}
+
+func (o *objectNode) wrap(keys keySet, key string) {
+	if len(o.entries) == 0 {
+		return
+	}
+	o.entries = expandDottedEntries(o.entries, keys)
+
+	var moved []bool
+	for i, entry := range o.entries {
+		next, leaf := keys.matchLeaf(entry.key, entry.value)
+		if leaf != nil && entry.key != key {
+			if moved == nil {
+				moved = make([]bool, len(o.entries))
+			}
+			moved[i] = true
+		} else if next != nil {
+			o.entries[i].value = wrap(entry.value, next, key)
+		}
+	}
+	if moved == nil {
+		return
+	}
+
+	var target *objectNode
+	for _, entry := range o.entries {
+		if entry.key == key {
+			obj, ok := entry.value.(*objectNode)
+			if !ok {
+				return
+			}
+			target = obj
+			break
+		}
+	}
+
+	writeIdx := 0
+	for i, entry := range o.entries {
+		if moved[i] {
+			if target == nil {
+				target = wrapIn(entry.key, entry.value)
+				o.entries[writeIdx] = objectEntry{key: key, value: target}
+				writeIdx++
+			} else {
+				target.entries = append(target.entries, entry)
+			}
+			continue
+		}
+		o.entries[writeIdx] = entry
+		writeIdx++
+	}
+	o.entries = o.entries[:writeIdx]
+}
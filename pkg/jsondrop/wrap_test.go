@@ -0,0 +1,74 @@
+package jsondrop
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapJSON(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+		keys              []string
+	}{
+		{
+			name:  "whole document",
+			input: `{"a":1,"b":{"c":2}}`,
+			want:  `{"props":{"a":1,"b":{"c":2}}}`,
+		},
+		{
+			name:  "scalar document",
+			input: `"x"`,
+			want:  `{"props":"x"}`,
+		},
+		{
+			name:  "top-level array elements are documents",
+			input: `[{"a":1},{"b":2}]`,
+			want:  `[{"props":{"a":1}},{"props":{"b":2}}]`,
+		},
+		{
+			name:  "selected members at the first one's position",
+			input: `{"x":0,"a":1,"y":0,"b":2}`,
+			want:  `{"x":0,"props":{"a":1,"b":2},"y":0}`,
+			keys:  []string{"a", "b"},
+		},
+		{
+			name:  "nested paths are wrapped in their parent",
+			input: `{"p":{"a":1,"b":2},"a":3}`,
+			want:  `{"p":{"props":{"a":1},"b":2},"a":3}`,
+			keys:  []string{"p.a"},
+		},
+		{
+			name:  "added to an existing object",
+			input: `{"props":{"x":0},"a":1}`,
+			want:  `{"props":{"x":0,"a":1}}`,
+			keys:  []string{"a"},
+		},
+		{
+			name:  "existing non-object is left alone",
+			input: `{"props":"str","a":1}`,
+			want:  `{"props":"str","a":1}`,
+			keys:  []string{"a"},
+		},
+		{
+			name:  "missing paths are a no-op",
+			input: `{"a":1}`,
+			want:  `{"a":1}`,
+			keys:  []string{"b"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var keys *jsonKey
+			if c.keys != nil {
+				keys = mustKeyDict(t, c.keys)
+			}
+			var buf bytes.Buffer
+			err := transformLine(wrapFunc(keys, "props"), []byte(c.input), &buf)
+			assert.NoError(t, err, "unexpected error processing line")
+			assert.Equal(t, c.want, buf.String(), "unexpected output")
+		})
+	}
+}
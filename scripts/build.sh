@@ -6,6 +6,10 @@ OUT_DIR="$ROOT_DIR/bin"
 
 mkdir -p "$OUT_DIR"
 
+VERSION=${VERSION:-$(git -C "$ROOT_DIR" describe --tags --always --dirty 2>/dev/null || echo "(devel)")}
+COMMIT=${COMMIT:-$(git -C "$ROOT_DIR" rev-parse HEAD 2>/dev/null || true)}
+PKG=json_drop_keys_udf/pkg/jsondrop
+
 go test ./...
 
 build_target() {
@@ -13,7 +17,7 @@ build_target() {
   local output="$OUT_DIR/json_drop_keys_udf-linux-$arch"
 
   CGO_ENABLED=0 GOOS=linux GOARCH="$arch" \
-    go build -trimpath -ldflags "-s -w" -o "$output" ./cmd/json_drop_keys_udf
+    go build -trimpath -ldflags "-s -w -X $PKG.version=$VERSION -X $PKG.commit=$COMMIT" -o "$output" ./cmd/json_drop_keys_udf
 
   chmod +x "$output"
 }
@@ -0,0 +1,13 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+ROOT_DIR=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+OUT_DIR="$ROOT_DIR/bin"
+
+mkdir -p "$OUT_DIR"
+
+# c-shared needs cgo and builds for the host, cross compiling needs a C cross compiler in CC
+go build -tags cshared -buildmode=c-shared -trimpath -ldflags "-s -w" \
+  -o "$OUT_DIR/libjson_drop_keys.so" ./cmd/json_drop_keys_udf
+
+echo "Built $OUT_DIR/libjson_drop_keys.so and its header, $OUT_DIR/libjson_drop_keys.h"
@@ -0,0 +1,15 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+ROOT_DIR=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+OUT_DIR="$ROOT_DIR/bin"
+
+mkdir -p "$OUT_DIR"
+
+# the reactor exports the transform to hosts, the command is the UDF binary under a WASI runtime
+GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -trimpath -ldflags "-s -w" \
+  -o "$OUT_DIR/json_drop_keys.wasm" ./cmd/json_drop_keys_udf
+GOOS=wasip1 GOARCH=wasm go build -trimpath -ldflags "-s -w" \
+  -o "$OUT_DIR/json_drop_keys_udf.wasm" ./cmd/json_drop_keys_udf
+
+echo "Built $OUT_DIR/json_drop_keys.wasm and $OUT_DIR/json_drop_keys_udf.wasm"
@@ -0,0 +1,14 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+# Runs every fuzz target for a while, FUZZTIME each (1m by default), with the corpus in testdata
+# and whatever earlier runs found. A crasher is written to pkg/jsondrop/testdata/fuzz, where go test
+# keeps running it as a regular test once it's committed.
+ROOT_DIR=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+cd "$ROOT_DIR"
+
+fuzztime="${FUZZTIME:-1m}"
+for target in $(go test -list '^Fuzz' ./pkg/jsondrop | grep '^Fuzz'); do
+  echo "Fuzzing $target for $fuzztime..." >&2
+  go test -run '^$' -fuzz "^$target\$" -fuzztime "$fuzztime" ./pkg/jsondrop
+done
@@ -58,6 +58,12 @@ docker compose -f "$COMPOSE_FILE" exec -T clickhouse clickhouse-client \
   > "$OUTPUT_FILE"
 
 diff -u "$ROOT_DIR/testdata/expected.tsv" "$OUTPUT_FILE"
+
+docker compose -f "$COMPOSE_FILE" exec -T clickhouse clickhouse-client \
+  --query "SELECT JSONKeepKeys(['id', 'obj.x'])(x) FROM file('input.tsv', 'TabSeparated', 'x String') FORMAT TabSeparated" \
+  > "$OUTPUT_FILE"
+
+diff -u "$ROOT_DIR/testdata/expected_keep.tsv" "$OUTPUT_FILE"
 rm -f "$OUTPUT_FILE"
 
 set +e